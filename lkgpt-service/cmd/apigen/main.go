@@ -0,0 +1,73 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/livekit-examples/livegpt/pkg/openapi"
+	"github.com/livekit-examples/livegpt/pkg/service"
+)
+
+// Generate the OpenAPI spec of the HTTP API and the Go/TypeScript clients, see pkg/service/openapi.go
+func main() {
+	app := cli.App{
+		Name: "apigen",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "spec",
+				Usage: "Output of the OpenAPI spec",
+				Value: "api/openapi.json",
+			},
+			&cli.StringFlag{
+				Name:  "go",
+				Usage: "Output of the Go client",
+				Value: "pkg/client/api.gen.go",
+			},
+			&cli.StringFlag{
+				Name:  "ts",
+				Usage: "Output of the TypeScript client",
+				Value: "../meet/lib/kitt-api.gen.ts",
+			},
+		},
+		Action: generate,
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func generate(c *cli.Context) error {
+	doc := service.OpenAPISpec()
+
+	spec, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFile(c.String("spec"), append(spec, '\n')); err != nil {
+		return err
+	}
+
+	goClient, err := openapi.GenerateGo(doc, filepath.Base(filepath.Dir(c.String("go"))))
+	if err != nil {
+		return err
+	}
+	if err := writeFile(c.String("go"), goClient); err != nil {
+		return err
+	}
+
+	// The TS client extends the hand-written KittClient of kitt-client.ts
+	return writeFile(c.String("ts"), openapi.GenerateTS(doc, "./kitt-client"))
+}
+
+func writeFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go"
+	"github.com/pion/webrtc/v3/pkg/media"
+
+	"github.com/livekit-examples/livegpt/pkg/utils"
+)
+
+var errInvalidOgg = errors.New("invalid ogg page")
+
+// Opus packets of an ogg file, played as the microphone of a speaker
+type fixture struct {
+	name      string
+	packets   [][]byte
+	durations []time.Duration
+	duration  time.Duration
+}
+
+func loadFixture(path string) (*fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	packets, err := oggPackets(data)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &fixture{name: filepath.Base(path)}
+	for _, pkt := range packets {
+		if bytes.HasPrefix(pkt, []byte("OpusHead")) || bytes.HasPrefix(pkt, []byte("OpusTags")) {
+			continue
+		}
+		d, err := utils.ParsePacketDuration(pkt)
+		if err != nil {
+			return nil, err
+		}
+		f.packets = append(f.packets, pkt)
+		f.durations = append(f.durations, d)
+		f.duration += d
+	}
+	if len(f.packets) == 0 {
+		return nil, errors.New("no opus packet")
+	}
+	return f, nil
+}
+
+// The pages of the encoders hold several packets (e.g 1s with ffmpeg), a packet can also span several pages.
+// The SDK's ReaderSampleProvider sends each page as a single sample instead
+func oggPackets(data []byte) ([][]byte, error) {
+	var packets [][]byte
+	var current []byte
+	for len(data) > 0 {
+		if len(data) < 27 || string(data[:4]) != "OggS" {
+			return nil, errInvalidOgg
+		}
+		segments := int(data[26])
+		if len(data) < 27+segments {
+			return nil, errInvalidOgg
+		}
+		table := data[27 : 27+segments]
+		body := data[27+segments:]
+		for _, size := range table {
+			if len(body) < int(size) {
+				return nil, errInvalidOgg
+			}
+			current = append(current, body[:size]...)
+			body = body[size:]
+			if size < 255 {
+				packets = append(packets, current) // Last segment of the packet
+				current = nil
+			}
+		}
+		data = body
+	}
+	return packets, nil
+}
+
+// Paced like a microphone, returns at the end of the fixture
+func playFixture(ctx context.Context, track *lksdk.LocalSampleTrack, f *fixture) error {
+	next := time.Now()
+	for i, pkt := range f.packets {
+		if err := track.WriteSample(media.Sample{Data: pkt, Duration: f.durations[i]}, nil); err != nil {
+			return err
+		}
+
+		next = next.Add(f.durations[i])
+		select {
+		case <-time.After(time.Until(next)):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
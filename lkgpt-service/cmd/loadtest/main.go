@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/livekit-examples/livegpt/pkg/client"
+)
+
+// Load test of a KITT deployment: synthetic rooms where speakers play opus fixtures in turns, the latencies of the
+// transcripts and answers are reported for capacity planning. The fixtures are ogg files starting with the
+// activation words (e.g "Hey KITT, what's the capital of France?"), e.g: ffmpeg -i question.wav -c:a libopus question.ogg
+func main() {
+	app := cli.App{
+		Name: "loadtest",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "url",
+				Usage:    "LiveKit server url",
+				EnvVars:  []string{"LIVEKIT_URL"},
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "api-key",
+				EnvVars:  []string{"LIVEKIT_API_KEY"},
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "api-secret",
+				EnvVars:  []string{"LIVEKIT_API_SECRET"},
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "kitt-url",
+				Usage: "lkgpt-service url (e.g http://localhost:3001), KITT is asked to join each room when set, it joins on the webhooks otherwise",
+			},
+			&cli.StringSliceFlag{
+				Name:     "fixture",
+				Usage:    "Ogg opus file played by the speakers, can be repeated (played in turns)",
+				Required: true,
+			},
+			&cli.IntFlag{
+				Name:  "rooms",
+				Value: 1,
+			},
+			&cli.IntFlag{
+				Name:  "speakers",
+				Usage: "Speakers per room, they speak in turns",
+				Value: 2,
+			},
+			&cli.StringFlag{
+				Name:  "room-prefix",
+				Value: "loadtest",
+			},
+			&cli.DurationFlag{
+				Name:  "duration",
+				Usage: "Duration of the test once the rooms are created",
+				Value: 5 * time.Minute,
+			},
+			&cli.DurationFlag{
+				Name:  "ramp-up",
+				Usage: "Delay between the creation of two rooms",
+				Value: time.Second,
+			},
+			&cli.DurationFlag{
+				Name:  "pause",
+				Usage: "Silence after an answer, before the next speaker",
+				Value: 2 * time.Second,
+			},
+			&cli.DurationFlag{
+				Name:  "join-timeout",
+				Usage: "The room fails when KITT didn't join after this duration",
+				Value: 30 * time.Second,
+			},
+			&cli.DurationFlag{
+				Name:  "answer-timeout",
+				Usage: "Utterances without an answer after this duration are counted as timeouts",
+				Value: 30 * time.Second,
+			},
+		},
+		Action: run,
+	}
+
+	if err := app.Run(os.Args); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+func run(c *cli.Context) error {
+	var fixtures []*fixture
+	for _, path := range c.StringSlice("fixture") {
+		f, err := loadFixture(path)
+		if err != nil {
+			return fmt.Errorf("fixture %s: %w", path, err)
+		}
+		fixtures = append(fixtures, f)
+	}
+
+	conf := &roomConfig{
+		url:           c.String("url"),
+		apiKey:        c.String("api-key"),
+		apiSecret:     c.String("api-secret"),
+		speakers:      c.Int("speakers"),
+		fixtures:      fixtures,
+		pause:         c.Duration("pause"),
+		joinTimeout:   c.Duration("join-timeout"),
+		answerTimeout: c.Duration("answer-timeout"),
+	}
+	if conf.speakers < 1 {
+		return errors.New("at least one speaker is required")
+	}
+	if kittUrl := c.String("kitt-url"); kittUrl != "" {
+		conf.kitt = client.New(kittUrl, client.WithSignature(conf.apiKey, conf.apiSecret))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-sigChan
+		fmt.Println("interrupted, reporting")
+		cancel()
+	}()
+
+	stats := newStats()
+	var wg sync.WaitGroup
+	rooms := c.Int("rooms")
+	rampUp := c.Duration("ramp-up")
+	deadline := time.Now().Add(time.Duration(rooms-1)*rampUp + c.Duration("duration"))
+	testCtx, stop := context.WithDeadline(ctx, deadline)
+	defer stop()
+
+	prefix := fmt.Sprintf("%s-%d", c.String("room-prefix"), time.Now().Unix()) // Unique per run
+	for i := 0; i < rooms && testCtx.Err() == nil; i++ {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			runRoom(testCtx, name, conf, stats)
+		}(fmt.Sprintf("%s-%d", prefix, i))
+
+		select {
+		case <-time.After(rampUp):
+		case <-testCtx.Done():
+		}
+	}
+
+	wg.Wait()
+	stats.Print(os.Stdout)
+	return nil
+}
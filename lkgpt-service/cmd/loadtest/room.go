@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/livekit-examples/livegpt/pkg/client"
+)
+
+const botIdentity = "KITT"
+
+// Packets of KITT, see pkg/service/packet.go
+const (
+	packet_Transcript = 0
+	packet_State      = 1
+	packet_Error      = 2
+
+	state_Idle     = 0
+	state_Speaking = 2
+)
+
+var errJoinTimeout = errors.New("KITT didn't join the room")
+
+type roomConfig struct {
+	url       string
+	apiKey    string
+	apiSecret string
+	kitt      *client.Client // nil when KITT joins on the webhooks
+
+	speakers      int
+	fixtures      []*fixture
+	pause         time.Duration
+	joinTimeout   time.Duration
+	answerTimeout time.Duration
+}
+
+type packet struct {
+	Type int             `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type receivedPacket struct {
+	packet
+	at time.Time
+}
+
+type transcriptPacket struct {
+	Sid     string `json:"sid"`
+	IsFinal bool   `json:"isFinal"`
+}
+
+type statePacket struct {
+	State int `json:"state"`
+}
+
+type errorPacket struct {
+	Message string `json:"message"`
+}
+
+type speaker struct {
+	room  *lksdk.Room
+	track *lksdk.LocalSampleTrack
+}
+
+type loadRoom struct {
+	name  string
+	conf  *roomConfig
+	stats *stats
+
+	joined  chan struct{}        // Closed when KITT joins
+	packets chan *receivedPacket // Of KITT, received by the first speaker
+	state   int                  // Last state of KITT
+}
+
+func runRoom(ctx context.Context, name string, conf *roomConfig, stats *stats) {
+	r := &loadRoom{
+		name:    name,
+		conf:    conf,
+		stats:   stats,
+		joined:  make(chan struct{}),
+		packets: make(chan *receivedPacket, 256),
+	}
+
+	start := time.Now()
+	var speakers []*speaker
+	defer func() {
+		for _, s := range speakers {
+			s.room.Disconnect()
+		}
+	}()
+	for i := 0; i < conf.speakers; i++ {
+		s, err := r.connect(i)
+		if err != nil {
+			stats.Error("connect", err)
+			return
+		}
+		speakers = append(speakers, s)
+	}
+	stats.Room()
+
+	if conf.kitt != nil {
+		if err := conf.kitt.JoinRoom(ctx, name); err != nil {
+			stats.Error("join", err)
+			return
+		}
+	}
+
+	select {
+	case <-r.joined:
+		stats.Add(metric_Join, time.Since(start))
+	case <-time.After(conf.joinTimeout):
+		stats.Error("join", errJoinTimeout)
+		return
+	case <-ctx.Done():
+		return
+	}
+
+	for turn := 0; ctx.Err() == nil; turn++ {
+		r.utterance(ctx, speakers[turn%len(speakers)], conf.fixtures[turn%len(conf.fixtures)])
+
+		select {
+		case <-time.After(conf.pause):
+		case <-ctx.Done():
+		}
+	}
+}
+
+// The first speaker receives the packets of KITT for the room
+func (r *loadRoom) connect(index int) (*speaker, error) {
+	var callback *lksdk.RoomCallback
+	if index == 0 {
+		callback = &lksdk.RoomCallback{
+			OnParticipantConnected: func(rp *lksdk.RemoteParticipant) {
+				if rp.Identity() == botIdentity {
+					r.kittJoined()
+				}
+			},
+			ParticipantCallback: lksdk.ParticipantCallback{
+				OnDataReceived: r.dataReceived,
+			},
+		}
+	}
+
+	room, err := lksdk.ConnectToRoom(r.conf.url, lksdk.ConnectInfo{
+		APIKey:              r.conf.apiKey,
+		APISecret:           r.conf.apiSecret,
+		RoomName:            r.name,
+		ParticipantIdentity: fmt.Sprintf("speaker-%d", index),
+		ParticipantName:     fmt.Sprintf("Speaker %d", index),
+	}, callback)
+	if err != nil {
+		return nil, err
+	}
+
+	track, err := lksdk.NewLocalSampleTrack(webrtc.RTPCodecCapability{
+		MimeType:  webrtc.MimeTypeOpus,
+		ClockRate: 48000,
+		Channels:  2,
+	})
+	if err != nil {
+		room.Disconnect()
+		return nil, err
+	}
+	if _, err := room.LocalParticipant.PublishTrack(track, &lksdk.TrackPublicationOptions{
+		Name:   "microphone",
+		Source: livekit.TrackSource_MICROPHONE,
+	}); err != nil {
+		room.Disconnect()
+		return nil, err
+	}
+
+	if index == 0 {
+		for _, rp := range room.GetParticipants() {
+			if rp.Identity() == botIdentity {
+				r.kittJoined() // Already in the room
+			}
+		}
+	}
+	return &speaker{room: room, track: track}, nil
+}
+
+func (r *loadRoom) kittJoined() {
+	select {
+	case <-r.joined:
+	default:
+		close(r.joined)
+	}
+}
+
+func (r *loadRoom) dataReceived(data []byte, rp *lksdk.RemoteParticipant) {
+	if rp == nil || rp.Identity() != botIdentity {
+		return
+	}
+
+	p := &receivedPacket{at: time.Now()}
+	if err := json.Unmarshal(data, &p.packet); err != nil {
+		return // Chunks and packets of other clients
+	}
+	select {
+	case r.packets <- p:
+	default:
+		r.stats.Error("packets", errors.New("dropped, the room is too slow"))
+	}
+}
+
+// Wait for KITT to be idle (e.g the greeting), play the fixture and wait for the answer
+func (r *loadRoom) utterance(ctx context.Context, s *speaker, f *fixture) {
+	r.drain()
+	if r.state != state_Idle && !r.consume(ctx, r.conf.answerTimeout, func(*receivedPacket) bool {
+		return r.state == state_Idle
+	}) {
+		r.stats.Error("answer", errors.New("KITT still speaking, speaking anyway"))
+	}
+
+	if err := playFixture(ctx, s.track, f); err != nil {
+		if ctx.Err() == nil {
+			r.stats.Error("play", err)
+		}
+		return
+	}
+	end := time.Now()
+	r.stats.Utterance()
+
+	sid := s.room.LocalParticipant.SID()
+	transcribed := false
+	answered := r.consume(ctx, r.conf.answerTimeout, func(p *receivedPacket) bool {
+		switch p.Type {
+		case packet_Transcript:
+			var transcript transcriptPacket
+			if json.Unmarshal(p.Data, &transcript) == nil && transcript.IsFinal && transcript.Sid == sid && !transcribed {
+				transcribed = true
+				r.stats.Add(metric_Transcript, p.at.Sub(end))
+			}
+		case packet_State:
+			if r.state == state_Speaking {
+				r.stats.Add(metric_Answer, p.at.Sub(end))
+				return true
+			}
+		}
+		return false
+	})
+	if !answered && ctx.Err() == nil {
+		r.stats.Timeout()
+	}
+}
+
+// Handle the packets received so far
+func (r *loadRoom) drain() {
+	for {
+		select {
+		case p := <-r.packets:
+			r.handle(p)
+		default:
+			return
+		}
+	}
+}
+
+// Handle the packets of KITT until done returns true, false on timeout
+func (r *loadRoom) consume(ctx context.Context, timeout time.Duration, done func(p *receivedPacket) bool) bool {
+	deadline := time.After(timeout)
+	for {
+		select {
+		case p := <-r.packets:
+			r.handle(p)
+			if done(p) {
+				return true
+			}
+		case <-deadline:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+// Track the state of KITT and count its errors
+func (r *loadRoom) handle(p *receivedPacket) {
+	switch p.Type {
+	case packet_State:
+		var state statePacket
+		if json.Unmarshal(p.Data, &state) == nil {
+			r.state = state.State
+		}
+	case packet_Error:
+		var e errorPacket
+		if json.Unmarshal(p.Data, &e) == nil {
+			r.stats.Error("kitt", errors.New(e.Message))
+		}
+	}
+}
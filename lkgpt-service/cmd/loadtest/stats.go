@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	metric_Join       = "join"       // KITT joined the room, since the first speaker connected
+	metric_Transcript = "transcript" // Final transcript of the speaker, since the end of the utterance
+	metric_Answer     = "answer"     // KITT starts speaking, since the end of the utterance
+)
+
+var metrics = []string{metric_Join, metric_Transcript, metric_Answer}
+
+// Shared by the rooms
+type stats struct {
+	lock       sync.Mutex
+	start      time.Time
+	latencies  map[string][]time.Duration
+	rooms      int
+	utterances int
+	timeouts   int            // Utterances without an answer
+	errors     map[string]int // Counted by message
+}
+
+func newStats() *stats {
+	return &stats{
+		start:     time.Now(),
+		latencies: make(map[string][]time.Duration),
+		errors:    make(map[string]int),
+	}
+}
+
+func (s *stats) Add(metric string, latency time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if latency < 0 {
+		latency = 0 // e.g the final transcript arrived before the end of the fixture
+	}
+	s.latencies[metric] = append(s.latencies[metric], latency)
+}
+
+func (s *stats) Room() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.rooms++
+}
+
+func (s *stats) Utterance() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.utterances++
+}
+
+func (s *stats) Timeout() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.timeouts++
+}
+
+func (s *stats) Error(kind string, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.errors[fmt.Sprintf("%s: %v", kind, err)]++
+}
+
+func (s *stats) Print(w io.Writer) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	fmt.Fprintf(w, "\n%d rooms, %d utterances in %v\n", s.rooms, s.utterances, time.Since(s.start).Round(time.Second))
+	for _, metric := range metrics {
+		latencies := s.latencies[metric]
+		if len(latencies) == 0 {
+			fmt.Fprintf(w, "%-10s no samples\n", metric)
+			continue
+		}
+
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		fmt.Fprintf(w, "%-10s n=%-5d p50=%-8v p90=%-8v p99=%-8v max=%v\n", metric, len(latencies),
+			percentile(latencies, 0.5), percentile(latencies, 0.9), percentile(latencies, 0.99), percentile(latencies, 1))
+	}
+
+	errors := 0
+	for _, count := range s.errors {
+		errors += count
+	}
+	fmt.Fprintf(w, "timeouts   %d (%s of the utterances)\n", s.timeouts, rate(s.timeouts, s.utterances))
+	fmt.Fprintf(w, "errors     %d (%s of the utterances)\n", errors, rate(errors, s.utterances))
+
+	messages := make([]string, 0, len(s.errors))
+	for message := range s.errors {
+		messages = append(messages, message)
+	}
+	sort.Strings(messages)
+	for _, message := range messages {
+		fmt.Fprintf(w, "  %5d  %s\n", s.errors[message], message)
+	}
+}
+
+// Nearest-rank percentile of the sorted latencies
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i].Round(time.Millisecond)
+}
+
+func rate(count, total int) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(count)/float64(total))
+}
@@ -14,6 +14,7 @@ import (
 
 	"github.com/livekit-examples/livegpt/pkg/config"
 	"github.com/livekit-examples/livegpt/pkg/service"
+	"github.com/livekit-examples/livegpt/pkg/store"
 
 	stt "cloud.google.com/go/speech/apiv1"
 	tts "cloud.google.com/go/texttospeech/apiv1"
@@ -78,20 +79,48 @@ func runServer(c *cli.Context) error {
 		gcpCred = option.WithCredentialsJSON([]byte(gcpBody))
 	}
 
+	// The GCP clients are only created for the Google providers
 	ctx := context.Background()
-	sttClient, err := stt.NewClient(ctx, gcpCred)
-	if err != nil {
-		return err
+	var sttClient *stt.Client
+	if conf.Transcription.Provider == service.TranscriptionProvider_Google {
+		sttClient, err = stt.NewClient(ctx, gcpCred)
+		if err != nil {
+			return err
+		}
 	}
 
-	ttsClient, err := tts.NewClient(ctx, gcpCred)
-	if err != nil {
-		return err
+	var ttsClient *tts.Client
+	if conf.Synthesis.Provider == service.SynthesisProvider_Google {
+		ttsClient, err = tts.NewClient(ctx, gcpCred)
+		if err != nil {
+			return err
+		}
 	}
 
 	logger.InitFromConfig(conf.Logger, "livegpt")
 
-	server := service.NewLiveGPT(conf, sttClient, ttsClient)
+	blobStore, err := service.NewBlobStore(ctx, conf.Storage, gcpCred)
+	if err != nil {
+		logger.Errorw("failed to create the storage", err)
+	}
+
+	var docs service.NotesDocumentProvider
+	if conf.Notes.Document.Provider != "" {
+		docs, err = service.NewNotesDocumentProvider(ctx, conf.Notes.Document, gcpCred)
+		if err != nil {
+			logger.Errorw("failed to create the notes documents provider", err)
+		}
+	}
+
+	var db store.Store
+	if conf.Database.Url != "" {
+		db, err = store.NewPostgresStore(ctx, conf.Database.Url)
+		if err != nil {
+			return err
+		}
+	}
+
+	server := service.NewLiveGPT(conf, sttClient, ttsClient, blobStore, db, docs)
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 
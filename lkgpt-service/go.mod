@@ -5,11 +5,14 @@ go 1.19
 require (
 	cloud.google.com/go/speech v1.15.0
 	cloud.google.com/go/texttospeech v1.6.0
+	github.com/lib/pq v1.10.9
 	github.com/livekit/protocol v1.5.4
 	github.com/livekit/server-sdk-go v1.0.10
 	github.com/pion/rtp v1.7.13
 	github.com/pion/webrtc/v3 v3.1.59
-	github.com/sashabaranov/go-openai v1.5.7
+	github.com/prometheus/client_golang v1.15.0
+	github.com/redis/go-redis/v9 v9.0.3
+	github.com/sashabaranov/go-openai v1.24.0
 	github.com/urfave/cli/v2 v2.25.1
 	github.com/urfave/negroni v1.0.0
 	golang.org/x/exp v0.0.0-20230321023759-10a507213a29
@@ -65,11 +68,9 @@ require (
 	github.com/pion/transport/v2 v2.0.2 // indirect
 	github.com/pion/turn/v2 v2.1.0 // indirect
 	github.com/pion/udp/v2 v2.0.1 // indirect
-	github.com/prometheus/client_golang v1.15.0 // indirect
 	github.com/prometheus/client_model v0.3.0 // indirect
 	github.com/prometheus/common v0.42.0 // indirect
 	github.com/prometheus/procfs v0.9.0 // indirect
-	github.com/redis/go-redis/v9 v9.0.3 // indirect
 	github.com/russross/blackfriday/v2 v2.1.0 // indirect
 	github.com/thoas/go-funk v0.9.3 // indirect
 	github.com/twitchtv/twirp v8.1.3+incompatible // indirect
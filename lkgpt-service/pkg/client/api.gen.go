@@ -0,0 +1,198 @@
+// Code generated by cmd/apigen. DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"time"
+)
+
+type Agenda struct {
+	Start time.Time    `json:"start"`
+	Items []AgendaItem `json:"items"`
+}
+
+type AgendaItem struct {
+	Topic   string `json:"topic"`
+	Minutes int    `json:"minutes"`
+}
+
+type CalendarEvent struct {
+	Title    string            `json:"title"`
+	Agenda   string            `json:"agenda,omitempty"`
+	Start    time.Time         `json:"start"`
+	End      time.Time         `json:"end"`
+	Invitees []CalendarInvitee `json:"invitees,omitempty"`
+}
+
+type CalendarInvitee struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+type Job struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Room      string          `json:"room"`
+	Payload   json.RawMessage `json:"payload"`
+	Status    string          `json:"status"`
+	Attempts  int             `json:"attempts"`
+	Error     string          `json:"error,omitempty"`
+	RunAt     time.Time       `json:"runAt"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+type Language struct {
+	Code  string `json:"code"`
+	Label string `json:"label"`
+}
+
+type MeetingNotes struct {
+	Topics      []NotesTopic `json:"topics"`
+	Decisions   []string     `json:"decisions"`
+	ActionItems []string     `json:"actionItems"`
+}
+
+type MeetingStats struct {
+	Start        time.Time          `json:"start"`
+	Duration     int64              `json:"duration"`
+	Sentiment    float64            `json:"sentiment"`
+	Participants []ParticipantStats `json:"participants"`
+}
+
+type NotesTopic struct {
+	Title  string   `json:"title"`
+	Points []string `json:"points"`
+}
+
+type ParticipantStats struct {
+	SID           string  `json:"sid"`
+	Name          string  `json:"name"`
+	TalkTime      int64   `json:"talkTime"`
+	Words         int     `json:"words"`
+	Turns         int     `json:"turns"`
+	Interruptions int     `json:"interruptions"`
+	Interrupted   int     `json:"interrupted"`
+	Sentiment     float64 `json:"sentiment"`
+}
+
+type RoomEvent struct {
+	Type int             `json:"type"`
+	Room string          `json:"room"`
+	Time time.Time       `json:"time"`
+	Data json.RawMessage `json:"data"`
+}
+
+type TranscriptLine struct {
+	RoomSID         string    `json:"roomSid"`
+	ParticipantName string    `json:"participantName"`
+	IsBot           bool      `json:"isBot"`
+	Text            string    `json:"text"`
+	Time            time.Time `json:"time"`
+	AudioKey        string    `json:"audioKey,omitempty"`
+}
+
+// Make KITT join the room
+func (c *Client) JoinRoom(ctx context.Context, room string) error {
+	return c.do(ctx, "POST", "/join/"+url.PathEscape(room), nil, nil, nil)
+}
+
+// Stream the events of the room (transcripts, answers, state, notes, ...)
+func (c *Client) StreamRoomEvents(ctx context.Context, room string, onEvent func(event *RoomEvent) error) error {
+	return c.stream(ctx, "/rooms/"+url.PathEscape(room)+"/events", nil, func(data []byte) error {
+		var event *RoomEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return err
+		}
+		return onEvent(event)
+	})
+}
+
+// Get the calendar event linked to the room
+func (c *Client) GetRoomCalendar(ctx context.Context, room string) (*CalendarEvent, error) {
+	var res *CalendarEvent
+	err := c.do(ctx, "GET", "/rooms/"+url.PathEscape(room)+"/calendar", nil, nil, &res)
+	return res, err
+}
+
+// Link the room to a calendar event
+func (c *Client) SetRoomCalendar(ctx context.Context, room string, body *CalendarEvent) error {
+	return c.do(ctx, "PUT", "/rooms/"+url.PathEscape(room)+"/calendar", nil, body, nil)
+}
+
+// Get the notes of the meeting (notes mode)
+func (c *Client) GetRoomNotes(ctx context.Context, room string) (*MeetingNotes, error) {
+	var res *MeetingNotes
+	err := c.do(ctx, "GET", "/rooms/"+url.PathEscape(room)+"/notes", nil, nil, &res)
+	return res, err
+}
+
+// Get the agenda of the meeting (facilitator mode)
+func (c *Client) GetRoomAgenda(ctx context.Context, room string) (*Agenda, error) {
+	var res *Agenda
+	err := c.do(ctx, "GET", "/rooms/"+url.PathEscape(room)+"/agenda", nil, nil, &res)
+	return res, err
+}
+
+// Replace the agenda of the meeting (facilitator mode)
+func (c *Client) SetRoomAgenda(ctx context.Context, room string, body *Agenda) error {
+	return c.do(ctx, "PUT", "/rooms/"+url.PathEscape(room)+"/agenda", nil, body, nil)
+}
+
+// Get the talk time, interruptions and sentiment of the participants (analytics)
+func (c *Client) GetRoomStats(ctx context.Context, room string) (*MeetingStats, error) {
+	var res *MeetingStats
+	err := c.do(ctx, "GET", "/rooms/"+url.PathEscape(room)+"/stats", nil, nil, &res)
+	return res, err
+}
+
+// List the final transcripts and the answers of every session of the room (stored transcripts)
+func (c *Client) ListTranscripts(ctx context.Context, room string, sid string) ([]TranscriptLine, error) {
+	query := url.Values{}
+	if sid != "" {
+		query.Set("sid", sid)
+	}
+	var res []TranscriptLine
+	err := c.do(ctx, "GET", "/transcripts/"+url.PathEscape(room), query, nil, &res)
+	return res, err
+}
+
+// Get the facts KITT remembers about the participant
+func (c *Client) GetMemory(ctx context.Context, identity string) ([]string, error) {
+	var res []string
+	err := c.do(ctx, "GET", "/memory/"+url.PathEscape(identity), nil, nil, &res)
+	return res, err
+}
+
+// Erase the memory of the participant
+func (c *Client) EraseMemory(ctx context.Context, identity string) error {
+	return c.do(ctx, "DELETE", "/memory/"+url.PathEscape(identity), nil, nil, nil)
+}
+
+// List the languages supported by KITT, the first one is the default language
+func (c *Client) ListLanguages(ctx context.Context) ([]Language, error) {
+	var res []Language
+	err := c.do(ctx, "GET", "/languages", nil, nil, &res)
+	return res, err
+}
+
+// List the post-meeting jobs of the room
+func (c *Client) ListJobs(ctx context.Context, room string) ([]Job, error) {
+	query := url.Values{}
+	if room != "" {
+		query.Set("room", room)
+	}
+	var res []Job
+	err := c.do(ctx, "GET", "/jobs", query, nil, &res)
+	return res, err
+}
+
+// Get a post-meeting job
+func (c *Client) GetJob(ctx context.Context, id string) (*Job, error) {
+	var res *Job
+	err := c.do(ctx, "GET", "/jobs/"+url.PathEscape(id), nil, nil, &res)
+	return res, err
+}
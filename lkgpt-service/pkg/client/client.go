@@ -0,0 +1,207 @@
+// Package client is a typed client of the HTTP API of lkgpt-service.
+// The types and the methods are generated from the OpenAPI spec (api.gen.go, see cmd/apigen)
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Client struct {
+	baseUrl    string
+	httpClient *http.Client
+	authorize  []func(req *http.Request, body []byte) error
+}
+
+type Option func(c *Client)
+
+// Sent in the Authorization header, see auth.AccessToken of the LiveKit SDK
+func WithAccessToken(token string) Option {
+	return func(c *Client) {
+		c.authorize = append(c.authorize, func(req *http.Request, body []byte) error {
+			req.Header.Set("Authorization", "Bearer "+token)
+			return nil
+		})
+	}
+}
+
+// Sign the requests with the LiveKit API key/secret (admin_signature of the server config)
+func WithSignature(apiKey, secret string) Option {
+	return func(c *Client) {
+		c.authorize = append(c.authorize, func(req *http.Request, body []byte) error {
+			nonce := make([]byte, 16)
+			if _, err := rand.Read(nonce); err != nil {
+				return err
+			}
+
+			timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+			bodyHash := sha256.Sum256(body)
+			payload := strings.Join([]string{
+				req.Method,
+				req.URL.RequestURI(),
+				timestamp,
+				hex.EncodeToString(nonce),
+				base64.StdEncoding.EncodeToString(bodyHash[:]),
+			}, "\n")
+
+			mac := hmac.New(sha256.New, []byte(secret))
+			mac.Write([]byte(payload))
+
+			req.Header.Set("X-Kitt-Key", apiKey)
+			req.Header.Set("X-Kitt-Timestamp", timestamp)
+			req.Header.Set("X-Kitt-Nonce", hex.EncodeToString(nonce))
+			req.Header.Set("X-Kitt-Signature", base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+			return nil
+		})
+	}
+}
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// baseUrl of lkgpt-service, e.g http://localhost:3001
+func New(baseUrl string, opts ...Option) *Client {
+	c := &Client{
+		baseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Error returned when the server doesn't answer with a 2XX status
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("kitt: status %d: %s", e.StatusCode, e.Message)
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, body interface{}) (*http.Request, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, err
+		}
+	}
+
+	u := c.baseUrl + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	for _, authorize := range c.authorize {
+		if err := authorize(req, data); err != nil {
+			return nil, err
+		}
+	}
+	return req, nil
+}
+
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(msg))}
+	}
+	return resp, nil
+}
+
+// v is decoded from the JSON response when not nil
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body interface{}, v interface{}) error {
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return err
+	}
+	if v != nil {
+		req.Header.Set("Accept", "application/json")
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if v != nil {
+		return json.NewDecoder(resp.Body).Decode(v)
+	}
+	return nil
+}
+
+// Read the Server-Sent Events until ctx is done, the stream is closed or onData returns an error
+func (c *Client) stream(ctx context.Context, path string, query url.Values, onData func(data []byte) error) error {
+	req, err := c.newRequest(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := c.send(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var data []byte
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			// End of the event
+			if len(data) > 0 {
+				if err := onData(data); err != nil {
+					return err
+				}
+				data = nil
+			}
+		case strings.HasPrefix(line, "data:"):
+			if len(data) > 0 {
+				data = append(data, '\n')
+			}
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " ")...)
+		}
+	}
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return scanner.Err()
+}
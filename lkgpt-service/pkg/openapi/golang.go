@@ -0,0 +1,239 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Words written in upper case in the Go identifiers
+var goInitialisms = map[string]bool{
+	"api":  true,
+	"id":   true,
+	"json": true,
+	"sid":  true,
+	"url":  true,
+}
+
+// Generate the types and the methods of the Go client, the Client type and its do/stream methods are
+// hand-written in the same package
+func GenerateGo(doc *Document, pkg string) ([]byte, error) {
+	g := &goGenerator{imports: map[string]bool{"context": true}}
+	body := &bytes.Buffer{}
+
+	for _, name := range sortedSchemaNames(doc) {
+		g.writeType(body, name, doc.Components.Schemas[name])
+	}
+	for _, op := range doc.Operations() {
+		g.writeMethod(body, op)
+	}
+
+	out := &bytes.Buffer{}
+	fmt.Fprintf(out, "// Code generated by cmd/apigen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkg)
+	imports := make([]string, 0, len(g.imports))
+	for imp := range g.imports {
+		imports = append(imports, imp)
+	}
+	sort.Strings(imports)
+	for _, imp := range imports {
+		fmt.Fprintf(out, "\t%q\n", imp)
+	}
+	out.WriteString(")\n")
+	out.Write(body.Bytes())
+
+	return format.Source(out.Bytes())
+}
+
+type goGenerator struct {
+	imports map[string]bool
+}
+
+func (g *goGenerator) writeType(w *bytes.Buffer, name string, s *Schema) {
+	if s.Description != "" {
+		fmt.Fprintf(w, "\n// %s", s.Description)
+	}
+	if s.Type != "object" || s.Properties == nil {
+		fmt.Fprintf(w, "\ntype %s %s\n", name, g.goType(s))
+		return
+	}
+
+	fmt.Fprintf(w, "\ntype %s struct {\n", name)
+	for _, prop := range s.PropertyNames() {
+		tag := prop
+		if !contains(s.Required, prop) {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(w, "\t%s %s `json:%q`\n", goName(prop), g.goType(s.Properties[prop]), tag)
+	}
+	w.WriteString("}\n")
+}
+
+func (g *goGenerator) writeMethod(w *bytes.Buffer, op *OperationRef) {
+	var args []string
+	var query []*Parameter
+	for _, p := range op.Parameters {
+		args = append(args, p.Name+" string")
+		if p.In == "query" {
+			query = append(query, p)
+		}
+	}
+
+	body := "nil"
+	if s := op.RequestSchema(); s != nil {
+		args = append(args, "body "+g.goType(s))
+		body = "body"
+	}
+
+	queryArg := "nil"
+	if len(query) > 0 {
+		g.imports["net/url"] = true
+		queryArg = "query"
+	}
+
+	name := goName(op.OperationID)
+	if op.Summary != "" {
+		fmt.Fprintf(w, "\n// %s\n", op.Summary)
+	} else {
+		w.WriteString("\n")
+	}
+
+	res := op.ResponseSchema()
+	switch {
+	case op.Stream:
+		g.imports["encoding/json"] = true
+		eventType := g.goType(res)
+		args = append(args, fmt.Sprintf("onEvent func(event %s) error", eventType))
+		fmt.Fprintf(w, "func (c *Client) %s(ctx context.Context, %s) error {\n", name, strings.Join(args, ", "))
+		g.writeQuery(w, query)
+		fmt.Fprintf(w, "\treturn c.stream(ctx, %s, %s, func(data []byte) error {\n", g.goPath(op.Path), queryArg)
+		fmt.Fprintf(w, "\t\tvar event %s\n", eventType)
+		w.WriteString("\t\tif err := json.Unmarshal(data, &event); err != nil {\n\t\t\treturn err\n\t\t}\n")
+		w.WriteString("\t\treturn onEvent(event)\n\t})\n}\n")
+	case res == nil:
+		fmt.Fprintf(w, "func (c *Client) %s(%s) error {\n", name, strings.Join(append([]string{"ctx context.Context"}, args...), ", "))
+		g.writeQuery(w, query)
+		fmt.Fprintf(w, "\treturn c.do(ctx, %q, %s, %s, %s, nil)\n}\n", op.Method, g.goPath(op.Path), queryArg, body)
+	default:
+		resType := g.goType(res)
+		fmt.Fprintf(w, "func (c *Client) %s(%s) (%s, error) {\n", name, strings.Join(append([]string{"ctx context.Context"}, args...), ", "), resType)
+		g.writeQuery(w, query)
+		fmt.Fprintf(w, "\tvar res %s\n", resType)
+		fmt.Fprintf(w, "\terr := c.do(ctx, %q, %s, %s, %s, &res)\n", op.Method, g.goPath(op.Path), queryArg, body)
+		w.WriteString("\treturn res, err\n}\n")
+	}
+}
+
+// Empty params are omitted
+func (g *goGenerator) writeQuery(w *bytes.Buffer, query []*Parameter) {
+	if len(query) == 0 {
+		return
+	}
+
+	w.WriteString("\tquery := url.Values{}\n")
+	for _, p := range query {
+		fmt.Fprintf(w, "\tif %s != \"\" {\n\t\tquery.Set(%q, %s)\n\t}\n", p.Name, p.Name, p.Name)
+	}
+}
+
+// Go expression of the path with the escaped params
+func (g *goGenerator) goPath(path string) string {
+	params := PathParams(path)
+	if len(params) == 0 {
+		return fmt.Sprintf("%q", path)
+	}
+
+	g.imports["net/url"] = true
+	var parts []string
+	rest := path
+	for _, p := range params {
+		before, after, _ := strings.Cut(rest, "{"+p+"}")
+		if before != "" {
+			parts = append(parts, fmt.Sprintf("%q", before))
+		}
+		parts = append(parts, fmt.Sprintf("url.PathEscape(%s)", p))
+		rest = after
+	}
+	if rest != "" {
+		parts = append(parts, fmt.Sprintf("%q", rest))
+	}
+	return strings.Join(parts, " + ")
+}
+
+func (g *goGenerator) goType(s *Schema) string {
+	if s.Ref != "" {
+		return "*" + s.RefName()
+	}
+
+	switch s.Type {
+	case "string":
+		switch s.Format {
+		case "date-time":
+			g.imports["time"] = true
+			return "time.Time"
+		case "byte":
+			return "[]byte"
+		}
+		return "string"
+	case "boolean":
+		return "bool"
+	case "integer":
+		if s.Format == "int64" {
+			return "int64"
+		}
+		return "int"
+	case "number":
+		return "float64"
+	case "array":
+		return "[]" + strings.TrimPrefix(g.goType(s.Items), "*")
+	case "object":
+		if s.AdditionalProperties != nil {
+			return "map[string]" + strings.TrimPrefix(g.goType(s.AdditionalProperties), "*")
+		}
+	}
+
+	g.imports["encoding/json"] = true
+	return "json.RawMessage"
+}
+
+// Exported Go identifier from a camelCase name
+func goName(name string) string {
+	var words []string
+	start := 0
+	for i, r := range name {
+		if i > start && unicode.IsUpper(r) {
+			words = append(words, name[start:i])
+			start = i
+		}
+	}
+	words = append(words, name[start:])
+
+	for i, word := range words {
+		if goInitialisms[strings.ToLower(word)] {
+			words[i] = strings.ToUpper(word)
+		} else {
+			words[i] = strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return strings.Join(words, "")
+}
+
+func sortedSchemaNames(doc *Document) []string {
+	names := make([]string, 0, len(doc.Components.Schemas))
+	for name := range doc.Components.Schemas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,358 @@
+// Package openapi builds the OpenAPI specification of the HTTP API from the Go types of the handlers,
+// and generates the typed clients from it (see cmd/apigen)
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const Version = "3.0.3"
+
+// An operation of the HTTP API
+type Route struct {
+	Method   string
+	Path     string // Path params between braces, e.g /rooms/{room}/agenda
+	ID       string // operationId, also the name of the client methods
+	Summary  string
+	Query    []Param
+	Request  interface{} // Value of the type of the JSON body, nil when there is none
+	Response interface{} // Value of the type of the JSON response, nil when there is none
+	Stream   bool        // Response is sent as Server-Sent Events
+	Security []string    // Names of the security schemes, any of them is accepted
+}
+
+type Param struct {
+	Name        string
+	Description string
+	Required    bool
+}
+
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"` // Path -> lowercase method -> operation
+	Components Components                       `json:"components"`
+
+	// Order of the routes, used by the generators
+	routes []Route
+}
+
+// Operations in the order of the routes
+func (d *Document) Operations() []*OperationRef {
+	res := make([]*OperationRef, 0, len(d.routes))
+	for _, r := range d.routes {
+		res = append(res, &OperationRef{
+			Method:    r.Method,
+			Path:      r.Path,
+			Stream:    r.Stream,
+			Operation: d.Paths[r.Path][strings.ToLower(r.Method)],
+		})
+	}
+	return res
+}
+
+type OperationRef struct {
+	Method string
+	Path   string
+	Stream bool
+	*Operation
+}
+
+// JSON schema of the body of the request, nil when there is none
+func (o *OperationRef) RequestSchema() *Schema {
+	if o.RequestBody == nil {
+		return nil
+	}
+	return o.RequestBody.Content["application/json"].Schema
+}
+
+// JSON schema of the response (of each event when streamed), nil when there is none
+func (o *OperationRef) ResponseSchema() *Schema {
+	resp := o.Responses["200"]
+	if resp == nil {
+		return nil
+	}
+	for _, media := range resp.Content {
+		return media.Schema
+	}
+	return nil
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"` // path or query
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"` // http or apiKey
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// A schema without type accepts any JSON value
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+
+	// Order of the properties in the Go struct, used by the generators
+	order []string
+}
+
+const refPrefix = "#/components/schemas/"
+
+// Name of the referenced component
+func (s *Schema) RefName() string {
+	return strings.TrimPrefix(s.Ref, refPrefix)
+}
+
+// Property names in the order of the Go struct
+func (s *Schema) PropertyNames() []string {
+	return s.order
+}
+
+var pathParamRegexp = regexp.MustCompile(`{([^}]+)}`)
+
+// Path params in the order they appear in path
+func PathParams(path string) []string {
+	var params []string
+	for _, m := range pathParamRegexp.FindAllStringSubmatch(path, -1) {
+		params = append(params, m[1])
+	}
+	return params
+}
+
+func Build(info Info, security map[string]*SecurityScheme, routes []Route) *Document {
+	b := &builder{schemas: make(map[string]*Schema)}
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    info,
+		Paths:   make(map[string]map[string]*Operation),
+		routes:  routes,
+	}
+
+	for _, r := range routes {
+		op := &Operation{
+			OperationID: r.ID,
+			Summary:     r.Summary,
+			Responses:   make(map[string]*Response),
+		}
+
+		for _, name := range PathParams(r.Path) {
+			op.Parameters = append(op.Parameters, &Parameter{
+				Name:     name,
+				In:       "path",
+				Required: true,
+				Schema:   &Schema{Type: "string"},
+			})
+		}
+		for _, q := range r.Query {
+			op.Parameters = append(op.Parameters, &Parameter{
+				Name:        q.Name,
+				In:          "query",
+				Description: q.Description,
+				Required:    q.Required,
+				Schema:      &Schema{Type: "string"},
+			})
+		}
+
+		if r.Request != nil {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content: map[string]MediaType{
+					"application/json": {Schema: b.schema(reflect.TypeOf(r.Request))},
+				},
+			}
+		}
+
+		switch {
+		case r.Response == nil:
+			op.Responses["2XX"] = &Response{Description: "Success"}
+		case r.Stream:
+			op.Responses["200"] = &Response{
+				Description: "Server-Sent Events, the data of each event is JSON encoded",
+				Content: map[string]MediaType{
+					"text/event-stream": {Schema: b.schema(reflect.TypeOf(r.Response))},
+				},
+			}
+		default:
+			op.Responses["200"] = &Response{
+				Description: "Success",
+				Content: map[string]MediaType{
+					"application/json": {Schema: b.schema(reflect.TypeOf(r.Response))},
+				},
+			}
+		}
+		op.Responses["default"] = &Response{
+			Description: "Error, the body contains the error message",
+			Content: map[string]MediaType{
+				"text/plain": {Schema: &Schema{Type: "string"}},
+			},
+		}
+
+		for _, name := range r.Security {
+			op.Security = append(op.Security, map[string][]string{name: {}})
+		}
+
+		if doc.Paths[r.Path] == nil {
+			doc.Paths[r.Path] = make(map[string]*Operation)
+		}
+		doc.Paths[r.Path][strings.ToLower(r.Method)] = op
+	}
+
+	doc.Components = Components{
+		Schemas:         b.schemas,
+		SecuritySchemes: security,
+	}
+	return doc
+}
+
+type builder struct {
+	schemas map[string]*Schema
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	durationType = reflect.TypeOf(time.Duration(0))
+	rawType      = reflect.TypeOf(json.RawMessage{})
+)
+
+func (b *builder) schema(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case durationType:
+		return &Schema{Type: "integer", Format: "int64", Description: "Nanoseconds"}
+	case rawType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t)
+		}
+		ref := &Schema{Ref: refPrefix + t.Name()}
+		if _, ok := b.schemas[t.Name()]; !ok {
+			b.schemas[t.Name()] = &Schema{} // Recursive types
+			b.schemas[t.Name()] = b.object(t)
+		}
+		return ref
+	default:
+		return &Schema{} // interface{}
+	}
+}
+
+// Same rules as encoding/json for the field names, omitempty fields are optional
+func (b *builder) object(t reflect.Type) *Schema {
+	s := &Schema{
+		Type:       "object",
+		Properties: make(map[string]*Schema),
+	}
+	b.addFields(s, t)
+	return s
+}
+
+func (b *builder) addFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				b.addFields(s, ft)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = b.schema(f.Type)
+		s.order = append(s.order, name)
+		if !strings.Contains(opts, "omitempty") {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package openapi
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// Generate the interfaces and the KittApi class of the TypeScript client, the request/stream
+// methods are implemented by the hand-written base class imported from baseModule
+func GenerateTS(doc *Document, baseModule string) []byte {
+	w := &bytes.Buffer{}
+	w.WriteString("// Code generated by cmd/apigen. DO NOT EDIT.\n\n")
+	fmt.Fprintf(w, "import { KittClient } from '%s';\n", baseModule)
+
+	for _, name := range sortedSchemaNames(doc) {
+		writeTSType(w, name, doc.Components.Schemas[name])
+	}
+
+	w.WriteString("\nexport class KittApi extends KittClient {")
+	for _, op := range doc.Operations() {
+		writeTSMethod(w, op)
+	}
+	w.WriteString("}\n")
+	return w.Bytes()
+}
+
+func writeTSType(w *bytes.Buffer, name string, s *Schema) {
+	w.WriteString("\n")
+	if s.Description != "" {
+		fmt.Fprintf(w, "/** %s */\n", s.Description)
+	}
+	if s.Type != "object" || s.Properties == nil {
+		fmt.Fprintf(w, "export type %s = %s;\n", name, tsType(s))
+		return
+	}
+
+	fmt.Fprintf(w, "export interface %s {\n", name)
+	for _, prop := range s.PropertyNames() {
+		optional := ""
+		if !contains(s.Required, prop) {
+			optional = "?"
+		}
+		fmt.Fprintf(w, "  %s%s: %s;\n", prop, optional, tsType(s.Properties[prop]))
+	}
+	w.WriteString("}\n")
+}
+
+func writeTSMethod(w *bytes.Buffer, op *OperationRef) {
+	var args, query []string
+	for _, p := range op.Parameters {
+		if p.In == "query" {
+			query = append(query, p.Name)
+		}
+		if p.Required {
+			args = append(args, p.Name+": string")
+		} else {
+			args = append(args, p.Name+"?: string")
+		}
+	}
+
+	var options []string
+	if len(query) > 0 {
+		options = append(options, fmt.Sprintf("query: { %s }", strings.Join(query, ", ")))
+	}
+	if s := op.RequestSchema(); s != nil {
+		args = append(args, "body: "+tsType(s))
+		options = append(options, "body")
+	}
+
+	if op.Summary != "" {
+		fmt.Fprintf(w, "\n  /** %s */", op.Summary)
+	}
+
+	path := tsPath(op.Path)
+	res := op.ResponseSchema()
+	if op.Stream {
+		eventType := tsType(res)
+		args = append(args, fmt.Sprintf("onEvent: (event: %s) => void", eventType))
+		fmt.Fprintf(w, "\n  %s(%s): AbortController {\n", op.OperationID, strings.Join(args, ", "))
+		queryArg := "undefined"
+		if len(query) > 0 {
+			queryArg = fmt.Sprintf("{ %s }", strings.Join(query, ", "))
+		}
+		fmt.Fprintf(w, "    return this.stream<%s>(%s, %s, onEvent);\n  }\n", eventType, path, queryArg)
+		return
+	}
+
+	resType := "void"
+	if res != nil {
+		resType = tsType(res)
+	}
+	fmt.Fprintf(w, "\n  %s(%s): Promise<%s> {\n", op.OperationID, strings.Join(args, ", "), resType)
+	if len(options) > 0 {
+		fmt.Fprintf(w, "    return this.request<%s>('%s', %s, { %s });\n  }\n", resType, op.Method, path, strings.Join(options, ", "))
+	} else {
+		fmt.Fprintf(w, "    return this.request<%s>('%s', %s);\n  }\n", resType, op.Method, path)
+	}
+}
+
+// Template literal of the path with the escaped params
+func tsPath(path string) string {
+	params := PathParams(path)
+	if len(params) == 0 {
+		return fmt.Sprintf("'%s'", path)
+	}
+
+	for _, p := range params {
+		path = strings.Replace(path, "{"+p+"}", "${encodeURIComponent("+p+")}", 1)
+	}
+	return "`" + path + "`"
+}
+
+func tsType(s *Schema) string {
+	if s.Ref != "" {
+		return s.RefName()
+	}
+
+	switch s.Type {
+	case "string":
+		return "string"
+	case "boolean":
+		return "boolean"
+	case "integer", "number":
+		return "number"
+	case "array":
+		return tsType(s.Items) + "[]"
+	case "object":
+		if s.AdditionalProperties != nil {
+			return "Record<string, " + tsType(s.AdditionalProperties) + ">"
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+	lksdk "github.com/livekit/server-sdk-go"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// Times are in seconds from the start of the recording, to seek the media element directly
+type alignedWord struct {
+	Word  string  `json:"word"`
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+type alignedPhrase struct {
+	Speaker string        `json:"speaker"`
+	IsBot   bool          `json:"isBot,omitempty"`
+	Text    string        `json:"text"`
+	Start   float64       `json:"start"`
+	End     float64       `json:"end"`
+	Words   []alignedWord `json:"words,omitempty"` // Estimated when the STT didn't provide the word offsets
+}
+
+// Exported file, one per recording of the room
+type alignmentExport struct {
+	Room           string          `json:"room"`
+	RoomSid        string          `json:"roomSid"`
+	RoomStart      time.Time       `json:"roomStart"`
+	EgressID       string          `json:"egressId"`
+	Recording      string          `json:"recording"` // Location of the file or of the playlist
+	RecordingStart time.Time       `json:"recordingStart"`
+	Phrases        []alignedPhrase `json:"phrases"`
+}
+
+type timedPhrase struct {
+	speaker string
+	isBot   bool
+	text    string
+	start   time.Time
+	end     time.Time
+	words   []RecognizedWord
+}
+
+// alignmentSink keeps the timing of the phrases of a room. When the room finishes, it is aligned to each
+// Egress recording of the room and uploaded to the storage. The recordings are listed at the end, so the
+// egress webhooks don't have to reach the instance hosting the room
+type alignmentSink struct {
+	conf      config.AlignmentConfig
+	store     BlobStore
+	egress    *lksdk.EgressClient
+	roomName  string
+	roomSid   string
+	roomStart time.Time
+
+	lock    sync.Mutex
+	phrases []*timedPhrase
+}
+
+func newAlignmentSink(conf config.AlignmentConfig, store BlobStore, egress *lksdk.EgressClient, roomName, roomSid string, roomStart time.Time) *alignmentSink {
+	return &alignmentSink{
+		conf:      conf,
+		store:     store,
+		egress:    egress,
+		roomName:  roomName,
+		roomSid:   roomSid,
+		roomStart: roomStart,
+	}
+}
+
+func (s *alignmentSink) HandleEvent(event *RoomEvent) {
+	var phrase *timedPhrase
+	switch data := event.Data.(type) {
+	case *TranscriptEvent:
+		if !data.IsFinal || strings.TrimSpace(data.Text) == "" {
+			return
+		}
+
+		words := transcriptWords(data, event.Time)
+		if len(words) == 0 {
+			return
+		}
+		phrase = &timedPhrase{
+			speaker: data.ParticipantName,
+			text:    data.Text,
+			start:   words[0].Start,
+			end:     words[len(words)-1].End,
+			words:   words,
+		}
+	case *SpeakingEvent:
+		// Sentence of KITT, timed when its audio started playing
+		phrase = &timedPhrase{
+			speaker: BotIdentity,
+			isBot:   true,
+			text:    data.Text,
+			start:   data.Start,
+			end:     data.Start.Add(data.Duration),
+		}
+	default:
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.phrases = append(s.phrases, phrase)
+}
+
+func (s *alignmentSink) Close() {
+	s.lock.Lock()
+	phrases := s.phrases
+	s.phrases = nil
+	s.lock.Unlock()
+
+	if len(phrases) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	res, err := s.egress.ListEgress(ctx, &livekit.ListEgressRequest{RoomName: s.roomName})
+	if err != nil {
+		logger.Errorw("failed to list the recordings", err, "room", s.roomName)
+		return
+	}
+
+	for _, info := range res.Items {
+		if info.RoomId != s.roomSid {
+			continue // Previous session of a room with the same name
+		}
+
+		export := s.align(info, phrases)
+		if export == nil {
+			continue
+		}
+
+		data, err := json.Marshal(export)
+		if err != nil {
+			logger.Errorw("failed to marshal the alignment", err, "room", s.roomName)
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%s_%s_%s.json", strings.Trim(s.conf.Dir, "/"), sanitizeFilename(s.roomName), s.roomSid, info.EgressId)
+		if err := s.store.Put(ctx, key, data, "application/json"); err != nil {
+			logger.Errorw("failed to store the alignment", err, "room", s.roomName, "egress", info.EgressId)
+		}
+	}
+}
+
+// Phrases within the recording, nil when it never started
+func (s *alignmentSink) align(info *livekit.EgressInfo, phrases []*timedPhrase) *alignmentExport {
+	location, startedAt, endedAt := recordingTimeline(info)
+	if startedAt == 0 {
+		return nil
+	}
+
+	start := time.Unix(0, startedAt)
+	end := time.Time{}
+	if endedAt > 0 {
+		end = time.Unix(0, endedAt)
+	}
+
+	offset := func(t time.Time) float64 {
+		d := t.Sub(start)
+		if d < 0 {
+			return 0
+		}
+		return d.Seconds()
+	}
+
+	export := &alignmentExport{
+		Room:           s.roomName,
+		RoomSid:        s.roomSid,
+		RoomStart:      s.roomStart,
+		EgressID:       info.EgressId,
+		Recording:      location,
+		RecordingStart: start,
+		Phrases:        []alignedPhrase{},
+	}
+	for _, p := range phrases {
+		if p.end.Before(start) || (!end.IsZero() && p.start.After(end)) {
+			continue // Not recorded
+		}
+
+		phrase := alignedPhrase{
+			Speaker: p.speaker,
+			IsBot:   p.isBot,
+			Text:    p.text,
+			Start:   offset(p.start),
+			End:     offset(p.end),
+		}
+		for _, w := range p.words {
+			phrase.Words = append(phrase.Words, alignedWord{
+				Word:  w.Word,
+				Start: offset(w.Start),
+				End:   offset(w.End),
+			})
+		}
+		export.Phrases = append(export.Phrases, phrase)
+	}
+	return export
+}
+
+// Location and timing (unix nanoseconds) of the recorded file, the ones of the egress for the streams
+func recordingTimeline(info *livekit.EgressInfo) (string, int64, int64) {
+	if len(info.FileResults) > 0 && info.FileResults[0].StartedAt > 0 {
+		f := info.FileResults[0]
+		return firstNonEmpty(f.Location, f.Filename), f.StartedAt, f.EndedAt
+	}
+	if len(info.SegmentResults) > 0 && info.SegmentResults[0].StartedAt > 0 {
+		seg := info.SegmentResults[0]
+		return firstNonEmpty(seg.PlaylistLocation, seg.PlaylistName), seg.StartedAt, seg.EndedAt
+	}
+	if f := info.GetFile(); f != nil && f.StartedAt > 0 {
+		return firstNonEmpty(f.Location, f.Filename), f.StartedAt, f.EndedAt
+	}
+	return "", info.StartedAt, info.EndedAt
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
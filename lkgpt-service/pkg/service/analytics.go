@@ -0,0 +1,235 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+const (
+	wordsPerSecond    = 2.5 // Speaking rate used when the transcript has no word timings
+	interruptedWindow = time.Minute
+)
+
+// Statistics of one participant over the meeting
+type ParticipantStats struct {
+	ParticipantSid  string        `json:"sid"`
+	ParticipantName string        `json:"name"`
+	TalkTime        time.Duration `json:"talkTime"`
+	Words           int           `json:"words"`
+	Turns           int           `json:"turns"`         // Number of final transcripts
+	Interruptions   int           `json:"interruptions"` // Started speaking while someone else was speaking
+	Interrupted     int           `json:"interrupted"`   // Was speaking when someone else started
+	Sentiment       float64       `json:"sentiment"`     // Average of the sentences, from -1 (negative) to 1 (positive)
+}
+
+type MeetingStats struct {
+	Start        time.Time           `json:"start"`
+	Duration     time.Duration       `json:"duration"`
+	Sentiment    float64             `json:"sentiment"`    // Average of every sentence
+	Participants []*ParticipantStats `json:"participants"` // Most talkative first
+}
+
+// A final transcript
+type speechSegment struct {
+	sid   string
+	start time.Time
+	end   time.Time
+}
+
+// meetingAnalytics computes the talk time, the interruptions and the sentiment of each participant from the final transcripts
+type meetingAnalytics struct {
+	conf  config.AnalyticsConfig
+	start time.Time
+
+	lock         sync.Mutex
+	participants map[string]*ParticipantStats // sid -> stats
+	sentiments   map[string]float64           // sid -> sum of the sentiments
+	recent       []*speechSegment             // Segments that can still overlap with the next ones
+}
+
+func newMeetingAnalytics(conf config.AnalyticsConfig) *meetingAnalytics {
+	return &meetingAnalytics{
+		conf:         conf,
+		start:        time.Now(),
+		participants: make(map[string]*ParticipantStats),
+		sentiments:   make(map[string]float64),
+	}
+}
+
+func (a *meetingAnalytics) HandleEvent(event *RoomEvent) {
+	data, ok := event.Data.(*TranscriptEvent)
+	if !ok || !data.IsFinal || strings.TrimSpace(data.Text) == "" {
+		return
+	}
+
+	words := len(strings.Fields(data.Text))
+	segment := &speechSegment{sid: data.ParticipantSid}
+	if len(data.Words) > 0 {
+		segment.start = data.Words[0].Start
+		segment.end = data.Words[len(data.Words)-1].End
+	} else {
+		// The final transcript is received once the participant stopped speaking
+		segment.end = event.Time
+		segment.start = event.Time.Add(-time.Duration(float64(words) / wordsPerSecond * float64(time.Second)))
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	stats := a.participants[data.ParticipantSid]
+	if stats == nil {
+		stats = &ParticipantStats{ParticipantSid: data.ParticipantSid}
+		a.participants[data.ParticipantSid] = stats
+	}
+	stats.ParticipantName = data.ParticipantName
+	stats.TalkTime += segment.end.Sub(segment.start)
+	stats.Words += words
+	stats.Turns++
+	a.sentiments[data.ParticipantSid] += sentimentScore(data.Text)
+
+	// The transcripts of the participants are received out of order, so the new segment is compared
+	// with the recent ones of the others. Each overlap is counted once, when its second segment is received
+	for _, other := range a.recent {
+		if other.sid == segment.sid {
+			continue
+		}
+
+		overlap := minTime(segment.end, other.end).Sub(maxTime(segment.start, other.start))
+		if overlap < a.conf.MinOverlap || overlap <= 0 {
+			continue
+		}
+
+		interrupter, interrupted := segment.sid, other.sid
+		if other.start.After(segment.start) {
+			interrupter, interrupted = other.sid, segment.sid
+		}
+		a.participants[interrupter].Interruptions++
+		a.participants[interrupted].Interrupted++
+	}
+
+	recent := a.recent[:0]
+	for _, s := range a.recent {
+		if segment.end.Sub(s.end) < interruptedWindow {
+			recent = append(recent, s)
+		}
+	}
+	a.recent = append(recent, segment)
+}
+
+func (a *meetingAnalytics) Stats() *MeetingStats {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	stats := &MeetingStats{
+		Start:        a.start,
+		Duration:     time.Since(a.start),
+		Participants: make([]*ParticipantStats, 0, len(a.participants)),
+	}
+
+	var sentiment float64
+	var turns int
+	for sid, p := range a.participants {
+		c := *p
+		c.Sentiment = a.sentiments[sid] / float64(p.Turns)
+		stats.Participants = append(stats.Participants, &c)
+
+		sentiment += a.sentiments[sid]
+		turns += p.Turns
+	}
+	if turns > 0 {
+		stats.Sentiment = sentiment / float64(turns)
+	}
+
+	sort.Slice(stats.Participants, func(i, j int) bool {
+		return stats.Participants[i].TalkTime > stats.Participants[j].TalkTime
+	})
+	return stats
+}
+
+// Lexicon-based, good enough to follow the mood of a meeting without sending each sentence to a model
+var (
+	positiveWords = toSet("good", "great", "excellent", "awesome", "amazing", "nice", "love", "happy", "glad",
+		"agree", "perfect", "thanks", "thank", "helpful", "easy", "success", "successful", "fantastic", "wonderful",
+		"cool", "excited", "exciting", "works", "working", "fixed", "progress", "better", "best")
+	negativeWords = toSet("bad", "terrible", "awful", "hate", "dislike", "sad", "angry", "annoying", "disagree",
+		"problem", "problems", "issue", "issues", "wrong", "broken", "fail", "failed", "failing", "difficult",
+		"worried", "concern", "concerned", "blocked", "blocker", "delay", "delayed", "worse", "worst", "bug")
+	negationWords = toSet("not", "no", "never", "don't", "doesn't", "didn't", "isn't", "wasn't", "aren't", "can't", "won't")
+)
+
+// From -1 (negative) to 1 (positive), 0 when no word of the lexicon is found
+func sentimentScore(text string) float64 {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\''
+	})
+
+	var positive, negative int
+	for i, w := range words {
+		score := 0
+		if positiveWords[w] {
+			score = 1
+		} else if negativeWords[w] {
+			score = -1
+		}
+		if score != 0 && i > 0 && negationWords[words[i-1]] {
+			score = -score
+		}
+
+		if score > 0 {
+			positive++
+		} else if score < 0 {
+			negative++
+		}
+	}
+
+	if positive+negative == 0 {
+		return 0
+	}
+	return float64(positive-negative) / float64(positive+negative)
+}
+
+func toSet(words ...string) map[string]bool {
+	set := make(map[string]bool, len(words))
+	for _, w := range words {
+		set[w] = true
+	}
+	return set
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// GET /rooms/{room}/stats
+func (s *LiveGPT) roomStatsHandler(w http.ResponseWriter, req *http.Request, p *GPTParticipant) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if p.analytics == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("the analytics are disabled"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(p.analytics.Stats())
+}
@@ -0,0 +1,381 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// Anthropic Messages API, the OpenAI requests are translated:
+// the system messages of the conversation become user messages (only the leading ones can be the system prompt),
+// the tool calls and results become tool_use/tool_result blocks and the JSON mode is obtained by prefilling the answer
+
+const (
+	anthropicUrl     = "https://api.anthropic.com"
+	anthropicVersion = "2023-06-01"
+)
+
+type anthropicLLM struct {
+	conf config.LLMConfig
+}
+
+func newAnthropicLLM(conf config.LLMConfig) *anthropicLLM {
+	return &anthropicLLM{conf: conf}
+}
+
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+	Temperature *float32           `json:"temperature,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+}
+
+type anthropicMessage struct {
+	Role    string           `json:"role"` // user or assistant
+	Content []anthropicBlock `json:"content"`
+}
+
+type anthropicBlock struct {
+	Type      string          `json:"type"` // text, tool_use or tool_result
+	Text      string          `json:"text,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	Name      string          `json:"name,omitempty"`
+	Input     json.RawMessage `json:"input,omitempty"`
+	ToolUseID string          `json:"tool_use_id,omitempty"`
+	Content   string          `json:"content,omitempty"` // Result of the tool
+}
+
+type anthropicTool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	InputSchema interface{} `json:"input_schema"`
+}
+
+type anthropicUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// Returns the request and the prefilled beginning of the answer
+func (l *anthropicLLM) newRequest(req openai.ChatCompletionRequest) (*anthropicRequest, string) {
+	ar := &anthropicRequest{
+		Model:     req.Model,
+		MaxTokens: req.MaxTokens,
+		Stream:    req.Stream,
+	}
+	if ar.MaxTokens == 0 {
+		ar.MaxTokens = l.conf.MaxTokens
+	}
+	if req.Temperature != 0 {
+		ar.Temperature = &req.Temperature
+	}
+
+	var system []string
+	add := func(role string, block anthropicBlock) {
+		if n := len(ar.Messages); n > 0 && ar.Messages[n-1].Role == role {
+			ar.Messages[n-1].Content = append(ar.Messages[n-1].Content, block)
+			return
+		}
+		ar.Messages = append(ar.Messages, anthropicMessage{Role: role, Content: []anthropicBlock{block}})
+	}
+
+	for _, m := range req.Messages {
+		switch m.Role {
+		case openai.ChatMessageRoleSystem:
+			if len(ar.Messages) == 0 {
+				system = append(system, m.Content)
+			} else {
+				add("user", anthropicBlock{Type: "text", Text: "(Instruction) " + m.Content})
+			}
+		case openai.ChatMessageRoleAssistant:
+			if m.Content != "" {
+				add("assistant", anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, call := range m.ToolCalls {
+				input := json.RawMessage(call.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				add("assistant", anthropicBlock{Type: "tool_use", ID: call.ID, Name: call.Function.Name, Input: input})
+			}
+		case openai.ChatMessageRoleTool:
+			add("user", anthropicBlock{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content})
+		default:
+			add("user", anthropicBlock{Type: "text", Text: m.Content})
+		}
+	}
+	if len(ar.Messages) == 0 || ar.Messages[0].Role != "user" {
+		ar.Messages = append([]anthropicMessage{{Role: "user", Content: []anthropicBlock{{Type: "text", Text: "(The meeting started)"}}}}, ar.Messages...)
+	}
+
+	for _, tool := range req.Tools {
+		if tool.Function == nil {
+			continue
+		}
+		schema := tool.Function.Parameters
+		if schema == nil {
+			schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		ar.Tools = append(ar.Tools, anthropicTool{
+			Name:        tool.Function.Name,
+			Description: tool.Function.Description,
+			InputSchema: schema,
+		})
+	}
+
+	var prefill string
+	if req.ResponseFormat != nil && req.ResponseFormat.Type == openai.ChatCompletionResponseFormatTypeJSONObject {
+		system = append(system, "Answer only with the JSON object, without any text before or after it.")
+		// A prefilled answer can't call the tools
+		if len(ar.Tools) == 0 && ar.Messages[len(ar.Messages)-1].Role == "user" {
+			prefill = "{"
+			ar.Messages = append(ar.Messages, anthropicMessage{Role: "assistant", Content: []anthropicBlock{{Type: "text", Text: prefill}}})
+		}
+	}
+	ar.System = strings.Join(system, "\n\n")
+	return ar, prefill
+}
+
+func (l *anthropicLLM) post(ctx context.Context, body *anthropicRequest) (*http.Response, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	baseUrl := anthropicUrl
+	if l.conf.BaseUrl != "" {
+		baseUrl = strings.TrimSuffix(l.conf.BaseUrl, "/")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseUrl+"/v1/messages", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-api-key", l.conf.ApiKey)
+	req.Header.Set("anthropic-version", anthropicVersion)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("Anthropic request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
+
+func (l *anthropicLLM) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	req.Stream = false
+	ar, prefill := l.newRequest(req)
+	resp, err := l.post(ctx, ar)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	defer resp.Body.Close()
+
+	res := struct {
+		ID         string           `json:"id"`
+		Model      string           `json:"model"`
+		Content    []anthropicBlock `json:"content"`
+		StopReason string           `json:"stop_reason"`
+		Usage      anthropicUsage   `json:"usage"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+
+	message := openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleAssistant,
+		Content: prefill,
+	}
+	for _, block := range res.Content {
+		switch block.Type {
+		case "text":
+			message.Content += block.Text
+		case "tool_use":
+			message.ToolCalls = append(message.ToolCalls, openai.ToolCall{
+				ID:   block.ID,
+				Type: openai.ToolTypeFunction,
+				Function: openai.FunctionCall{
+					Name:      block.Name,
+					Arguments: string(block.Input),
+				},
+			})
+		}
+	}
+
+	return openai.ChatCompletionResponse{
+		ID:    res.ID,
+		Model: res.Model,
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      message,
+			FinishReason: anthropicFinishReason(res.StopReason),
+		}},
+		Usage: openai.Usage{
+			PromptTokens:     res.Usage.InputTokens,
+			CompletionTokens: res.Usage.OutputTokens,
+			TotalTokens:      res.Usage.InputTokens + res.Usage.OutputTokens,
+		},
+	}, nil
+}
+
+func (l *anthropicLLM) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (LLMStream, error) {
+	req.Stream = true
+	ar, prefill := l.newRequest(req)
+	resp, err := l.post(ctx, ar)
+	if err != nil {
+		return nil, err
+	}
+
+	return &anthropicStream{
+		body:    resp.Body,
+		reader:  bufio.NewReader(resp.Body),
+		prefill: prefill,
+		tools:   make(map[int]int),
+	}, nil
+}
+
+// Server-sent events of the Messages API, returned as OpenAI deltas
+type anthropicStream struct {
+	body    io.ReadCloser
+	reader  *bufio.Reader
+	prefill string      // Returned first
+	tools   map[int]int // Index of the content block -> index of the tool call
+	done    bool
+}
+
+func (s *anthropicStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	if s.prefill != "" {
+		content := s.prefill
+		s.prefill = ""
+		return streamDelta(openai.ChatCompletionStreamChoiceDelta{Content: content}, ""), nil
+	}
+
+	for !s.done {
+		data, err := s.nextEvent()
+		if err != nil {
+			return openai.ChatCompletionStreamResponse{}, err
+		}
+
+		event := struct {
+			Type         string         `json:"type"`
+			Index        int            `json:"index"`
+			ContentBlock anthropicBlock `json:"content_block"`
+			Delta        struct {
+				Type        string `json:"type"`
+				Text        string `json:"text"`
+				PartialJson string `json:"partial_json"`
+				StopReason  string `json:"stop_reason"`
+			} `json:"delta"`
+			Error struct {
+				Type    string `json:"type"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}{}
+		if err := json.Unmarshal(data, &event); err != nil {
+			return openai.ChatCompletionStreamResponse{}, err
+		}
+
+		switch event.Type {
+		case "content_block_start":
+			if event.ContentBlock.Type != "tool_use" {
+				continue
+			}
+			index := len(s.tools)
+			s.tools[event.Index] = index
+			return streamDelta(openai.ChatCompletionStreamChoiceDelta{
+				ToolCalls: []openai.ToolCall{{
+					Index: &index,
+					ID:    event.ContentBlock.ID,
+					Type:  openai.ToolTypeFunction,
+					Function: openai.FunctionCall{
+						Name: event.ContentBlock.Name,
+					},
+				}},
+			}, ""), nil
+		case "content_block_delta":
+			switch event.Delta.Type {
+			case "text_delta":
+				return streamDelta(openai.ChatCompletionStreamChoiceDelta{Content: event.Delta.Text}, ""), nil
+			case "input_json_delta":
+				index := s.tools[event.Index]
+				return streamDelta(openai.ChatCompletionStreamChoiceDelta{
+					ToolCalls: []openai.ToolCall{{
+						Index: &index,
+						Function: openai.FunctionCall{
+							Arguments: event.Delta.PartialJson,
+						},
+					}},
+				}, ""), nil
+			}
+		case "message_delta":
+			if event.Delta.StopReason != "" {
+				return streamDelta(openai.ChatCompletionStreamChoiceDelta{}, anthropicFinishReason(event.Delta.StopReason)), nil
+			}
+		case "message_stop":
+			s.done = true
+		case "error":
+			return openai.ChatCompletionStreamResponse{}, fmt.Errorf("Anthropic stream failed: %s: %s", event.Error.Type, event.Error.Message)
+		}
+	}
+	return openai.ChatCompletionStreamResponse{}, io.EOF
+}
+
+// Data of the next server-sent event
+func (s *anthropicStream) nextEvent() ([]byte, error) {
+	for {
+		line, err := s.reader.ReadBytes('\n')
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(bytes.TrimSpace(line)) == 0 {
+				return nil, io.ErrUnexpectedEOF // Closed before message_stop
+			}
+			if !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+		}
+
+		line = bytes.TrimSpace(line)
+		if bytes.HasPrefix(line, []byte("data:")) {
+			return bytes.TrimSpace(line[len("data:"):]), nil
+		}
+	}
+}
+
+func (s *anthropicStream) Close() error {
+	return s.body.Close()
+}
+
+func streamDelta(delta openai.ChatCompletionStreamChoiceDelta, finishReason openai.FinishReason) openai.ChatCompletionStreamResponse {
+	return openai.ChatCompletionStreamResponse{
+		Choices: []openai.ChatCompletionStreamChoice{{
+			Delta:        delta,
+			FinishReason: finishReason,
+		}},
+	}
+}
+
+func anthropicFinishReason(stopReason string) openai.FinishReason {
+	switch stopReason {
+	case "tool_use":
+		return openai.FinishReasonToolCalls
+	case "max_tokens":
+		return openai.FinishReasonLength
+	default:
+		return openai.FinishReasonStop
+	}
+}
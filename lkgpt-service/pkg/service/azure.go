@@ -0,0 +1,177 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// Azure Speech REST APIs, for the deployments that can't use the GCP credentials.
+// The utterances are transcribed with the short audio API (see fallback.go), there is no interim result
+
+const azureOutputFormat = "ogg-48khz-16bit-mono-opus"
+
+func (f *SpeechFallback) transcribeAzure(ctx context.Context, audio []byte, language *Language, start time.Time) (*RecognizeResult, error) {
+	u := fmt.Sprintf("https://%s.stt.speech.microsoft.com/speech/recognition/conversation/cognitiveservices/v1?language=%s&format=detailed",
+		f.azure.Region, url.QueryEscape(language.Code))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(audio))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Ocp-Apim-Subscription-Key", f.azure.Key)
+	req.Header.Set("Content-Type", "audio/ogg; codecs=opus")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("Azure request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+
+	res := struct {
+		RecognitionStatus string `json:"RecognitionStatus"`
+		NBest             []struct {
+			Confidence float32 `json:"Confidence"`
+			Display    string  `json:"Display"`
+		} `json:"NBest"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, err
+	}
+
+	result := &RecognizeResult{
+		IsFinal:   true,
+		Stability: 1,
+		Language:  language,
+	}
+	// NoMatch, InitialSilenceTimeout... are returned as an empty transcript
+	if res.RecognitionStatus == "Success" && len(res.NBest) > 0 {
+		result.Text = strings.TrimSpace(res.NBest[0].Display)
+		result.Confidence = res.NBest[0].Confidence
+	}
+	return result, nil
+}
+
+type AzureSynthesizer struct {
+	conf  config.AzureConfig
+	usage *usageMeter
+
+	lock   sync.Mutex
+	voices map[string]string // language code -> voice name
+}
+
+func NewAzureSynthesizer(conf config.AzureConfig, voices map[string]config.VoiceConfig) *AzureSynthesizer {
+	s := &AzureSynthesizer{
+		conf:   conf,
+		voices: make(map[string]string),
+	}
+	s.SetVoices(voices)
+	return s
+}
+
+// The name of the voices is the Azure voice name, the gender is ignored
+func (s *AzureSynthesizer) SetVoices(voices map[string]config.VoiceConfig) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for code, voice := range voices {
+		if voice.Name != "" {
+			s.voices[code] = voice.Name
+		}
+	}
+}
+
+func (s *AzureSynthesizer) SetUsageMeter(usage *usageMeter) {
+	s.usage = usage
+}
+
+func (s *AzureSynthesizer) voice(language *Language) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if voice, ok := s.voices[language.Code]; ok {
+		return voice
+	}
+	return s.conf.Voice
+}
+
+func (s *AzureSynthesizer) Synthesize(ctx context.Context, text string, language *Language) ([]byte, error) {
+	resp, err := s.request(ctx, text, language)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	audio, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(audio) == 0 {
+		return nil, errors.New("no audio returned by Azure")
+	}
+
+	s.usage.Add(usage_TTSCharacters, float64(utf8.RuneCountInString(text)))
+	return audio, nil
+}
+
+// Azure sends the audio while it is synthesized (chunked response)
+func (s *AzureSynthesizer) SynthesizeStream(ctx context.Context, text string, language *Language) (io.ReadCloser, error) {
+	resp, err := s.request(ctx, text, language)
+	if err != nil {
+		return nil, err
+	}
+
+	s.usage.Add(usage_TTSCharacters, float64(utf8.RuneCountInString(text)))
+	return resp.Body, nil
+}
+
+// The body of the response must be closed
+func (s *AzureSynthesizer) request(ctx context.Context, text string, language *Language) (*http.Response, error) {
+	var escaped bytes.Buffer
+	if err := xml.EscapeText(&escaped, []byte(text)); err != nil {
+		return nil, err
+	}
+	// The lang element makes the multilingual voices speak the language
+	ssml := fmt.Sprintf("<speak version='1.0' xmlns='http://www.w3.org/2001/10/synthesis' xml:lang='%s'>"+
+		"<voice name='%s'><lang xml:lang='%s'>%s</lang></voice></speak>",
+		language.Code, s.voice(language), language.Code, escaped.String())
+
+	u := fmt.Sprintf("https://%s.tts.speech.microsoft.com/cognitiveservices/v1", s.conf.Region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, strings.NewReader(ssml))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Ocp-Apim-Subscription-Key", s.conf.Key)
+	req.Header.Set("Content-Type", "application/ssml+xml")
+	req.Header.Set("X-Microsoft-OutputFormat", azureOutputFormat)
+	req.Header.Set("User-Agent", BotIdentity)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("Azure request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
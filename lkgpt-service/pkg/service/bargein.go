@@ -0,0 +1,102 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+	lksdk "github.com/livekit/server-sdk-go"
+)
+
+// Barge-in: KITT stops mid-sentence when the participant it is answering starts speaking.
+// The track is cleared and the synthesis in flight is canceled, the participant is then
+// activated so what they said is answered. The stop command does the same without the activation
+
+const (
+	bargeIn_Transcript    = "transcript"     // Interim or final transcript of the participant
+	bargeIn_ActiveSpeaker = "active_speaker" // LiveKit detected the participant speaking (VAD)
+)
+
+// Answer being spoken, see GPTParticipant.answer
+type currentAnswer struct {
+	sid     string
+	cancel  context.CancelFunc // Synthesis of the sentences
+	stopped atomic.Bool
+}
+
+// Returns false when the answer was already stopped
+func (a *currentAnswer) stop() bool {
+	if !a.stopped.CompareAndSwap(false, true) {
+		return false
+	}
+	a.cancel()
+	return true
+}
+
+func (p *GPTParticipant) setCurrentAnswer(current *currentAnswer) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.current = current
+}
+
+// Returns true when the last answer to rp was stopped by a barge-in, the flag is cleared either way
+func (p *GPTParticipant) takeBargeIn(rp *lksdk.RemoteParticipant) bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	bargedIn := p.bargedIn == rp.SID()
+	p.bargedIn = ""
+	return bargedIn
+}
+
+func (p *GPTParticipant) bargeIn(rp *lksdk.RemoteParticipant, source string) {
+	if !p.conf.BargeIn.Enabled {
+		return
+	}
+
+	p.lock.Lock()
+	current := p.current
+	if current == nil || current.sid != rp.SID() || !current.stop() {
+		p.lock.Unlock()
+		return
+	}
+	p.bargedIn = rp.SID()
+	p.lock.Unlock()
+
+	discarded := p.gptTrack.Clear()
+	logger.Debugw("barge-in, stopped the answer", "participant", rp.SID(), "source", source, "discarded", discarded)
+}
+
+// Stop the answer being spoken if any and clear the track (greeting, refusals...), returns the audio discarded
+func (p *GPTParticipant) stopSpeaking() time.Duration {
+	p.lock.Lock()
+	current := p.current
+	p.lock.Unlock()
+
+	if current != nil {
+		current.stop()
+	}
+	return p.gptTrack.Clear()
+}
+
+// Interim transcripts shorter than BargeIn.MinWords are ignored ("ok", "mhm")
+func (p *GPTParticipant) transcriptBargeIn(result RecognizeResult, rp *lksdk.RemoteParticipant) {
+	if len(strings.Fields(result.Text)) < p.conf.BargeIn.MinWords {
+		return
+	}
+	p.bargeIn(rp, bargeIn_Transcript)
+}
+
+func (p *GPTParticipant) activeSpeakersChanged(speakers []lksdk.Participant) {
+	if !p.conf.BargeIn.ActiveSpeaker {
+		return
+	}
+
+	for _, speaker := range speakers {
+		if rp, ok := speaker.(*lksdk.RemoteParticipant); ok {
+			p.bargeIn(rp, bargeIn_ActiveSpeaker)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+	storage "google.golang.org/api/storage/v1"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+	"github.com/livekit-examples/livegpt/pkg/store"
+)
+
+const (
+	StorageProvider_Local = "local"
+	StorageProvider_S3    = "s3"
+	StorageProvider_GCS   = "gcs"
+
+	storageTimeout = 30 * time.Second
+)
+
+// Files produced by KITT (captions, meeting summaries, debug audio)
+// Keys are slash-separated paths, e.g "captions/room_RM_xxx.vtt"
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) ([]byte, error) // store.ErrNotFound when the key doesn't exist
+}
+
+// gcpCred is used by the GCS backend
+func NewBlobStore(ctx context.Context, conf config.StorageConfig, gcpCred option.ClientOption) (BlobStore, error) {
+	switch conf.Provider {
+	case StorageProvider_Local:
+		if err := os.MkdirAll(conf.Local.Dir, 0755); err != nil {
+			return nil, err
+		}
+		return &localBlobStore{dir: conf.Local.Dir}, nil
+	case StorageProvider_S3:
+		s := &s3BlobStore{conf: conf.S3}
+		if s.conf.AccessKey == "" {
+			s.conf.AccessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+			s.conf.SecretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+			s.sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		}
+		if s.conf.Endpoint == "" {
+			s.conf.Endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", s.conf.Region)
+		}
+		return s, nil
+	case StorageProvider_GCS:
+		svc, err := storage.NewService(ctx, gcpCred)
+		if err != nil {
+			return nil, err
+		}
+		return &gcsBlobStore{bucket: conf.GCS.Bucket, svc: svc}, nil
+	default:
+		return nil, fmt.Errorf("unknown storage provider: %s", conf.Provider)
+	}
+}
+
+type localBlobStore struct {
+	dir string
+}
+
+func (s *localBlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+func (s *localBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if os.IsNotExist(err) {
+		return nil, store.ErrNotFound
+	}
+	return data, err
+}
+
+type gcsBlobStore struct {
+	bucket string
+	svc    *storage.Service
+}
+
+func (s *gcsBlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	object := &storage.Object{
+		Name:        key,
+		ContentType: contentType,
+	}
+	_, err := s.svc.Objects.Insert(s.bucket, object).Media(bytes.NewReader(data)).Context(ctx).Do()
+	return err
+}
+
+func (s *gcsBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := s.svc.Objects.Get(s.bucket, key).Context(ctx).Download()
+	if err != nil {
+		var apiErr *googleapi.Error
+		if errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound {
+			return nil, store.ErrNotFound
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// Path-style PUT requests signed with AWS Signature Version 4
+type s3BlobStore struct {
+	conf         config.S3Config
+	sessionToken string
+}
+
+func (s *s3BlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path := "/" + s.conf.Bucket + "/" + s3Escape(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, strings.TrimSuffix(s.conf.Endpoint, "/")+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	s.sign(req, path, data, time.Now())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("s3 returned %s: %s", resp.Status, body)
+	}
+	return nil
+}
+
+func (s *s3BlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	path := "/" + s.conf.Bucket + "/" + s3Escape(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(s.conf.Endpoint, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	s.sign(req, path, nil, time.Now())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, store.ErrNotFound
+	}
+	if resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("s3 returned %s: %s", resp.Status, body)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (s *s3BlobStore) sign(req *http.Request, path string, payload []byte, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	payloadHash := sha256Hex(payload)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.sessionToken)
+	}
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, payloadHash, amzDate)
+	if s.sessionToken != "" {
+		signedHeaders += ";x-amz-security-token"
+		canonicalHeaders += fmt.Sprintf("x-amz-security-token:%s\n", s.sessionToken)
+	}
+
+	canonicalRequest := strings.Join([]string{req.Method, path, "", canonicalHeaders, signedHeaders, payloadHash}, "\n")
+	scope := fmt.Sprintf("%s/%s/s3/aws4_request", date, s.conf.Region)
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.conf.SecretKey), date)
+	key = hmacSHA256(key, s.conf.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.conf.AccessKey, scope, signedHeaders, signature))
+}
+
+// URI-encode every byte except the unreserved characters and the slashes
+func s3Escape(key string) string {
+	var sb strings.Builder
+	for _, b := range []byte(key) {
+		if b >= 'A' && b <= 'Z' || b >= 'a' && b <= 'z' || b >= '0' && b <= '9' ||
+			b == '-' || b == '_' || b == '.' || b == '~' || b == '/' {
+			sb.WriteByte(b)
+		} else {
+			sb.WriteString(fmt.Sprintf("%%%02X", b))
+		}
+	}
+	return sb.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
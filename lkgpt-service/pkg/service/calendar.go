@@ -0,0 +1,128 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+type CalendarInvitee struct {
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+}
+
+// Calendar event the room has been scheduled for
+type CalendarEvent struct {
+	Title    string            `json:"title"`
+	Agenda   string            `json:"agenda,omitempty"`
+	Start    time.Time         `json:"start"`
+	End      time.Time         `json:"end"`
+	Invitees []CalendarInvitee `json:"invitees,omitempty"`
+}
+
+type RoomMetadata struct {
+	Calendar *CalendarEvent                `json:"calendar,omitempty"`
+	Agenda   *Agenda                       `json:"agenda,omitempty"`
+	Voices   map[string]config.VoiceConfig `json:"voices,omitempty"` // Language code -> voice
+
+	ReplyLanguage string `json:"replyLanguage,omitempty"` // Code of the language of every answer, see ReplyConfig.Language
+}
+
+func parseRoomMetadata(metadata string) RoomMetadata {
+	m := RoomMetadata{}
+	if metadata != "" {
+		if err := json.Unmarshal([]byte(metadata), &m); err != nil {
+			logger.Warnw("error unmarshalling room metadata", err)
+		}
+	}
+	return m
+}
+
+// Injected in the system prompt so KITT knows what the meeting is about
+func (e *CalendarEvent) prompt() string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("The meeting is scheduled in the calendar as \"%s\"", e.Title))
+	if !e.Start.IsZero() {
+		sb.WriteString(fmt.Sprintf(", from %s", e.Start.Format("January 2, 2006 3:04pm")))
+		if !e.End.IsZero() {
+			sb.WriteString(fmt.Sprintf(" to %s", e.End.Format("3:04pm")))
+		}
+	}
+	sb.WriteString(". ")
+
+	if e.Agenda != "" {
+		sb.WriteString(fmt.Sprintf("Agenda: %s ", e.Agenda))
+	}
+
+	if len(e.Invitees) > 0 {
+		names := make([]string, 0, len(e.Invitees))
+		for _, invitee := range e.Invitees {
+			if invitee.Name != "" {
+				names = append(names, invitee.Name)
+			} else {
+				names = append(names, invitee.Email)
+			}
+		}
+		sb.WriteString(fmt.Sprintf("Invitees: %s. ", strings.Join(names, ", ")))
+	}
+	return sb.String()
+}
+
+func (p *GPTParticipant) CalendarEvent() *CalendarEvent {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.calendar
+}
+
+func (p *GPTParticipant) SetCalendarEvent(event *CalendarEvent) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.calendar = event
+}
+
+func (p *GPTParticipant) roomMetadataChanged(metadata string) {
+	m := parseRoomMetadata(metadata)
+	if m.Calendar != nil {
+		p.SetCalendarEvent(m.Calendar)
+	}
+	if m.Agenda != nil {
+		p.SetAgenda(m.Agenda)
+	}
+	if len(m.Voices) > 0 {
+		p.synthesizer.SetVoices(m.Voices)
+	}
+	if m.ReplyLanguage != "" {
+		p.setReplyLanguage(m.ReplyLanguage)
+	}
+}
+
+// GET/PUT /rooms/{room}/calendar
+// Links the room to a calendar event, used by the scheduling integrations when the event isn't in the room metadata
+func (s *LiveGPT) roomCalendarHandler(w http.ResponseWriter, req *http.Request, p *GPTParticipant) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(p.CalendarEvent())
+	case http.MethodPut:
+		event := &CalendarEvent{}
+		if err := json.NewDecoder(req.Body).Decode(event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		p.SetCalendarEvent(event)
+		s.audit(req, "calendar_updated", p.room.Name(), event.Title)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
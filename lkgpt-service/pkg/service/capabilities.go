@@ -0,0 +1,91 @@
+package service
+
+import (
+	"sort"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+)
+
+// Features listed in the capabilities packet, the frontends adapt their UI instead of guessing the deployment
+const (
+	feature_Captions     = "captions"      // Transcript packets
+	feature_ReadAlong    = "read_along"    // Speaking packets
+	feature_CaptionFiles = "caption_files" // VTT/SRT files written to the storage
+	feature_Alignment    = "alignment"     // Transcript aligned to the recordings, written to the storage
+	feature_Notes        = "notes"         // Notes packets (notes mode)
+	feature_Agenda       = "agenda"        // Agenda checkpoints (facilitator mode)
+	feature_Chat         = "chat"          // Answers mirrored in the LiveKit chat
+	feature_ChatPrompts  = "chat_prompts"  // Messages mentioning @KITT are answered
+	feature_Memory       = "memory"
+	feature_Escalation   = "escalation"
+	feature_TurnTaking   = "turn_taking"
+	feature_Polls        = "polls"
+	feature_Citations    = "citations" // Citations packets
+	feature_Progress     = "progress"  // Progress packets of the tool calls
+)
+
+func (p *GPTParticipant) capabilities() *capabilitiesPacket {
+	behavior := p.currentBehavior()
+	caps := &capabilitiesPacket{
+		Mode:     p.conf.Mode,
+		Behavior: behavior,
+		Features: []string{feature_Captions},
+		Commands: []string{},
+		Signals:  []string{},
+	}
+	if caps.Mode == "" {
+		caps.Mode = Mode_Assistant
+	}
+
+	add := func(enabled bool, feature string) {
+		if enabled {
+			caps.Features = append(caps.Features, feature)
+		}
+	}
+	add(!p.isNoteTaker(), feature_ReadAlong)
+	add(p.conf.Captions.Enabled, feature_CaptionFiles)
+	add(p.conf.Alignment.Enabled, feature_Alignment)
+	add(p.isNoteTaker(), feature_Notes)
+	add(p.isFacilitator(), feature_Agenda)
+	add(p.conf.Chat.Enabled, feature_Chat)
+	add((p.conf.Chat.Prompts || p.isChatOnly()) && !p.isNoteTaker(), feature_ChatPrompts)
+	add(p.conf.Memory.Enabled, feature_Memory)
+	add(p.conf.Escalation.Enabled, feature_Escalation)
+	add(p.conf.TurnTaking.Enabled, feature_TurnTaking)
+	add(p.conf.Polls.Enabled && !p.isNoteTaker(), feature_Polls)
+	add(p.conf.Citations.Enabled, feature_Citations)
+	add(p.conf.Progress.Enabled && !p.tools.Empty(), feature_Progress)
+
+	if p.conf.Join.Behavior == JoinBehavior_Command {
+		caps.Commands = append(caps.Commands, command_Start)
+	}
+	if !p.isNoteTaker() && behavior != RoomBehavior_Captions {
+		caps.Commands = append(caps.Commands, command_Activate, command_Stop, command_Repeat)
+	}
+	caps.Commands = append(caps.Commands, command_ResetContext, command_ChangeLanguage)
+	if p.conf.TurnTaking.Enabled {
+		caps.Signals = append(caps.Signals, signal_Typing, signal_PushToTalk, signal_HandRaised)
+	}
+
+	for code := range Languages {
+		caps.Languages = append(caps.Languages, code)
+	}
+	sort.Strings(caps.Languages)
+	return caps
+}
+
+// Sent to everyone when KITT joins, then to each participant joining
+func (p *GPTParticipant) sendCapabilities(sids ...string) {
+	if p.room == nil {
+		return // Still connecting, they're sent to everyone once connected
+	}
+
+	pkt := &packet{
+		Type: packet_Capabilities,
+		Data: p.capabilities(),
+	}
+	if err := publishPacket(p.room.LocalParticipant, pkt, livekit.DataPacket_RELIABLE, sids); err != nil {
+		logger.Errorw("failed to send the capabilities", err, "room", p.room.Name())
+	}
+}
@@ -0,0 +1,217 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+const (
+	CaptionsFormatVTT = "vtt"
+	CaptionsFormatSRT = "srt"
+
+	estimatedWordDuration = 400 * time.Millisecond // Used when the STT didn't provide the word offsets
+)
+
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+type captionCue struct {
+	Start   time.Duration // Relative to the start of the room
+	End     time.Duration
+	Speaker string
+	Text    string
+}
+
+// captionsSink builds the WebVTT/SRT files from the final transcripts of a room while the meeting progresses,
+// they are uploaded to the storage when the sink is closed
+type captionsSink struct {
+	conf      config.CaptionsConfig
+	store     BlobStore
+	base      string // Key of the files, without the extension
+	roomStart time.Time
+
+	lock     sync.Mutex
+	files    map[string]*bytes.Buffer
+	srtIndex int
+}
+
+func newCaptionsSink(conf config.CaptionsConfig, store BlobStore, roomName, roomSid string, roomStart time.Time) (*captionsSink, error) {
+	s := &captionsSink{
+		conf:      conf,
+		store:     store,
+		base:      fmt.Sprintf("%s/%s_%s", strings.Trim(conf.Dir, "/"), sanitizeFilename(roomName), roomSid),
+		roomStart: roomStart,
+		files:     make(map[string]*bytes.Buffer),
+	}
+
+	for _, format := range conf.Formats {
+		if format != CaptionsFormatVTT && format != CaptionsFormatSRT {
+			return nil, fmt.Errorf("unknown captions format: %s", format)
+		}
+
+		f := &bytes.Buffer{}
+		if format == CaptionsFormatVTT {
+			f.WriteString("WEBVTT\n\n")
+		}
+		s.files[format] = f
+	}
+
+	return s, nil
+}
+
+func (s *captionsSink) HandleEvent(event *RoomEvent) {
+	if mute, ok := event.Data.(*MuteEvent); ok {
+		s.writeMuteNote(mute, event.Time)
+		return
+	}
+
+	transcript, ok := event.Data.(*TranscriptEvent)
+	if !ok || !transcript.IsFinal || strings.TrimSpace(transcript.Text) == "" {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, cue := range s.buildCues(transcript, event.Time) {
+		for format, f := range s.files {
+			var err error
+			switch format {
+			case CaptionsFormatVTT:
+				_, err = fmt.Fprintf(f, "%s --> %s\n<v %s>%s\n\n",
+					formatCueTime(cue.Start, "."), formatCueTime(cue.End, "."), vttEscaper.Replace(cue.Speaker), vttEscaper.Replace(cue.Text))
+			case CaptionsFormatSRT:
+				s.srtIndex++
+				_, err = fmt.Fprintf(f, "%d\n%s --> %s\n%s: %s\n\n",
+					s.srtIndex, formatCueTime(cue.Start, ","), formatCueTime(cue.End, ","), cue.Speaker, cue.Text)
+			}
+
+			if err != nil {
+				logger.Errorw("failed to write caption cue", err, "room", event.Room, "format", format)
+			}
+		}
+	}
+}
+
+// WebVTT comment, not displayed by the players (SRT has no comments)
+func (s *captionsSink) writeMuteNote(mute *MuteEvent, at time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	f, ok := s.files[CaptionsFormatVTT]
+	if !ok {
+		return
+	}
+
+	action := "unmuted"
+	if mute.Muted {
+		action = "muted"
+	}
+	name := strings.NewReplacer("-->", "->", "\n", " ").Replace(mute.ParticipantName) // Would end the note
+	fmt.Fprintf(f, "NOTE %s %s %s their microphone\n\n", formatCueTime(at.Sub(s.roomStart), "."), name, action)
+}
+
+// Split a final transcript into cues of at most MaxCueWords words and MaxCueDuration
+func (s *captionsSink) buildCues(transcript *TranscriptEvent, receivedAt time.Time) []captionCue {
+	words := transcriptWords(transcript, receivedAt)
+
+	var cues []captionCue
+	var current []string
+	var cueStart, cueEnd time.Time
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		cues = append(cues, captionCue{
+			Start:   s.relative(cueStart),
+			End:     s.relative(cueEnd),
+			Speaker: transcript.ParticipantName,
+			Text:    strings.Join(current, " "),
+		})
+		current = nil
+	}
+
+	for _, w := range words {
+		if len(current) > 0 && (len(current) >= s.conf.MaxCueWords || w.End.Sub(cueStart) > s.conf.MaxCueDuration) {
+			flush()
+		}
+
+		if len(current) == 0 {
+			cueStart = w.Start
+		}
+		current = append(current, w.Word)
+		cueEnd = w.End
+	}
+	flush()
+
+	return cues
+}
+
+// Words of the transcript, the timing is estimated from the time the transcript was received when the STT didn't provide the word offsets
+func transcriptWords(transcript *TranscriptEvent, receivedAt time.Time) []RecognizedWord {
+	if len(transcript.Words) > 0 {
+		return transcript.Words
+	}
+
+	fields := strings.Fields(transcript.Text)
+	start := receivedAt.Add(-time.Duration(len(fields)) * estimatedWordDuration)
+	words := make([]RecognizedWord, 0, len(fields))
+	for i, w := range fields {
+		words = append(words, RecognizedWord{
+			Word:  w,
+			Start: start.Add(time.Duration(i) * estimatedWordDuration),
+			End:   start.Add(time.Duration(i+1) * estimatedWordDuration),
+		})
+	}
+	return words
+}
+
+func (s *captionsSink) relative(t time.Time) time.Duration {
+	d := t.Sub(s.roomStart)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+func (s *captionsSink) Close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	for format, f := range s.files {
+		contentType := "text/vtt"
+		if format == CaptionsFormatSRT {
+			contentType = "application/x-subrip"
+		}
+
+		if err := s.store.Put(ctx, s.base+"."+format, f.Bytes(), contentType); err != nil {
+			logger.Errorw("failed to store the captions", err, "key", s.base, "format", format)
+		}
+	}
+	s.files = map[string]*bytes.Buffer{}
+}
+
+// HH:MM:SS.mmm (WebVTT) or HH:MM:SS,mmm (SRT)
+func formatCueTime(d time.Duration, msSeparator string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, (ms/60000)%60, (ms/1000)%60, msSeparator, ms%1000)
+}
+
+func sanitizeFilename(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' || r == 0 {
+			return '_'
+		}
+		return r
+	}, name)
+}
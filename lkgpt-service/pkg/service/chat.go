@@ -0,0 +1,371 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/utils"
+	lksdk "github.com/livekit/server-sdk-go"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+const (
+	chatSendTimeout = 5 * time.Second
+	chatQueueSize   = 64
+)
+
+var (
+	ChatBusyReply = "Sorry, I'm answering someone else, ask me again in a moment."
+
+	chatMentionRegexp = regexp.MustCompile(`(?i)@kitt\b[\s,:]*`)
+)
+
+// Message of the LiveKit chat components, sending the same id again edits the message
+type chatMessage struct {
+	ID            string `json:"id"`
+	Timestamp     int64  `json:"timestamp"` // Unix time in milliseconds
+	Message       string `json:"message"`
+	EditTimestamp int64  `json:"editTimestamp,omitempty"`
+}
+
+// chatSink mirrors the conversation into the chat topic, so the chat UIs show it without the KITT packets.
+// The data is sent by the server API: it isn't attributed to a participant, the messages are prefixed with the speaker name
+type chatSink struct {
+	conf        config.ChatConfig
+	roomService *lksdk.RoomServiceClient
+	roomName    string
+
+	lock    sync.Mutex
+	answers map[string]*chatMessage // sid of the participant being answered -> message being streamed
+	closed  bool
+	queue   chan *chatMessage
+	done    chan struct{}
+}
+
+func newChatSink(conf config.ChatConfig, roomService *lksdk.RoomServiceClient, roomName string) *chatSink {
+	s := &chatSink{
+		conf:        conf,
+		roomService: roomService,
+		roomName:    roomName,
+		answers:     make(map[string]*chatMessage),
+		queue:       make(chan *chatMessage, chatQueueSize),
+		done:        make(chan struct{}),
+	}
+	go s.sendMessages()
+	return s
+}
+
+func (s *chatSink) HandleEvent(event *RoomEvent) {
+	switch data := event.Data.(type) {
+	case *TranscriptEvent:
+		if s.conf.Transcripts && data.IsFinal && strings.TrimSpace(data.Text) != "" {
+			s.enqueue(&chatMessage{
+				ID:        utils.NewGuid("CM_"),
+				Timestamp: event.Time.UnixMilli(),
+				Message:   fmt.Sprintf("%s: %s", data.ParticipantName, data.Text),
+			})
+		}
+	case *SpeakingEvent:
+		if !s.conf.Stream {
+			return
+		}
+
+		s.lock.Lock()
+		msg := s.answers[data.ParticipantSid]
+		if msg == nil || data.Index == 0 {
+			msg = &chatMessage{
+				ID:        utils.NewGuid("CM_"),
+				Timestamp: data.Start.UnixMilli(),
+				Message:   BotIdentity + ":",
+			}
+			s.answers[data.ParticipantSid] = msg
+		} else {
+			msg.EditTimestamp = data.Start.UnixMilli()
+		}
+		msg.Message += " " + data.Text
+		update := *msg
+		s.lock.Unlock()
+
+		s.enqueue(&update)
+	case *AnswerEvent:
+		s.lock.Lock()
+		_, streamed := s.answers[data.ParticipantSid]
+		delete(s.answers, data.ParticipantSid)
+		s.lock.Unlock()
+
+		// Answers that weren't streamed sentence by sentence (not streaming, refusals, ...)
+		if !streamed && strings.TrimSpace(data.Answer) != "" {
+			s.enqueue(&chatMessage{
+				ID:        utils.NewGuid("CM_"),
+				Timestamp: event.Time.UnixMilli(),
+				Message:   fmt.Sprintf("%s: %s", BotIdentity, data.Answer),
+			})
+		}
+		for _, disclaimer := range data.Disclaimers {
+			s.enqueue(&chatMessage{
+				ID:        utils.NewGuid("CM_"),
+				Timestamp: event.Time.UnixMilli(),
+				Message:   fmt.Sprintf("%s: %s", BotIdentity, disclaimer),
+			})
+		}
+		if len(data.Citations) > 0 {
+			s.enqueue(&chatMessage{
+				ID:        utils.NewGuid("CM_"),
+				Timestamp: event.Time.UnixMilli(),
+				Message:   fmt.Sprintf("%s: %s", BotIdentity, formatCitations(data.Citations)),
+			})
+		}
+	case *FarewellEvent:
+		if data.Message != "" {
+			s.enqueue(&chatMessage{
+				ID:        utils.NewGuid("CM_"),
+				Timestamp: event.Time.UnixMilli(),
+				Message:   fmt.Sprintf("%s: %s", BotIdentity, data.Message),
+			})
+		}
+		if data.Summary != "" {
+			s.enqueue(&chatMessage{
+				ID:        utils.NewGuid("CM_"),
+				Timestamp: event.Time.UnixMilli(),
+				Message:   fmt.Sprintf("%s: Summary of the meeting: %s", BotIdentity, data.Summary),
+			})
+		}
+	case *ChatEvent:
+		if data.ParticipantSid == "" { // The answers are mirrored from their AnswerEvent
+			s.enqueue(&chatMessage{
+				ID:        utils.NewGuid("CM_"),
+				Timestamp: event.Time.UnixMilli(),
+				Message:   fmt.Sprintf("%s: %s", BotIdentity, data.Message),
+			})
+		}
+	}
+}
+
+// The events are published while KITT is speaking, the messages are sent in order by a single goroutine
+func (s *chatSink) enqueue(msg *chatMessage) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return
+	}
+
+	select {
+	case s.queue <- msg:
+	default:
+		logger.Warnw("chat queue full, dropping message", nil, "room", s.roomName)
+	}
+}
+
+func (s *chatSink) sendMessages() {
+	defer close(s.done)
+
+	topic := s.conf.Topic
+	for msg := range s.queue {
+		data, err := json.Marshal(msg)
+		if err != nil {
+			logger.Errorw("failed to marshal the chat message", err)
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), chatSendTimeout)
+		_, err = s.roomService.SendData(ctx, &livekit.SendDataRequest{
+			Room:  s.roomName,
+			Data:  data,
+			Kind:  livekit.DataPacket_RELIABLE,
+			Topic: &topic,
+		})
+		cancel()
+		if err != nil {
+			logger.Errorw("failed to send the chat message", err, "room", s.roomName)
+		}
+	}
+}
+
+// Sends the queued messages before returning
+func (s *chatSink) Close() {
+	s.lock.Lock()
+	s.closed = true
+	close(s.queue)
+	s.lock.Unlock()
+
+	<-s.done
+}
+
+// Chat messages sent by the LiveKit components, the KITT packets never have a message field
+func parseChatMessage(data []byte) (*chatMessage, bool) {
+	msg := &chatMessage{}
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, false
+	}
+	if strings.TrimSpace(msg.Message) == "" || msg.Timestamp == 0 || msg.EditTimestamp != 0 {
+		return nil, false // Edits of the previous messages aren't new prompts
+	}
+	return msg, true
+}
+
+// Returns the message without the mention, false when KITT isn't mentioned
+func chatMention(text string) (string, bool) {
+	if !chatMentionRegexp.MatchString(text) {
+		return "", false
+	}
+	return strings.TrimSpace(chatMentionRegexp.ReplaceAllString(text, "")), true
+}
+
+// Answer the chat messages mentioning @KITT, the reply is sent in the chat by the chatSink (AnswerEvent)
+func (p *GPTParticipant) chatReceived(msg *chatMessage, rp *lksdk.RemoteParticipant) {
+	question, ok := chatMention(msg.Message)
+	if !ok || question == "" {
+		return
+	}
+
+	if p.currentJoinState() != joinState_Listening || p.isNoteTaker() || p.isEscalated() {
+		return
+	}
+
+	prompt := &SpeechEvent{
+		ParticipantName: rp.Identity(),
+		Text:            question,
+	}
+
+	if !p.isBusy.CompareAndSwap(false, true) {
+		p.publishChatAnswer(rp, prompt, botSpeech(ChatBusyReply, false))
+		return
+	}
+
+	events, _ := p.history.AppendWindow(&MeetingEvent{
+		Speech: prompt,
+	}, p.conf.Reply.HistoryTokens)
+
+	go func() {
+		defer p.isBusy.Store(false)
+		defer p.answerFinished()
+		p.recordAnswer(rp)
+		p.setState(state_Loading)
+
+		logger.Debugw("answering chat message", "participant", rp.SID(), "text", question)
+		var answer *SpeechEvent
+		var err error
+		if p.conf.Chat.VoiceReplies {
+			answer, err = p.answer(nil, events, prompt, rp, p.participantLanguage(rp))
+		} else {
+			answer, err = p.answerText(events, prompt, rp, p.participantLanguage(rp))
+		}
+		if errors.Is(err, errFloorTaken) {
+			answer, err = p.answerText(events, prompt, rp, p.participantLanguage(rp)) // Still answered in the chat
+		}
+		p.setState(state_Idle)
+		if err != nil {
+			logger.Errorw("failed to answer chat message", err, "participant", rp.SID(), "text", question)
+			return
+		}
+
+		p.publishChatAnswer(rp, prompt, answer)
+		p.history.Append(&MeetingEvent{
+			Speech: answer,
+		})
+		p.answerWaiting()
+	}()
+}
+
+// Also sent as a chat packet in the chat-only rooms, where the clients may not show the LiveKit chat
+func (p *GPTParticipant) publishChatAnswer(rp *lksdk.RemoteParticipant, prompt *SpeechEvent, answer *SpeechEvent) {
+	p.publishAnswer(rp, prompt, answer)
+	if !p.isChatOnly() || answer.Text == "" {
+		return
+	}
+
+	p.bus.Publish(&RoomEvent{
+		Type: RoomEvent_Chat,
+		Room: p.room.Name(),
+		Data: &ChatEvent{
+			ParticipantSid: rp.SID(),
+			Message:        answer.Text,
+		},
+	})
+}
+
+// Complete without synthesizing the answer
+func (p *GPTParticipant) answerText(events []*MeetingEvent, prompt *SpeechEvent, rp *lksdk.RemoteParticipant, language *Language) (*SpeechEvent, error) {
+	var verdict *PolicyVerdict
+	if needsPolicyCheck(p.conf.Guardrails) {
+		verdict = p.checkPolicy(prompt.Text)
+		if verdict != nil && verdict.DeniedTopic != "" {
+			logger.Infow("chat question denied by the guardrails", "participant", rp.SID(), "topic", verdict.DeniedTopic)
+			return botSpeech(p.conf.Guardrails.Refusal, false), nil
+		}
+	}
+
+	stream, err := p.completion.Complete(p.ctx, events, prompt, rp, p.room, p.replyLanguage(language), p.meetingContext(), p.tools, &ToolContext{Participant: p, Speaker: rp})
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+
+	var sentences []string
+	for {
+		sentence, err := stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, err
+		}
+
+		if !p.pipeline.sentence(p.stageContext(rp.SID(), rp.Identity(), language), sentence) {
+			continue
+		}
+		if text := strings.TrimSpace(sentence.Text); text != "" {
+			sentences = append(sentences, text)
+		}
+	}
+
+	text := strings.Join(sentences, " ")
+	if verdict != nil {
+		text = writtenAnswer(p.conf.Guardrails, verdict, text)
+	}
+	answer := botSpeech(text, false)
+	answer.Citations = p.answerCitations(stream)
+	return answer, nil
+}
+
+func (p *GPTParticipant) publishAnswer(rp *lksdk.RemoteParticipant, prompt *SpeechEvent, answer *SpeechEvent) {
+	p.bus.Publish(&RoomEvent{
+		Type: RoomEvent_Answer,
+		Room: p.room.Name(),
+		Data: &AnswerEvent{
+			ParticipantSid:  rp.SID(),
+			ParticipantName: rp.Identity(),
+			Prompt:          prompt.Text,
+			Answer:          answer.Text,
+			AudioKey:        answer.AudioKey,
+			Disclaimers:     answer.Disclaimers,
+			Citations:       answer.Citations,
+		},
+	})
+}
+
+// Language of the transcriber of rp, the one of its metadata when it isn't transcribed
+func (p *GPTParticipant) participantLanguage(rp *lksdk.RemoteParticipant) *Language {
+	p.lock.Lock()
+	transcriber := p.transcribers[rp.SID()]
+	p.lock.Unlock()
+	if transcriber != nil {
+		return transcriber.Language()
+	}
+
+	if language, ok := Languages[parseParticipantMetadata(rp).LanguageCode]; ok {
+		return language
+	}
+	return p.defaultLanguage()
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+)
+
+// Rooms where nobody publishes a microphone (screen share or camera only) can't talk to KITT: after
+// ChatOnlyConfig.Delay, the chat messages mentioning @KITT are answered and KITT announces it with a chat packet.
+// Back to normal once a microphone is published
+
+const chatOnlyCheckInterval = 5 * time.Second
+
+func (p *GPTParticipant) isChatOnly() bool {
+	return p.chatOnly.Load()
+}
+
+func (p *GPTParticipant) watchChatOnly() {
+	ticker := time.NewTicker(chatOnlyCheckInterval)
+	defer ticker.Stop()
+
+	var since time.Time // First check without any microphone
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if len(p.room.GetParticipants()) == 0 || p.hasMicrophones() {
+			since = time.Time{}
+			if p.chatOnly.CompareAndSwap(true, false) {
+				p.chatOnlyChanged(false)
+			}
+			continue
+		}
+
+		if since.IsZero() {
+			since = time.Now()
+		}
+		if time.Since(since) >= p.conf.ChatOnly.Delay && p.chatOnly.CompareAndSwap(false, true) {
+			p.chatOnlyChanged(true)
+		}
+	}
+}
+
+// Muted microphones count, their participants can unmute them
+func (p *GPTParticipant) hasMicrophones() bool {
+	for _, rp := range p.room.GetParticipants() {
+		for _, publication := range rp.Tracks() {
+			if publication.Source() == livekit.TrackSource_MICROPHONE {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *GPTParticipant) chatOnlyChanged(chatOnly bool) {
+	logger.Infow("chat-only interaction changed", "room", p.room.Name(), "chatOnly", chatOnly)
+	p.sendCapabilities() // feature_ChatPrompts
+
+	if chatOnly && p.conf.ChatOnly.Announcement != "" {
+		p.bus.Publish(&RoomEvent{
+			Type: RoomEvent_Chat,
+			Room: p.room.Name(),
+			Data: &ChatEvent{
+				Message: p.conf.ChatOnly.Announcement,
+			},
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/utils"
+	lksdk "github.com/livekit/server-sdk-go"
+)
+
+// Packets larger than a datachannel message are split in chunk packets, sent in order on the reliable channel.
+// The receivers concatenate the Data of the chunks and decode the result as a packet
+
+const (
+	maxPacketSize = 15 * 1024 // The SCTP messages of some browsers are limited to 16KiB
+	chunkSize     = 10 * 1024 // Bytes of the packet per chunk, base64 grows them by a third
+
+	maxChunkedSize    = 1 << 20 // Largest packet reassembled from the chunks of a client
+	maxPendingChunked = 4       // Packets being reassembled per participant, the oldest one is dropped
+	chunkTimeout      = 30 * time.Second
+)
+
+var (
+	errInvalidChunk  = errors.New("invalid chunk")
+	errChunkTooLarge = errors.New("chunked packet too large")
+)
+
+// Marshal the packet, in several messages when it is too large
+func encodePacket(pkt *packet) ([][]byte, error) {
+	data, err := json.Marshal(pkt)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) <= maxPacketSize {
+		return [][]byte{data}, nil
+	}
+
+	id := utils.NewGuid("PC_")
+	count := (len(data) + chunkSize - 1) / chunkSize
+	messages := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * chunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+
+		chunk, err := json.Marshal(&packet{
+			Type: packet_Chunk,
+			Data: &chunkPacket{
+				ID:    id,
+				Index: i,
+				Count: count,
+				Size:  len(data),
+				Data:  data[i*chunkSize : end],
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, chunk)
+	}
+	return messages, nil
+}
+
+// Send the packet to sids (everyone when empty), the chunks of a large packet are always reliable
+func publishPacket(lp *lksdk.LocalParticipant, pkt *packet, kind livekit.DataPacket_Kind, sids []string) error {
+	messages, err := encodePacket(pkt)
+	if err != nil {
+		packetErrorsTotal.WithLabelValues(packetDirection_Send).Inc()
+		return err
+	}
+	if len(messages) > 1 {
+		kind = livekit.DataPacket_RELIABLE
+	}
+
+	for _, msg := range messages {
+		if err := lp.PublishData(msg, kind, sids); err != nil {
+			packetErrorsTotal.WithLabelValues(packetDirection_Send).Inc()
+			return err
+		}
+	}
+	return nil
+}
+
+type pendingPacket struct {
+	sid      string
+	id       string
+	size     int
+	parts    [][]byte
+	received int // Bytes received
+	started  time.Time
+}
+
+// chunkAssembler reassembles the chunked packets sent by the clients
+type chunkAssembler struct {
+	lock    sync.Mutex
+	pending []*pendingPacket // Oldest first
+}
+
+// Returns the packet once its last chunk is received, nil meanwhile
+func (a *chunkAssembler) add(sid string, chunk *chunkPacket) ([]byte, error) {
+	if chunk.ID == "" || chunk.Count <= 0 || chunk.Index < 0 || chunk.Index >= chunk.Count || chunk.Size <= 0 {
+		return nil, errInvalidChunk
+	}
+	if chunk.Size > maxChunkedSize {
+		return nil, errChunkTooLarge
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.expire(time.Now())
+
+	var p *pendingPacket
+	count := 0
+	for _, pending := range a.pending {
+		if pending.sid != sid {
+			continue
+		}
+		count++
+		if pending.id == chunk.ID {
+			p = pending
+		}
+	}
+
+	if p == nil {
+		if count >= maxPendingChunked {
+			a.dropOldest(sid)
+		}
+		p = &pendingPacket{
+			sid:     sid,
+			id:      chunk.ID,
+			size:    chunk.Size,
+			parts:   make([][]byte, chunk.Count),
+			started: time.Now(),
+		}
+		a.pending = append(a.pending, p)
+	}
+
+	if len(p.parts) != chunk.Count || p.size != chunk.Size {
+		a.remove(p)
+		return nil, errInvalidChunk
+	}
+	if p.parts[chunk.Index] != nil {
+		return nil, nil // Duplicate
+	}
+
+	p.received += len(chunk.Data)
+	if p.received > p.size {
+		a.remove(p)
+		return nil, errInvalidChunk
+	}
+	p.parts[chunk.Index] = chunk.Data
+
+	for _, part := range p.parts {
+		if part == nil {
+			return nil, nil
+		}
+	}
+
+	a.remove(p)
+	data := make([]byte, 0, p.size)
+	for _, part := range p.parts {
+		data = append(data, part...)
+	}
+	return data, nil
+}
+
+// Drop the packets of a participant who left
+func (a *chunkAssembler) forget(sid string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	pending := a.pending[:0]
+	for _, p := range a.pending {
+		if p.sid != sid {
+			pending = append(pending, p)
+		}
+	}
+	a.pending = pending
+}
+
+func (a *chunkAssembler) expire(now time.Time) {
+	pending := a.pending[:0]
+	for _, p := range a.pending {
+		if now.Sub(p.started) < chunkTimeout {
+			pending = append(pending, p)
+		}
+	}
+	a.pending = pending
+}
+
+func (a *chunkAssembler) dropOldest(sid string) {
+	for _, p := range a.pending {
+		if p.sid == sid {
+			a.remove(p)
+			return
+		}
+	}
+}
+
+func (a *chunkAssembler) remove(p *pendingPacket) {
+	for i, pending := range a.pending {
+		if pending == p {
+			a.pending = append(a.pending[:i], a.pending[i+1:]...)
+			return
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The tools grounding the answers in documents or search results (e.g a retrieval plugin) report their
+// sources with ToolContext.Cite. They are numbered in the tool result so the model can attribute them,
+// then sent with the answer: citations packet, chat message and answer events
+
+// Source of an answer
+type Citation struct {
+	Title   string `json:"title"`
+	Url     string `json:"url,omitempty"`
+	Snippet string `json:"snippet,omitempty"` // Excerpt the answer relies on
+}
+
+// Report the sources of the result of the current tool call, the duplicates are ignored
+func (tc *ToolContext) Cite(citations ...*Citation) {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+
+	for _, c := range citations {
+		if c == nil || (c.Title == "" && c.Url == "") {
+			continue
+		}
+		if tc.citationIndex(c) >= 0 {
+			continue
+		}
+		citation := *c
+		tc.citations = append(tc.citations, &citation)
+	}
+}
+
+// Sources cited during the answer, in the order they were reported
+func (tc *ToolContext) Citations() []*Citation {
+	if tc == nil {
+		return nil
+	}
+
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+
+	citations := make([]*Citation, len(tc.citations))
+	copy(citations, tc.citations)
+	return citations
+}
+
+// The caller must hold the lock
+func (tc *ToolContext) citationIndex(c *Citation) int {
+	for i, citation := range tc.citations {
+		if (c.Url != "" && citation.Url == c.Url) || (c.Url == "" && citation.Url == "" && strings.EqualFold(citation.Title, c.Title)) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (tc *ToolContext) citationCount() int {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+	return len(tc.citations)
+}
+
+// List the sources cited since from at the end of the tool result
+func (tc *ToolContext) appendSources(result string, from int) string {
+	citations := tc.Citations()
+	if from >= len(citations) || tc.Participant == nil || !tc.Participant.conf.Citations.Enabled {
+		return result
+	}
+
+	var sb strings.Builder
+	sb.WriteString(result)
+	sb.WriteString("\n\nSources:\n")
+	for i := from; i < len(citations); i++ {
+		sb.WriteString(fmt.Sprintf("[%d] %s", i+1, citations[i].Title))
+		if citations[i].Url != "" {
+			sb.WriteString(" - " + citations[i].Url)
+		}
+		sb.WriteString("\n")
+	}
+	if tc.Participant.conf.Citations.Spoken {
+		sb.WriteString("Name the sources your answer relies on, e.g \"according to <title>\", never read the URLs.")
+	}
+	return sb.String()
+}
+
+// Sources sent with the answer, nil when the citations are disabled
+func (p *GPTParticipant) answerCitations(stream *ChatStream) []*Citation {
+	if !p.conf.Citations.Enabled || stream == nil {
+		return nil
+	}
+
+	citations := stream.toolCtx.Citations()
+	if max := p.conf.Citations.MaxCitations; max > 0 && len(citations) > max {
+		citations = citations[:max]
+	}
+	return citations
+}
+
+// Single line listing the sources, for the chat
+func formatCitations(citations []*Citation) string {
+	parts := make([]string, 0, len(citations))
+	for i, c := range citations {
+		if c.Url != "" {
+			parts = append(parts, fmt.Sprintf("[%d] %s (%s)", i+1, c.Title, c.Url))
+		} else {
+			parts = append(parts, fmt.Sprintf("[%d] %s", i+1, c.Title))
+		}
+	}
+	return "Sources: " + strings.Join(parts, ", ")
+}
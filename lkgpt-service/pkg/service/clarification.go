@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go"
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// Clarifying questions: when a request is ambiguous, KITT asks a question with the ask_clarification tool.
+// The question is pending for the participant who asked the request (unlike the activation, it survives
+// the other participants speaking), their next sentence is answered as the clarification without any wake word
+
+type clarification struct {
+	question  string
+	request   string // What the participant asked, as understood by KITT
+	turns     int    // Clarifying questions asked in a row for the request
+	expiresAt time.Time
+}
+
+// Pending questions, per participant sid
+type clarifications struct {
+	lock    sync.Mutex
+	pending map[string]*clarification
+}
+
+func (c *clarifications) set(sid string, question *clarification) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.pending == nil {
+		c.pending = make(map[string]*clarification)
+	}
+	c.pending[sid] = question
+}
+
+// nil when there's no question pending for sid
+func (c *clarifications) get(sid string) *clarification {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	question, ok := c.pending[sid]
+	if !ok {
+		return nil
+	}
+	if time.Now().After(question.expiresAt) {
+		delete(c.pending, sid)
+		return nil
+	}
+	return question
+}
+
+// Remove the pending question of sid, nil when there's none
+func (c *clarifications) take(sid string) *clarification {
+	question := c.get(sid)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.pending, sid)
+	return question
+}
+
+func (c *clarifications) forget(sid string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.pending, sid)
+}
+
+func (c *clarification) prompt(participantName string) string {
+	return fmt.Sprintf("%s is answering your clarifying question \"%s\" about their request: %s",
+		participantName, c.question, c.request)
+}
+
+// True when the next final transcript of rp is the answer to a clarifying question
+func (p *GPTParticipant) awaitsClarification(rp *lksdk.RemoteParticipant) bool {
+	return p.clarifications.get(rp.SID()) != nil
+}
+
+type askClarificationTool struct {
+	conf config.ClarificationConfig
+}
+
+func (t *askClarificationTool) Definition() *openai.FunctionDefinition {
+	return &openai.FunctionDefinition{
+		Name: "ask_clarification",
+		Description: "Ask the participant a clarifying question when their request is ambiguous, instead of guessing. " +
+			"Their next sentence is routed to you as the answer, even if other participants are talking.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"question": map[string]interface{}{
+					"type":        "string",
+					"description": "The clarifying question, as you will say it",
+				},
+				"request": map[string]interface{}{
+					"type":        "string",
+					"description": "Short summary of what the participant asked",
+				},
+			},
+			"required": []string{"question", "request"},
+		},
+	}
+}
+
+func (t *askClarificationTool) Call(ctx context.Context, tc *ToolContext, arguments string) (string, error) {
+	args := struct {
+		Question string `json:"question"`
+		Request  string `json:"request"`
+	}{}
+	if err := parseToolArguments(arguments, &args); err != nil {
+		return "", err
+	}
+
+	question := strings.TrimSpace(args.Question)
+	if question == "" {
+		return "", errors.New("question is required")
+	}
+	if tc.Speaker == nil {
+		return "", errors.New("there is no participant to ask")
+	}
+
+	turns := 1
+	request := strings.TrimSpace(args.Request)
+	if previous := tc.clarification; previous != nil {
+		turns = previous.turns + 1
+		request = previous.request
+	}
+	if t.conf.MaxQuestions > 0 && turns > t.conf.MaxQuestions {
+		return fmt.Sprintf("You already asked %d clarifying questions, answer with your best understanding of the request.", turns-1), nil
+	}
+
+	tc.Participant.clarifications.set(tc.Speaker.SID(), &clarification{
+		question:  question,
+		request:   request,
+		turns:     turns,
+		expiresAt: time.Now().Add(t.conf.Timeout),
+	})
+	return "Ask the question now, it must be the only question of your answer and end it.", nil
+}
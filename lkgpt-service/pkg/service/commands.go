@@ -0,0 +1,79 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/livekit/protocol/logger"
+	lksdk "github.com/livekit/server-sdk-go"
+)
+
+// Commands sent by the clients to control KITT (see commandPacket), the start, activate and stop
+// commands are handled in dataReceived
+
+// Say the last answer again, ignored when KITT is busy
+func (p *GPTParticipant) repeatLastAnswer(rp *lksdk.RemoteParticipant) {
+	if p.isNoteTaker() {
+		return
+	}
+
+	last := p.lastAnswer()
+	if last == nil {
+		return
+	}
+
+	if !p.isBusy.CompareAndSwap(false, true) {
+		logger.Debugw("busy, not repeating the last answer", "participant", rp.Identity())
+		return
+	}
+
+	go func() {
+		defer p.isBusy.Store(false)
+		if err := p.say(last.Text, p.replyLanguage(p.participantLanguage(rp))); err != nil {
+			logger.Errorw("failed to repeat the last answer", err, "participant", rp.Identity())
+		}
+	}()
+}
+
+// nil when KITT didn't say anything yet
+func (p *GPTParticipant) lastAnswer() *SpeechEvent {
+	events := p.history.Snapshot()
+	for i := len(events) - 1; i >= 0; i-- {
+		if speech := events[i].Speech; speech != nil && speech.IsBot && speech.Text != "" {
+			return speech
+		}
+	}
+	return nil
+}
+
+// Forget the conversation: the next answers are completed without the previous exchanges.
+// The transcript, the notes and the scratchpad are kept
+func (p *GPTParticipant) resetContext(rp *lksdk.RemoteParticipant) {
+	p.history.Reset()
+
+	p.lock.Lock()
+	p.interrupted = nil
+	p.waiting = nil
+	p.lock.Unlock()
+
+	for _, participant := range p.room.GetParticipants() {
+		p.clarifications.forget(participant.SID())
+	}
+	logger.Infow("conversation context reset", "room", p.room.Name(), "participant", rp.Identity())
+}
+
+// Answer in the language code, or in the language of each speaker when empty
+func (p *GPTParticipant) changeLanguage(rp *lksdk.RemoteParticipant, code string) {
+	if code == "" {
+		p.lock.Lock()
+		p.replyLang = nil
+		p.lock.Unlock()
+		return
+	}
+
+	if findLanguage(code) == nil {
+		p.publishError(fmt.Sprintf("Sorry, %s isn't supported", code), nil)
+		return
+	}
+	p.setReplyLanguage(code)
+	logger.Debugw("reply language changed", "participant", rp.Identity(), "language", code)
+}
@@ -2,14 +2,20 @@ package service
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/livekit/protocol/logger"
 	lksdk "github.com/livekit/server-sdk-go"
 	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
 )
 
 // A sentence in the conversation (Used for the history)
@@ -17,6 +23,12 @@ type SpeechEvent struct {
 	ParticipantName string
 	IsBot           bool
 	Text            string
+	Time            time.Time
+	Interrupted     bool   // The answer of KITT was cut off, Text only contains what was played
+	AudioKey        string // Blob of the audio of the answer (See StorageConfig.AnswerAudio)
+
+	Disclaimers []string    // Written disclaimers of the answer, see GuardrailsConfig
+	Citations   []*Citation // Sources of the answer, see citations.go
 }
 
 type JoinLeaveEvent struct {
@@ -25,23 +37,159 @@ type JoinLeaveEvent struct {
 	Time            time.Time
 }
 
+type MicrophoneEvent struct {
+	Muted           bool
+	ParticipantName string
+	Time            time.Time
+}
+
 type MeetingEvent struct {
-	Speech *SpeechEvent
-	Join   *JoinLeaveEvent
+	Speech     *SpeechEvent
+	Join       *JoinLeaveEvent
+	Microphone *MicrophoneEvent
+}
+
+func (e *MicrophoneEvent) describe() string {
+	if e.Muted {
+		return fmt.Sprintf("%s muted their microphone at %s", e.ParticipantName, e.Time.Format("3:04pm"))
+	}
+	return fmt.Sprintf("%s unmuted their microphone at %s", e.ParticipantName, e.Time.Format("3:04pm"))
+}
+
+// What KITT knows about the meeting beyond its history
+type MeetingContext struct {
+	Calendar *CalendarEvent
+	Agenda   *Agenda
+	Memories map[string][]string // identity -> facts remembered from the previous meetings
+	Language *Language           // Language of every answer, nil to answer in the language of the speaker
+
+	Scratchpad []*ScratchpadNote
+
+	Clarification *clarification // Clarifying question the current participant is answering
+	Waited        []string       // Participants whose prompts waited for another answer, see overlap.go
+}
+
+func (m *MeetingContext) prompt() string {
+	var sb strings.Builder
+	if m.Calendar != nil {
+		sb.WriteString(m.Calendar.prompt())
+	}
+	if m.Agenda != nil {
+		sb.WriteString(m.Agenda.prompt())
+	}
+
+	for identity, facts := range m.Memories {
+		if len(facts) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("What you remember about %s from previous meetings: %s ", identity, strings.Join(facts, " ")))
+	}
+
+	if len(m.Scratchpad) > 0 {
+		sb.WriteString(fmt.Sprintf("Your notes for this meeting (see store_note):\n%s", formatScratchpad(m.Scratchpad)))
+	}
+
+	if m.Language != nil {
+		sb.WriteString(fmt.Sprintf("Always answer in %s, even when the participants speak another language. ", m.Language.Label))
+	}
+	return sb.String()
 }
 
 type ChatCompletion struct {
-	client *openai.Client
+	client     LLMClient
+	conf       config.LLMConfig        // Models of the tasks
+	guardrails config.GuardrailsConfig // Policy of the answers
+	injection  config.InjectionConfig
+	questions  string // See QuestionsPolicy_*
+	usage      *usageMeter
+
+	lock  sync.Mutex
+	model string // Model of the answers, replaced by a cheaper one when the instance is overloaded
 }
 
-func NewChatCompletion(client *openai.Client) *ChatCompletion {
-	return &ChatCompletion{
+func NewChatCompletion(client LLMClient, conf config.LLMConfig) *ChatCompletion {
+	c := &ChatCompletion{
 		client: client,
+		conf:   conf,
 	}
+	c.model = c.taskModel(LLMTask_Answers)
+	return c
+}
+
+func (c *ChatCompletion) SetGuardrails(conf config.GuardrailsConfig) {
+	c.guardrails = conf
+}
+
+// Model of the answers, empty to use the one of the config
+func (c *ChatCompletion) SetModel(model string) {
+	if model == "" {
+		model = c.taskModel(LLMTask_Answers)
+	} else {
+		model = c.resolveModel(model)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.model = model
+}
+
+// Model of the task, LLMConfig.Model when the task has none
+func (c *ChatCompletion) taskModel(task string) string {
+	var model string
+	switch task {
+	case LLMTask_Answers:
+		model = c.conf.Tasks.Answers
+	case LLMTask_Summaries:
+		model = c.conf.Tasks.Summaries
+	case LLMTask_Classification:
+		model = c.conf.Tasks.Classification
+	}
+	if model == "" {
+		model = c.conf.Model
+	}
+	return c.resolveModel(model)
+}
+
+// The names without an alias are models
+func (c *ChatCompletion) resolveModel(model string) string {
+	if name, ok := c.conf.Aliases[model]; ok {
+		return name
+	}
+	return model
+}
+
+func (c *ChatCompletion) answerModel() string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.model
+}
+
+func (c *ChatCompletion) SetInjectionDefense(conf config.InjectionConfig) {
+	c.injection = conf
+}
+
+func (c *ChatCompletion) SetQuestionsPolicy(policy string) {
+	c.questions = policy
+}
+
+func (c *ChatCompletion) SetUsageMeter(usage *usageMeter) {
+	c.usage = usage
+}
+
+func (c *ChatCompletion) countUsage(usage openai.Usage) {
+	c.usage.Add(usage_OpenAITokens, float64(usage.TotalTokens))
+}
+
+// Delimited (and filtered) speech of a participant, suspicious is true when an injection phrase was found
+func (c *ChatCompletion) speech(participantName, text string) (content string, suspicious bool) {
+	if c.injection.Filter {
+		text, suspicious = filterInjection(text)
+	}
+	return delimitSpeech(participantName, text), suspicious
 }
 
 func (c *ChatCompletion) Complete(ctx context.Context, events []*MeetingEvent, prompt *SpeechEvent,
-	participant *lksdk.RemoteParticipant, room *lksdk.Room, language *Language) (*ChatStream, error) {
+	participant *lksdk.RemoteParticipant, room *lksdk.Room, language *Language, meeting *MeetingContext, tools *ToolSet, toolCtx *ToolContext) (*ChatStream, error) {
 
 	var sb strings.Builder
 	participants := room.GetParticipants()
@@ -54,14 +202,32 @@ func (c *ChatCompletion) Complete(ctx context.Context, events []*MeetingEvent, p
 	participantNames := sb.String()
 	sb.Reset()
 
+	codes := make([]string, 0, len(Languages))
+	for code := range Languages {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	systemPrompt := "You are KITT, a voice assistant in a meeting created by LiveKit. " +
+		"Keep your responses concise while still being friendly and personable. " +
+		"If your response is a question, please append a question mark symbol to the end of it. " + // Used for auto-trigger
+		"Answer with a JSON object containing \"sentences\", an array of objects with \"language\" " +
+		fmt.Sprintf("(the code of the language the sentence is spoken in, one of %s) ", strings.Join(codes, ", ")) +
+		"and \"text\" (a single sentence, without any formatting). " +
+		fmt.Sprintf("There are actually %d participants in the meeting: %s. ", len(participants), participantNames) +
+		fmt.Sprintf("Current language: %s Current date: %s", language.Label, time.Now().Format("January 2, 2006 3:04pm"))
+	if meeting != nil {
+		systemPrompt += ". " + meeting.prompt()
+	}
+	systemPrompt += " " + speechPolicyPrompt
+	if policy := policyPrompt(c.guardrails); policy != "" {
+		systemPrompt += " Policy you must follow: " + policy
+	}
+
 	messages := make([]openai.ChatCompletionMessage, 0, len(events)+3)
 	messages = append(messages, openai.ChatCompletionMessage{
-		Role: openai.ChatMessageRoleSystem,
-		Content: "You are KITT, a voice assistant in a meeting created by LiveKit. " +
-			"Keep your responses concise while still being friendly and personable. " +
-			"If your response is a question, please append a question mark symbol to the end of it. " + // Used for auto-trigger
-			fmt.Sprintf("There are actually %d participants in the meeting: %s. ", len(participants), participantNames) +
-			fmt.Sprintf("Current language: %s Current date: %s", language.Label, time.Now().Format("January 2, 2006 3:04pm")),
+		Role:    openai.ChatMessageRoleSystem,
+		Content: systemPrompt,
 	})
 
 	for _, e := range events {
@@ -72,10 +238,17 @@ func (c *ChatCompletion) Complete(ctx context.Context, events []*MeetingEvent, p
 					Content: e.Speech.Text,
 					Name:    BotIdentity,
 				})
+				if e.Speech.Interrupted {
+					messages = append(messages, openai.ChatCompletionMessage{
+						Role:    openai.ChatMessageRoleSystem,
+						Content: InterruptedAnswerPrompt,
+					})
+				}
 			} else {
+				content, _ := c.speech(e.Speech.ParticipantName, e.Speech.Text)
 				messages = append(messages, openai.ChatCompletionMessage{
 					Role:    openai.ChatMessageRoleUser,
-					Content: fmt.Sprintf("%s said %s", e.Speech.ParticipantName, e.Speech.Text),
+					Content: content,
 					Name:    e.Speech.ParticipantName,
 				})
 			}
@@ -94,6 +267,13 @@ func (c *ChatCompletion) Complete(ctx context.Context, events []*MeetingEvent, p
 				})
 			}
 		}
+
+		if e.Microphone != nil {
+			messages = append(messages, openai.ChatCompletionMessage{
+				Role:    openai.ChatMessageRoleSystem,
+				Content: e.Microphone.describe(),
+			})
+		}
 	}
 
 	messages = append(messages, openai.ChatCompletionMessage{
@@ -101,59 +281,316 @@ func (c *ChatCompletion) Complete(ctx context.Context, events []*MeetingEvent, p
 		Content: fmt.Sprintf("You are currently talking to %s", participant.Identity()),
 	})
 
+	if instruction := questionsPrompt(c.questions, prompt.Text); instruction != "" {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: instruction,
+		})
+	}
+
+	if instruction := overlapPrompt(meeting.waited()); instruction != "" {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: instruction,
+		})
+	}
+
+	if meeting != nil && meeting.Clarification != nil {
+		messages = append(messages, openai.ChatCompletionMessage{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: meeting.Clarification.prompt(prompt.ParticipantName),
+		})
+	}
+
 	// prompt
+	content, suspicious := c.speech(prompt.ParticipantName, prompt.Text)
+	if suspicious {
+		// Answer the rest of the question, but don't let it trigger any action
+		logger.Infow("injection phrase filtered, tools disabled for this answer", "participant", prompt.ParticipantName)
+		tools = nil
+	}
 	messages = append(messages, openai.ChatCompletionMessage{
 		Role:    openai.ChatMessageRoleUser,
-		Content: prompt.Text,
+		Content: content,
 		Name:    prompt.ParticipantName,
 	})
 
-	stream, err := c.client.CreateChatCompletionStream(ctx, openai.ChatCompletionRequest{
-		Model:    openai.GPT3Dot5Turbo,
+	request := openai.ChatCompletionRequest{
+		Model:    c.answerModel(),
 		Messages: messages,
 		Stream:   true,
-	})
+		Tools:    tools.Definitions(),
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		},
+	}
 
+	stream, err := c.client.CreateChatCompletionStream(ctx, request)
 	if err != nil {
 		logger.Errorw("error creating chat completion stream", err)
 		return nil, err
 	}
+	c.usage.Add(usage_OpenAITokens, estimateTokens(request.Messages))
 
-	return &ChatStream{
-		stream: stream,
-	}, nil
+	cs := &ChatStream{
+		ctx:     ctx,
+		client:  c.client,
+		usage:   c.usage,
+		request: request,
+		tools:   tools,
+		toolCtx: toolCtx,
+		stream:  stream,
+	}
+	cs.decoder = json.NewDecoder(&chatStreamReader{stream: cs})
+	return cs, nil
 }
 
-// Wrapper around openai.ChatCompletionStream to return only complete sentences
+// A sentence of the answer, with the language it must be synthesized in
+type Sentence struct {
+	Language string `json:"language"`
+	Text     string `json:"text"`
+}
+
+// Wrapper around the LLMStream to return only complete sentences
+// The completion is a JSON object ({"sentences": [...]}), decoded as it is streamed
+// Tool calls are executed transparently, the stream then continues with the new completion
 type ChatStream struct {
-	stream *openai.ChatCompletionStream
+	ctx     context.Context
+	client  LLMClient
+	usage   *usageMeter
+	request openai.ChatCompletionRequest
+	tools   *ToolSet
+	toolCtx *ToolContext
+	rounds  int
+
+	stream    LLMStream
+	toolCalls []openai.ToolCall
+	decoder   *json.Decoder
+	inArray   bool // The decoder is positioned inside the "sentences" array
+}
+
+func (c *ChatStream) Recv() (*Sentence, error) {
+	if !c.inArray {
+		if err := c.openSentences(); err != nil {
+			return nil, err
+		}
+		c.inArray = true
+	}
+
+	if !c.decoder.More() {
+		// Consume the closing bracket, returns the error of the stream if it failed
+		if _, err := c.decoder.Token(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	sentence := &Sentence{}
+	if err := c.decoder.Decode(sentence); err != nil {
+		return nil, err
+	}
+	return sentence, nil
+}
+
+// Move the decoder to the first element of the "sentences" array, the other keys are skipped
+func (c *ChatStream) openSentences() error {
+	if err := c.expectDelim('{'); err != nil {
+		return err
+	}
+
+	for c.decoder.More() {
+		key, err := c.decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		if key == "sentences" {
+			return c.expectDelim('[')
+		}
+
+		var skipped json.RawMessage
+		if err := c.decoder.Decode(&skipped); err != nil {
+			return err
+		}
+	}
+	return io.EOF // No sentences
 }
 
-func (c *ChatStream) Recv() (string, error) {
-	sb := strings.Builder{}
-	for {
+func (c *ChatStream) expectDelim(delim json.Delim) error {
+	token, err := c.decoder.Token()
+	if err != nil {
+		return err
+	}
+	if token != delim {
+		return fmt.Errorf("invalid completion, expected %s, got %v", delim, token)
+	}
+	return nil
+}
+
+// Content of the completion, read by the JSON decoder
+type chatStreamReader struct {
+	stream *ChatStream
+	buffer []byte
+}
+
+func (r *chatStreamReader) Read(b []byte) (int, error) {
+	c := r.stream
+	for len(r.buffer) == 0 {
 		response, err := c.stream.Recv()
 		if err != nil {
-			content := sb.String()
-			if err == io.EOF && len(strings.TrimSpace(content)) != 0 {
-				return content, nil
+			if err == io.EOF && len(c.toolCalls) != 0 {
+				calls := c.toolCalls
+				c.toolCalls = nil
+				if err := c.callTools(calls); err != nil {
+					return 0, err
+				}
+				continue
 			}
-			return "", err
+			return 0, err
 		}
 
 		if len(response.Choices) == 0 {
 			continue
 		}
 
-		delta := response.Choices[0].Delta.Content
-		sb.WriteString(delta)
+		c.toolCalls = appendToolCallDeltas(c.toolCalls, response.Choices[0].Delta.ToolCalls)
+		r.buffer = append(r.buffer, response.Choices[0].Delta.Content...)
+		c.usage.Add(usage_OpenAITokens, float64(len(response.Choices[0].Delta.Content))/charsPerToken)
+	}
 
-		if strings.HasSuffix(strings.TrimSpace(delta), ".") {
-			return sb.String(), nil
+	n := copy(b, r.buffer)
+	r.buffer = r.buffer[n:]
+	return n, nil
+}
+
+// Execute the tool calls and continue the conversation with their results
+func (c *ChatStream) callTools(calls []openai.ToolCall) error {
+	c.stream.Close()
+
+	c.rounds++
+	if c.rounds > maxToolRounds {
+		return errors.New("too many consecutive tool calls")
+	}
+
+	c.request.Messages = append(c.request.Messages, openai.ChatCompletionMessage{
+		Role:      openai.ChatMessageRoleAssistant,
+		ToolCalls: calls,
+	})
+
+	for _, call := range calls {
+		c.request.Messages = append(c.request.Messages, openai.ChatCompletionMessage{
+			Role:       openai.ChatMessageRoleTool,
+			Content:    c.tools.Call(c.ctx, c.toolCtx, call),
+			ToolCallID: call.ID,
+		})
+	}
+
+	stream, err := c.client.CreateChatCompletionStream(c.ctx, c.request)
+	if err != nil {
+		return err
+	}
+	c.usage.Add(usage_OpenAITokens, estimateTokens(c.request.Messages))
+
+	c.stream = stream
+	return nil
+}
+
+// The tool calls are streamed in chunks, the first chunk contains the id and the name of the function
+func appendToolCallDeltas(calls []openai.ToolCall, deltas []openai.ToolCall) []openai.ToolCall {
+	for _, delta := range deltas {
+		index := len(calls) - 1
+		if delta.Index != nil {
+			index = *delta.Index
+		}
+		if index < 0 {
+			index = 0
+		}
+
+		for index >= len(calls) {
+			calls = append(calls, openai.ToolCall{Type: openai.ToolTypeFunction})
+		}
+
+		call := &calls[index]
+		if delta.ID != "" {
+			call.ID = delta.ID
 		}
+		if delta.Function.Name != "" {
+			call.Function.Name = delta.Function.Name
+		}
+		call.Function.Arguments += delta.Function.Arguments
 	}
+	return calls
 }
 
 func (c *ChatStream) Close() {
 	c.stream.Close()
 }
+
+type MeetingSummary struct {
+	Summary     string   `json:"summary"`
+	ActionItems []string `json:"actionItems"`
+}
+
+// Summarize the meeting history and extract the action items, the notes of the scratchpad complete the transcript
+func (c *ChatCompletion) Summarize(ctx context.Context, events []*MeetingEvent, notes []*ScratchpadNote) (*MeetingSummary, error) {
+	transcript := formatTranscript(events)
+	if len(notes) > 0 {
+		transcript += fmt.Sprintf("\nNotes taken by the assistant during the meeting:\n%s", formatScratchpad(notes))
+	}
+
+	resp, err := c.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: c.taskModel(LLMTask_Summaries),
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role: openai.ChatMessageRoleSystem,
+				Content: "You write the notes of a meeting from its transcript. " +
+					"Answer with a JSON object containing \"summary\" (a short paragraph) and " +
+					"\"actionItems\" (an array of strings, each one mentioning who is responsible when known).",
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: transcript,
+			},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.countUsage(resp.Usage)
+
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("no summary returned")
+	}
+
+	summary := &MeetingSummary{}
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), summary); err != nil {
+		return nil, fmt.Errorf("invalid summary: %w", err)
+	}
+	return summary, nil
+}
+
+// One line per event, used when the whole history is sent as a single message
+func formatTranscript(events []*MeetingEvent) string {
+	var sb strings.Builder
+	for _, e := range events {
+		if e.Speech != nil {
+			sb.WriteString(fmt.Sprintf("%s: %s\n", e.Speech.ParticipantName, e.Speech.Text))
+		}
+
+		if e.Join != nil {
+			if e.Join.Leave {
+				sb.WriteString(fmt.Sprintf("(%s left the meeting at %s)\n", e.Join.ParticipantName, e.Join.Time.Format("3:04pm")))
+			} else {
+				sb.WriteString(fmt.Sprintf("(%s joined the meeting at %s)\n", e.Join.ParticipantName, e.Join.Time.Format("3:04pm")))
+			}
+		}
+
+		if e.Microphone != nil {
+			sb.WriteString(fmt.Sprintf("(%s)\n", e.Microphone.describe()))
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"time"
+
+	lksdk "github.com/livekit/server-sdk-go"
+)
+
+type answerRecord struct {
+	participantSid string
+	time           time.Time
+}
+
+// Returns why rp can't be answered right now, empty when it can
+func (p *GPTParticipant) cooldown(rp *lksdk.RemoteParticipant) string {
+	conf := p.conf.Cooldown
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	if conf.MinGap > 0 && now.Sub(p.lastAnswerEnd) < conf.MinGap {
+		return "min_gap"
+	}
+
+	p.pruneAnswerLog(now)
+	if conf.RoomPerMinute > 0 && len(p.answerLog) >= conf.RoomPerMinute {
+		return "room_per_minute"
+	}
+
+	if conf.ParticipantPerMinute > 0 {
+		count := 0
+		for _, record := range p.answerLog {
+			if record.participantSid == rp.SID() {
+				count++
+			}
+		}
+		if count >= conf.ParticipantPerMinute {
+			return "participant_per_minute"
+		}
+	}
+	return ""
+}
+
+func (p *GPTParticipant) recordAnswer(rp *lksdk.RemoteParticipant) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	p.pruneAnswerLog(now)
+	p.answerLog = append(p.answerLog, answerRecord{
+		participantSid: rp.SID(),
+		time:           now,
+	})
+}
+
+// The min gap starts once KITT stopped speaking
+func (p *GPTParticipant) answerFinished() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.lastAnswerEnd = time.Now()
+}
+
+// The caller must hold the lock
+func (p *GPTParticipant) pruneAnswerLog(now time.Time) {
+	i := 0
+	for i < len(p.answerLog) && now.Sub(p.answerLog[i].time) >= time.Minute {
+		i++
+	}
+	p.answerLog = p.answerLog[i:]
+}
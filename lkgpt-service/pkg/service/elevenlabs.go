@@ -0,0 +1,137 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+const elevenLabsUrl = "https://api.elevenlabs.io/v1/text-to-speech"
+
+type ElevenLabsSynthesizer struct {
+	conf  config.ElevenLabsConfig
+	usage *usageMeter
+
+	lock   sync.Mutex
+	voices map[string]string // language code -> voice id
+}
+
+func NewElevenLabsSynthesizer(conf config.ElevenLabsConfig, voices map[string]config.VoiceConfig) *ElevenLabsSynthesizer {
+	s := &ElevenLabsSynthesizer{
+		conf:   conf,
+		voices: make(map[string]string),
+	}
+	for code, voiceId := range conf.Voices {
+		s.voices[code] = voiceId
+	}
+	s.SetVoices(voices)
+	return s
+}
+
+// The name of the voices is the ElevenLabs voice id, the gender is ignored
+func (s *ElevenLabsSynthesizer) SetVoices(voices map[string]config.VoiceConfig) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for code, voice := range voices {
+		if voice.Name != "" {
+			s.voices[code] = voice.Name
+		}
+	}
+}
+
+func (s *ElevenLabsSynthesizer) SetUsageMeter(usage *usageMeter) {
+	s.usage = usage
+}
+
+func (s *ElevenLabsSynthesizer) voice(language *Language) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if voiceId, ok := s.voices[language.Code]; ok {
+		return voiceId
+	}
+	return s.conf.VoiceId
+}
+
+func (s *ElevenLabsSynthesizer) Synthesize(ctx context.Context, text string, language *Language) ([]byte, error) {
+	resp, err := s.request(ctx, text, language, false)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	audio, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if len(audio) == 0 {
+		return nil, errors.New("no audio returned by ElevenLabs")
+	}
+
+	s.usage.Add(usage_TTSCharacters, float64(utf8.RuneCountInString(text)))
+	return audio, nil
+}
+
+// The stream endpoint sends the audio while it is generated
+func (s *ElevenLabsSynthesizer) SynthesizeStream(ctx context.Context, text string, language *Language) (io.ReadCloser, error) {
+	resp, err := s.request(ctx, text, language, true)
+	if err != nil {
+		return nil, err
+	}
+
+	s.usage.Add(usage_TTSCharacters, float64(utf8.RuneCountInString(text)))
+	return resp.Body, nil
+}
+
+// The body of the response must be closed
+func (s *ElevenLabsSynthesizer) request(ctx context.Context, text string, language *Language, stream bool) (*http.Response, error) {
+	voiceId := s.voice(language)
+	if voiceId == "" {
+		return nil, fmt.Errorf("no ElevenLabs voice for %s", language.Code)
+	}
+
+	body, err := json.Marshal(map[string]string{
+		"text":     text,
+		"model_id": s.conf.ModelId,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	path := url.PathEscape(voiceId)
+	if stream {
+		path += "/stream"
+	}
+	u := fmt.Sprintf("%s/%s?output_format=%s", elevenLabsUrl, path, url.QueryEscape(s.conf.OutputFormat))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("xi-api-key", s.conf.ApiKey)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "audio/ogg")
+
+	// Not httpClient, long sentences can take more than its timeout
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("ElevenLabs request failed with status %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return resp, nil
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/livekit/protocol/auth"
+	"github.com/livekit/protocol/logger"
+	lksdk "github.com/livekit/server-sdk-go"
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// Sent to the escalation webhook, agentToken can be used by the human agent to join the room
+type escalationRequest struct {
+	Room          string    `json:"room"`
+	RoomSid       string    `json:"roomSid"`
+	Participant   string    `json:"participant"`
+	Reason        string    `json:"reason"`
+	LiveKitUrl    string    `json:"livekitUrl"`
+	AgentIdentity string    `json:"agentIdentity"`
+	AgentToken    string    `json:"agentToken"`
+	Time          time.Time `json:"time"`
+}
+
+// While escalated, KITT stops answering until the human agent leaves the room
+type escalationState struct {
+	id            uint64
+	active        bool
+	agentIdentity string
+	agentJoined   bool
+}
+
+type escalationTool struct {
+	conf    config.EscalationConfig
+	livekit config.LiveKitConfig
+}
+
+func (t *escalationTool) Definition() *openai.FunctionDefinition {
+	return &openai.FunctionDefinition{
+		Name: "escalate_to_human",
+		Description: "Page a human agent into the meeting. Call it when a participant asks to talk to a human, " +
+			"or when you are not confident you can answer correctly.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"reason": map[string]interface{}{
+					"type":        "string",
+					"description": "Why a human agent is needed",
+				},
+			},
+			"required": []string{"reason"},
+		},
+	}
+}
+
+func (t *escalationTool) Call(ctx context.Context, tc *ToolContext, arguments string) (string, error) {
+	args := struct {
+		Reason string `json:"reason"`
+	}{}
+	if err := parseToolArguments(arguments, &args); err != nil {
+		return "", err
+	}
+
+	p := tc.Participant
+	if p.isEscalated() {
+		return "A human agent has already been paged.", nil
+	}
+
+	agentIdentity := fmt.Sprintf("%s%d", t.conf.AgentIdentityPrefix, time.Now().UnixMilli())
+	agentToken, err := auth.NewAccessToken(t.livekit.ApiKey, t.livekit.SecretKey).
+		SetIdentity(agentIdentity).
+		SetValidFor(t.conf.AgentTimeout).
+		AddGrant(&auth.VideoGrant{
+			Room:     p.room.Name(),
+			RoomJoin: true,
+		}).ToJWT()
+	if err != nil {
+		return "", err
+	}
+
+	body, err := json.Marshal(&escalationRequest{
+		Room:          p.room.Name(),
+		RoomSid:       p.room.SID(),
+		Participant:   tc.Speaker.Identity(),
+		Reason:        args.Reason,
+		LiveKitUrl:    t.livekit.Url,
+		AgentIdentity: agentIdentity,
+		AgentToken:    agentToken,
+		Time:          time.Now(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.conf.WebhookUrl, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.conf.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("escalation webhook returned status %d", resp.StatusCode)
+	}
+
+	logger.Infow("escalated to a human agent", "room", p.room.Name(), "agent", agentIdentity, "reason", args.Reason)
+	p.escalate(agentIdentity)
+
+	return "A human agent has been paged and will join the meeting shortly. " +
+		"Tell the participants about the handoff, you will stop answering until the agent leaves.", nil
+}
+
+func (p *GPTParticipant) isEscalated() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.escalation.active
+}
+
+func (p *GPTParticipant) escalate(agentIdentity string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.escalation.id++
+	p.escalation.active = true
+	p.escalation.agentIdentity = agentIdentity
+	p.escalation.agentJoined = false
+
+	// Resume answering if the agent never joins
+	id := p.escalation.id
+	go func() {
+		select {
+		case <-time.After(p.conf.Escalation.AgentTimeout):
+		case <-p.ctx.Done():
+			return
+		}
+
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		if p.escalation.id == id && p.escalation.active && !p.escalation.agentJoined {
+			logger.Infow("human agent didn't join, resuming", "room", p.room.Name())
+			p.escalation.active = false
+		}
+	}()
+}
+
+func (p *GPTParticipant) isEscalationAgent(rp *lksdk.RemoteParticipant) bool {
+	prefix := p.conf.Escalation.AgentIdentityPrefix
+	return rp.Identity() == p.escalation.agentIdentity || (prefix != "" && strings.HasPrefix(rp.Identity(), prefix))
+}
+
+func (p *GPTParticipant) escalationParticipantConnected(rp *lksdk.RemoteParticipant) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.escalation.active && p.isEscalationAgent(rp) {
+		logger.Infow("human agent joined", "room", p.room.Name(), "agent", rp.Identity())
+		p.escalation.agentJoined = true
+	}
+}
+
+func (p *GPTParticipant) escalationParticipantDisconnected(rp *lksdk.RemoteParticipant) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.escalation.active && p.escalation.agentJoined && p.isEscalationAgent(rp) {
+		logger.Infow("human agent left, resuming", "room", p.room.Name(), "agent", rp.Identity())
+		p.escalation.active = false
+	}
+}
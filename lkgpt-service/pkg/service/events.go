@@ -0,0 +1,215 @@
+package service
+
+import (
+	"sync"
+	"time"
+)
+
+type RoomEventType int32
+
+const (
+	RoomEvent_Transcript RoomEventType = 0
+	RoomEvent_State      RoomEventType = 1
+	RoomEvent_Answer     RoomEventType = 2
+	RoomEvent_Error      RoomEventType = 3
+	RoomEvent_Notes      RoomEventType = 4
+	RoomEvent_Speaking   RoomEventType = 5
+	RoomEvent_Mute       RoomEventType = 6
+	RoomEvent_Poll       RoomEventType = 7
+	RoomEvent_Progress   RoomEventType = 8
+	RoomEvent_Health     RoomEventType = 9
+	RoomEvent_Chat       RoomEventType = 10
+	RoomEvent_Farewell   RoomEventType = 11
+)
+
+func (t RoomEventType) String() string {
+	switch t {
+	case RoomEvent_Transcript:
+		return "transcript"
+	case RoomEvent_State:
+		return "state"
+	case RoomEvent_Answer:
+		return "answer"
+	case RoomEvent_Error:
+		return "error"
+	case RoomEvent_Notes:
+		return "notes"
+	case RoomEvent_Speaking:
+		return "speaking"
+	case RoomEvent_Mute:
+		return "mute"
+	case RoomEvent_Poll:
+		return "poll"
+	case RoomEvent_Progress:
+		return "progress"
+	case RoomEvent_Health:
+		return "health"
+	case RoomEvent_Chat:
+		return "chat"
+	case RoomEvent_Farewell:
+		return "farewell"
+	default:
+		return "unknown"
+	}
+}
+
+// Events happening inside a room, published by the GPTParticipant
+type RoomEvent struct {
+	Type RoomEventType `json:"type"`
+	Room string        `json:"room"`
+	Time time.Time     `json:"time"`
+	Data interface{}   `json:"data"` // *TranscriptEvent, *StateEvent, *AnswerEvent, *ErrorEvent, *NotesEvent, *SpeakingEvent, *MuteEvent, *PollEvent, *ProgressEvent, *HealthEvent, *ChatEvent or *FarewellEvent
+}
+
+type TranscriptEvent struct {
+	ParticipantSid  string           `json:"sid"`
+	ParticipantName string           `json:"name"`
+	Text            string           `json:"text"`
+	IsFinal         bool             `json:"isFinal"`
+	Words           []RecognizedWord `json:"words,omitempty"`
+}
+
+type StateEvent struct {
+	State gptState `json:"state"`
+}
+
+type AnswerEvent struct {
+	ParticipantSid  string `json:"sid"`
+	ParticipantName string `json:"name"`
+	Prompt          string `json:"prompt"`
+	Answer          string `json:"answer"`
+	AudioKey        string `json:"audioKey,omitempty"` // Blob of the played audio, when stored
+
+	Disclaimers []string    `json:"disclaimers,omitempty"` // Written disclaimers, not spoken
+	Citations   []*Citation `json:"citations,omitempty"`
+}
+
+type ErrorEvent struct {
+	Message string `json:"message"` // User-facing message
+	Err     error  `json:"-"`
+}
+
+type NotesEvent struct {
+	Notes *MeetingNotes `json:"notes"`
+}
+
+// Sentence of the answer KITT started to speak, so the clients can display it while it is heard
+type SpeakingEvent struct {
+	ParticipantSid string        `json:"sid"` // Participant being answered
+	Text           string        `json:"text"`
+	Language       string        `json:"language"`
+	Index          int           `json:"index"` // Position of the sentence in the answer
+	Start          time.Time     `json:"start"`
+	Duration       time.Duration `json:"duration"`
+}
+
+// Progress of a tool call taking a while, see progress.go
+type ProgressEvent struct {
+	ParticipantSid string        `json:"sid"` // Participant being answered
+	TaskId         string        `json:"taskId"`
+	Tool           string        `json:"tool"`
+	Message        string        `json:"message,omitempty"`
+	Progress       float64       `json:"progress"` // 0.0 - 1.0, -1 when unknown
+	Elapsed        time.Duration `json:"elapsed"`
+	Done           bool          `json:"done"` // The tool returned
+}
+
+// The assistant is limited (providers failing or rate-limited, quota exceeded, overload), see health.go
+type HealthEvent struct {
+	Degraded bool           `json:"degraded"`
+	Issues   []*HealthIssue `json:"issues"` // Empty once recovered
+}
+
+type HealthIssue struct {
+	Provider string    `json:"provider,omitempty"` // healthProvider_*, empty for the issues of the instance
+	Reason   string    `json:"reason"`             // degradation_*
+	RetryAt  time.Time `json:"retryAt,omitempty"`  // When the provider is tested again, zero when unknown
+	Message  string    `json:"message"`            // User-facing message
+}
+
+// Message of KITT for the chat, see chatonly.go. The answers of the chat prompts are AnswerEvents,
+// their ChatEvent only carries the text for the clients without the LiveKit chat
+type ChatEvent struct {
+	ParticipantSid string `json:"sid,omitempty"` // Participant answered, empty for the announcements
+	Message        string `json:"message"`
+}
+
+// KITT is leaving the room on its own, see farewell.go
+type FarewellEvent struct {
+	Reason  string `json:"reason"`            // LeaveReason_*
+	Message string `json:"message,omitempty"` // User-facing message
+	Summary string `json:"summary,omitempty"` // Of the meeting, LeaveReason_MaxDuration only
+}
+
+// A participant muted/unmuted their microphone
+type MuteEvent struct {
+	ParticipantSid  string `json:"sid"`
+	ParticipantName string `json:"name"`
+	Muted           bool   `json:"muted"`
+}
+
+type EventSink interface {
+	HandleEvent(event *RoomEvent)
+}
+
+type EventSinkFunc func(event *RoomEvent)
+
+func (f EventSinkFunc) HandleEvent(event *RoomEvent) {
+	f(event)
+}
+
+// EventBus dispatches the events of one room to its sinks (packets, webhooks, storage, metrics, ...)
+// Sinks are called synchronously and in order from the publishing goroutine, so they must not block.
+type EventBus struct {
+	lock   sync.RWMutex
+	nextId uint64
+	sinks  map[uint64]EventSink
+	order  []uint64
+}
+
+func NewEventBus() *EventBus {
+	return &EventBus{
+		sinks: make(map[uint64]EventSink),
+	}
+}
+
+// Subscribe returns a function used to remove the sink from the bus
+func (b *EventBus) Subscribe(sink EventSink) func() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	id := b.nextId
+	b.nextId++
+	b.sinks[id] = sink
+	b.order = append(b.order, id)
+
+	return func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+
+		delete(b.sinks, id)
+		for i, oid := range b.order {
+			if oid == id {
+				b.order = append(b.order[:i], b.order[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (b *EventBus) Publish(event *RoomEvent) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	b.lock.RLock()
+	sinks := make([]EventSink, 0, len(b.order))
+	for _, id := range b.order {
+		sinks = append(sinks, b.sinks[id])
+	}
+	b.lock.RUnlock()
+
+	for _, sink := range sinks {
+		sink.HandleEvent(event)
+	}
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+)
+
+const (
+	Mode_Facilitator = "facilitator" // Answer the participants and keep the meeting on the agenda
+
+	facilitationTick     = time.Second
+	facilitationMaxDelay = time.Minute // Announcements delayed more than this (KITT busy) are dropped
+)
+
+type AgendaItem struct {
+	Topic   string `json:"topic"`
+	Minutes int    `json:"minutes"`
+}
+
+type Agenda struct {
+	Start time.Time    `json:"start"` // Defaults to the time the agenda is received
+	Items []AgendaItem `json:"items"`
+}
+
+func (a *Agenda) prompt() string {
+	topics := make([]string, 0, len(a.Items))
+	for _, item := range a.Items {
+		topics = append(topics, fmt.Sprintf("%s (%d min)", item.Topic, item.Minutes))
+	}
+	return fmt.Sprintf("Meeting agenda, started at %s: %s. ", a.Start.Format("3:04pm"), strings.Join(topics, ", "))
+}
+
+type announcement struct {
+	at   time.Time
+	text string
+}
+
+// Timed prompts said by KITT: before/at the end of each agenda item and at regular intervals
+func (a *Agenda) announcements(warnBefore, interval time.Duration) []announcement {
+	var res []announcement
+
+	checkpoint := a.Start
+	for i, item := range a.Items {
+		checkpoint = checkpoint.Add(time.Duration(item.Minutes) * time.Minute)
+
+		next := "that's the end of the agenda"
+		if i+1 < len(a.Items) {
+			next = fmt.Sprintf("next topic is %s", a.Items[i+1].Topic)
+		}
+
+		if warnBefore > 0 && time.Duration(item.Minutes)*time.Minute > warnBefore {
+			res = append(res, announcement{
+				at:   checkpoint.Add(-warnBefore),
+				text: fmt.Sprintf("We have %s left on %s; %s.", formatMinutes(warnBefore), item.Topic, next),
+			})
+		}
+
+		if i+1 < len(a.Items) {
+			res = append(res, announcement{
+				at:   checkpoint,
+				text: fmt.Sprintf("Time is up for %s, let's move on to %s.", item.Topic, a.Items[i+1].Topic),
+			})
+		} else {
+			res = append(res, announcement{
+				at:   checkpoint,
+				text: "We've reached the end of the agenda, time to wrap up.",
+			})
+		}
+	}
+
+	end := checkpoint
+	if interval > 0 {
+		for at := a.Start.Add(interval); end.Sub(at) >= time.Minute; at = at.Add(interval) {
+			res = append(res, announcement{
+				at:   at,
+				text: fmt.Sprintf("Quick time check, we have %s left in the meeting.", formatMinutes(end.Sub(at))),
+			})
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].at.Before(res[j].at)
+	})
+	return res
+}
+
+func formatMinutes(d time.Duration) string {
+	minutes := int(d.Round(time.Minute).Minutes())
+	if minutes == 1 {
+		return "1 minute"
+	}
+	return fmt.Sprintf("%d minutes", minutes)
+}
+
+func (p *GPTParticipant) isFacilitator() bool {
+	return p.conf.Mode == Mode_Facilitator
+}
+
+func (p *GPTParticipant) Agenda() *Agenda {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.agenda
+}
+
+func (p *GPTParticipant) SetAgenda(agenda *Agenda) {
+	if agenda.Start.IsZero() {
+		agenda.Start = time.Now()
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.agenda = agenda
+	p.agendaVersion++
+}
+
+// Speak the announcements of the agenda when they are due
+func (p *GPTParticipant) facilitate() {
+	ticker := time.NewTicker(facilitationTick)
+	defer ticker.Stop()
+
+	var (
+		version       uint64
+		announcements []announcement
+	)
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		p.lock.Lock()
+		if p.agendaVersion != version {
+			version = p.agendaVersion
+			announcements = nil
+			if p.agenda != nil {
+				announcements = p.agenda.announcements(p.conf.Facilitation.WarnBefore, p.conf.Facilitation.Interval)
+			}
+		}
+		p.lock.Unlock()
+
+		now := time.Now()
+		for len(announcements) > 0 && now.Sub(announcements[0].at) > facilitationMaxDelay {
+			announcements = announcements[1:]
+		}
+
+		if len(announcements) == 0 || now.Before(announcements[0].at) {
+			continue
+		}
+
+		if p.currentJoinState() != joinState_Listening || p.isEscalated() {
+			continue
+		}
+
+		if !p.isBusy.CompareAndSwap(false, true) {
+			continue // Retry on the next tick
+		}
+
+		text := announcements[0].text
+		announcements = announcements[1:]
+		if err := p.say(text, p.replyLanguage(p.defaultLanguage())); err != nil {
+			logger.Errorw("failed to say the announcement", err, "room", p.room.Name())
+		} else {
+			p.history.Append(&MeetingEvent{
+				Speech: &SpeechEvent{
+					ParticipantName: BotIdentity,
+					IsBot:           true,
+					Text:            text,
+					Time:            time.Now(),
+				},
+			})
+		}
+		p.isBusy.Store(false)
+	}
+}
+
+// GET/PUT /rooms/{room}/agenda
+func (s *LiveGPT) roomAgendaHandler(w http.ResponseWriter, req *http.Request, p *GPTParticipant) {
+	switch req.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(p.Agenda())
+	case http.MethodPut:
+		agenda := &Agenda{}
+		if err := json.NewDecoder(req.Body).Decode(agenda); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		for _, item := range agenda.Items {
+			if item.Topic == "" || item.Minutes <= 0 {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte("every agenda item needs a topic and a positive duration"))
+				return
+			}
+		}
+
+		p.SetAgenda(agenda)
+		s.audit(req, "agenda_updated", p.room.Name(), fmt.Sprintf("%d items", len(agenda.Items)))
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,165 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+	"github.com/livekit-examples/livegpt/pkg/utils"
+)
+
+// When the Google speech stream can't be opened or drops, or when Google doesn't support the language,
+// the Transcriber buffers the audio and sends each utterance to a batch transcription API instead.
+// There are no interim results in this mode, only the final ones.
+// It is also how the utterances are transcribed when Azure is the transcription provider
+
+const (
+	FallbackProvider_OpenAI = "openai" // Whisper
+	FallbackProvider_Azure  = "azure"
+
+	fallbackTick             = 200 * time.Millisecond
+	fallbackSilenceThreshold = 8 // Bytes, see utils.IsSilentPacket
+)
+
+var (
+	errUnsupportedLanguage = errors.New("language not supported by the speech stream")
+	errNoSpeechStream      = errors.New("no speech stream with this transcription provider")
+)
+
+type SpeechFallback struct {
+	conf   config.TranscriptionFallbackConfig
+	client *openai.Client
+	azure  config.AzureConfig
+}
+
+// nil when the fallback is disabled
+func NewSpeechFallback(conf config.TranscriptionFallbackConfig, azure config.AzureConfig, gptClient *openai.Client) (*SpeechFallback, error) {
+	if !conf.Enabled {
+		return nil, nil
+	}
+
+	switch conf.Provider {
+	case FallbackProvider_OpenAI:
+		if gptClient == nil {
+			return nil, errors.New("the openai transcription fallback requires openai_api_key")
+		}
+		return &SpeechFallback{
+			conf:   conf,
+			client: gptClient,
+		}, nil
+	case FallbackProvider_Azure:
+		return &SpeechFallback{
+			conf:  conf,
+			azure: azure,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown transcription fallback provider: %s", conf.Provider)
+	}
+}
+
+// Transcribe an ogg/opus utterance that started at start
+func (f *SpeechFallback) Transcribe(ctx context.Context, audio []byte, language *Language, start time.Time) (*RecognizeResult, error) {
+	if f.conf.Provider == FallbackProvider_Azure {
+		return f.transcribeAzure(ctx, audio, language, start)
+	}
+
+	resp, err := f.client.CreateTranscription(ctx, openai.AudioRequest{
+		Model:                  openai.Whisper1,
+		FilePath:               "utterance.ogg",
+		Reader:                 bytes.NewReader(audio),
+		Language:               strings.Split(language.Code, "-")[0], // ISO-639-1
+		Prompt:                 "KITT",
+		Format:                 openai.AudioResponseFormatVerboseJSON,
+		TimestampGranularities: []openai.TranscriptionTimestampGranularity{openai.TranscriptionTimestampGranularityWord},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RecognizeResult{
+		Text:      strings.TrimSpace(resp.Text),
+		IsFinal:   true,
+		Stability: 1,
+		Language:  language,
+	}
+	for _, w := range resp.Words {
+		result.Words = append(result.Words, RecognizedWord{
+			Word:  w.Word,
+			Start: start.Add(time.Duration(w.Start * float64(time.Second))),
+			End:   start.Add(time.Duration(w.End * float64(time.Second))),
+		})
+	}
+	return result, nil
+}
+
+// Audio of the current utterance, written by the Transcriber while it uses the fallback
+type fallbackBuffer struct {
+	packets   []*rtp.Packet
+	duration  time.Duration
+	start     time.Time // Time of the first packet
+	lastVoice time.Time // Zero while only silence was received
+}
+
+func (b *fallbackBuffer) write(pkt *rtp.Packet) {
+	now := time.Now()
+	if len(b.packets) == 0 {
+		b.start = now
+	}
+
+	p := *pkt
+	p.Payload = append([]byte{}, pkt.Payload...)
+	b.packets = append(b.packets, &p)
+	if d, err := utils.ParsePacketDuration(pkt.Payload); err == nil {
+		b.duration += d
+	}
+	if !utils.IsSilentPacket(pkt.Payload, fallbackSilenceThreshold) {
+		b.lastVoice = now
+	}
+}
+
+// The utterance is complete when the speaker paused or when the buffer is full
+func (b *fallbackBuffer) complete(now time.Time, conf config.TranscriptionFallbackConfig) bool {
+	if b.lastVoice.IsZero() {
+		return false
+	}
+	return now.Sub(b.lastVoice) >= conf.Pause || b.duration >= conf.MaxBuffer
+}
+
+func (b *fallbackBuffer) reset() {
+	b.packets = nil
+	b.duration = 0
+	b.start = time.Time{}
+	b.lastVoice = time.Time{}
+}
+
+// Encode the buffered packets as an ogg/opus file
+func (b *fallbackBuffer) ogg(codec webrtc.RTPCodecParameters) ([]byte, error) {
+	var buf bytes.Buffer
+	writer, err := oggwriter.NewWith(&buf, codec.ClockRate, codec.Channels)
+	if err != nil {
+		return nil, err
+	}
+
+	clock := newRTPClock(codec.ClockRate)
+	for _, pkt := range b.packets {
+		timestamp, ok := clock.next(pkt)
+		if !ok {
+			continue
+		}
+		rewritten := *pkt
+		rewritten.Timestamp = timestamp
+		if err := writer.WriteRTP(&rewritten); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
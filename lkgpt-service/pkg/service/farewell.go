@@ -0,0 +1,178 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+)
+
+// KITT leaving the room on its own announces it (see LeaveConfig): a farewell packet with the reason,
+// then optionally a spoken farewell, so the participants aren't confused by the assistant vanishing.
+// After LeaveConfig.MaxDuration, the farewell also has a summary of the meeting
+
+const (
+	LeaveReason_Shutdown    = "shutdown"     // The server is stopping (drain)
+	LeaveReason_Idle        = "idle"         // Nobody spoke for LeaveConfig.IdleTimeout
+	LeaveReason_MaxDuration = "max_duration" // KITT has been in the room for LeaveConfig.MaxDuration
+)
+
+const (
+	idleCheckInterval  = 10 * time.Second
+	farewellFlushDelay = 500 * time.Millisecond // Leave the time to deliver the farewell packet before disconnecting
+	farewellBusyPoll   = 100 * time.Millisecond
+	farewellSummary    = 30 * time.Second // Timeout of the summary
+)
+
+// Announce the reason and disconnect, returns once disconnected (at most LeaveConfig.Timeout for the farewell)
+func (p *GPTParticipant) Leave(reason string) {
+	if !p.leaving.CompareAndSwap(false, true) {
+		return
+	}
+
+	message := p.conf.Leave.Messages[reason]
+	logger.Infow("leaving the room", "room", p.room.Name(), "reason", reason)
+	var summary string
+	if reason == LeaveReason_MaxDuration {
+		summary = p.farewellSummary()
+	}
+	p.bus.Publish(&RoomEvent{
+		Type: RoomEvent_Farewell,
+		Room: p.room.Name(),
+		Data: &FarewellEvent{
+			Reason:  reason,
+			Message: message,
+			Summary: summary,
+		},
+	})
+
+	if p.conf.Leave.Spoken && message != "" && !p.isNoteTaker() && len(p.room.GetParticipants()) > 0 {
+		p.sayFarewell(message)
+	} else {
+		time.Sleep(farewellFlushDelay)
+	}
+	p.Disconnect()
+}
+
+// The current answer is stopped, the farewell is dropped when KITT is still busy after LeaveConfig.Timeout
+func (p *GPTParticipant) sayFarewell(message string) {
+	deadline := time.After(p.conf.Leave.Timeout)
+	p.stopSpeaking()
+	for !p.isBusy.CompareAndSwap(false, true) {
+		select {
+		case <-time.After(farewellBusyPoll):
+		case <-deadline:
+			logger.Warnw("still busy, leaving without the spoken farewell", nil, "room", p.room.Name())
+			return
+		case <-p.ctx.Done():
+			return
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer p.isBusy.Store(false)
+		if err := p.say(message, p.replyLanguage(p.defaultLanguage())); err != nil {
+			logger.Errorw("failed to say the farewell", err, "room", p.room.Name())
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-deadline:
+		logger.Warnw("farewell too long, leaving", nil, "room", p.room.Name())
+	}
+}
+
+// Leave once nobody spoke (or was answered) for LeaveConfig.IdleTimeout
+func (p *GPTParticipant) watchIdle() {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if time.Since(p.lastSpeech()) >= p.conf.Leave.IdleTimeout {
+			p.Leave(LeaveReason_Idle)
+			return
+		}
+	}
+}
+
+// Summary of the meeting so far, empty when nobody spoke or the summary failed
+func (p *GPTParticipant) farewellSummary() string {
+	events := p.transcript.Snapshot()
+	spoken := false
+	for _, event := range events {
+		if event.Speech != nil {
+			spoken = true
+			break
+		}
+	}
+	if !spoken {
+		return ""
+	}
+
+	ctx, cancel := context.WithTimeout(p.ctx, farewellSummary)
+	defer cancel()
+	summary, err := p.completion.Summarize(ctx, events, p.scratchpad.all())
+	if err != nil {
+		logger.Errorw("failed to summarize the meeting before leaving", err, "room", p.room.Name())
+		return ""
+	}
+	return summary.Summary
+}
+
+// Leave after LeaveConfig.MaxDuration, the forgotten rooms would be transcribed forever
+func (p *GPTParticipant) watchMaxDuration() {
+	timer := time.NewTimer(time.Until(p.connectedAt.Add(p.conf.Leave.MaxDuration)))
+	defer timer.Stop()
+
+	select {
+	case <-p.ctx.Done():
+	case <-timer.C:
+		p.Leave(LeaveReason_MaxDuration)
+	}
+}
+
+// Last final transcript or answer, the connection time before
+func (p *GPTParticipant) lastSpeech() time.Time {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	last := p.connectedAt
+	if p.lastAnswerEnd.After(last) {
+		last = p.lastAnswerEnd
+	}
+	for _, t := range p.lastSpoke {
+		if t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+// Every room says its farewell before the server stops
+func (s *LiveGPT) drain() {
+	participants := s.connectedParticipants()
+	if len(participants) == 0 {
+		return
+	}
+
+	logger.Infow("leaving the rooms", "rooms", len(participants))
+	var wg sync.WaitGroup
+	for _, p := range participants {
+		wg.Add(1)
+		go func(p *GPTParticipant) {
+			defer wg.Done()
+			p.Leave(LeaveReason_Shutdown)
+		}(p)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	sttpb "cloud.google.com/go/speech/apiv1/speechpb"
+	"github.com/livekit/protocol/logger"
+	"github.com/sashabaranov/go-openai"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// Fault injection for the integration tests (see FaultsConfig): the calls to the providers fail, hang or slow
+// down on demand, to exercise the reconnection of the speech streams, the circuit breakers and the barge-in.
+// The faults are injected under the health wrappers, the breakers see them like real failures
+
+const (
+	FaultMode_Error = "error" // The call fails right away
+	FaultMode_Hang  = "hang"  // The call blocks until it is canceled
+	FaultMode_Delay = "delay" // The call is slowed down by FaultConfig.Delay
+
+	FaultError_Unavailable = "unavailable"  // 503, gRPC Unavailable for STT
+	FaultError_RateLimited = "rate_limited" // 429, gRPC ResourceExhausted for STT
+)
+
+const (
+	faultProvider_STT = "stt"
+	faultProvider_LLM = "llm"
+	faultProvider_TTS = "tts"
+
+	faultsEnv     = "KITT_FAULTS"
+	maxFaultsBody = 4096
+)
+
+var faultProviders = []string{faultProvider_STT, faultProvider_LLM, faultProvider_TTS}
+
+// nil when the faults are disabled
+type faultInjector struct {
+	lock   sync.Mutex
+	faults map[string]config.FaultConfig // By provider
+}
+
+// spec uses the syntax of KITT_FAULTS, it enables the faults and overrides the ones of the config
+func newFaultInjector(conf config.FaultsConfig, spec string) (*faultInjector, error) {
+	faults := map[string]config.FaultConfig{
+		faultProvider_STT: conf.STT,
+		faultProvider_LLM: conf.LLM,
+		faultProvider_TTS: conf.TTS,
+	}
+	if spec != "" {
+		overrides, err := parseFaults(spec)
+		if err != nil {
+			return nil, err
+		}
+		for provider, fault := range overrides {
+			faults[provider] = fault
+		}
+	} else if !conf.Enabled {
+		return nil, nil
+	}
+
+	for provider, fault := range faults {
+		if err := validateFault(fault); err != nil {
+			return nil, fmt.Errorf("%s: %w", provider, err)
+		}
+	}
+
+	f := &faultInjector{faults: faults}
+	logger.Warnw("fault injection enabled, the providers will fail on purpose", nil, "faults", f.String())
+	return f, nil
+}
+
+// Comma-separated provider=mode[:arg][@probability], arg is the delay of the delay mode or the error of the
+// error mode, e.g "stt=error:rate_limited,llm=delay:3s@0.5,tts=hang". The providers not listed have no fault
+func parseFaults(spec string) (map[string]config.FaultConfig, error) {
+	faults := make(map[string]config.FaultConfig)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		provider, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid fault %q, expected provider=mode", entry)
+		}
+		provider = strings.TrimSpace(provider)
+		if !isFaultProvider(provider) {
+			return nil, fmt.Errorf("unknown provider %q", provider)
+		}
+
+		var fault config.FaultConfig
+		value, probability, ok := strings.Cut(strings.TrimSpace(value), "@")
+		if ok {
+			p, err := strconv.ParseFloat(probability, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid probability %q", probability)
+			}
+			fault.Probability = p
+		}
+
+		fault.Mode = value
+		if mode, arg, ok := strings.Cut(value, ":"); ok {
+			fault.Mode = mode
+			if mode == FaultMode_Delay {
+				delay, err := time.ParseDuration(arg)
+				if err != nil {
+					return nil, fmt.Errorf("invalid delay %q", arg)
+				}
+				fault.Delay = delay
+			} else {
+				fault.Error = arg
+			}
+		}
+
+		if err := validateFault(fault); err != nil {
+			return nil, fmt.Errorf("%s: %w", provider, err)
+		}
+		faults[provider] = fault
+	}
+	return faults, nil
+}
+
+func isFaultProvider(provider string) bool {
+	for _, p := range faultProviders {
+		if p == provider {
+			return true
+		}
+	}
+	return false
+}
+
+func validateFault(fault config.FaultConfig) error {
+	switch fault.Mode {
+	case "", FaultMode_Hang:
+	case FaultMode_Error:
+		if fault.Error != "" && fault.Error != FaultError_Unavailable && fault.Error != FaultError_RateLimited {
+			return fmt.Errorf("unknown error %q", fault.Error)
+		}
+	case FaultMode_Delay:
+		if fault.Delay <= 0 {
+			return fmt.Errorf("the delay mode requires a delay")
+		}
+	default:
+		return fmt.Errorf("unknown mode %q", fault.Mode)
+	}
+
+	if fault.Probability < 0 || fault.Probability > 1 {
+		return fmt.Errorf("the probability must be between 0 and 1")
+	}
+	return nil
+}
+
+// Replace the faults, the providers not listed have no fault
+func (f *faultInjector) set(faults map[string]config.FaultConfig) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.faults = faults
+}
+
+// The faults with the syntax of KITT_FAULTS
+func (f *faultInjector) String() string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	var entries []string
+	for provider, fault := range f.faults {
+		if fault.Mode == "" {
+			continue
+		}
+
+		entry := provider + "=" + fault.Mode
+		if fault.Mode == FaultMode_Delay {
+			entry += ":" + fault.Delay.String()
+		} else if fault.Mode == FaultMode_Error && fault.Error != "" {
+			entry += ":" + fault.Error
+		}
+		if fault.Probability > 0 {
+			entry += "@" + strconv.FormatFloat(fault.Probability, 'f', -1, 64)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// Returns the error the call must fail with, nil to continue the call (possibly after the delay)
+func (f *faultInjector) inject(ctx context.Context, provider string) error {
+	if f == nil {
+		return nil
+	}
+
+	f.lock.Lock()
+	fault := f.faults[provider]
+	f.lock.Unlock()
+	if fault.Mode == "" || (fault.Probability > 0 && rand.Float64() >= fault.Probability) {
+		return nil
+	}
+
+	logger.Debugw("injecting a fault", "provider", provider, "mode", fault.Mode)
+	switch fault.Mode {
+	case FaultMode_Error:
+		return faultError(provider, fault.Error)
+	case FaultMode_Hang:
+		<-ctx.Done()
+		return ctx.Err()
+	case FaultMode_Delay:
+		select {
+		case <-time.After(fault.Delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// Errors of the real providers, so the retries and the breakers handle them the same way
+func faultError(provider, kind string) error {
+	rateLimited := kind == FaultError_RateLimited
+	if provider == faultProvider_STT {
+		if rateLimited {
+			return status.Error(codes.ResourceExhausted, "injected fault")
+		}
+		return status.Error(codes.Unavailable, "injected fault")
+	}
+
+	code := http.StatusServiceUnavailable
+	if rateLimited {
+		code = http.StatusTooManyRequests
+	}
+	return &openai.APIError{
+		HTTPStatusCode: code,
+		Message:        "injected fault",
+	}
+}
+
+func (f *faultInjector) wrapLLM(llm LLMClient) LLMClient {
+	if f == nil {
+		return llm
+	}
+	return &faultLLM{LLMClient: llm, faults: f}
+}
+
+func (f *faultInjector) wrapSynthesizer(synthesizer SpeechSynthesizer) SpeechSynthesizer {
+	if f == nil {
+		return synthesizer
+	}
+	return &faultSynthesizer{SpeechSynthesizer: synthesizer, faults: f}
+}
+
+// The results of the stream are also delayed or failed
+func (f *faultInjector) wrapSpeechStream(ctx context.Context, stream sttpb.Speech_StreamingRecognizeClient) sttpb.Speech_StreamingRecognizeClient {
+	if f == nil {
+		return stream
+	}
+	return &faultSpeechStream{Speech_StreamingRecognizeClient: stream, ctx: ctx, faults: f}
+}
+
+type faultLLM struct {
+	LLMClient
+	faults *faultInjector
+}
+
+func (l *faultLLM) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	if err := l.faults.inject(ctx, faultProvider_LLM); err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	return l.LLMClient.CreateChatCompletion(ctx, req)
+}
+
+func (l *faultLLM) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (LLMStream, error) {
+	if err := l.faults.inject(ctx, faultProvider_LLM); err != nil {
+		return nil, err
+	}
+	return l.LLMClient.CreateChatCompletionStream(ctx, req)
+}
+
+type faultSynthesizer struct {
+	SpeechSynthesizer
+	faults *faultInjector
+}
+
+func (s *faultSynthesizer) Synthesize(ctx context.Context, text string, language *Language) ([]byte, error) {
+	if err := s.faults.inject(ctx, faultProvider_TTS); err != nil {
+		return nil, err
+	}
+	return s.SpeechSynthesizer.Synthesize(ctx, text, language)
+}
+
+func (s *faultSynthesizer) SynthesizeStream(ctx context.Context, text string, language *Language) (io.ReadCloser, error) {
+	if err := s.faults.inject(ctx, faultProvider_TTS); err != nil {
+		return nil, err
+	}
+	return s.SpeechSynthesizer.SynthesizeStream(ctx, text, language)
+}
+
+type faultSpeechStream struct {
+	sttpb.Speech_StreamingRecognizeClient
+	ctx    context.Context
+	faults *faultInjector
+}
+
+func (s *faultSpeechStream) Recv() (*sttpb.StreamingRecognizeResponse, error) {
+	if err := s.faults.inject(s.ctx, faultProvider_STT); err != nil {
+		return nil, err
+	}
+	return s.Speech_StreamingRecognizeClient.Recv()
+}
+
+// GET returns the faults, PUT replaces them (KITT_FAULTS syntax in the body, empty to clear them).
+// Only registered when the faults are enabled, always behind the admin signature
+func (s *LiveGPT) faultsHandler(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		_, _ = w.Write([]byte(s.faults.String()))
+	case http.MethodPut:
+		body, err := io.ReadAll(io.LimitReader(req.Body, maxFaultsBody))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		faults, err := parseFaults(strings.TrimSpace(string(body)))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		s.audit(req, "faults", "", string(body))
+		s.faults.set(faults)
+		logger.Warnw("faults changed", nil, "faults", s.faults.String())
+		_, _ = w.Write([]byte(s.faults.String()))
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// The faults can break the live rooms: PUT /faults requires a signature even when admin_signature.required is false
+func TestFaultsRouteSigned(t *testing.T) {
+	s := newSignatureTestServer(false)
+	faults, err := newFaultInjector(config.FaultsConfig{Enabled: true}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.faults = faults
+	routes := s.routes()
+
+	tests := []struct {
+		name   string
+		req    *http.Request
+		status int
+		faults string
+	}{
+		{
+			name:   "unsigned",
+			req:    httptest.NewRequest(http.MethodPut, "/faults", strings.NewReader("tts=error")),
+			status: http.StatusUnauthorized,
+			faults: "",
+		},
+		{
+			name:   "unsigned get",
+			req:    httptest.NewRequest(http.MethodGet, "/faults", nil),
+			status: http.StatusUnauthorized,
+			faults: "",
+		},
+		{
+			name:   "signed",
+			req:    signedTestRequest(http.MethodPut, "/faults", "faults", []byte("tts=error")),
+			status: http.StatusOK,
+			faults: "tts=error",
+		},
+	}
+
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		routes.ServeHTTP(w, tt.req)
+		if w.Code != tt.status {
+			t.Errorf("%s: got %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if got := s.faults.String(); got != tt.faults {
+			t.Errorf("%s: faults %q, want %q", tt.name, got, tt.faults)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"errors"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+	lksdk "github.com/livekit/server-sdk-go"
+)
+
+// The clients signal when a participant is about to speak, KITT waits for them before answering.
+// The signals expire: the typing one is repeated while typing, the others are released by the clients
+
+const (
+	signal_Typing     = "typing"
+	signal_PushToTalk = "push_to_talk"
+	signal_HandRaised = "hand_raised"
+
+	floorCheckInterval = 200 * time.Millisecond
+)
+
+var errFloorTaken = errors.New("another participant is about to speak")
+
+func (p *GPTParticipant) floorSignal(rp *lksdk.RemoteParticipant, signal string, active bool) {
+	var ttl time.Duration
+	switch signal {
+	case signal_Typing:
+		ttl = p.conf.TurnTaking.TypingTimeout
+	case signal_PushToTalk, signal_HandRaised:
+		ttl = p.conf.TurnTaking.MaxHold
+	default:
+		logger.Warnw("unknown signal", nil, "signal", signal, "participant", rp.Identity())
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	signals := p.floor[rp.SID()]
+	if !active {
+		delete(signals, signal)
+		return
+	}
+
+	if signals == nil {
+		signals = make(map[string]time.Time)
+		p.floor[rp.SID()] = signals
+	}
+	signals[signal] = time.Now().Add(ttl)
+}
+
+func (p *GPTParticipant) releaseFloor(rp *lksdk.RemoteParticipant) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	delete(p.floor, rp.SID())
+}
+
+// True when a participant other than rp is about to speak, typing only counts when withTyping is set
+func (p *GPTParticipant) floorTaken(rp *lksdk.RemoteParticipant, withTyping bool) bool {
+	if !p.conf.TurnTaking.Enabled {
+		return false
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	now := time.Now()
+	for sid, signals := range p.floor {
+		if sid == rp.SID() {
+			continue // The participant being answered is waiting for the answer
+		}
+
+		for signal, expiration := range signals {
+			if now.After(expiration) {
+				delete(signals, signal)
+				continue
+			}
+			if withTyping || signal != signal_Typing {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns false when the floor is still taken after TurnTaking.MaxDelay, the answer is then dropped
+func (p *GPTParticipant) waitForFloor(rp *lksdk.RemoteParticipant) bool {
+	if !p.floorTaken(rp, true) {
+		return true
+	}
+
+	logger.Debugw("floor taken, delaying the answer", "participant", rp.SID())
+	ticker := time.NewTicker(floorCheckInterval)
+	defer ticker.Stop()
+
+	deadline := time.After(p.conf.TurnTaking.MaxDelay)
+	for {
+		select {
+		case <-ticker.C:
+			if !p.floorTaken(rp, true) {
+				return true
+			}
+		case <-deadline:
+			return false
+		case <-p.ctx.Done():
+			return false
+		}
+	}
+}
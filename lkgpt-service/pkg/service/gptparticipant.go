@@ -21,6 +21,15 @@ import (
 	"github.com/livekit/protocol/livekit"
 	"github.com/livekit/protocol/logger"
 	lksdk "github.com/livekit/server-sdk-go"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// Reply policies when a single participant is in the room with KITT
+const (
+	ReplyPolicy_Always   = "always"    // Answer every sentence
+	ReplyPolicy_WakeWord = "wake_word" // Only answer after the activation words, like in a multi-user meeting
+	ReplyPolicy_Command  = "command"   // Only answer after an activate command packet
 )
 
 var (
@@ -29,121 +38,278 @@ var (
 
 	BotIdentity = "KITT"
 
-	// Naive trigger/activation implementation
+	// Naive trigger/activation implementation, used when no wake word engine is running (see wakeword.go)
 	GreetingWords = []string{"hi", "hello", "hey", "hallo", "salut", "bonjour", "hola", "eh", "ey"}
 	NameWords     = []string{"kit", "gpt", "kitt", "livekit", "live-kit", "kid"}
 
 	ActivationWordsLen = 2
 	ActivationTimeout  = 4 * time.Second // If the participant didn't say anything for this duration, stop listening
 
-	Languages = map[string]*Language{
-		"en-US": {
-			Code:             "en-US",
-			Label:            "English",
-			TranscriberCode:  "en-US",
-			SynthesizerModel: "en-US-Wavenet-D",
-		},
-		"fr-FR": {
-			Code:             "fr-FR",
-			Label:            "Français",
-			TranscriberCode:  "fr-FR",
-			SynthesizerModel: "fr-FR-Wavenet-B",
-		},
-		"de-DE": {
-			Code:             "de-DE",
-			Label:            "German",
-			TranscriberCode:  "de-DE",
-			SynthesizerModel: "de-DE-Wavenet-B",
-		},
-		"es-ES": {
-			Code:             "es-ES",
-			Label:            "Spanish",
-			TranscriberCode:  "es-ES",
-			SynthesizerModel: "es-ES-Wavenet-B",
-		},
-	}
-	DefaultLanguage = Languages["en-US"]
+	republishBackoff     = 500 * time.Millisecond
+	republishMaxAttempts = 5
 )
 
-type Language struct {
-	Code             string
-	Label            string
-	TranscriberCode  string
-	SynthesizerModel string
-}
-
 type ParticipantMetadata struct {
 	LanguageCode string `json:"languageCode,omitempty"`
+	Email        string `json:"email,omitempty"`  // The meeting notes are sent to this address
+	Memory       bool   `json:"memory,omitempty"` // Opt-in to the long-term memory across meetings
+
+	MinConfidence *float32 `json:"minConfidence,omitempty"` // Overrides transcription.min_confidence (e.g. noisy room)
+}
+
+// Participant who joined the meeting at some point
+type attendee struct {
+	Identity string
+	Name     string
+	Metadata ParticipantMetadata
+}
+
+func parseParticipantMetadata(rp *lksdk.RemoteParticipant) ParticipantMetadata {
+	metadata := ParticipantMetadata{}
+	if rp.Metadata() != "" {
+		err := json.Unmarshal([]byte(rp.Metadata()), &metadata)
+		if err != nil {
+			logger.Warnw("error unmarshalling participant metadata", err)
+		}
+	}
+	return metadata
 }
 
 type GPTParticipant struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
+	conf      *config.Config
+	bus       *EventBus
 	room      *lksdk.Room
 	sttClient *stt.Client
 	ttsClient *tts.Client
 	gptClient *openai.Client
+	fallback  *SpeechFallback  // Transcription when the speech stream is unavailable, nil when disabled
+	faults    *faultInjector   // nil unless testing, see faults.go
+	recorder  *sessionRecorder // nil when the sessions aren't recorded, see replay.go
 
 	gptTrack *GPTTrack
 
 	transcribers map[string]*Transcriber
-	synthesizer  *Synthesizer
+	synthesizer  SpeechSynthesizer
+	llm          *sessionLLM // Records the outputs of the LLM or replays them
 	completion   *ChatCompletion
+	tools        *ToolSet
 
 	lock           sync.Mutex
 	onDisconnected func()
-	events         []*MeetingEvent
+	onFinished     func(record *MeetingRecord)
+	stopReplay     context.CancelFunc  // Set while a session is replayed, see replay.go
+	behavior       string              // RoomBehavior_*, switched on the size of the room, see presets.go
+	history        *History            // Conversation with KITT, the history of the completions
+	transcript     *transcriptRecorder // Whole meeting, used for the notes
+	analytics      *meetingAnalytics   // nil when the analytics are disabled
+	attendees      map[string]*attendee
+	memories       map[string][]string             // identity -> facts remembered from the previous meetings
+	lastSpoke      map[string]time.Time            // sid -> last final transcript, the last speakers are kept transcribed when the load is critical
+	floor          map[string]map[string]time.Time // sid -> signal -> expiration, see floor.go
+	answerLog      []answerRecord                  // Answers of the last minute, see cooldown.go
+	lastAnswerEnd  time.Time
+	loadLevel      LoadLevel
+	replyLang      *Language              // Language of every answer, nil to answer in the language of the speaker
+	langVotes      map[string]int         // language code -> words of the final transcripts, see roomlanguage.go
+	detached       map[string]*time.Timer // sid -> close of the transcriber of an unsubscribed track, see trackUnsubscribed
+	finishOnce     sync.Once
+
+	joinState atomic.Int32 // See join.go
+	state     atomic.Int32 // Last gptState published, sent in the snapshots
+
+	roomLanguage atomic.Pointer[Language] // Detected language of the room, nil until then
+	langDetected chan struct{}            // Closed once roomLanguage is set
 
 	// Current active participant
 	isBusy            atomic.Bool
 	activeInterim     atomic.Bool // True when KITT has been activated using an interim result
+	chatOnly          atomic.Bool // Nobody publishes a microphone, see chatonly.go
+	leaving           atomic.Bool // See farewell.go
+	replaying         atomic.Bool // The live transcripts are ignored, see replay.go
+	connectedAt       time.Time
 	activeId          uint64
 	activeParticipant *lksdk.RemoteParticipant // If set, answer his next sentence/question
 	lastActivity      time.Time
+	speculation       *speculation // Completion started on an interim result
+	escalation        escalationState
+	calendar          *CalendarEvent // Event the room has been scheduled for, if any
+	notes             *MeetingNotes  // Notes mode only
+	agenda            *Agenda        // Facilitator mode only
+	interrupted       *interruptedAnswer
+	agendaVersion     uint64
+	memory            MemoryStore // nil when the memory is disabled
+	store             BlobStore   // nil when the storage couldn't be created
+	usage             *usageMeter
+	pipeline          *Pipeline      // Custom stages, see pipeline.go
+	chunks            chunkAssembler // Packets sent in several chunks by the clients
+	scratchpad        scratchpad     // Notes of the LLM, see scratchpad.go
+	poll              *poll          // Last poll of the room, see polls.go
+	issues            issueProposals // Action items waiting for a confirmation, see issues.go
+	current           *currentAnswer // Answer being spoken, see bargein.go
+	bargedIn          string         // sid of the participant who stopped the last answer
+	clarifications    clarifications // Clarifying questions waiting for an answer, see clarification.go
+	health            []*HealthIssue // Last issues published, see health.go
+
+	waiting []*waitingPrompt // Prompts received while answering, see overlap.go
+	waited  []string         // Participants whose prompts waited, for the next answer
 }
 
-func ConnectGPTParticipant(url, token string, sttClient *stt.Client, ttsClient *tts.Client, gptClient *openai.Client) (*GPTParticipant, error) {
+// Dependencies of a GPTParticipant, built by LiveGPT for each room it joins.
+// The optional ones (memory, store, health, faults, recorder) are nil when disabled
+type participantDeps struct {
+	conf *config.Config
+
+	// Shared by the rooms
+	memory    MemoryStore
+	store     BlobStore
+	usage     *usageMeter
+	sttClient *stt.Client
+	ttsClient *tts.Client
+	llm       LLMClient
+	gptClient *openai.Client
+	health    *providerHealth
+	faults    *faultInjector
+
+	// Of the room
+	bus      *EventBus
+	pipeline *Pipeline
+	tools    *ToolSet
+	recorder *sessionRecorder
+}
+
+func ConnectGPTParticipant(url, token string, deps *participantDeps) (*GPTParticipant, error) {
+	conf := deps.conf
+	synthesizer, err := NewSpeechSynthesizer(conf.Synthesis, conf.Azure, deps.ttsClient)
+	if err != nil {
+		return nil, err
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
+	sessionLLM := newSessionLLM(deps.llm, conf.Replay, deps.recorder)
 
 	p := &GPTParticipant{
 		ctx:          ctx,
 		cancel:       cancel,
-		sttClient:    sttClient,
-		ttsClient:    ttsClient,
-		gptClient:    gptClient,
+		conf:         conf,
+		bus:          deps.bus,
+		sttClient:    deps.sttClient,
+		ttsClient:    deps.ttsClient,
+		gptClient:    deps.gptClient,
 		transcribers: make(map[string]*Transcriber),
-		synthesizer:  NewSynthesizer(ttsClient),
-		completion:   NewChatCompletion(gptClient),
+		synthesizer:  instrumentSynthesizer(deps.health.wrapSynthesizer(deps.faults.wrapSynthesizer(synthesizer))),
+		faults:       deps.faults,
+		recorder:     deps.recorder,
+		llm:          sessionLLM,
+		completion:   NewChatCompletion(sessionLLM, conf.LLM),
+		tools:        deps.tools,
+		history:      NewHistory(),
+		transcript:   &transcriptRecorder{},
+		attendees:    make(map[string]*attendee),
+		memories:     make(map[string][]string),
+		lastSpoke:    make(map[string]time.Time),
+		floor:        make(map[string]map[string]time.Time),
+		langVotes:    make(map[string]int),
+		langDetected: make(chan struct{}),
+		detached:     make(map[string]*time.Timer),
+		memory:       deps.memory,
+		store:        deps.store,
+		usage:        deps.usage,
+		pipeline:     deps.pipeline,
+		connectedAt:  time.Now(),
+	}
+	p.completion.SetGuardrails(conf.Guardrails)
+	fallbackConf := conf.Transcription.Fallback
+	if conf.Transcription.Provider == TranscriptionProvider_Azure {
+		// Azure has no speech stream, every utterance goes through the fallback
+		fallbackConf.Enabled = true
+		fallbackConf.Provider = FallbackProvider_Azure
+	}
+	if fallback, err := NewSpeechFallback(fallbackConf, conf.Azure, deps.gptClient); err != nil {
+		logger.Errorw("failed to create the transcription fallback", err)
+	} else {
+		p.fallback = fallback
+	}
+	if conf.Reply.Language != "" {
+		p.setReplyLanguage(conf.Reply.Language)
 	}
+	p.completion.SetInjectionDefense(conf.Injection)
+	p.completion.SetQuestionsPolicy(conf.Reply.MultipleQuestions)
+	p.completion.SetUsageMeter(deps.usage)
+	p.synthesizer.SetUsageMeter(deps.usage)
 
 	roomCallback := &lksdk.RoomCallback{
 		ParticipantCallback: lksdk.ParticipantCallback{
 			OnTrackPublished:    p.trackPublished,
+			OnTrackUnpublished:  p.trackUnpublished,
 			OnTrackSubscribed:   p.trackSubscribed,
 			OnTrackUnsubscribed: p.trackUnsubscribed,
+			OnTrackMuted:        p.trackMuted,
+			OnTrackUnmuted:      p.trackUnmuted,
+			OnDataReceived:      p.dataReceived,
+			OnMetadataChanged:   p.metadataChanged,
 		},
+		OnParticipantConnected:    p.participantConnected,
 		OnParticipantDisconnected: p.participantDisconnected,
+		OnRoomMetadataChanged:     p.roomMetadataChanged,
+		OnActiveSpeakersChanged:   p.activeSpeakersChanged,
 		OnDisconnected:            p.disconnected,
 	}
 
 	room, err := lksdk.ConnectToRoomWithToken(url, token, roomCallback, lksdk.WithAutoSubscribe(false))
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
-	track, err := NewGPTTrack()
+	// The join is retried (see joinFailed), don't leave a stale KITT in the room
+	track, err := NewGPTTrack(conf.Synthesis)
 	if err != nil {
+		room.Disconnect()
+		cancel()
 		return nil, err
 	}
 
 	_, err = track.Publish(room.LocalParticipant)
 	if err != nil {
+		room.Disconnect()
+		cancel()
 		return nil, err
 	}
 
 	p.gptTrack = track
 	p.room = room
+	track.OnUnbind(p.trackUnbound)
+	p.roomMetadataChanged(room.Metadata())
+	p.behavior = p.roomBehavior("")
+	deps.bus.Subscribe(&packetSink{room: room})
+	deps.bus.Subscribe(p.transcript)
+	if conf.Analytics.Enabled {
+		p.analytics = newMeetingAnalytics(conf.Analytics)
+		deps.bus.Subscribe(p.analytics)
+	}
+	for _, rp := range room.GetParticipants() {
+		p.addAttendee(rp)
+	}
+	p.sendCapabilities()
+	p.startJoinBehavior()
+	if p.isNoteTaker() {
+		go p.takeNotes()
+	}
+	if p.isFacilitator() {
+		go p.facilitate()
+	}
+	if conf.ChatOnly.Enabled && !p.isNoteTaker() {
+		go p.watchChatOnly()
+	}
+	if conf.Leave.IdleTimeout > 0 {
+		go p.watchIdle()
+	}
+	if conf.Leave.MaxDuration > 0 {
+		go p.watchMaxDuration()
+	}
 
 	go func() {
 		// Check if there's no participant when KITT joins.
@@ -157,6 +323,53 @@ func ConnectGPTParticipant(url, token string, sttClient *stt.Client, ttsClient *
 	return p, nil
 }
 
+func (p *GPTParticipant) Events() *EventBus {
+	return p.bus
+}
+
+// Snapshot of the context injected in the system prompt. Takes p.lock, never call it while holding the lock
+func (p *GPTParticipant) meetingContext() *MeetingContext {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	memories := make(map[string][]string, len(p.memories))
+	for identity, facts := range p.memories {
+		memories[identity] = facts
+	}
+
+	return &MeetingContext{
+		Calendar: p.calendar,
+		Agenda:   p.agenda,
+		Memories: memories,
+		Language: p.replyLang,
+
+		Scratchpad: p.scratchpad.all(),
+	}
+}
+
+// Language of the answers to a speaker of language, the reply language of the room when set
+func (p *GPTParticipant) replyLanguage(language *Language) *Language {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.replyLang != nil {
+		return p.replyLang
+	}
+	return language
+}
+
+func (p *GPTParticipant) setReplyLanguage(code string) {
+	language := findLanguage(code)
+	if language == nil {
+		logger.Warnw("unknown reply language", nil, "language", code)
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.replyLang = language
+}
+
 func (p *GPTParticipant) OnDisconnected(f func()) {
 	p.lock.Lock()
 	defer p.lock.Unlock()
@@ -164,10 +377,25 @@ func (p *GPTParticipant) OnDisconnected(f func()) {
 	p.onDisconnected = f
 }
 
+// Called once when KITT leaves the room, used for the post-meeting processing
+func (p *GPTParticipant) OnFinished(f func(record *MeetingRecord)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.onFinished = f
+}
+
 func (p *GPTParticipant) Disconnect() {
 	logger.Infow("disconnecting gpt participant", "room", p.room.Name())
 	p.room.Disconnect()
 
+	p.lock.Lock()
+	for sid, timer := range p.detached {
+		timer.Stop()
+		delete(p.detached, sid)
+	}
+	p.lock.Unlock()
+
 	for _, transcriber := range p.transcribers {
 		transcriber.Close()
 	}
@@ -176,8 +404,15 @@ func (p *GPTParticipant) Disconnect() {
 
 	p.lock.Lock()
 	onDisconnected := p.onDisconnected
+	onFinished := p.onFinished
 	p.lock.Unlock()
 
+	if onFinished != nil {
+		p.finishOnce.Do(func() {
+			onFinished(p.meetingRecord())
+		})
+	}
+
 	if onDisconnected != nil {
 		onDisconnected()
 	}
@@ -187,6 +422,12 @@ func (p *GPTParticipant) trackPublished(publication *lksdk.RemoteTrackPublicatio
 	if publication.Source() != livekit.TrackSource_MICROPHONE {
 		return
 	}
+	p.checkRoomBehavior()
+
+	if p.currentLoadLevel() == LoadLevel_Critical {
+		p.updateSubscriptions() // Only if it is one of the last speakers
+		return
+	}
 
 	err := publication.SetSubscribed(true)
 	if err != nil {
@@ -199,71 +440,361 @@ func (p *GPTParticipant) trackSubscribed(track *webrtc.TrackRemote, publication
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
-	if _, ok := p.transcribers[rp.SID()]; ok {
-		return
-	}
+	if transcriber, ok := p.transcribers[rp.SID()]; ok {
+		timer, detached := p.detached[rp.SID()]
+		if !detached {
+			return
+		}
 
-	metadata := ParticipantMetadata{}
-	if rp.Metadata() != "" {
-		err := json.Unmarshal([]byte(rp.Metadata()), &metadata)
-		if err != nil {
-			logger.Warnw("error unmarshalling participant metadata", err)
+		// Resubscribed within the grace period, the speech stream is still open
+		timer.Stop()
+		delete(p.detached, rp.SID())
+		if transcriber.SameCodec(track.Codec()) {
+			logger.Infow("reusing the transcriber", "participant", rp.Identity())
+			if publication.IsMuted() {
+				transcriber.Pause() // Muted while unsubscribed
+			} else {
+				transcriber.Resume()
+			}
+			go p.forwardRTP(track, transcriber, rp)
+			return
 		}
+
+		delete(p.transcribers, rp.SID())
+		go transcriber.Close() // Its results are handled under the lock
 	}
 
+	transcriber, err := p.startTranscriber(track.Codec(), rp, publication.IsMuted())
+	if err != nil {
+		logger.Errorw("failed to create the transcriber", err)
+		return
+	}
+	go p.forwardRTP(track, transcriber, rp)
+}
+
+// Transcriber in the language of the metadata of rp, the caller must hold the lock
+func (p *GPTParticipant) startTranscriber(codec webrtc.RTPCodecParameters, rp *lksdk.RemoteParticipant, muted bool) (*Transcriber, error) {
+	metadata := parseParticipantMetadata(rp)
 	language, ok := Languages[metadata.LanguageCode]
 	if !ok {
-		language = DefaultLanguage
+		language = p.defaultLanguage()
 	}
 
 	logger.Infow("starting to transcribe", "participant", rp.Identity(), "language", language.Code)
-	transcriber, err := NewTranscriber(track.Codec(), p.sttClient, language)
+	transcriber, err := NewTranscriber(codec, p.sttClient, language, p.fallback, p.conf.Transcription)
 	if err != nil {
-		logger.Errorw("failed to create the transcriber", err)
-		return
+		return nil, err
+	}
+
+	transcriber.SetUsageMeter(p.usage)
+	transcriber.SetFaults(p.faults)
+	if muted {
+		transcriber.Pause()
 	}
+	transcriber.SetDegraded(p.loadLevel >= LoadLevel_Reduced)
+	detection := p.conf.Transcription.LanguageDetection
+	transcriber.SetDetectLanguage((detection.Enabled && !ok) || detection.PerUtterance, p.candidateLanguages())
+	transcriber.SetWakeWord(newWakeWordDetector(p.conf.WakeWord, codec, func(name string) {
+		p.wakeWordDetected(rp, name)
+	}))
 
 	p.transcribers[rp.SID()] = transcriber
 	go func() {
 		for result := range transcriber.Results() {
+			if p.replaying.Load() {
+				continue // The recorded transcripts are fed instead, see replay.go
+			}
 			p.onTranscriptionReceived(result, rp, transcriber)
 		}
 	}()
+	return transcriber, nil
+}
 
-	// Forward track packets to the transcriber
-	go func() {
-		for {
-			pkt, _, err := track.ReadRTP()
-			if err != nil {
-				if err != io.EOF {
-					logger.Errorw("failed to read track", err, "participant", rp.SID())
-				}
-				return
+// Rebuild the transcriber of a participant who changed their languageCode, without reconnecting
+func (p *GPTParticipant) metadataChanged(oldMetadata string, participant lksdk.Participant) {
+	rp, ok := participant.(*lksdk.RemoteParticipant)
+	if !ok {
+		return
+	}
+
+	old := ParticipantMetadata{}
+	if oldMetadata != "" {
+		_ = json.Unmarshal([]byte(oldMetadata), &old)
+	}
+	if parseParticipantMetadata(rp).LanguageCode == old.LanguageCode {
+		return
+	}
+
+	p.lock.Lock()
+	transcriber, ok := p.transcribers[rp.SID()]
+	if _, detached := p.detached[rp.SID()]; !ok || detached {
+		p.lock.Unlock()
+		return // The metadata is read when the track is (re)subscribed
+	}
+
+	next, err := p.startTranscriber(transcriber.rtpCodec, rp, transcriber.IsMuted())
+	if err != nil {
+		p.lock.Unlock()
+		logger.Errorw("failed to rebuild the transcriber", err, "participant", rp.Identity())
+		return
+	}
+	transcriber.ReplaceWith(next)
+	p.lock.Unlock()
+
+	p.discardSpeculation(rp) // Speculated on the other language
+	transcriber.Close()
+}
+
+// Forward track packets to the transcriber
+func (p *GPTParticipant) forwardRTP(track *webrtc.TrackRemote, transcriber *Transcriber, rp *lksdk.RemoteParticipant) {
+	for {
+		pkt, _, err := track.ReadRTP()
+		if err != nil {
+			if err != io.EOF {
+				logger.Errorw("failed to read track", err, "participant", rp.SID())
 			}
+			return
+		}
 
+		err = transcriber.WriteRTP(pkt)
+		for err == io.EOF {
+			next := transcriber.Replacement()
+			if next == nil {
+				break
+			}
+			// Rebuilt in another language (see metadataChanged), pkt is the first packet of the new one
+			transcriber = next
 			err = transcriber.WriteRTP(pkt)
-			if err != nil {
-				if err != io.EOF {
-					logger.Errorw("failed to forward pkt to the transcriber", err, "participant", rp.SID())
-				}
-				return
+		}
+		if err != nil {
+			if err != io.EOF {
+				logger.Errorw("failed to forward pkt to the transcriber", err, "participant", rp.SID())
 			}
+			return
 		}
-	}()
+	}
 }
 
+// The transcriber is kept for the grace period: a track resubscribed after a network blip reuses its speech stream
 func (p *GPTParticipant) trackUnsubscribed(track *webrtc.TrackRemote, publication *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
+	sid := rp.SID()
 	p.lock.Lock()
-	if transcriber, ok := p.transcribers[rp.SID()]; ok {
+	transcriber, ok := p.transcribers[sid]
+	if !ok {
 		p.lock.Unlock()
+		return
+	}
+
+	if grace := p.conf.Transcription.ResubscribeGrace; grace > 0 && p.ctx.Err() == nil {
+		if timer, detached := p.detached[sid]; detached {
+			timer.Stop()
+		}
+		p.detached[sid] = time.AfterFunc(grace, func() {
+			p.closeDetached(sid)
+		})
+		p.lock.Unlock()
+		return
+	}
+
+	delete(p.transcribers, sid)
+	p.lock.Unlock()
+	transcriber.Close()
+}
+
+// Close the transcriber of a track that wasn't resubscribed
+func (p *GPTParticipant) closeDetached(sid string) {
+	p.lock.Lock()
+	timer, detached := p.detached[sid]
+	if !detached {
+		p.lock.Unlock()
+		return // Reused, or closed by Disconnect
+	}
+	timer.Stop()
+	delete(p.detached, sid)
+	transcriber := p.transcribers[sid]
+	delete(p.transcribers, sid)
+	p.lock.Unlock()
+
+	if transcriber != nil {
+		logger.Debugw("closing the detached transcriber", "participant", sid)
 		transcriber.Close()
-		p.lock.Lock()
-		delete(p.transcribers, rp.SID())
 	}
+}
+
+func (p *GPTParticipant) trackMuted(publication lksdk.TrackPublication, participant lksdk.Participant) {
+	p.setMuted(publication, participant, true)
+}
+
+func (p *GPTParticipant) trackUnmuted(publication lksdk.TrackPublication, participant lksdk.Participant) {
+	p.setMuted(publication, participant, false)
+}
+
+// Pause the transcription of a muted microphone (Google bills the open streams) and note it in the history
+func (p *GPTParticipant) setMuted(publication lksdk.TrackPublication, participant lksdk.Participant, muted bool) {
+	rp, ok := participant.(*lksdk.RemoteParticipant)
+	if !ok || publication.Source() != livekit.TrackSource_MICROPHONE {
+		return
+	}
+
+	p.lock.Lock()
+	transcriber := p.transcribers[rp.SID()]
 	p.lock.Unlock()
+
+	p.history.Append(&MeetingEvent{
+		Microphone: &MicrophoneEvent{
+			Muted:           muted,
+			ParticipantName: rp.Identity(),
+			Time:            time.Now(),
+		},
+	})
+
+	if transcriber != nil {
+		if muted {
+			transcriber.Pause()
+		} else {
+			transcriber.Resume()
+		}
+	}
+
+	p.bus.Publish(&RoomEvent{
+		Type: RoomEvent_Mute,
+		Room: p.room.Name(),
+		Data: &MuteEvent{
+			ParticipantSid:  rp.SID(),
+			ParticipantName: rp.Name(),
+			Muted:           muted,
+		},
+	})
+}
+
+func (p *GPTParticipant) dataReceived(data []byte, rp *lksdk.RemoteParticipant) {
+	if msg, ok := parseChatMessage(data); ok {
+		if p.conf.Chat.Prompts || p.isChatOnly() {
+			p.chatReceived(msg, rp)
+		}
+		return
+	}
+
+	pkt := &incomingPacket{}
+	if err := json.Unmarshal(data, pkt); err != nil {
+		return
+	}
+
+	if pkt.Type == packet_Chunk {
+		chunk := &chunkPacket{}
+		if err := json.Unmarshal(pkt.Data, chunk); err != nil {
+			packetErrorsTotal.WithLabelValues(packetDirection_Receive).Inc()
+			logger.Warnw("failed to parse chunk packet", err, "participant", rp.Identity())
+			return
+		}
+
+		data, err := p.chunks.add(rp.SID(), chunk)
+		if err != nil {
+			packetErrorsTotal.WithLabelValues(packetDirection_Receive).Inc()
+			logger.Warnw("dropping chunked packet", err, "participant", rp.Identity(), "id", chunk.ID)
+			return
+		}
+		if data != nil {
+			p.dataReceived(data, rp)
+		}
+		return
+	}
+
+	if pkt.Type == packet_Signal {
+		signal := &signalPacket{}
+		if err := json.Unmarshal(pkt.Data, signal); err != nil {
+			packetErrorsTotal.WithLabelValues(packetDirection_Receive).Inc()
+			logger.Warnw("failed to parse signal packet", err, "participant", rp.Identity())
+			return
+		}
+		p.floorSignal(rp, signal.Signal, signal.Active)
+		return
+	}
+
+	if pkt.Type == packet_Vote {
+		vote := &votePacket{}
+		if err := json.Unmarshal(pkt.Data, vote); err != nil {
+			packetErrorsTotal.WithLabelValues(packetDirection_Receive).Inc()
+			logger.Warnw("failed to parse vote packet", err, "participant", rp.Identity())
+			return
+		}
+		p.vote(rp, vote)
+		return
+	}
+
+	if pkt.Type != packet_Command {
+		return // Not a command, the clients also use the datachannels between themselves
+	}
+
+	cmd := &commandPacket{}
+	if err := json.Unmarshal(pkt.Data, cmd); err != nil {
+		packetErrorsTotal.WithLabelValues(packetDirection_Receive).Inc()
+		logger.Warnw("failed to parse command packet", err, "participant", rp.Identity())
+		return
+	}
+
+	logger.Debugw("received command", "command", cmd.Command, "participant", rp.Identity())
+	switch cmd.Command {
+	case command_Start:
+		p.start()
+	case command_Activate:
+		logger.Debugw("activating KITT for participant", "participant", rp.Identity())
+		p.activeInterim.Store(false)
+		p.activateParticipant(rp)
+	case command_Stop:
+		discarded := p.stopSpeaking()
+		logger.Debugw("stopped speaking", "participant", rp.Identity(), "discarded", discarded)
+	case command_Repeat:
+		p.repeatLastAnswer(rp)
+	case command_ResetContext:
+		p.resetContext(rp)
+	case command_ChangeLanguage:
+		p.changeLanguage(rp, cmd.Language)
+	default:
+		logger.Warnw("unknown command", nil, "command", cmd.Command, "participant", rp.Identity())
+	}
+}
+
+func (p *GPTParticipant) participantConnected(rp *lksdk.RemoteParticipant) {
+	p.escalationParticipantConnected(rp)
+	p.addAttendee(rp)
+	p.checkRoomBehavior()
+	p.sendCapabilities(rp.SID())
+	p.sendSnapshot(rp.SID())
+}
+
+func (p *GPTParticipant) minConfidence(rp *lksdk.RemoteParticipant) float32 {
+	if metadata := parseParticipantMetadata(rp); metadata.MinConfidence != nil {
+		return *metadata.MinConfidence
+	}
+	return p.conf.Transcription.MinConfidence
+}
+
+// Remember the participants, they may have left when the notes are sent
+func (p *GPTParticipant) addAttendee(rp *lksdk.RemoteParticipant) {
+	metadata := parseParticipantMetadata(rp)
+
+	p.lock.Lock()
+	p.attendees[rp.Identity()] = &attendee{
+		Identity: rp.Identity(),
+		Name:     rp.Name(),
+		Metadata: metadata,
+	}
+	p.lock.Unlock()
+
+	if metadata.Memory {
+		p.loadMemory(rp.Identity())
+	}
 }
 
 func (p *GPTParticipant) participantDisconnected(rp *lksdk.RemoteParticipant) {
+	p.escalationParticipantDisconnected(rp)
+	p.releaseFloor(rp)
+	p.chunks.forget(rp.SID())
+	p.clarifications.forget(rp.SID())
+	p.closeDetached(rp.SID()) // Won't be resubscribed
+	p.checkRoomBehavior()
+
 	participants := p.room.GetParticipants()
 	logger.Debugw("participant disconnected", "numParticipants", len(participants))
 	if len(participants) == 0 {
@@ -271,6 +802,34 @@ func (p *GPTParticipant) participantDisconnected(rp *lksdk.RemoteParticipant) {
 	}
 }
 
+// Republish the GPTTrack, otherwise KITT keeps speaking into the void
+func (p *GPTParticipant) trackUnbound() {
+	if p.ctx.Err() != nil {
+		return // Disconnecting
+	}
+
+	logger.Warnw("gpt track unbound, republishing", nil, "room", p.room.Name())
+	backoff := republishBackoff
+	for attempt := 1; attempt <= republishMaxAttempts; attempt++ {
+		select {
+		case <-time.After(backoff):
+		case <-p.ctx.Done():
+			return
+		}
+
+		pub, err := p.gptTrack.Republish(p.room.LocalParticipant)
+		if err == nil {
+			logger.Infow("gpt track republished", "room", p.room.Name(), "track", pub.SID())
+			return
+		}
+
+		logger.Errorw("failed to republish the gpt track", err, "room", p.room.Name(), "attempt", attempt)
+		backoff *= 2
+	}
+
+	p.publishError("Sorry, KITT lost its audio track", errors.New("failed to republish the gpt track"))
+}
+
 func (p *GPTParticipant) disconnected() {
 	p.Disconnect()
 }
@@ -285,7 +844,7 @@ func (p *GPTParticipant) activateParticipant(rp *lksdk.RemoteParticipant) {
 		p.activeId++
 		p.activeParticipant = rp
 		p.lastActivity = time.Now()
-		_ = p.sendStatePacket(state_Active)
+		p.setState(state_Active)
 
 		tmpActiveId := p.activeId
 		go func() {
@@ -299,7 +858,7 @@ func (p *GPTParticipant) activateParticipant(rp *lksdk.RemoteParticipant) {
 
 				if time.Since(p.lastActivity) >= ActivationTimeout {
 					p.activeParticipant = nil
-					_ = p.sendStatePacket(state_Idle)
+					p.setState(state_Idle)
 					p.lock.Unlock()
 					return
 				}
@@ -312,23 +871,70 @@ func (p *GPTParticipant) activateParticipant(rp *lksdk.RemoteParticipant) {
 }
 
 func (p *GPTParticipant) onTranscriptionReceived(result RecognizeResult, rp *lksdk.RemoteParticipant, transcriber *Transcriber) {
+	p.recorder.recordTranscript(rp.Identity(), result)
 	if result.Error != nil {
-		_ = p.sendErrorPacket(fmt.Sprintf("Sorry, an error occured while transcribing %s's speech using Google STT", rp.Identity()))
+		p.publishError(fmt.Sprintf("Sorry, an error occured while transcribing %s's speech using Google STT", rp.Identity()), result.Error)
 		return
 	}
 
-	_ = p.sendPacket(&packet{
-		Type: packet_Transcript,
-		Data: &transcriptPacket{
-			Sid:     rp.SID(),
-			Name:    rp.Name(),
-			Text:    result.Text,
-			IsFinal: result.IsFinal,
+	stageCtx := p.stageContext(rp.SID(), rp.Identity(), transcriber.Language())
+	if !p.pipeline.transcript(stageCtx, &result) {
+		return
+	}
+
+	lowConfidence := result.IsFinal && result.Confidence > 0 && result.Confidence < p.minConfidence(rp)
+	if lowConfidence {
+		// Likely background noise (TV, music, ...). The empty final result clears the interim caption
+		logger.Debugw("ignoring low confidence transcript", "participant", rp.SID(), "confidence", result.Confidence, "text", result.Text)
+		result.Text = ""
+		result.Words = nil
+		p.discardSpeculation(rp)
+	}
+
+	p.bus.Publish(&RoomEvent{
+		Type: RoomEvent_Transcript,
+		Room: p.room.Name(),
+		Data: &TranscriptEvent{
+			ParticipantSid:  rp.SID(),
+			ParticipantName: rp.Name(),
+			Text:            result.Text,
+			IsFinal:         result.IsFinal,
+			Words:           result.Words,
 		},
 	})
 
-	// When there's only one participant in the meeting, no activation/trigger is needed
-	// The bot will answer directly.
+	if lowConfidence {
+		return // Never fed to the LLM
+	}
+
+	p.transcriptBargeIn(result, rp)
+
+	if result.IsFinal {
+		p.lock.Lock()
+		p.lastSpoke[rp.SID()] = time.Now()
+		p.lock.Unlock()
+		p.voteLanguage(result, transcriber)
+	}
+
+	if p.currentJoinState() != joinState_Listening {
+		return // Waiting for the start command or greeting the participants
+	}
+
+	if p.isNoteTaker() {
+		return // Never speak, the notes are updated periodically
+	}
+
+	if p.isEscalated() {
+		return // A human agent is handling the room
+	}
+
+	behavior := p.currentBehavior()
+	if behavior == RoomBehavior_Captions {
+		return // Too many participants to answer, see presets.go
+	}
+
+	// When there's only one participant in the meeting, no activation/trigger is needed by default
+	// The bot will answer directly. (See ReplyPolicy_*)
 	//
 	// When there are multiple participants, activation is required.
 	// 1. Wait for activation sentence (Hey Kitt!)
@@ -342,8 +948,11 @@ func (p *GPTParticipant) onTranscriptionReceived(result RecognizeResult, rp *lks
 	}
 	p.lock.Unlock()
 
+	oneOnOne := len(p.room.GetParticipants()) == 1
+	replyPolicy := p.conf.Reply.OneOnOne
+
 	shouldAnswer := false
-	if len(p.room.GetParticipants()) == 1 {
+	if oneOnOne && replyPolicy == ReplyPolicy_Always {
 		// Always answer when we're alone with KITT
 		if activeParticipant == nil {
 			activeParticipant = rp
@@ -351,11 +960,15 @@ func (p *GPTParticipant) onTranscriptionReceived(result RecognizeResult, rp *lks
 		}
 
 		shouldAnswer = result.IsFinal
+		if !result.IsFinal {
+			p.speculate(result, rp, transcriber.Language())
+		}
 	} else {
 		// Check if the participant is activating the KITT
 		justActivated := false
 		words := strings.Split(strings.ToLower(strings.TrimSpace(result.Text)), " ")
-		if len(words) >= 2 { // No max length but only check the first 3 words
+		wakeWordEnabled := (!oneOnOne || replyPolicy != ReplyPolicy_Command) && behavior != RoomBehavior_Command
+		if wakeWordEnabled && len(words) >= 2 && !transcriber.DetectsWakeWord() { // No max length but only check the first 3 words
 			limit := len(words)
 			if limit > ActivationWordsLen {
 				limit = ActivationWordsLen
@@ -394,217 +1007,641 @@ func (p *GPTParticipant) onTranscriptionReceived(result RecognizeResult, rp *lks
 				// Ignore if the participant stopped speaking after the activation, answer his next sentence
 				shouldAnswer = false
 			}
+		} else if activeParticipant == rp {
+			p.speculate(result, rp, transcriber.Language())
 		}
 	}
 
+	if result.IsFinal && !shouldAnswer && p.awaitsClarification(rp) {
+		shouldAnswer = true // Answer to the clarifying question, no activation needed
+	}
+
+	if result.IsFinal {
+		shouldAnswer = p.pipeline.turn(stageCtx, &result, shouldAnswer)
+	}
+
+	var prompt *SpeechEvent
 	if shouldAnswer {
-		prompt := &SpeechEvent{
+		prompt = &SpeechEvent{
 			ParticipantName: rp.Identity(),
 			IsBot:           false,
 			Text:            result.Text,
 		}
+		shouldAnswer = p.pipeline.prompt(stageCtx, prompt)
+	}
 
-		p.lock.Lock()
+	if result.IsFinal && (!shouldAnswer || prompt.Text != result.Text) {
+		p.discardSpeculation(rp) // Started on the text before the prompt stages
+	}
+
+	if shouldAnswer {
 
 		// Don't include the current prompt in the history when answering
-		events := make([]*MeetingEvent, len(p.events))
-		copy(events, p.events)
-		p.events = append(p.events, &MeetingEvent{
+		events, nEvents := p.history.AppendWindow(&MeetingEvent{
 			Speech: prompt,
-		})
+		}, p.conf.Reply.HistoryTokens)
+
+		p.lock.Lock()
 		p.activeParticipant = nil
+		spec := p.speculation
+		p.speculation = nil
 		p.lock.Unlock()
 
-		if shouldAnswer && p.isBusy.CompareAndSwap(false, true) {
+		if reason := p.cooldown(rp); reason != "" {
+			logger.Debugw("cooldown, not answering", "participant", rp.SID(), "reason", reason, "text", result.Text)
+			if !p.isBusy.Load() {
+				p.setState(state_Idle) // Was activated
+			}
+			if spec != nil {
+				spec.discard()
+			}
+		} else if p.isBusy.CompareAndSwap(false, true) {
 			go func() {
 				defer p.isBusy.Store(false)
-				_ = p.sendStatePacket(state_Loading)
+				defer p.answerFinished()
+				p.recordAnswer(rp)
+				p.setState(state_Loading)
+
+				if interrupted := p.takeInterruptedAnswer(rp); interrupted != nil {
+					if isAffirmative(result.Text) {
+						if spec != nil {
+							spec.discard()
+						}
+						p.resume(interrupted, rp)
+						return
+					}
+					logger.Debugw("dropping the interrupted answer", "participant", rp.SID())
+				}
+
+				tools := p.tools
+				switch intent := p.classifyIntent(events, prompt, rp); intent.Intent {
+				case Intent_NotAddressed:
+					if spec != nil {
+						spec.discard()
+					}
+					logger.Debugw("not addressed to KITT, not answering", "participant", rp.SID(), "text", result.Text)
+					p.setState(state_Idle)
+					p.answerWaiting()
+					return
+				case Intent_Command:
+					if spec != nil {
+						spec.discard()
+					}
+					p.handleIntentCommand(rp, intent.Command, transcriber.Language())
+					p.setState(state_Idle)
+					p.answerWaiting()
+					return
+				case Intent_ChitChat:
+					tools = nil // A speculative stream already has them
+				}
+
+				var stream *ChatStream
+				if p.condenseUtterance(prompt, transcriber.Language()) {
+					if spec != nil {
+						spec.discard() // Started on the whole utterance
+					}
+				} else if spec != nil {
+					stream = spec.take(rp.SID(), result.Text, nEvents, p.conf.Speculation.MaxDistance)
+				}
 
 				logger.Debugw("answering to", "participant", rp.SID(), "text", result.Text)
-				answer, err := p.answer(events, prompt, rp, transcriber.Language()) // Will send state_Speaking
+				answer, err := p.answerWith(stream, events, prompt, rp, transcriber.Language(), tools) // Will send state_Speaking
 				if err != nil {
-					logger.Errorw("failed to answer", err, "participant", rp.SID(), "text", result.Text)
-					p.sendStatePacket(state_Idle)
+					if errors.Is(err, errFloorTaken) {
+						logger.Debugw("floor taken, dropping the answer", "participant", rp.SID(), "text", result.Text)
+					} else {
+						logger.Errorw("failed to answer", err, "participant", rp.SID(), "text", result.Text)
+					}
+					p.setState(state_Idle)
 					return
 				}
 
 				// KITT finished speaking, check if the last sentence was a question.
-				// If so, auto activate the current participant
-				if strings.HasSuffix(answer, "?") {
+				// If so, auto activate the current participant. Same when they interrupted KITT
+				if p.takeBargeIn(rp) || strings.HasSuffix(answer.Text, "?") {
 					// Checking this suffix should be enough
 					p.activateParticipant(rp)
 				} else {
-					p.sendStatePacket(state_Idle)
+					p.setState(state_Idle)
 				}
 
-				botAnswer := &SpeechEvent{
-					ParticipantName: BotIdentity,
-					IsBot:           true,
-					Text:            answer,
-				}
+				p.bus.Publish(&RoomEvent{
+					Type: RoomEvent_Answer,
+					Room: p.room.Name(),
+					Data: &AnswerEvent{
+						ParticipantSid:  rp.SID(),
+						ParticipantName: rp.Identity(),
+						Prompt:          prompt.Text,
+						Answer:          answer.Text,
+						AudioKey:        answer.AudioKey,
+						Disclaimers:     answer.Disclaimers,
+						Citations:       answer.Citations,
+					},
+				})
 
-				p.lock.Lock()
-				p.events = append(p.events, &MeetingEvent{
-					Speech: botAnswer,
+				p.history.Append(&MeetingEvent{
+					Speech: answer,
 				})
-				p.lock.Unlock()
+
+				p.handleInterruption(rp)
+				p.answerWaiting()
 			}()
+		} else {
+			if spec != nil {
+				spec.discard()
+			}
+			p.queuePrompt(rp, prompt, transcriber.Language())
 		}
 	}
 }
 
-func (p *GPTParticipant) answer(events []*MeetingEvent, prompt *SpeechEvent, rp *lksdk.RemoteParticipant, language *Language) (string, error) {
-	stream, err := p.completion.Complete(p.ctx, events, prompt, rp, p.room, language)
-	if err != nil {
-		if errors.Is(err, context.Canceled) {
-			return "", nil
+// Start a speculative completion when a stable interim result looks like a complete question
+func (p *GPTParticipant) speculate(result RecognizeResult, rp *lksdk.RemoteParticipant, language *Language) {
+	if !p.conf.Speculation.Enabled || result.Stability < p.conf.Speculation.MinStability {
+		return
+	}
+
+	if p.isBusy.Load() || !looksLikeQuestion(result.Text) || p.awaitsClarification(rp) {
+		return
+	}
+
+	meeting := p.meetingContext() // Takes the lock
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.speculation != nil {
+		if p.speculation.sid == rp.SID() && wordDistance(p.speculation.text, result.Text) == 0 {
+			return // Already speculating on this text
 		}
+		p.speculation.discard()
+	}
+
+	events := p.history.Window(p.conf.Reply.HistoryTokens)
+	prompt := &SpeechEvent{
+		ParticipantName: rp.Identity(),
+		IsBot:           false,
+		Text:            result.Text,
+	}
+
+	logger.Debugw("starting speculative completion", "participant", rp.SID(), "text", result.Text)
+	p.speculation = newSpeculation(p.ctx, p.completion, events, p.history.Len(), prompt, rp, p.room, language, meeting, p.tools, &ToolContext{Participant: p, Speaker: rp})
+}
+
+func (p *GPTParticipant) discardSpeculation(rp *lksdk.RemoteParticipant) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.speculation != nil && p.speculation.sid == rp.SID() {
+		p.speculation.discard()
+		p.speculation = nil
+	}
+}
+
+// stream can be a speculative completion, a new one is created when nil
+func (p *GPTParticipant) answer(stream *ChatStream, events []*MeetingEvent, prompt *SpeechEvent, rp *lksdk.RemoteParticipant, language *Language) (*SpeechEvent, error) {
+	return p.answerWith(stream, events, prompt, rp, language, p.tools)
+}
 
-		_ = p.sendErrorPacket("Sorry, an error occured while communicating with OpenAI. Max context length reached?")
-		return "", err
+// tools is nil to answer without them (e.g chit-chat, see intent.go)
+func (p *GPTParticipant) answerWith(stream *ChatStream, events []*MeetingEvent, prompt *SpeechEvent, rp *lksdk.RemoteParticipant, language *Language, tools *ToolSet) (*SpeechEvent, error) {
+	replyLanguage := p.replyLanguage(nil)
+	if replyLanguage != nil {
+		language = replyLanguage
 	}
 
-	var last chan struct{} // Used to order the goroutines (See QueueReader bellow)
+	// The policy check runs while the completion is created, nothing is played before its verdict
+	var verdictChan chan *PolicyVerdict
+	if needsPolicyCheck(p.conf.Guardrails) {
+		verdictChan = make(chan *PolicyVerdict, 1)
+		go func() {
+			verdictChan <- p.checkPolicy(prompt.Text)
+		}()
+	}
+
+	var injectionChan chan bool
+	if p.conf.Injection.Classifier {
+		injectionChan = make(chan bool, 1)
+		go func() {
+			injectionChan <- p.detectInjection(prompt.Text)
+		}()
+	}
+
+	meeting := p.meetingContext()
+	meeting.Waited = p.takeWaited()
+	toolCtx := &ToolContext{Participant: p, Speaker: rp}
+	if question := p.clarifications.take(rp.SID()); question != nil {
+		meeting.Clarification = question
+		toolCtx.clarification = question
+	}
+
+	if stream == nil {
+		var err error
+		stream, err = p.completion.Complete(p.ctx, events, prompt, rp, p.room, language, meeting, tools, toolCtx)
+		if err != nil {
+			if errors.Is(err, context.Canceled) {
+				return botSpeech("", false), nil
+			}
+
+			p.publishError("Sorry, an error occured while communicating with OpenAI. Max context length reached?", err)
+			return nil, err
+		}
+	}
+
+	if injectionChan != nil && <-injectionChan {
+		stream.Close()
+		logger.Infow("prompt injection detected, not answering", "participant", rp.SID(), "text", prompt.Text)
+		if err := p.say(p.conf.Injection.Response, language); err != nil {
+			return nil, err
+		}
+		return botSpeech(p.conf.Injection.Response, false), nil
+	}
+
+	var preamble, postamble, written []string // Disclaimers spoken before/after the answer, and the written ones
+	if verdictChan != nil {
+		if verdict := <-verdictChan; verdict != nil {
+			if verdict.DeniedTopic != "" {
+				stream.Close()
+				logger.Infow("question denied by the guardrails", "participant", rp.SID(), "topic", verdict.DeniedTopic)
+				if err := p.say(p.conf.Guardrails.Refusal, language); err != nil {
+					return nil, err
+				}
+				return botSpeech(p.conf.Guardrails.Refusal, false), nil
+			}
+			disclaimers := verdictDisclaimers(p.conf.Guardrails, verdict)
+			preamble, postamble, written = disclaimers.before, disclaimers.after, disclaimers.written
+		}
+	}
+
+	if !p.waitForFloor(rp) {
+		stream.Close()
+		return nil, errFloorTaken
+	}
+
+	// Canceled when the participant barges in, see bargein.go
+	synthesisCtx, cancelSynthesis := context.WithCancel(p.ctx)
+	defer cancelSynthesis()
+	current := &currentAnswer{
+		sid:    rp.SID(),
+		cancel: cancelSynthesis,
+	}
+	p.setCurrentAnswer(current)
+	defer p.setCurrentAnswer(nil)
+
 	var wg sync.WaitGroup
 
+	// The sentences start playing while they are synthesized, unless the audio stages need their whole audio
+	streamAudio := p.conf.Synthesis.Streaming && !p.pipeline.hasAudioStages()
+
+	// Sentences that couldn't be played, kept to resume the answer (See resume.go)
+	var (
+		sentences  []string
+		failedLock sync.Mutex
+		failed     = make(map[int]bool)
+		truncated  bool
+	)
+	markFailed := func(index int) {
+		failedLock.Lock()
+		defer failedLock.Unlock()
+		failed[index] = true
+	}
+
+	// Limit how many sentences can be synthesized ahead of the playback.
+	// A slot is released when the audio of a sentence finished playing (or when the synthesis failed)
+	var slots chan struct{}
+	if n := p.conf.Synthesis.MaxPrefetch; n > 0 {
+		slots = make(chan struct{}, n+1) // +1 for the sentence being played
+	}
+	releaseSlot := func() {
+		if slots != nil {
+			<-slots
+		}
+	}
+
 	p.gptTrack.OnComplete(func(err error) {
+		releaseSlot()
 		wg.Done()
 	})
 
-	sb := strings.Builder{}
+	// Verbal updates while a tool call takes a while (see progress.go), played before the answer.
+	// They take a slot like the sentences, and are skipped when the playback is busy anyway
+	progressLanguage := language
+	stream.toolCtx.setProgressSpeech(func(text string) {
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			default:
+				return
+			}
+		}
+
+		audioContent, err := p.synthesizer.Synthesize(synthesisCtx, text, progressLanguage)
+		if err != nil {
+			releaseSlot()
+			logger.Warnw("failed to synthesize the progress update", err, "text", text)
+			return
+		}
+
+		wg.Add(1) // Done by OnComplete
+		if err := p.gptTrack.QueueReader(bytes.NewReader(audioContent)); err != nil {
+			wg.Done()
+			releaseSlot()
+			logger.Warnw("failed to queue the progress update", err, "text", text)
+		}
+	})
+	defer stream.toolCtx.setProgressSpeech(nil)
+
+	// Text of the queued sentences, broadcasted when their audio starts playing
+	var (
+		draftsLock sync.Mutex
+		drafts     = make(map[uint64]*SpeakingEvent)
+		played     = make(map[int]bool)   // Index of the sentences whose audio started playing
+		audio      = make(map[int][]byte) // Synthesized sentences, kept when the answer audio is stored
+	)
+	p.gptTrack.OnStart(func(seq uint64, duration time.Duration) {
+		draftsLock.Lock()
+		draft, ok := drafts[seq]
+		if ok {
+			played[draft.Index] = true
+		}
+		draftsLock.Unlock()
+		if !ok {
+			return
+		}
+
+		event := *draft
+		event.Start = time.Now()
+		event.Duration = duration
+		go p.bus.Publish(&RoomEvent{ // Don't delay the audio samples
+			Type: RoomEvent_Speaking,
+			Room: p.room.Name(),
+			Data: &event,
+		})
+	})
+
+	// Only the played sentences are kept in the history, the participants never heard the others
+	spoken := func() *SpeechEvent {
+		draftsLock.Lock()
+		defer draftsLock.Unlock()
+
+		var texts []string
+		var chunks [][]byte
+		for i, sentence := range sentences {
+			if played[i] {
+				texts = append(texts, sentence)
+				if data, ok := audio[i]; ok {
+					chunks = append(chunks, data)
+				}
+			}
+		}
+		speech := botSpeech(strings.Join(texts, " "), truncated || len(texts) < len(sentences))
+		speech.Disclaimers = written
+		speech.Citations = p.answerCitations(stream)
+		if len(chunks) > 0 {
+			speech.AudioKey = p.storeAnswerAudio(chunks)
+		}
+		return speech
+	}
+
+	answered := false // The completion ended, only the disclaimers after the answer are left
 	for {
-		sentence, err := stream.Recv()
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			case <-p.ctx.Done():
+				return spoken(), nil
+			}
+		}
+
+		var sentence *Sentence
+		var err error
+		if len(preamble) > 0 {
+			sentence = &Sentence{Text: preamble[0]}
+			preamble = preamble[1:]
+		} else if !answered {
+			sentence, err = stream.Recv()
+			answered = errors.Is(err, io.EOF)
+		} else {
+			err = io.EOF
+		}
+		if answered && len(postamble) > 0 {
+			sentence, err = &Sentence{Text: postamble[0]}, nil
+			postamble = postamble[1:]
+		}
 		if err != nil {
+			releaseSlot()
 			if errors.Is(err, io.EOF) || errors.Is(err, context.Canceled) {
 				break
 			}
 
-			_ = p.sendErrorPacket("Sorry, an error occured while communicating with OpenAI. It can happen when the servers are overloaded")
-			return "", err
+			p.publishError("Sorry, an error occured while communicating with OpenAI. It can happen when the servers are overloaded", err)
+			if len(sentences) == 0 {
+				return nil, err
+			}
+
+			// The beginning of the answer is being played, the rest can be requested again
+			logger.Errorw("answer interrupted", err, "participant", rp.SID())
+			truncated = true
+			break
 		}
 
-		// Try to parse the language from the sentence (ChatGPT can provide <en-US>, en-US as a prefix)
-		trimSentence := strings.TrimSpace(sentence)
-		lowerSentence := strings.ToLower(trimSentence)
-		for code, lang := range Languages {
-			prefix1 := strings.ToLower(fmt.Sprintf("<%s>", code))
-			prefix2 := strings.ToLower(code)
+		if !p.pipeline.sentence(p.stageContext(rp.SID(), rp.Identity(), language), sentence) {
+			releaseSlot()
+			continue
+		}
 
-			if strings.HasPrefix(lowerSentence, prefix1) {
-				trimSentence = trimSentence[len(prefix1):]
-			} else if strings.HasPrefix(lowerSentence, prefix2) {
-				trimSentence = trimSentence[len(prefix2):]
-			} else {
-				continue
-			}
+		trimSentence := strings.TrimSpace(sentence.Text)
+		if trimSentence == "" {
+			releaseSlot()
+			continue
+		}
 
-			language = lang
+		if current.stopped.Load() {
+			releaseSlot()
+			stream.Close()
+			truncated = true
 			break
 		}
 
-		sb.WriteString(trimSentence)
-		sb.WriteString(" ")
+		if p.conf.TurnTaking.Interrupt && p.floorTaken(rp, false) {
+			// The next sentences can be resumed once the participant spoke
+			releaseSlot()
+			stream.Close()
+			logger.Debugw("floor taken, interrupting the answer", "participant", rp.SID())
+			sentences = append(sentences, trimSentence)
+			markFailed(len(sentences) - 1)
+			truncated = true
+			break
+		}
 
-		tmpLast := last
+		// The language can change in the middle of the answer, the last known one is kept when it is missing
+		if lang := findLanguage(sentence.Language); lang != nil && replyLanguage == nil {
+			language = lang
+		}
+
+		// The sentences are synthesized concurrently, the track plays them in the reserved order.
+		// A failed sentence is skipped without stalling the next ones
+		seq := p.gptTrack.Reserve()
 		tmpLang := language
-		currentCh := make(chan struct{})
+		index := len(sentences)
+		sentences = append(sentences, trimSentence)
+
+		draftsLock.Lock()
+		drafts[seq] = &SpeakingEvent{
+			ParticipantSid: rp.SID(),
+			Text:           trimSentence,
+			Language:       tmpLang.Code,
+			Index:          index,
+		}
+		draftsLock.Unlock()
 
 		wg.Add(1)
 		go func() {
-			defer close(currentCh)
 			defer wg.Done()
 
+			synthesisFailed := func(err error) {
+				p.gptTrack.SkipAt(seq)
+				markFailed(index)
+				releaseSlot()
+				if synthesisCtx.Err() != nil {
+					return // Barge-in
+				}
+				logger.Errorw("failed to synthesize", err, "sentence", trimSentence)
+				p.publishError("Sorry, an error occured while synthesizing voice data", err)
+			}
+
 			logger.Debugw("synthesizing", "sentence", trimSentence)
-			resp, err := p.synthesizer.Synthesize(p.ctx, trimSentence, tmpLang)
+			if streamAudio {
+				reader, err := p.synthesizer.SynthesizeStream(synthesisCtx, trimSentence, tmpLang)
+				if err != nil {
+					synthesisFailed(err)
+					return
+				}
+				defer reader.Close()
+
+				// The audio is only kept when it is stored
+				var source io.Reader = reader
+				var recorded bytes.Buffer
+				if p.conf.Storage.DebugAudio || (p.conf.Storage.AnswerAudio && p.store != nil) {
+					source = io.TeeReader(reader, &recorded)
+				}
+
+				wg.Add(1) // Done by OnComplete, the playback starts with the first page
+				done, err := p.gptTrack.QueueStreamAt(seq, source)
+				if err != nil {
+					wg.Done()
+					markFailed(index)
+					releaseSlot()
+					if !errors.Is(err, ErrFlushed) && synthesisCtx.Err() == nil {
+						logger.Errorw("failed to queue stream", err, "sentence", trimSentence)
+					}
+					return
+				}
+				p.setState(state_Speaking)
+
+				if err := <-done; err != nil {
+					if !errors.Is(err, ErrFlushed) && synthesisCtx.Err() == nil {
+						logger.Errorw("failed to read the synthesized audio", err, "sentence", trimSentence)
+					}
+					return
+				}
+
+				logger.Debugw("finished synthesizing", "sentence", trimSentence)
+				audioContent := recorded.Bytes()
+				if p.conf.Storage.DebugAudio {
+					go p.storeDebugAudio(seq, audioContent)
+				}
+				if p.conf.Storage.AnswerAudio && p.store != nil {
+					draftsLock.Lock()
+					audio[index] = audioContent
+					draftsLock.Unlock()
+				}
+				return
+			}
+
+			audioContent, err := p.synthesizer.Synthesize(synthesisCtx, trimSentence, tmpLang)
 			if err != nil {
-				logger.Errorw("failed to synthesize", err, "sentence", trimSentence)
-				_ = p.sendErrorPacket("Sorry, an error occured while synthesizing voice data using Google TTS")
+				synthesisFailed(err)
 				return
 			}
 
-			if tmpLast != nil {
-				<-tmpLast // Reorder outputs
+			audioContent = p.pipeline.audio(p.stageContext(rp.SID(), rp.Identity(), tmpLang), trimSentence, audioContent)
+			if p.conf.Storage.DebugAudio {
+				go p.storeDebugAudio(seq, audioContent)
+			}
+			if p.conf.Storage.AnswerAudio && p.store != nil {
+				draftsLock.Lock()
+				audio[index] = audioContent
+				draftsLock.Unlock()
 			}
 
 			logger.Debugw("finished synthesizing, queuing sentence", "sentence", trimSentence)
-			err = p.gptTrack.QueueReader(bytes.NewReader(resp.AudioContent))
+			wg.Add(1) // Done by OnComplete, before queuing since the playback can finish first
+			err = p.gptTrack.QueueReaderAt(seq, bytes.NewReader(audioContent))
 			if err != nil {
-				logger.Errorw("failed to queue reader", err, "sentence", trimSentence)
+				wg.Done()
+				markFailed(index)
+				releaseSlot()
+				if !errors.Is(err, ErrFlushed) {
+					logger.Errorw("failed to queue reader", err, "sentence", trimSentence)
+				}
 				return
 			}
 
-			_ = p.sendStatePacket(state_Speaking)
-			wg.Add(1)
+			p.setState(state_Speaking)
 		}()
-
-		last = currentCh
 	}
 
 	wg.Wait()
 
-	return strings.TrimSpace(sb.String()), nil
-}
-
-// Packets sent over the datachannels
-type packetType int32
-
-const (
-	packet_Transcript packetType = 0
-	packet_State      packetType = 1
-	packet_Error      packetType = 2 // Show an error message to the user screen
-)
-
-type gptState int32
-
-const (
-	state_Idle     gptState = 0
-	state_Loading  gptState = 1
-	state_Speaking gptState = 2
-	state_Active   gptState = 3
-)
-
-type packet struct {
-	Type packetType  `json:"type"`
-	Data interface{} `json:"data"`
-}
-
-type transcriptPacket struct {
-	Sid     string `json:"sid"`
-	Name    string `json:"name"`
-	Text    string `json:"text"`
-	IsFinal bool   `json:"isFinal"`
-}
-
-type statePacket struct {
-	State gptState `json:"state"`
-}
+	// Nothing to resume after a barge-in or a stop command
+	if (truncated || len(failed) > 0) && p.ctx.Err() == nil && !current.stopped.Load() {
+		interrupted := &interruptedAnswer{
+			participantSid: rp.SID(),
+			events:         events,
+			prompt:         prompt,
+			language:       language,
+			truncated:      truncated,
+		}
+		for i, sentence := range sentences {
+			if failed[i] {
+				interrupted.unspoken = append(interrupted.unspoken, sentence)
+			} else {
+				interrupted.spoken = append(interrupted.spoken, sentence)
+			}
+		}
+		p.setInterruptedAnswer(interrupted)
+	}
 
-type errorPacket struct {
-	Message string `json:"message"`
+	return spoken(), nil
 }
 
-func (p *GPTParticipant) sendPacket(packet *packet) error {
-	data, err := json.Marshal(packet)
-	if err != nil {
-		return err
+func botSpeech(text string, interrupted bool) *SpeechEvent {
+	return &SpeechEvent{
+		ParticipantName: BotIdentity,
+		IsBot:           true,
+		Text:            text,
+		Interrupted:     interrupted,
 	}
-	return p.room.LocalParticipant.PublishData(data, livekit.DataPacket_RELIABLE, []string{})
 }
 
-func (p *GPTParticipant) sendStatePacket(state gptState) error {
-	return p.sendPacket(&packet{
-		Type: packet_State,
-		Data: &statePacket{
+func (p *GPTParticipant) setState(state gptState) {
+	p.state.Store(int32(state))
+	p.bus.Publish(&RoomEvent{
+		Type: RoomEvent_State,
+		Room: p.room.Name(),
+		Data: &StateEvent{
 			State: state,
 		},
 	})
 }
 
-func (p *GPTParticipant) sendErrorPacket(message string) error {
-	return p.sendPacket(&packet{
-		Type: packet_Error,
-		Data: &errorPacket{
+func (p *GPTParticipant) publishError(message string, err error) {
+	p.bus.Publish(&RoomEvent{
+		Type: RoomEvent_Error,
+		Room: p.room.Name(),
+		Data: &ErrorEvent{
 			Message: message,
+			Err:     err,
 		},
 	})
 }
@@ -1,11 +1,13 @@
 package service
 
 import (
+	"container/heap"
 	"errors"
 	"io"
 	"sync"
 	"time"
 
+	"github.com/livekit-examples/livegpt/pkg/config"
 	"github.com/livekit-examples/livegpt/pkg/utils"
 	"github.com/livekit/protocol/logger"
 	lksdk "github.com/livekit/server-sdk-go"
@@ -16,6 +18,8 @@ import (
 var (
 	ErrMuted         = errors.New("the track is muted")
 	ErrInvalidFormat = errors.New("invalid format")
+	ErrBacklogFull   = errors.New("too much audio is already queued")
+	ErrFlushed       = errors.New("the audio has been flushed")
 
 	OpusSilenceFrame = []byte{
 		0xf8, 0xff, 0xfe, 0x00, 0x00, 0x00, 0x00, 0x00,
@@ -33,14 +37,45 @@ var (
 )
 
 type GPTTrack struct {
+	lock        sync.Mutex
 	sampleTrack *lksdk.LocalSampleTrack
-	provider    *provider
+	publication *lksdk.LocalTrackPublication
+	onUnbind    func()
+
+	provider *provider
+	conf     config.SynthesisConfig
 
 	doneChan   chan struct{}
 	closedChan chan struct{}
 }
 
-func NewGPTTrack() (*GPTTrack, error) {
+// Snapshot of the audio waiting to be played
+type TrackStats struct {
+	QueuedDuration time.Duration // Including the remaining of the audio being played
+	QueuedReaders  int           // Including the audio being played
+	PendingSeqs    int           // Reserved positions not queued nor skipped yet
+}
+
+func NewGPTTrack(conf config.SynthesisConfig) (*GPTTrack, error) {
+	provider := &provider{
+		maxBacklog: conf.MaxBacklog,
+	}
+
+	track, err := newSampleTrack(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GPTTrack{
+		sampleTrack: track,
+		provider:    provider,
+		conf:        conf,
+		doneChan:    make(chan struct{}),
+		closedChan:  make(chan struct{}),
+	}, nil
+}
+
+func newSampleTrack(provider *provider) (*lksdk.LocalSampleTrack, error) {
 	cap := webrtc.RTPCodecCapability{
 		Channels:  1,
 		MimeType:  webrtc.MimeTypeOpus,
@@ -52,91 +87,485 @@ func NewGPTTrack() (*GPTTrack, error) {
 		return nil, err
 	}
 
-	provider := &provider{}
 	err = track.StartWrite(provider, func() {})
 	if err != nil {
 		return nil, err
 	}
 
-	return &GPTTrack{
-		sampleTrack: track,
-		provider:    provider,
-		doneChan:    make(chan struct{}),
-		closedChan:  make(chan struct{}),
-	}, nil
+	return track, nil
 }
 
 func (t *GPTTrack) Publish(lp *lksdk.LocalParticipant) (pub *lksdk.LocalTrackPublication, err error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
 	pub, err = lp.PublishTrack(t.sampleTrack, &lksdk.TrackPublicationOptions{})
+	if err == nil {
+		t.publication = pub
+	}
 	return
 }
 
+// Publish a new sample track after the previous one has been unbound.
+// The queued audio is kept, the interrupted sentence is played again from its beginning
+func (t *GPTTrack) Republish(lp *lksdk.LocalParticipant) (*lksdk.LocalTrackPublication, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.publication != nil {
+		_ = lp.UnpublishTrack(t.publication.SID()) // Can already be unpublished by the server
+		t.publication = nil
+	}
+
+	track, err := newSampleTrack(t.provider)
+	if err != nil {
+		return nil, err
+	}
+	t.sampleTrack = track
+	t.watchUnbind(track)
+
+	pub, err := lp.PublishTrack(track, &lksdk.TrackPublicationOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	t.publication = pub
+	return pub, nil
+}
+
+// Called when the track is removed from the peer connection (unpublished by the server, failed renegotiation, ...)
+// The audio isn't played anymore until the track is republished
+func (t *GPTTrack) OnUnbind(f func()) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.onUnbind = f
+	t.watchUnbind(t.sampleTrack)
+}
+
+// Only the unbind of the current sample track is reported, the previous ones are unpublished by Republish
+// (requires lock)
+func (t *GPTTrack) watchUnbind(track *lksdk.LocalSampleTrack) {
+	track.OnUnbind(func() {
+		t.lock.Lock()
+		current := t.sampleTrack == track
+		onUnbind := t.onUnbind
+		t.lock.Unlock()
+
+		if current && onUnbind != nil {
+			onUnbind()
+		}
+	})
+}
+
 // Called when the last oggReader in the queue finished being read
 func (t *GPTTrack) OnComplete(f func(err error)) {
 	t.provider.OnComplete(f)
 }
 
+// Called when the audio queued at the position seq starts playing (again if the track was republished).
+// The duration of a streamed audio is the one received so far
+func (t *GPTTrack) OnStart(f func(seq uint64, duration time.Duration)) {
+	t.provider.OnStart(f)
+}
+
+func (t *GPTTrack) Stats() TrackStats {
+	return t.provider.Stats()
+}
+
+// Queue reader after all the readers already queued/reserved
 func (t *GPTTrack) QueueReader(reader io.Reader) error {
-	oggReader, oggHeader, err := utils.NewOggReader(reader)
+	return t.QueueReaderAt(t.Reserve(), reader)
+}
+
+// Reserve a position in the playback order, it must then be filled using QueueReaderAt or skipped using Skip.
+// Used to synthesize multiple sentences concurrently while keeping their order.
+func (t *GPTTrack) Reserve() uint64 {
+	return t.provider.Reserve()
+}
+
+// Queue reader at the position seq, it is played once all the previous positions are played or skipped.
+// The position is skipped when an error is returned.
+func (t *GPTTrack) QueueReaderAt(seq uint64, reader io.Reader) error {
+	audio, err := readOggAudio(reader)
 	if err != nil {
+		t.provider.Skip(seq)
+		return err
+	}
+
+	if t.conf.TrimSilence {
+		audio.trimSilence(t.conf.SilenceThreshold, t.conf.SilencePadding)
+	}
+
+	if err := t.provider.QueueAudio(seq, audio); err != nil {
+		if err == ErrBacklogFull {
+			trackRefusedTotal.Inc()
+		}
+		t.provider.Skip(seq)
 		return err
 	}
+	return nil
+}
+
+// Queue the audio of reader at the position seq while it is read (e.g streaming synthesis): it starts playing
+// with its first page instead of once complete. Returns once the audio is queued, the position is skipped when an
+// error is returned. The rest is read in the background, done receives the result once reader is fully read
+// (ErrFlushed when the audio was dropped meanwhile, ErrBacklogFull when the audio exceeds the max backlog,
+// the audio received so far is played when reading fails)
+func (t *GPTTrack) QueueStreamAt(seq uint64, reader io.Reader) (done <-chan error, err error) {
+	oggReader, err := newOggAudioReader(reader)
+	if err != nil {
+		t.provider.Skip(seq)
+		return nil, err
+	}
+
+	audio := &oggAudio{streaming: true}
+	if err := t.provider.QueueAudio(seq, audio); err != nil {
+		if err == ErrBacklogFull {
+			trackRefusedTotal.Inc()
+		}
+		t.provider.Skip(seq)
+		return nil, err
+	}
+
+	var trimmer *silenceTrimmer
+	if t.conf.TrimSilence {
+		trimmer = &silenceTrimmer{threshold: t.conf.SilenceThreshold, padding: t.conf.SilencePadding}
+	}
+
+	result := make(chan error, 1)
+	go func() {
+		defer t.provider.EndAudio(audio)
+
+		err := readOggPages(oggReader, func(samples []media.Sample) error {
+			return t.provider.AppendAudio(audio, trimmer.push(samples))
+		})
+		if err == nil {
+			err = t.provider.AppendAudio(audio, trimmer.end())
+		}
+		if err == ErrBacklogFull {
+			trackRefusedTotal.Inc()
+		}
+		result <- err
+	}()
+	return result, nil
+}
+
+// Skip the position seq (e.g the synthesis failed), the next positions are played without waiting for it
+func (t *GPTTrack) SkipAt(seq uint64) {
+	t.provider.Skip(seq)
+}
+
+// Abort the audio being played and drop the queued ones, the reserved positions are skipped (barge-in, stop command).
+// OnComplete is called with ErrFlushed for every dropped audio. Returns the duration of audio discarded
+func (t *GPTTrack) Clear() time.Duration {
+	return t.provider.Clear()
+}
+
+// Abort the audio being played, the next queued one starts right away. Returns the duration of audio discarded
+func (t *GPTTrack) Skip() time.Duration {
+	return t.provider.SkipCurrent()
+}
+
+const noGranule = ^uint64(0) // No packet finishes on the page
+
+// Opus packets of an ogg file, parsed when queued so the backlog duration is known
+type oggAudio struct {
+	samples  []media.Sample
+	duration time.Duration
+
+	// Streamed audio (see QueueStreamAt), guarded by the lock of the provider
+	streaming bool // More samples are coming, the playback waits for them
+	dropped   bool // Flushed or skipped, the next samples are discarded
+}
+
+func readOggAudio(reader io.Reader) (*oggAudio, error) {
+	oggReader, err := newOggAudioReader(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	audio := &oggAudio{}
+	if err := readOggPages(oggReader, func(samples []media.Sample) error {
+		audio.append(samples)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	return audio, nil
+}
+
+func newOggAudioReader(reader io.Reader) (*utils.OggReader, error) {
+	oggReader, oggHeader, err := utils.NewOggReader(reader)
+	if err != nil {
+		return nil, err
+	}
 
 	// oggHeader.SampleRate is _not_ the sample rate to use for playback.
 	// see https://www.rfc-editor.org/rfc/rfc7845.html#section-3
 	if oggHeader.Channels != 1 /*|| oggHeader.SampleRate != 48000*/ {
-		return ErrInvalidFormat
+		return nil, ErrInvalidFormat
 	}
+	return oggReader, nil
+}
 
-	t.provider.QueueReader(oggReader)
-	return nil
+// onPage is called with the samples of each page once it is complete (their durations are corrected with the
+// granule position of the page), then with the samples of the last packets at the end of the stream
+func readOggPages(oggReader *utils.OggReader, onPage func(samples []media.Sample) error) error {
+	var (
+		page        []media.Sample // Samples of the current page
+		lastGranule uint64         // Granule position at the end of the previous page
+		firstPage   = true
+		pageSamples int64 // Samples of the current page, according to the TOC of its packets
+	)
+	for {
+		data, err := oggReader.ReadPacket()
+		if err != nil {
+			if err == io.EOF {
+				if len(page) > 0 {
+					return onPage(page)
+				}
+				return nil
+			}
+			return err
+		}
+
+		// Zero-length packets carry no audio, only the position of their page matters
+		if len(data) > 0 {
+			samples, err := utils.ParsePacketSamples(data)
+			if err != nil {
+				return err
+			}
+
+			page = append(page, media.Sample{
+				Data:     data,
+				Duration: utils.SamplesDuration(int64(samples)),
+			})
+			pageSamples += int64(samples)
+		}
+
+		granule, endOfPage := oggReader.Granule()
+		if !endOfPage {
+			continue
+		}
+
+		// The granule positions are the reference, the TOC durations don't account for the
+		// discontinuities (gaps in the stream) and for the samples trimmed at the end of the stream
+		if firstPage && granule != noGranule {
+			// The stream can start at a non-zero granule position
+			if int64(granule) > pageSamples {
+				lastGranule = granule - uint64(pageSamples)
+			}
+			firstPage = false
+		}
+
+		if granule != noGranule && granule >= lastGranule {
+			if diff := int64(granule-lastGranule) - pageSamples; diff != 0 && len(page) > 0 {
+				logger.Debugw("ogg discontinuity", "samples", diff)
+				last := &page[len(page)-1]
+				last.Duration += utils.SamplesDuration(diff)
+				if last.Duration < 0 {
+					last.Duration = 0
+				}
+			}
+			lastGranule = granule
+		}
+
+		if len(page) > 0 {
+			if err := onPage(page); err != nil {
+				return err
+			}
+		}
+		page = nil
+		pageSamples = 0
+	}
+}
+
+func (a *oggAudio) append(samples []media.Sample) {
+	a.samples = append(a.samples, samples...)
+	for _, sample := range samples {
+		a.duration += sample.Duration
+	}
+}
+
+// Remove the leading/trailing silence, it adds up when the sentences are queued one after the other.
+// padding is kept on both sides so the speech isn't clipped
+func (a *oggAudio) trimSilence(threshold int, padding time.Duration) {
+	start := 0
+	for start < len(a.samples) && utils.IsSilentPacket(a.samples[start].Data, threshold) {
+		start++
+	}
+
+	end := len(a.samples)
+	for end > start && utils.IsSilentPacket(a.samples[end-1].Data, threshold) {
+		end--
+	}
+
+	if start == end {
+		return // Only silence, keep it as is
+	}
+
+	for kept := time.Duration(0); start > 0 && kept < padding; start-- {
+		kept += a.samples[start-1].Duration
+	}
+	for kept := time.Duration(0); end < len(a.samples) && kept < padding; end++ {
+		kept += a.samples[end].Duration
+	}
+
+	a.samples = a.samples[start:end]
+	a.duration = 0
+	for _, sample := range a.samples {
+		a.duration += sample.Duration
+	}
+}
+
+// trimSilence of the streamed audio: the silence is held back until the next speech, the leading silence
+// beyond padding is dropped and the trailing one is cut to padding once the stream ends
+type silenceTrimmer struct {
+	threshold int
+	padding   time.Duration
+
+	speech bool           // Speech was received
+	held   []media.Sample // Silence since the start, or since the last speech
+}
+
+// The samples to play, nil-safe
+func (t *silenceTrimmer) push(samples []media.Sample) []media.Sample {
+	if t == nil {
+		return samples
+	}
+
+	var out []media.Sample
+	for _, sample := range samples {
+		if utils.IsSilentPacket(sample.Data, t.threshold) {
+			t.held = append(t.held, sample)
+			if !t.speech {
+				t.held = lastSamples(t.held, t.padding)
+			}
+			continue
+		}
+
+		out = append(out, t.held...) // The pauses between the words are kept
+		out = append(out, sample)
+		t.held = nil
+		t.speech = true
+	}
+	return out
+}
+
+// The padding after the speech, nil-safe
+func (t *silenceTrimmer) end() []media.Sample {
+	if t == nil || !t.speech {
+		return nil // Only silence
+	}
+
+	var kept time.Duration
+	for i, sample := range t.held {
+		if kept >= t.padding {
+			return t.held[:i]
+		}
+		kept += sample.Duration
+	}
+	return t.held
+}
+
+// The samples at the end lasting at least d
+func lastSamples(samples []media.Sample, d time.Duration) []media.Sample {
+	var kept time.Duration
+	for i := len(samples) - 1; i >= 0; i-- {
+		if kept >= d {
+			return samples[i+1:]
+		}
+		kept += samples[i].Duration
+	}
+	return samples
+}
+
+type queuedAudio struct {
+	seq   uint64
+	audio *oggAudio // nil when skipped
+}
+
+// Min-heap on the sequence numbers
+type audioQueue []*queuedAudio
+
+func (q audioQueue) Len() int            { return len(q) }
+func (q audioQueue) Less(i, j int) bool  { return q[i].seq < q[j].seq }
+func (q audioQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *audioQueue) Push(x interface{}) { *q = append(*q, x.(*queuedAudio)) }
+func (q *audioQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	item := old[n-1]
+	*q = old[:n-1]
+	return item
 }
 
 type provider struct {
-	reader      *utils.OggReader
-	lastGranule uint64
+	audio    *oggAudio // Being played
+	seq      uint64    // Position of audio
+	position int       // Next sample of audio
 
-	queue      []*utils.OggReader
+	queue      audioQueue
+	reserved   uint64        // Next sequence number to reserve
+	next       uint64        // Next sequence number to play
+	queued     time.Duration // Remaining duration of the queued audio (including the one being played)
+	maxBacklog time.Duration
 	lock       sync.Mutex
 	onComplete func(err error)
+	onStart    func(seq uint64, duration time.Duration)
 }
 
 func (p *provider) NextSample() (media.Sample, error) {
 	p.lock.Lock()
 	onComplete := p.onComplete
-	if p.reader == nil && len(p.queue) > 0 {
-		p.lastGranule = 0
-		p.reader = p.queue[0]
-		p.queue = p.queue[1:]
+	for p.audio == nil && len(p.queue) > 0 && p.queue[0].seq <= p.next {
+		item := heap.Pop(&p.queue).(*queuedAudio)
+		if item.seq < p.next {
+			continue // Already skipped
+		}
+
+		p.next++
+		if item.audio != nil {
+			p.audio = item.audio
+			p.seq = item.seq
+			p.position = 0
+		}
 	}
-	p.lock.Unlock()
 
-	if p.reader != nil {
-		data, err := p.reader.ReadPacket()
-		if err != nil {
-			if onComplete != nil {
-				onComplete(err)
-			}
+	if p.audio != nil {
+		if p.position < len(p.audio.samples) {
+			start := p.position == 0
+			seq, duration := p.seq, p.audio.duration
+			onStart := p.onStart
 
-			if err == io.EOF {
-				p.reader = nil
-				return p.NextSample()
-			} else {
-				logger.Errorw("failed to parse next page", err)
-				return media.Sample{}, err
+			sample := p.audio.samples[p.position]
+			p.position++
+			p.queued -= sample.Duration
+			p.lock.Unlock()
+
+			if start && onStart != nil {
+				onStart(seq, duration)
 			}
+			return sample, nil
 		}
 
-		duration, err := utils.ParsePacketDuration(data)
-		if err != nil {
-			return media.Sample{}, err
+		if p.audio.streaming {
+			p.lock.Unlock()
+			return media.Sample{ // Waiting for the next samples of the stream
+				Data:     OpusSilenceFrame,
+				Duration: OpusSilenceFrameDuration,
+			}, nil
 		}
 
-		return media.Sample{
-			Data:     data,
-			Duration: duration,
-		}, nil
+		p.audio = nil
+		p.lock.Unlock()
+		if onComplete != nil {
+			onComplete(nil)
+		}
+		return p.NextSample()
 	}
+	p.lock.Unlock()
 
 	// Otherwise send empty Opus frames
 	return media.Sample{
@@ -150,6 +579,16 @@ func (p *provider) OnBind() error {
 }
 
 func (p *provider) OnUnbind() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	// Nobody heard the end of the current sentence, replay it entirely once republished
+	if p.audio != nil {
+		for _, sample := range p.audio.samples[:p.position] {
+			p.queued += sample.Duration
+		}
+		p.position = 0
+	}
 	return nil
 }
 
@@ -161,9 +600,148 @@ func (t *provider) OnComplete(f func(err error)) {
 	t.onComplete = f
 }
 
-func (p *provider) QueueReader(reader *utils.OggReader) {
+func (p *provider) OnStart(f func(seq uint64, duration time.Duration)) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.onStart = f
+}
+
+func (p *provider) Stats() TrackStats {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	stats := TrackStats{
+		QueuedDuration: p.queued,
+		PendingSeqs:    int(p.reserved - p.next),
+	}
+	if p.audio != nil {
+		stats.QueuedReaders++
+	}
+	for _, item := range p.queue {
+		if item.seq < p.next {
+			continue // Already skipped
+		}
+
+		stats.PendingSeqs--
+		if item.audio != nil {
+			stats.QueuedReaders++
+		}
+	}
+	return stats
+}
+
+func (p *provider) Reserve() uint64 {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	seq := p.reserved
+	p.reserved++
+	return seq
+}
+
+func (p *provider) QueueAudio(seq uint64, audio *oggAudio) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if seq < p.next {
+		return ErrFlushed // Reserved before a flush
+	}
+
+	if p.maxBacklog > 0 && p.queued+audio.duration > p.maxBacklog {
+		return ErrBacklogFull
+	}
+
+	p.queued += audio.duration
+	heap.Push(&p.queue, &queuedAudio{seq: seq, audio: audio})
+	return nil
+}
+
+// Samples of a streamed audio, ErrFlushed when it was dropped. Its duration is only known while it is read:
+// ErrBacklogFull once it would exceed the max backlog, the samples appended so far are still played
+func (p *provider) AppendAudio(audio *oggAudio, samples []media.Sample) error {
 	p.lock.Lock()
 	defer p.lock.Unlock()
 
-	p.queue = append(p.queue, reader)
+	if audio.dropped {
+		return ErrFlushed
+	}
+
+	var duration time.Duration
+	for _, sample := range samples {
+		duration += sample.Duration
+	}
+	if p.maxBacklog > 0 && p.queued+duration > p.maxBacklog {
+		return ErrBacklogFull
+	}
+
+	audio.append(samples)
+	p.queued += duration
+	return nil
+}
+
+// The streamed audio is complete, it ends once its samples are played
+func (p *provider) EndAudio(audio *oggAudio) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	audio.streaming = false
+}
+
+func (p *provider) Skip(seq uint64) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	heap.Push(&p.queue, &queuedAudio{seq: seq})
+}
+
+func (p *provider) Clear() time.Duration {
+	p.lock.Lock()
+	discarded := p.queued
+	dropped := 0
+	if p.audio != nil {
+		dropped++
+		p.audio.dropped = true
+		p.audio = nil
+	}
+	for _, item := range p.queue {
+		if item.seq >= p.next && item.audio != nil {
+			dropped++
+			item.audio.dropped = true
+		}
+	}
+	p.queue = nil
+	p.next = p.reserved
+	p.queued = 0
+	onComplete := p.onComplete
+	p.lock.Unlock()
+
+	if onComplete != nil {
+		for i := 0; i < dropped; i++ {
+			onComplete(ErrFlushed)
+		}
+	}
+	return discarded
+}
+
+func (p *provider) SkipCurrent() time.Duration {
+	p.lock.Lock()
+	if p.audio == nil {
+		p.lock.Unlock()
+		return 0
+	}
+
+	var discarded time.Duration
+	for _, sample := range p.audio.samples[p.position:] {
+		discarded += sample.Duration
+	}
+	p.queued -= discarded
+	p.audio.dropped = true
+	p.audio = nil
+	onComplete := p.onComplete
+	p.lock.Unlock()
+
+	if onComplete != nil {
+		onComplete(ErrFlushed)
+	}
+	return discarded
 }
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+)
+
+// Ogg file of n CELT packets of 20ms, one per page like the synthesized audio
+func testOggAudio(t *testing.T, n int) []byte {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	writer, err := oggwriter.NewWith(buf, 48000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		pkt := &rtp.Packet{
+			Header:  rtp.Header{SequenceNumber: uint16(i), Timestamp: uint32(i * 960)},
+			Payload: append([]byte{31 << 3}, bytes.Repeat([]byte{0xaa}, 40)...),
+		}
+		if err := writer.WriteRTP(pkt); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// The sample track isn't needed to queue the audio
+func newTestGPTTrack(conf config.SynthesisConfig) *GPTTrack {
+	return &GPTTrack{
+		provider: &provider{maxBacklog: conf.MaxBacklog},
+		conf:     conf,
+	}
+}
+
+func TestGPTTrackMaxBacklog(t *testing.T) {
+	const maxBacklog = 500 * time.Millisecond
+	second := testOggAudio(t, 50)
+
+	t.Run("queued", func(t *testing.T) {
+		track := newTestGPTTrack(config.SynthesisConfig{MaxBacklog: maxBacklog})
+		if err := track.QueueReaderAt(track.Reserve(), bytes.NewReader(second)); !errors.Is(err, ErrBacklogFull) {
+			t.Fatalf("got %v, want %v", err, ErrBacklogFull)
+		}
+		if queued := track.Stats().QueuedDuration; queued != 0 {
+			t.Errorf("queued: got %v, want 0", queued)
+		}
+	})
+
+	t.Run("streamed", func(t *testing.T) {
+		track := newTestGPTTrack(config.SynthesisConfig{MaxBacklog: maxBacklog, Streaming: true})
+		done, err := track.QueueStreamAt(track.Reserve(), bytes.NewReader(second))
+		if err != nil {
+			t.Fatal(err) // The duration isn't known yet
+		}
+		if err := <-done; !errors.Is(err, ErrBacklogFull) {
+			t.Fatalf("got %v, want %v", err, ErrBacklogFull)
+		}
+
+		// The beginning is played, up to the max backlog (the durations follow the granule positions of the oggwriter)
+		if queued := track.Stats().QueuedDuration; queued > maxBacklog || queued < maxBacklog-40*time.Millisecond {
+			t.Errorf("queued: got %v, want about %v", queued, maxBacklog)
+		}
+
+		// The next sentences are refused until the backlog is played
+		if _, err := track.QueueStreamAt(track.Reserve(), bytes.NewReader(testOggAudio(t, 1))); err != nil {
+			t.Fatal(err)
+		}
+		if err := track.QueueReaderAt(track.Reserve(), bytes.NewReader(testOggAudio(t, 5))); !errors.Is(err, ErrBacklogFull) {
+			t.Errorf("got %v, want %v", err, ErrBacklogFull)
+		}
+	})
+
+	t.Run("streamed under the max backlog", func(t *testing.T) {
+		track := newTestGPTTrack(config.SynthesisConfig{MaxBacklog: 2 * time.Second, Streaming: true})
+		done, err := track.QueueStreamAt(track.Reserve(), bytes.NewReader(second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+		if queued := track.Stats().QueuedDuration; queued < time.Second-40*time.Millisecond {
+			t.Errorf("queued: got %v, want about %v", queued, time.Second)
+		}
+	})
+}
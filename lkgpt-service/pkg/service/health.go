@@ -0,0 +1,329 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// Health of the providers and of the instance, sent to the participants with packet_Health so the clients
+// can show that the assistant is limited instead of looking broken (see HealthConfig).
+// A provider failing FailureThreshold times in a row opens its circuit breaker: its requests fail right away
+// for OpenDuration, then a single request tests it again. A rate-limited provider (429) opens it right away
+// for RateLimitDuration
+
+const healthCheckInterval = 5 * time.Second // Quota, load and the breakers waiting for a test request
+
+const (
+	healthProvider_LLM = "llm"
+	healthProvider_TTS = "tts"
+)
+
+const (
+	degradation_CircuitOpen   = "circuit_open"   // The provider keeps failing
+	degradation_RateLimited   = "rate_limited"   // The provider refuses the requests (429)
+	degradation_QuotaExceeded = "quota_exceeded" // See QuotaConfig
+	degradation_Overloaded    = "overloaded"     // See LoadConfig, the answers use the reduced model
+)
+
+var errProviderUnavailable = errors.New("provider temporarily unavailable")
+
+type circuitBreaker struct {
+	conf config.HealthConfig
+
+	lock      sync.Mutex
+	failures  int       // In a row
+	openUntil time.Time // Zero when closed
+	reason    string    // degradation_CircuitOpen or degradation_RateLimited while open
+	testing   bool      // A request is testing the provider after openUntil
+}
+
+// False when the request must fail right away
+func (b *circuitBreaker) allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if b.testing || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.testing = true
+	return true
+}
+
+// Returns true when the breaker opened or closed. The canceled requests aren't failures of the provider
+func (b *circuitBreaker) record(err error) bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.testing = false
+	if err == nil {
+		closed := !b.openUntil.IsZero()
+		b.failures = 0
+		b.openUntil = time.Time{}
+		b.reason = ""
+		return closed
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, errProviderUnavailable) {
+		return false
+	}
+
+	wasOpen := !b.openUntil.IsZero()
+	b.failures++
+	switch {
+	case isRateLimited(err):
+		b.openUntil = time.Now().Add(b.conf.RateLimitDuration)
+		b.reason = degradation_RateLimited
+	case wasOpen || b.failures >= b.conf.FailureThreshold:
+		b.openUntil = time.Now().Add(b.conf.OpenDuration)
+		b.reason = degradation_CircuitOpen
+	default:
+		return false
+	}
+	return !wasOpen
+}
+
+// Empty reason when closed
+func (b *circuitBreaker) state() (reason string, retryAt time.Time) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.reason, b.openUntil
+}
+
+func isRateLimited(err error) bool {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode == http.StatusTooManyRequests
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
+
+// Circuit breakers of the providers shared by the rooms, nil when HealthConfig is disabled
+type providerHealth struct {
+	breakers map[string]*circuitBreaker
+	onChange func() // Called when a breaker opens or closes
+}
+
+func newProviderHealth(conf config.HealthConfig, onChange func()) *providerHealth {
+	if !conf.Enabled {
+		return nil
+	}
+	return &providerHealth{
+		breakers: map[string]*circuitBreaker{
+			healthProvider_LLM: {conf: conf},
+			healthProvider_TTS: {conf: conf},
+		},
+		onChange: onChange,
+	}
+}
+
+func (h *providerHealth) allow(provider string) bool {
+	if h == nil {
+		return true
+	}
+	return h.breakers[provider].allow()
+}
+
+func (h *providerHealth) record(provider string, err error) {
+	if h == nil || !h.breakers[provider].record(err) {
+		return
+	}
+
+	reason, retryAt := h.breakers[provider].state()
+	if reason == "" {
+		logger.Infow("provider recovered", "provider", provider)
+	} else {
+		logger.Warnw("provider degraded", err, "provider", provider, "reason", reason, "retryAt", retryAt)
+	}
+	go h.onChange() // The caller may hold the lock of a participant
+}
+
+func (h *providerHealth) issues() []*HealthIssue {
+	if h == nil {
+		return nil
+	}
+
+	var issues []*HealthIssue
+	for provider, b := range h.breakers {
+		if reason, retryAt := b.state(); reason != "" {
+			issues = append(issues, &HealthIssue{
+				Provider: provider,
+				Reason:   reason,
+				RetryAt:  retryAt,
+			})
+		}
+	}
+	sort.Slice(issues, func(i, j int) bool {
+		return issues[i].Provider < issues[j].Provider
+	})
+	return issues
+}
+
+func (h *providerHealth) wrapLLM(llm LLMClient) LLMClient {
+	if h == nil {
+		return llm
+	}
+	return &healthLLM{LLMClient: llm, health: h}
+}
+
+func (h *providerHealth) wrapSynthesizer(synthesizer SpeechSynthesizer) SpeechSynthesizer {
+	if h == nil {
+		return synthesizer
+	}
+	return &healthSynthesizer{SpeechSynthesizer: synthesizer, health: h}
+}
+
+type healthLLM struct {
+	LLMClient
+	health *providerHealth
+}
+
+func (l *healthLLM) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	if !l.health.allow(healthProvider_LLM) {
+		return openai.ChatCompletionResponse{}, errProviderUnavailable
+	}
+	resp, err := l.LLMClient.CreateChatCompletion(ctx, req)
+	l.health.record(healthProvider_LLM, err)
+	return resp, err
+}
+
+// Only the creation of the stream is recorded
+func (l *healthLLM) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (LLMStream, error) {
+	if !l.health.allow(healthProvider_LLM) {
+		return nil, errProviderUnavailable
+	}
+	stream, err := l.LLMClient.CreateChatCompletionStream(ctx, req)
+	l.health.record(healthProvider_LLM, err)
+	return stream, err
+}
+
+type healthSynthesizer struct {
+	SpeechSynthesizer
+	health *providerHealth
+}
+
+func (s *healthSynthesizer) Synthesize(ctx context.Context, text string, language *Language) ([]byte, error) {
+	if !s.health.allow(healthProvider_TTS) {
+		return nil, errProviderUnavailable
+	}
+	audio, err := s.SpeechSynthesizer.Synthesize(ctx, text, language)
+	s.health.record(healthProvider_TTS, err)
+	return audio, err
+}
+
+// Only the request is recorded, not the reading of the audio
+func (s *healthSynthesizer) SynthesizeStream(ctx context.Context, text string, language *Language) (io.ReadCloser, error) {
+	if !s.health.allow(healthProvider_TTS) {
+		return nil, errProviderUnavailable
+	}
+	audio, err := s.SpeechSynthesizer.SynthesizeStream(ctx, text, language)
+	s.health.record(healthProvider_TTS, err)
+	return audio, err
+}
+
+// Shown by the clients
+var degradationMessages = map[string]string{
+	degradation_CircuitOpen:   "AI assistant temporarily limited, a provider isn't responding",
+	degradation_RateLimited:   "AI assistant temporarily limited, too many requests",
+	degradation_QuotaExceeded: "AI assistant limited, the usage quota is exceeded",
+	degradation_Overloaded:    "AI assistant limited, the service is busy",
+}
+
+// Called by the server with the issues of the providers, the ones of the instance are added.
+// A HealthEvent is published when the issues changed
+func (p *GPTParticipant) updateHealth(providerIssues []*HealthIssue) {
+	if !p.conf.Health.Enabled {
+		return
+	}
+
+	issues := append([]*HealthIssue{}, providerIssues...)
+	if p.usage.Exceeded() {
+		issues = append(issues, &HealthIssue{
+			Reason:  degradation_QuotaExceeded,
+			Message: degradationMessages[degradation_QuotaExceeded],
+		})
+	}
+	if p.currentLoadLevel() >= LoadLevel_Reduced {
+		issues = append(issues, &HealthIssue{
+			Reason:  degradation_Overloaded,
+			Message: degradationMessages[degradation_Overloaded],
+		})
+	}
+
+	p.lock.Lock()
+	if sameHealthIssues(p.health, issues) {
+		p.lock.Unlock()
+		return
+	}
+	p.health = issues
+	p.lock.Unlock()
+
+	p.bus.Publish(&RoomEvent{
+		Type: RoomEvent_Health,
+		Room: p.room.Name(),
+		Data: &HealthEvent{
+			Degraded: len(issues) > 0,
+			Issues:   issues,
+		},
+	})
+}
+
+// nil when everything is fine
+func (p *GPTParticipant) healthPacket() *healthPacket {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.health) == 0 {
+		return nil
+	}
+	return newHealthPacket(&HealthEvent{Degraded: true, Issues: p.health})
+}
+
+func sameHealthIssues(a, b []*HealthIssue) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Provider != b[i].Provider || a[i].Reason != b[i].Reason {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *LiveGPT) updateHealth() {
+	issues := s.health.issues()
+	for _, p := range s.connectedParticipants() {
+		p.updateHealth(issues)
+	}
+}
+
+// The quota, the load and the breakers reopening aren't notified
+func (s *LiveGPT) watchHealth() {
+	ticker := time.NewTicker(healthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.doneChan:
+			return
+		case <-ticker.C:
+			s.updateHealth()
+		}
+	}
+}
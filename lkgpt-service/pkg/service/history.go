@@ -0,0 +1,169 @@
+package service
+
+import (
+	"sync"
+)
+
+// History is a list of meeting events safe for concurrent use: the conversation of KITT (prompts of the
+// completions) and the transcript of the room (notes, summaries, exports).
+// The readers get snapshots, copies they can keep while the history grows. The zero value is empty
+type History struct {
+	lock   sync.Mutex
+	events []*MeetingEvent
+	nextId uint64
+	subs   map[uint64]func(e *MeetingEvent)
+}
+
+func NewHistory() *History {
+	return &History{}
+}
+
+// The subscribers are called synchronously after the events are added, so they must not block
+func (h *History) Append(events ...*MeetingEvent) {
+	h.lock.Lock()
+	h.events = append(h.events, events...)
+	subs := h.subscribers()
+	h.lock.Unlock()
+
+	for _, e := range events {
+		for _, f := range subs {
+			f(e)
+		}
+	}
+}
+
+// Append e and return the window of the events before it (see Window) and their total count,
+// so the prompt isn't part of its own history
+func (h *History) AppendWindow(e *MeetingEvent, maxTokens int) ([]*MeetingEvent, int) {
+	h.lock.Lock()
+	window := h.window(maxTokens)
+	n := len(h.events)
+	h.events = append(h.events, e)
+	subs := h.subscribers()
+	h.lock.Unlock()
+
+	for _, f := range subs {
+		f(e)
+	}
+	return window, n
+}
+
+func (h *History) Len() int {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return len(h.events)
+}
+
+func (h *History) Snapshot() []*MeetingEvent {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.copy(0)
+}
+
+// The n last events at most
+func (h *History) Last(n int) []*MeetingEvent {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if n > len(h.events) {
+		n = len(h.events)
+	} else if n < 0 {
+		n = 0
+	}
+	return h.copy(len(h.events) - n)
+}
+
+// Events added after the first index ones, and the index to use for the next call
+func (h *History) Since(index int) ([]*MeetingEvent, int) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if index > len(h.events) {
+		index = len(h.events) // Reset meanwhile
+	} else if index < 0 {
+		index = 0
+	}
+	return h.copy(index), len(h.events)
+}
+
+// The last events fitting in maxTokens (estimated), all of them when maxTokens is 0
+func (h *History) Window(maxTokens int) []*MeetingEvent {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.window(maxTokens)
+}
+
+func (h *History) Reset() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.events = nil
+}
+
+// Called with every event added, returns a function used to unsubscribe
+func (h *History) Subscribe(f func(e *MeetingEvent)) func() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if h.subs == nil {
+		h.subs = make(map[uint64]func(e *MeetingEvent))
+	}
+	id := h.nextId
+	h.nextId++
+	h.subs[id] = f
+
+	return func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		delete(h.subs, id)
+	}
+}
+
+// The caller must hold the lock
+func (h *History) copy(from int) []*MeetingEvent {
+	events := make([]*MeetingEvent, len(h.events)-from)
+	copy(events, h.events[from:])
+	return events
+}
+
+// The caller must hold the lock
+func (h *History) window(maxTokens int) []*MeetingEvent {
+	if maxTokens <= 0 {
+		return h.copy(0)
+	}
+
+	tokens := 0.0
+	from := len(h.events)
+	for from > 0 {
+		tokens += estimateEventTokens(h.events[from-1])
+		if tokens > float64(maxTokens) {
+			break
+		}
+		from--
+	}
+	return h.copy(from)
+}
+
+// The caller must hold the lock
+func (h *History) subscribers() []func(e *MeetingEvent) {
+	subs := make([]func(e *MeetingEvent), 0, len(h.subs))
+	for _, f := range h.subs {
+		subs = append(subs, f)
+	}
+	return subs
+}
+
+const eventOverheadTokens = 8 // Role, name and formatting of the message
+
+func estimateEventTokens(e *MeetingEvent) float64 {
+	chars := 0
+	if e.Speech != nil {
+		chars += len(e.Speech.ParticipantName) + len(e.Speech.Text)
+	}
+	if e.Join != nil {
+		chars += len(e.Join.ParticipantName) + 40
+	}
+	if e.Microphone != nil {
+		chars += len(e.Microphone.ParticipantName) + 40
+	}
+	return float64(chars)/charsPerToken + eventOverheadTokens
+}
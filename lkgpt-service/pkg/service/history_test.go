@@ -0,0 +1,253 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 16 estimated tokens: (1 + 31) chars / charsPerToken + eventOverheadTokens
+const speechTokens = 16
+
+func speech(i int) *MeetingEvent {
+	text := fmt.Sprintf("%-31s", fmt.Sprint(i))
+	return &MeetingEvent{Speech: &SpeechEvent{ParticipantName: "a", Text: text}}
+}
+
+func speechIndex(e *MeetingEvent) int {
+	var i int
+	_, _ = fmt.Sscan(strings.TrimSpace(e.Speech.Text), &i)
+	return i
+}
+
+func TestHistoryConcurrent(t *testing.T) {
+	const writers = 8
+	const perWriter = 200
+
+	h := NewHistory()
+	var received atomic.Int64
+	unsubscribe := h.Subscribe(func(e *MeetingEvent) {
+		received.Add(1)
+	})
+	defer unsubscribe()
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for w := 0; w < writers; w++ {
+		w := w
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				e := speech(w*perWriter + i)
+				if i%2 == 0 {
+					h.Append(e)
+					continue
+				}
+
+				window, n := h.AppendWindow(e, speechTokens*5)
+				if len(window) > 5 || len(window) > n {
+					t.Errorf("window of %d events out of %d", len(window), n)
+				}
+				for _, prev := range window {
+					if prev == e {
+						t.Errorf("the prompt is part of its own window")
+					}
+				}
+			}
+		}()
+	}
+
+	// Readers following the history with Since, each event must be read once
+	var readers sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			seen := make(map[int]bool)
+			index := 0
+			read := func() {
+				var events []*MeetingEvent
+				events, index = h.Since(index)
+				for _, e := range events {
+					i := speechIndex(e)
+					if seen[i] {
+						t.Errorf("event %d read twice", i)
+					}
+					seen[i] = true
+				}
+			}
+			for {
+				select {
+				case <-done:
+					read()
+					if len(seen) != writers*perWriter {
+						t.Errorf("read %d events, want %d", len(seen), writers*perWriter)
+					}
+					return
+				default:
+					read()
+					_ = h.Window(speechTokens * 10)
+					_ = h.Last(3)
+					_ = h.Snapshot()
+					_ = h.Len()
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(done)
+	readers.Wait()
+
+	if n := h.Len(); n != writers*perWriter {
+		t.Errorf("len: got %d, want %d", n, writers*perWriter)
+	}
+	if n := received.Load(); n != writers*perWriter {
+		t.Errorf("subscriber received %d events, want %d", n, writers*perWriter)
+	}
+}
+
+// The subscribers are called without the lock: a slow one only delays the Append that called it
+func TestHistorySlowSubscriber(t *testing.T) {
+	h := NewHistory()
+	release := make(chan struct{})
+	entered := make(chan struct{})
+	h.Subscribe(func(e *MeetingEvent) {
+		if speechIndex(e) == 0 {
+			close(entered)
+			<-release
+		}
+	})
+
+	appended := make(chan struct{})
+	go func() {
+		h.Append(speech(0))
+		close(appended)
+	}()
+	<-entered
+
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		h.Append(speech(1))
+		if n := h.Len(); n != 2 {
+			t.Errorf("len: got %d, want 2", n)
+		}
+		if window := h.Window(0); len(window) != 2 {
+			t.Errorf("window: got %d events, want 2", len(window))
+		}
+	}()
+
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the history is blocked by a slow subscriber")
+	}
+
+	select {
+	case <-appended:
+		t.Fatal("the Append calling the slow subscriber returned before it")
+	default:
+	}
+	close(release)
+	<-appended
+}
+
+// The subscribers can read the history and unsubscribe from their callback
+func TestHistorySubscriberReentrant(t *testing.T) {
+	h := NewHistory()
+	calls := 0
+	var unsubscribe func()
+	unsubscribe = h.Subscribe(func(e *MeetingEvent) {
+		calls++
+		if h.Len() == 0 {
+			t.Errorf("the event isn't added before the subscribers are called")
+		}
+		unsubscribe()
+	})
+
+	h.Append(speech(0))
+	h.Append(speech(1))
+	if calls != 1 {
+		t.Errorf("calls: got %d, want 1", calls)
+	}
+}
+
+func TestHistoryBounds(t *testing.T) {
+	h := NewHistory()
+	for i := 0; i < 5; i++ {
+		h.Append(speech(i))
+	}
+
+	indexes := func(events []*MeetingEvent) []int {
+		res := make([]int, len(events))
+		for i, e := range events {
+			res[i] = speechIndex(e)
+		}
+		return res
+	}
+
+	tests := []struct {
+		name string
+		got  []*MeetingEvent
+		want []int
+	}{
+		{name: "last", got: h.Last(2), want: []int{3, 4}},
+		{name: "last zero", got: h.Last(0), want: []int{}},
+		{name: "last negative", got: h.Last(-1), want: []int{}},
+		{name: "last beyond", got: h.Last(10), want: []int{0, 1, 2, 3, 4}},
+		{name: "since", got: first(h.Since(3)), want: []int{3, 4}},
+		{name: "since negative", got: first(h.Since(-1)), want: []int{0, 1, 2, 3, 4}},
+		{name: "since end", got: first(h.Since(5)), want: []int{}},
+		{name: "window unbounded", got: h.Window(0), want: []int{0, 1, 2, 3, 4}},
+		{name: "window", got: h.Window(speechTokens * 2), want: []int{3, 4}},
+		{name: "window partial event", got: h.Window(speechTokens*2 + speechTokens/2), want: []int{3, 4}},
+		{name: "window smaller than an event", got: h.Window(speechTokens / 2), want: []int{}},
+		{name: "window beyond", got: h.Window(speechTokens * 100), want: []int{0, 1, 2, 3, 4}},
+	}
+
+	for _, tt := range tests {
+		if got := fmt.Sprint(indexes(tt.got)); got != fmt.Sprint(tt.want) {
+			t.Errorf("%s: got %s, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// Since after a reset starts again from the first event
+	h.Reset()
+	h.Append(speech(9))
+	events, next := h.Since(5)
+	if len(events) != 0 || next != 1 {
+		t.Errorf("since after reset: got %d events and %d, want 0 and 1", len(events), next)
+	}
+}
+
+func first(events []*MeetingEvent, _ int) []*MeetingEvent {
+	return events
+}
+
+// The snapshots are copies, they don't change when the history grows or is reset
+func TestHistorySnapshot(t *testing.T) {
+	h := NewHistory()
+	h.Append(speech(0), speech(1))
+
+	snapshot := h.Snapshot()
+	window, n := h.AppendWindow(speech(2), 0)
+	snapshot[0] = speech(7)
+	h.Reset()
+
+	if n != 2 || len(window) != 2 || speechIndex(window[0]) != 0 {
+		t.Errorf("append window: got %d events out of %d", len(window), n)
+	}
+	if len(snapshot) != 2 || speechIndex(snapshot[1]) != 1 {
+		t.Errorf("snapshot changed: %d events", len(snapshot))
+	}
+
+	h.Append(speech(3))
+	if last := h.Last(1); speechIndex(last[0]) != 3 {
+		t.Errorf("last: got %d, want 3", speechIndex(last[0]))
+	}
+}
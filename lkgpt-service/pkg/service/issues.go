@@ -0,0 +1,300 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// Action items spoken during the meeting are first proposed with propose_issue, KITT reads them back
+// and asks for a confirmation (its answer ends with a question so the speaker doesn't need the wake word).
+// They are only filed in the issue tracker when confirm_issue is called
+
+const (
+	IssuesProvider_Jira   = "jira"
+	IssuesProvider_GitHub = "github"
+)
+
+type Issue struct {
+	Title       string
+	Description string
+	Assignee    string // Account id (Jira) or login (GitHub), empty when unassigned
+	Reporter    string // Identity of the participant
+}
+
+// Connector to an issue tracker
+type IssueTracker interface {
+	CreateIssue(ctx context.Context, issue *Issue) (*TicketRef, error)
+}
+
+func NewIssueTracker(conf config.IssuesConfig) (IssueTracker, error) {
+	switch conf.Provider {
+	case IssuesProvider_Jira:
+		return &jiraConnector{conf: conf.Jira}, nil
+	case IssuesProvider_GitHub:
+		return &githubConnector{conf: conf.GitHub}, nil
+	default:
+		return nil, fmt.Errorf("unknown issues provider: %s", conf.Provider)
+	}
+}
+
+func (j *jiraConnector) CreateIssue(ctx context.Context, issue *Issue) (*TicketRef, error) {
+	fields := map[string]interface{}{
+		"project":     map[string]string{"key": j.conf.ProjectKey},
+		"issuetype":   map[string]string{"name": j.conf.IssueType},
+		"summary":     issue.Title,
+		"description": fmt.Sprintf("%s\n\nReported by %s (created by %s)", issue.Description, issue.Reporter, BotIdentity),
+	}
+	if issue.Assignee != "" {
+		fields["assignee"] = map[string]string{"accountId": issue.Assignee}
+	}
+
+	res := struct {
+		Key string `json:"key"`
+	}{}
+	if err := doJSONRequest(ctx, http.MethodPost, strings.TrimSuffix(j.conf.Url, "/")+"/rest/api/2/issue",
+		map[string]interface{}{"fields": fields}, &res, j.setAuth); err != nil {
+		return nil, err
+	}
+
+	return &TicketRef{
+		Id:  res.Key,
+		Url: fmt.Sprintf("%s/browse/%s", strings.TrimSuffix(j.conf.Url, "/"), res.Key),
+	}, nil
+}
+
+type githubConnector struct {
+	conf config.GitHubConfig
+}
+
+func (g *githubConnector) setAuth(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+g.conf.Token)
+	req.Header.Set("Accept", "application/vnd.github+json")
+}
+
+func (g *githubConnector) CreateIssue(ctx context.Context, issue *Issue) (*TicketRef, error) {
+	apiUrl := "https://api.github.com"
+	if g.conf.ApiUrl != "" {
+		apiUrl = strings.TrimSuffix(g.conf.ApiUrl, "/")
+	}
+
+	body := map[string]interface{}{
+		"title": issue.Title,
+		"body":  fmt.Sprintf("%s\n\nReported by %s (created by %s)", issue.Description, issue.Reporter, BotIdentity),
+	}
+	if issue.Assignee != "" {
+		body["assignees"] = []string{issue.Assignee}
+	}
+	if len(g.conf.Labels) > 0 {
+		body["labels"] = g.conf.Labels
+	}
+
+	res := struct {
+		Number  int64  `json:"number"`
+		HtmlUrl string `json:"html_url"`
+	}{}
+	u := fmt.Sprintf("%s/repos/%s/%s/issues", apiUrl, g.conf.Owner, g.conf.Repo)
+	if err := doJSONRequest(ctx, http.MethodPost, u, body, &res, g.setAuth); err != nil {
+		return nil, err
+	}
+
+	return &TicketRef{
+		Id:  fmt.Sprintf("#%d", res.Number),
+		Url: res.HtmlUrl,
+	}, nil
+}
+
+type issueProposal struct {
+	id        int
+	issue     Issue
+	expiresAt time.Time
+}
+
+// Proposals waiting for a confirmation
+type issueProposals struct {
+	lock    sync.Mutex
+	lastId  int
+	pending []*issueProposal
+}
+
+func (ip *issueProposals) add(issue Issue, timeout time.Duration) *issueProposal {
+	ip.lock.Lock()
+	defer ip.lock.Unlock()
+
+	ip.lastId++
+	proposal := &issueProposal{
+		id:        ip.lastId,
+		issue:     issue,
+		expiresAt: time.Now().Add(timeout),
+	}
+	ip.pending = append(ip.pending, proposal)
+	return proposal
+}
+
+// Remove the proposal, nil when it doesn't exist or expired
+func (ip *issueProposals) take(id int) *issueProposal {
+	ip.lock.Lock()
+	defer ip.lock.Unlock()
+
+	now := time.Now()
+	var taken *issueProposal
+	pending := ip.pending[:0]
+	for _, proposal := range ip.pending {
+		if proposal.id == id && now.Before(proposal.expiresAt) {
+			taken = proposal
+		} else if now.Before(proposal.expiresAt) {
+			pending = append(pending, proposal)
+		}
+	}
+	ip.pending = pending
+	return taken
+}
+
+// Guess the assignee from the name said in the meeting: the participants of the room are matched
+// by identity or name, then mapped to their account with the assignees of the config
+func (p *GPTParticipant) guessAssignee(name string, assignees map[string]string) (account, participant string) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", ""
+	}
+	if account, ok := assignees[name]; ok {
+		return account, name
+	}
+
+	for _, rp := range p.room.GetParticipants() {
+		matched := strings.EqualFold(rp.Identity(), name) || strings.EqualFold(rp.Name(), name)
+		if fields := strings.Fields(rp.Name()); !matched && len(fields) > 0 {
+			matched = strings.EqualFold(fields[0], name) // First name only
+		}
+		if !matched {
+			continue
+		}
+		participant = rp.Name()
+		if participant == "" {
+			participant = rp.Identity()
+		}
+		return assignees[rp.Identity()], participant
+	}
+	return "", name
+}
+
+type proposeIssueTool struct {
+	conf config.IssuesConfig
+}
+
+func (t *proposeIssueTool) Definition() *openai.FunctionDefinition {
+	return &openai.FunctionDefinition{
+		Name: "propose_issue",
+		Description: "Prepare an issue for an action item of the meeting, when a participant asks you to track it. " +
+			"The issue is only created once the participants confirmed it, see confirm_issue.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"title": map[string]interface{}{
+					"type":        "string",
+					"description": "Short summary of the action item",
+				},
+				"description": map[string]interface{}{
+					"type":        "string",
+					"description": "Context of the action item from the discussion",
+				},
+				"assignee": map[string]interface{}{
+					"type":        "string",
+					"description": "Name of the participant responsible for the action item, if known",
+				},
+			},
+			"required": []string{"title"},
+		},
+	}
+}
+
+func (t *proposeIssueTool) Call(ctx context.Context, tc *ToolContext, arguments string) (string, error) {
+	args := struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+		Assignee    string `json:"assignee"`
+	}{}
+	if err := parseToolArguments(arguments, &args); err != nil {
+		return "", err
+	}
+
+	title := strings.TrimSpace(args.Title)
+	if title == "" {
+		return "", errors.New("title is required")
+	}
+
+	p := tc.Participant
+	account, assigneeName := p.guessAssignee(args.Assignee, t.conf.Assignees)
+	proposal := p.issues.add(Issue{
+		Title:       title,
+		Description: strings.TrimSpace(args.Description),
+		Assignee:    account,
+		Reporter:    tc.Speaker.Identity(),
+	}, t.conf.ConfirmTimeout)
+
+	assignment := "unassigned"
+	if account != "" {
+		assignment = "assigned to " + assigneeName
+	} else if assigneeName != "" {
+		assignment = fmt.Sprintf("unassigned, %s has no account in the issue tracker", assigneeName)
+	}
+	return fmt.Sprintf("Proposal %d: \"%s\", %s. Read it back and end your answer by asking the participants to confirm it. "+
+		"Then call confirm_issue with their answer, don't create it without an explicit yes.", proposal.id, title, assignment), nil
+}
+
+type confirmIssueTool struct {
+	tracker IssueTracker
+}
+
+func (t *confirmIssueTool) Definition() *openai.FunctionDefinition {
+	return &openai.FunctionDefinition{
+		Name:        "confirm_issue",
+		Description: "Create or drop a proposed issue, once the participants answered your confirmation question.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"proposal": map[string]interface{}{
+					"type":        "integer",
+					"description": "Number of the proposal returned by propose_issue",
+				},
+				"confirmed": map[string]interface{}{
+					"type":        "boolean",
+					"description": "True if the participants confirmed the issue, false if they declined it",
+				},
+			},
+			"required": []string{"proposal", "confirmed"},
+		},
+	}
+}
+
+func (t *confirmIssueTool) Call(ctx context.Context, tc *ToolContext, arguments string) (string, error) {
+	args := struct {
+		Proposal  int  `json:"proposal"`
+		Confirmed bool `json:"confirmed"`
+	}{}
+	if err := parseToolArguments(arguments, &args); err != nil {
+		return "", err
+	}
+
+	proposal := tc.Participant.issues.take(args.Proposal)
+	if proposal == nil {
+		return fmt.Sprintf("Proposal %d doesn't exist or expired, propose the issue again.", args.Proposal), nil
+	}
+	if !args.Confirmed {
+		return fmt.Sprintf("Proposal %d dropped.", proposal.id), nil
+	}
+
+	ref, err := t.tracker.CreateIssue(ctx, &proposal.issue)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Issue %s created (%s)", ref.Id, ref.Url), nil
+}
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisJobsPending = "kitt:jobs:pending" // List of the job ids ready to run
+	redisJobsDelayed = "kitt:jobs:delayed" // Sorted set of the job ids, scored by RunAt
+
+	redisDequeueTimeout = time.Second
+)
+
+// Queue shared by the instances, the jobs survive the restarts
+type redisJobQueue struct {
+	rc        redis.UniversalClient
+	retention time.Duration
+}
+
+func redisJobKey(id string) string {
+	return "kitt:jobs:" + id
+}
+
+func redisRoomJobsKey(room string) string {
+	return "kitt:jobs:room:" + room
+}
+
+func (q *redisJobQueue) Enqueue(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	pipe := q.rc.TxPipeline()
+	pipe.Set(ctx, redisJobKey(job.ID), data, 0)
+	pipe.SAdd(ctx, redisRoomJobsKey(job.Room), job.ID)
+	pipe.Expire(ctx, redisRoomJobsKey(job.Room), q.retention)
+	if time.Until(job.RunAt) > 0 {
+		pipe.ZAdd(ctx, redisJobsDelayed, redis.Z{Score: float64(job.RunAt.UnixMilli()), Member: job.ID})
+	} else {
+		pipe.LPush(ctx, redisJobsPending, job.ID)
+	}
+	_, err = pipe.Exec(ctx)
+	return err
+}
+
+func (q *redisJobQueue) Dequeue(ctx context.Context) (*Job, error) {
+	for {
+		if err := q.promoteDelayed(ctx); err != nil {
+			return nil, err
+		}
+
+		res, err := q.rc.BRPop(ctx, redisDequeueTimeout, redisJobsPending).Result()
+		if err != nil {
+			if errors.Is(err, redis.Nil) {
+				continue // Timeout, check the delayed jobs again
+			}
+			return nil, err
+		}
+
+		job, err := q.Get(ctx, res[1])
+		if err != nil {
+			if errors.Is(err, ErrJobNotFound) {
+				continue // Expired
+			}
+			return nil, err
+		}
+		return job, nil
+	}
+}
+
+// Move the delayed jobs that are due to the pending list.
+// ZRem succeeds on a single instance, so a job is only moved once
+func (q *redisJobQueue) promoteDelayed(ctx context.Context) error {
+	ids, err := q.rc.ZRangeByScore(ctx, redisJobsDelayed, &redis.ZRangeBy{
+		Min: "-inf",
+		Max: strconv.FormatInt(time.Now().UnixMilli(), 10),
+	}).Result()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		removed, err := q.rc.ZRem(ctx, redisJobsDelayed, id).Result()
+		if err != nil {
+			return err
+		}
+		if removed == 0 {
+			continue
+		}
+
+		if err := q.rc.LPush(ctx, redisJobsPending, id).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (q *redisJobQueue) Update(ctx context.Context, job *Job) error {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+
+	var expiration time.Duration
+	if job.Status == JobStatus_Done || job.Status == JobStatus_Failed {
+		expiration = q.retention
+	}
+	return q.rc.Set(ctx, redisJobKey(job.ID), data, expiration).Err()
+}
+
+func (q *redisJobQueue) Get(ctx context.Context, id string) (*Job, error) {
+	data, err := q.rc.Get(ctx, redisJobKey(id)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return nil, ErrJobNotFound
+		}
+		return nil, err
+	}
+
+	job := &Job{}
+	if err := json.Unmarshal(data, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func (q *redisJobQueue) ListRoom(ctx context.Context, room string) ([]*Job, error) {
+	ids, err := q.rc.SMembers(ctx, redisRoomJobsKey(room)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*Job
+	for _, id := range ids {
+		job, err := q.Get(ctx, id)
+		if err != nil {
+			if errors.Is(err, ErrJobNotFound) {
+				q.rc.SRem(ctx, redisRoomJobsKey(room), id)
+				continue
+			}
+			return nil, err
+		}
+		res = append(res, job)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+	return res, nil
+}
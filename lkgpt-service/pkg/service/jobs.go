@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/utils"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+const (
+	JobsBackend_Memory = "memory"
+	JobsBackend_Redis  = "redis"
+
+	JobStatus_Pending = "pending" // Waiting for a worker (or for its next attempt)
+	JobStatus_Running = "running"
+	JobStatus_Done    = "done"
+	JobStatus_Failed  = "failed" // Every attempt failed
+
+	jobTimeout = 5 * time.Minute
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+type Job struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Room      string          `json:"room"`
+	Payload   json.RawMessage `json:"payload"`
+	Status    string          `json:"status"`
+	Attempts  int             `json:"attempts"`
+	Error     string          `json:"error,omitempty"` // Error of the last attempt
+	RunAt     time.Time       `json:"runAt"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+type JobHandler func(ctx context.Context, job *Job) error
+
+type JobQueue interface {
+	// Add or replace the job, it is dequeued once RunAt is reached
+	Enqueue(ctx context.Context, job *Job) error
+	// Block until a job is due or ctx is done
+	Dequeue(ctx context.Context) (*Job, error)
+	// Persist the status of a job that has been dequeued
+	Update(ctx context.Context, job *Job) error
+	Get(ctx context.Context, id string) (*Job, error)
+	ListRoom(ctx context.Context, room string) ([]*Job, error)
+}
+
+// rc is required by the redis backend
+func NewJobQueue(conf config.JobsConfig, rc redis.UniversalClient) (JobQueue, error) {
+	switch conf.Backend {
+	case JobsBackend_Memory:
+		return newMemoryJobQueue(conf.Retention), nil
+	case JobsBackend_Redis:
+		if rc == nil {
+			return nil, errors.New("the redis backend requires redis.address")
+		}
+		return &redisJobQueue{rc: rc, retention: conf.Retention}, nil
+	default:
+		return nil, fmt.Errorf("unknown jobs backend: %s", conf.Backend)
+	}
+}
+
+// JobRunner executes the jobs of the queue with a pool of workers, the failed jobs are retried with a backoff
+type JobRunner struct {
+	conf  config.JobsConfig
+	queue JobQueue
+
+	lock     sync.Mutex
+	handlers map[string]JobHandler
+}
+
+func NewJobRunner(conf config.JobsConfig, queue JobQueue) *JobRunner {
+	return &JobRunner{
+		conf:     conf,
+		queue:    queue,
+		handlers: make(map[string]JobHandler),
+	}
+}
+
+func (r *JobRunner) Handle(jobType string, handler JobHandler) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.handlers[jobType] = handler
+}
+
+// Queue a new job, payload is encoded in JSON
+func (r *JobRunner) Enqueue(jobType, room string, payload interface{}) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	job := &Job{
+		ID:        utils.NewGuid("JB_"),
+		Type:      jobType,
+		Room:      room,
+		Payload:   data,
+		Status:    JobStatus_Pending,
+		RunAt:     now,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+	if err := r.queue.Enqueue(ctx, job); err != nil {
+		return nil, err
+	}
+
+	logger.Debugw("job queued", "job", job.ID, "type", jobType, "room", room)
+	return job, nil
+}
+
+// Run the workers until ctx is done
+func (r *JobRunner) Start(ctx context.Context) {
+	for i := 0; i < r.conf.Workers; i++ {
+		go r.work(ctx)
+	}
+}
+
+func (r *JobRunner) work(ctx context.Context) {
+	for {
+		job, err := r.queue.Dequeue(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+
+			logger.Errorw("failed to dequeue a job", err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(time.Second):
+			}
+			continue
+		}
+
+		r.run(ctx, job)
+	}
+}
+
+func (r *JobRunner) run(ctx context.Context, job *Job) {
+	r.lock.Lock()
+	handler, ok := r.handlers[job.Type]
+	r.lock.Unlock()
+
+	job.Attempts++
+	job.Status = JobStatus_Running
+	job.UpdatedAt = time.Now()
+	r.update(job)
+
+	var err error
+	if !ok {
+		err = fmt.Errorf("no handler for the job type %s", job.Type)
+		job.Attempts = r.conf.MaxAttempts // Not worth retrying
+	} else {
+		jobCtx, cancel := context.WithTimeout(ctx, jobTimeout)
+		err = handler(jobCtx, job)
+		cancel()
+	}
+
+	job.UpdatedAt = time.Now()
+	if err == nil {
+		job.Status = JobStatus_Done
+		job.Error = ""
+		r.update(job)
+		return
+	}
+
+	job.Error = err.Error()
+	if job.Attempts >= r.conf.MaxAttempts {
+		logger.Errorw("job failed", err, "job", job.ID, "type", job.Type, "attempts", job.Attempts)
+		job.Status = JobStatus_Failed
+		r.update(job)
+		return
+	}
+
+	logger.Warnw("job attempt failed, retrying", err, "job", job.ID, "type", job.Type, "attempts", job.Attempts)
+	job.Status = JobStatus_Pending
+	job.RunAt = time.Now().Add(r.conf.RetryBackoff * time.Duration(1<<(job.Attempts-1)))
+
+	enqueueCtx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+	if err := r.queue.Enqueue(enqueueCtx, job); err != nil {
+		logger.Errorw("failed to requeue the job", err, "job", job.ID)
+	}
+}
+
+func (r *JobRunner) update(job *Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	if err := r.queue.Update(ctx, job); err != nil {
+		logger.Errorw("failed to update the job", err, "job", job.ID)
+	}
+}
+
+// In-process queue, the jobs are lost when the server restarts
+type memoryJobQueue struct {
+	retention time.Duration
+
+	lock  sync.Mutex
+	jobs  map[string]*Job
+	ready chan *Job
+}
+
+func newMemoryJobQueue(retention time.Duration) *memoryJobQueue {
+	return &memoryJobQueue{
+		retention: retention,
+		jobs:      make(map[string]*Job),
+		ready:     make(chan *Job, 1024),
+	}
+}
+
+func (q *memoryJobQueue) Enqueue(ctx context.Context, job *Job) error {
+	// The map and the workers get their own copy
+	stored, queued := *job, *job
+	q.lock.Lock()
+	q.jobs[job.ID] = &stored
+	q.expire()
+	q.lock.Unlock()
+
+	push := func() {
+		select {
+		case q.ready <- &queued:
+		default:
+			logger.Errorw("job queue full, dropping job", nil, "job", job.ID)
+		}
+	}
+
+	if delay := time.Until(job.RunAt); delay > 0 {
+		time.AfterFunc(delay, push)
+	} else {
+		push()
+	}
+	return nil
+}
+
+func (q *memoryJobQueue) Dequeue(ctx context.Context) (*Job, error) {
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case job := <-q.ready:
+		return job, nil
+	}
+}
+
+func (q *memoryJobQueue) Update(ctx context.Context, job *Job) error {
+	stored := *job
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.jobs[job.ID] = &stored
+	return nil
+}
+
+func (q *memoryJobQueue) Get(ctx context.Context, id string) (*Job, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	job, ok := q.jobs[id]
+	if !ok {
+		return nil, ErrJobNotFound
+	}
+	res := *job
+	return &res, nil
+}
+
+func (q *memoryJobQueue) ListRoom(ctx context.Context, room string) ([]*Job, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var res []*Job
+	for _, job := range q.jobs {
+		if job.Room == room {
+			c := *job
+			res = append(res, &c)
+		}
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+	return res, nil
+}
+
+// Forget the finished jobs older than the retention (requires lock)
+func (q *memoryJobQueue) expire() {
+	for id, job := range q.jobs {
+		finished := job.Status == JobStatus_Done || job.Status == JobStatus_Failed
+		if finished && time.Since(job.UpdatedAt) > q.retention {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+// GET /jobs?room={room} and /jobs/{id}, requires a token with the roomAdmin grant for the room of the jobs
+func (s *LiveGPT) jobsHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	var res interface{}
+	id := strings.Trim(strings.TrimPrefix(req.URL.Path, "/jobs"), "/")
+	if id != "" {
+		job, err := s.jobs.queue.Get(req.Context(), id)
+		if err != nil {
+			if errors.Is(err, ErrJobNotFound) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			logger.Errorw("failed to get the job", err, "job", id)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if err := s.authenticateRoomAdmin(req, job.Room); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+		res = job
+	} else {
+		room := req.URL.Query().Get("room")
+		if err := s.authenticateRoomAdmin(req, room); err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		jobs, err := s.jobs.queue.ListRoom(req.Context(), room)
+		if err != nil {
+			logger.Errorw("failed to list the jobs", err, "room", room)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if jobs == nil {
+			jobs = []*Job{}
+		}
+		res = jobs
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"bytes"
+	"sync"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+)
+
+const (
+	JoinBehavior_Silent  = "silent"  // Stay silent until spoken to
+	JoinBehavior_Greet   = "greet"   // Introduce itself when joining
+	JoinBehavior_Command = "command" // Ignore the room until a "start" command is received, then greet
+
+	greetingDelay = 1 * time.Second // Give time to the participants to subscribe to the GPTTrack
+)
+
+// Cold-open state machine
+//
+//	Standby --(start command)--> Greeting --(greeting played)--> Listening
+//
+// KITT only answers in the Listening state, transcripts are still published in the other states.
+type joinState int32
+
+const (
+	joinState_Standby   joinState = 0
+	joinState_Greeting  joinState = 1
+	joinState_Listening joinState = 2
+)
+
+func (s joinState) String() string {
+	switch s {
+	case joinState_Standby:
+		return "standby"
+	case joinState_Greeting:
+		return "greeting"
+	case joinState_Listening:
+		return "listening"
+	default:
+		return "unknown"
+	}
+}
+
+// Called once connected to the room
+func (p *GPTParticipant) startJoinBehavior() {
+	switch p.conf.Join.Behavior {
+	case JoinBehavior_Greet:
+		p.transition(joinState_Greeting)
+	case JoinBehavior_Command:
+		p.transition(joinState_Standby)
+	default:
+		if p.conf.Join.Behavior != JoinBehavior_Silent && p.conf.Join.Behavior != "" {
+			logger.Warnw("unknown join behavior, defaulting to silent", nil, "behavior", p.conf.Join.Behavior)
+		}
+		p.transition(joinState_Listening)
+	}
+}
+
+func (p *GPTParticipant) currentJoinState() joinState {
+	return joinState(p.joinState.Load())
+}
+
+func (p *GPTParticipant) transition(to joinState) {
+	from := joinState(p.joinState.Swap(int32(to)))
+	logger.Debugw("join state changed", "room", p.room.Name(), "from", from.String(), "to", to.String())
+
+	if to == joinState_Greeting {
+		go p.greet()
+	}
+}
+
+// Handle the "start" command, ignored when KITT is already started
+func (p *GPTParticipant) start() {
+	if p.joinState.CompareAndSwap(int32(joinState_Standby), int32(joinState_Greeting)) {
+		logger.Debugw("join state changed", "room", p.room.Name(), "from", joinState_Standby.String(), "to", joinState_Greeting.String())
+		go p.greet()
+	}
+}
+
+func (p *GPTParticipant) greet() {
+	defer p.transition(joinState_Listening)
+
+	greeting := p.conf.Join.Greeting
+	if greeting == "" || p.isNoteTaker() {
+		return
+	}
+
+	select {
+	case <-time.After(greetingDelay):
+	case <-p.ctx.Done():
+		return
+	}
+	p.waitRoomLanguage(p.conf.Transcription.LanguageDetection.GreetingWait)
+
+	if !p.isBusy.CompareAndSwap(false, true) {
+		return
+	}
+	defer p.isBusy.Store(false)
+
+	if err := p.say(greeting, p.replyLanguage(p.defaultLanguage())); err != nil {
+		logger.Errorw("failed to greet", err, "room", p.room.Name())
+		return
+	}
+
+	p.history.Append(&MeetingEvent{
+		Speech: &SpeechEvent{
+			ParticipantName: BotIdentity,
+			IsBot:           true,
+			Text:            greeting,
+		},
+	})
+}
+
+// Synthesize text and wait until it has been played
+// The caller must hold isBusy
+func (p *GPTParticipant) say(text string, language *Language) error {
+	audioContent, err := p.synthesizer.Synthesize(p.ctx, text, language)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	var once sync.Once
+	p.gptTrack.OnComplete(func(err error) {
+		once.Do(func() { close(done) })
+	})
+
+	if err := p.gptTrack.QueueReader(bytes.NewReader(audioContent)); err != nil {
+		return err
+	}
+
+	p.setState(state_Speaking)
+	select {
+	case <-done:
+	case <-p.ctx.Done():
+	}
+	p.setState(state_Idle)
+	return nil
+}
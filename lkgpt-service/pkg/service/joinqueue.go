@@ -0,0 +1,135 @@
+package service
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+var errJoinQueueFull = errors.New("too many rooms waiting to be joined")
+
+var (
+	joinQueuedDesc = prometheus.NewDesc("kitt_join_queued",
+		"Number of rooms waiting to be joined", nil, nil)
+	joinConnectingDesc = prometheus.NewDesc("kitt_join_connecting",
+		"Number of connections to rooms being established", nil, nil)
+
+	joinFailedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kitt_join_failed_total",
+		Help: "Number of rooms that couldn't be joined after every attempt",
+	})
+)
+
+type joinRequest struct {
+	room    *livekit.Room
+	attempt int // Starts at 1
+}
+
+// joinQueue paces the connections to the rooms: each connection opens a signal WebSocket and
+// negotiates a PeerConnection, hundreds of them at once overload the LiveKit server
+type joinQueue struct {
+	conf    config.JoinQueueConfig
+	done    <-chan struct{}
+	connect func(room *livekit.Room, attempt int)
+
+	queue      chan *joinRequest
+	slots      chan struct{} // nil when the concurrent connections aren't limited
+	connecting atomic.Int32
+}
+
+func newJoinQueue(conf config.JoinQueueConfig, done <-chan struct{}, connect func(room *livekit.Room, attempt int)) *joinQueue {
+	q := &joinQueue{
+		conf:    conf,
+		done:    done,
+		connect: connect,
+		queue:   make(chan *joinRequest, conf.MaxQueued),
+	}
+	if conf.MaxConcurrent > 0 {
+		q.slots = make(chan struct{}, conf.MaxConcurrent)
+	}
+	return q
+}
+
+// Returns false when the queue is full
+func (q *joinQueue) Enqueue(room *livekit.Room) bool {
+	select {
+	case q.queue <- &joinRequest{room: room, attempt: 1}:
+		return true
+	default:
+		return false
+	}
+}
+
+// Queue the room again after the delay, the retries are never refused
+func (q *joinQueue) Retry(room *livekit.Room, attempt int, delay time.Duration) {
+	time.AfterFunc(delay, func() {
+		select {
+		case q.queue <- &joinRequest{room: room, attempt: attempt}:
+		case <-q.done:
+		}
+	})
+}
+
+func (q *joinQueue) Run() {
+	var pace <-chan time.Time
+	if q.conf.ConnectsPerSecond > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / q.conf.ConnectsPerSecond))
+		defer ticker.Stop()
+		pace = ticker.C
+	}
+
+	for {
+		var req *joinRequest
+		select {
+		case req = <-q.queue:
+		case <-q.done:
+			return
+		}
+
+		if pace != nil {
+			select {
+			case <-pace:
+			case <-q.done:
+				return
+			}
+		}
+
+		if q.slots != nil {
+			select {
+			case q.slots <- struct{}{}:
+			case <-q.done:
+				return
+			}
+		}
+
+		q.connecting.Add(1)
+		go func() {
+			defer func() {
+				q.connecting.Add(-1)
+				if q.slots != nil {
+					<-q.slots
+				}
+			}()
+			q.connect(req.room, req.attempt)
+		}()
+	}
+}
+
+type joinQueueCollector struct {
+	q *joinQueue
+}
+
+func (c *joinQueueCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- joinQueuedDesc
+	ch <- joinConnectingDesc
+}
+
+func (c *joinQueueCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(joinQueuedDesc, prometheus.GaugeValue, float64(len(c.q.queue)))
+	ch <- prometheus.MustNewConstMetric(joinConnectingDesc, prometheus.GaugeValue, float64(c.q.connecting.Load()))
+}
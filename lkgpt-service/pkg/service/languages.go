@@ -0,0 +1,85 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// Languages of the config, set by SetLanguages when the server starts
+var (
+	Languages       = map[string]*Language{}
+	DefaultLanguage *Language // The first language of the config
+
+	languageList []*Language // In the order of the config
+)
+
+type Language struct {
+	Code             string `json:"code"`
+	Label            string `json:"label"`
+	TranscriberCode  string `json:"-"`
+	SynthesizerModel string `json:"-"`
+	SynthesizerCode  string `json:"-"`
+}
+
+// Replace the languages with the ones of the config, not safe to call once the participants are connected
+func SetLanguages(confs []config.LanguageConfig) error {
+	if len(confs) == 0 {
+		return errors.New("at least one language is required")
+	}
+
+	languages := make(map[string]*Language, len(confs))
+	list := make([]*Language, 0, len(confs))
+	for _, conf := range confs {
+		if conf.Code == "" || conf.Label == "" {
+			return errors.New("the code and the label of the languages are required")
+		}
+		if _, ok := languages[conf.Code]; ok {
+			return fmt.Errorf("duplicated language: %s", conf.Code)
+		}
+
+		language := &Language{
+			Code:             conf.Code,
+			Label:            conf.Label,
+			TranscriberCode:  conf.TranscriberCode,
+			SynthesizerModel: conf.Voice,
+			SynthesizerCode:  conf.SynthesizerCode,
+		}
+		if language.SynthesizerCode == "" {
+			language.SynthesizerCode = language.Code
+		}
+		languages[language.Code] = language
+		list = append(list, language)
+	}
+
+	Languages = languages
+	languageList = list
+	DefaultLanguage = list[0]
+	return nil
+}
+
+// Case-insensitive lookup of a code or a transcriber code, nil when the language isn't supported
+func findLanguage(code string) *Language {
+	for c, lang := range Languages {
+		if strings.EqualFold(c, code) || strings.EqualFold(lang.TranscriberCode, code) {
+			return lang
+		}
+	}
+	return nil
+}
+
+// GET /languages, public: used by the language picker of the frontend before joining
+func (s *LiveGPT) languagesHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(languageList)
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+const (
+	LLMProvider_OpenAI      = "openai"
+	LLMProvider_AzureOpenAI = "azure_openai"
+	LLMProvider_Anthropic   = "anthropic"
+	LLMProvider_Ollama      = "ollama" // OpenAI compatible API of Ollama
+)
+
+// Tasks of the completions, each one can use its own model (see LLMConfig.Tasks)
+const (
+	LLMTask_Answers        = "answers"
+	LLMTask_Summaries      = "summaries"
+	LLMTask_Classification = "classification"
+)
+
+// Chat completion API of a LLM provider, used by ChatCompletion.
+// The requests and the responses are the OpenAI ones, the other providers translate them
+type LLMClient interface {
+	CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+	CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (LLMStream, error)
+}
+
+// Returns io.EOF once the completion is complete
+type LLMStream interface {
+	Recv() (openai.ChatCompletionStreamResponse, error)
+	Close() error
+}
+
+// openaiKey is used when the config has no API key
+func NewLLMClient(conf config.LLMConfig, openaiConf config.OpenAIConfig, openaiKey string) (LLMClient, error) {
+	apiKey := conf.ApiKey
+	switch conf.Provider {
+	case LLMProvider_OpenAI:
+		if apiKey == "" {
+			apiKey = openaiKey
+		}
+		if apiKey == "" {
+			return nil, errors.New("OpenAI API key not found. Please set OPENAI_API_KEY environment variable or set it in config.yaml")
+		}
+		clientConf := newOpenAIClientConfig(apiKey, openaiConf)
+		if conf.BaseUrl != "" {
+			clientConf.BaseURL = conf.BaseUrl
+		}
+		return &openaiLLM{client: openai.NewClientWithConfig(clientConf)}, nil
+	case LLMProvider_AzureOpenAI:
+		if conf.BaseUrl == "" || apiKey == "" {
+			return nil, errors.New("the base url and the API key of the Azure OpenAI resource are required")
+		}
+		clientConf := openai.DefaultAzureConfig(apiKey, conf.BaseUrl)
+		clientConf.APIVersion = conf.ApiVersion
+		clientConf.AzureModelMapperFunc = func(model string) string {
+			return model // The models are the deployment names
+		}
+		clientConf.HTTPClient = openaiHTTPClient(openaiConf.Headers)
+		return &openaiLLM{client: openai.NewClientWithConfig(clientConf)}, nil
+	case LLMProvider_Ollama:
+		baseUrl := conf.BaseUrl
+		if baseUrl == "" {
+			baseUrl = "http://localhost:11434"
+		}
+		clientConf := openai.DefaultConfig(apiKey) // Ignored by Ollama
+		clientConf.BaseURL = strings.TrimSuffix(baseUrl, "/") + "/v1"
+		clientConf.HTTPClient = openaiHTTPClient(openaiConf.Headers)
+		return &openaiLLM{client: openai.NewClientWithConfig(clientConf)}, nil
+	case LLMProvider_Anthropic:
+		if apiKey == "" {
+			return nil, errors.New("the Anthropic API key is required")
+		}
+		return newAnthropicLLM(conf), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider: %s", conf.Provider)
+	}
+}
+
+// OpenAI, Azure OpenAI and Ollama
+type openaiLLM struct {
+	client *openai.Client
+}
+
+func (l *openaiLLM) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	return l.client.CreateChatCompletion(ctx, req)
+}
+
+func (l *openaiLLM) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (LLMStream, error) {
+	stream, err := l.client.CreateChatCompletionStream(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Client config of the OpenAI API with the organization, the project and the extra headers of conf
+func newOpenAIClientConfig(apiKey string, conf config.OpenAIConfig) openai.ClientConfig {
+	clientConf := openai.DefaultConfig(apiKey)
+	clientConf.OrgID = conf.Organization
+
+	headers := make(map[string]string, len(conf.Headers)+1)
+	if conf.Project != "" {
+		headers["OpenAI-Project"] = conf.Project
+	}
+	for k, v := range conf.Headers {
+		headers[k] = v
+	}
+	clientConf.HTTPClient = openaiHTTPClient(headers)
+	return clientConf
+}
+
+// Returns http.DefaultClient when there's no header to add
+func openaiHTTPClient(headers map[string]string) *http.Client {
+	if len(headers) == 0 {
+		return http.DefaultClient
+	}
+	return &http.Client{
+		Transport: &headerTransport{headers: headers, next: http.DefaultTransport},
+	}
+}
+
+// Sets the headers of every request
+type headerTransport struct {
+	headers map[string]string
+	next    http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context()) // A RoundTripper must not modify the request
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/utils"
+	lksdk "github.com/livekit/server-sdk-go"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+type LoadLevel int32
+
+const (
+	LoadLevel_Normal   LoadLevel = 0
+	LoadLevel_Reduced  LoadLevel = 1 // No interim results, cheaper models
+	LoadLevel_Critical LoadLevel = 2 // Fewer tracks transcribed per room
+
+	loadCheckInterval = 5 * time.Second
+	loadHysteresis    = 0.1 // The level only decreases once the CPU usage is this much below the threshold
+)
+
+func (l LoadLevel) String() string {
+	switch l {
+	case LoadLevel_Normal:
+		return "normal"
+	case LoadLevel_Reduced:
+		return "reduced"
+	case LoadLevel_Critical:
+		return "critical"
+	default:
+		return "unknown"
+	}
+}
+
+var (
+	loadCPUDesc = prometheus.NewDesc("kitt_load_cpu",
+		"CPU usage of the instance (0.0 - 1.0)", nil, nil)
+	loadLevelDesc = prometheus.NewDesc("kitt_load_level",
+		"Degradation level of the rooms (0 = normal, 1 = reduced, 2 = critical)", nil, nil)
+	loadTranscribersDesc = prometheus.NewDesc("kitt_load_transcribers",
+		"Number of open speech streams", nil, nil)
+	loadRoomsDesc = prometheus.NewDesc("kitt_load_rooms",
+		"Number of rooms joined by the instance", nil, nil)
+)
+
+// loadMonitor computes the degradation level of the instance from its CPU usage and its number of speech streams
+type loadMonitor struct {
+	conf config.LoadConfig
+	s    *LiveGPT
+	cpu  *utils.CPUStats
+
+	lock         sync.Mutex
+	level        LoadLevel
+	usage        float64
+	transcribers int
+}
+
+func newLoadMonitor(conf config.LoadConfig, s *LiveGPT) (*loadMonitor, error) {
+	cpu, err := utils.NewCPUStats(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &loadMonitor{
+		conf: conf,
+		s:    s,
+		cpu:  cpu,
+	}, nil
+}
+
+func (m *loadMonitor) Level() LoadLevel {
+	if m == nil {
+		return LoadLevel_Normal
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.level
+}
+
+func (m *loadMonitor) Run(done <-chan struct{}) {
+	defer m.cpu.Stop()
+
+	ticker := time.NewTicker(loadCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			m.check()
+		}
+	}
+}
+
+func (m *loadMonitor) check() {
+	participants := m.s.connectedParticipants()
+	transcribers := 0
+	for _, p := range participants {
+		transcribers += p.transcriberCount()
+	}
+
+	usage := 1 - m.cpu.GetCPUIdle()/float64(m.cpu.NumCPU())
+
+	m.lock.Lock()
+	previous := m.level
+	m.usage = usage
+	m.transcribers = transcribers
+	m.level = m.nextLevel(previous, usage, transcribers)
+	level := m.level
+	m.lock.Unlock()
+
+	if level == previous {
+		return
+	}
+
+	logger.Infow("load level changed", "level", level, "previous", previous, "cpu", usage, "transcribers", transcribers)
+	for _, p := range participants {
+		p.setLoadLevel(level)
+	}
+}
+
+func (m *loadMonitor) nextLevel(current LoadLevel, usage float64, transcribers int) LoadLevel {
+	exceeds := func(threshold float64, level LoadLevel) bool {
+		if current >= level {
+			threshold -= loadHysteresis
+		}
+		return usage >= threshold
+	}
+
+	level := LoadLevel_Normal
+	if exceeds(m.conf.ReducedCPU, LoadLevel_Reduced) {
+		level = LoadLevel_Reduced
+	}
+	if m.conf.MaxTranscribers > 0 && transcribers > m.conf.MaxTranscribers {
+		level = LoadLevel_Reduced
+	}
+	if exceeds(m.conf.CriticalCPU, LoadLevel_Critical) {
+		level = LoadLevel_Critical
+	}
+	return level
+}
+
+// Reports the load signals when scraped
+type loadCollector struct {
+	m *loadMonitor
+}
+
+func (c *loadCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- loadCPUDesc
+	ch <- loadLevelDesc
+	ch <- loadTranscribersDesc
+	ch <- loadRoomsDesc
+}
+
+func (c *loadCollector) Collect(ch chan<- prometheus.Metric) {
+	rooms := len(c.m.s.connectedParticipants())
+
+	c.m.lock.Lock()
+	defer c.m.lock.Unlock()
+	ch <- prometheus.MustNewConstMetric(loadCPUDesc, prometheus.GaugeValue, c.m.usage)
+	ch <- prometheus.MustNewConstMetric(loadLevelDesc, prometheus.GaugeValue, float64(c.m.level))
+	ch <- prometheus.MustNewConstMetric(loadTranscribersDesc, prometheus.GaugeValue, float64(c.m.transcribers))
+	ch <- prometheus.MustNewConstMetric(loadRoomsDesc, prometheus.GaugeValue, float64(rooms))
+}
+
+func (p *GPTParticipant) transcriberCount() int {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return len(p.transcribers)
+}
+
+// Applied to the next speech streams and completions, the subscriptions are updated right away
+func (p *GPTParticipant) setLoadLevel(level LoadLevel) {
+	p.lock.Lock()
+	if p.loadLevel == level {
+		p.lock.Unlock()
+		return
+	}
+	p.loadLevel = level
+	transcribers := make([]*Transcriber, 0, len(p.transcribers))
+	for _, t := range p.transcribers {
+		transcribers = append(transcribers, t)
+	}
+	p.lock.Unlock()
+
+	degraded := level >= LoadLevel_Reduced
+	for _, t := range transcribers {
+		t.SetDegraded(degraded)
+	}
+
+	if degraded {
+		p.completion.SetModel(p.conf.Load.ReducedModel)
+	} else {
+		p.completion.SetModel("")
+	}
+
+	p.updateSubscriptions()
+}
+
+func (p *GPTParticipant) currentLoadLevel() LoadLevel {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.loadLevel
+}
+
+// Subscribe to every microphone, or only to the ones of the last speakers when the load is critical
+func (p *GPTParticipant) updateSubscriptions() {
+	p.lock.Lock()
+	limit := -1
+	if p.loadLevel == LoadLevel_Critical {
+		limit = p.conf.Load.CriticalTracks
+	}
+	lastSpoke := make(map[string]time.Time, len(p.lastSpoke))
+	for sid, t := range p.lastSpoke {
+		lastSpoke[sid] = t
+	}
+	if p.activeParticipant != nil {
+		lastSpoke[p.activeParticipant.SID()] = time.Now() // Never stop listening to the participant KITT is talking to
+	}
+	p.lock.Unlock()
+
+	participants := p.room.GetParticipants()
+	sort.SliceStable(participants, func(i, j int) bool {
+		return lastSpoke[participants[i].SID()].After(lastSpoke[participants[j].SID()])
+	})
+
+	microphones := 0
+	for _, rp := range participants {
+		publication, ok := rp.GetTrack(livekit.TrackSource_MICROPHONE).(*lksdk.RemoteTrackPublication)
+		if !ok || publication == nil {
+			continue
+		}
+
+		subscribe := limit < 0 || microphones < limit
+		microphones++
+		if publication.IsSubscribed() == subscribe {
+			continue
+		}
+
+		if !subscribe {
+			logger.Infow("instance overloaded, unsubscribing", "participant", rp.Identity(), "room", p.room.Name())
+		}
+		if err := publication.SetSubscribed(subscribe); err != nil {
+			logger.Errorw("failed to update the subscription", err, "track", publication.SID(), "participant", rp.SID())
+		}
+	}
+}
+
+func (s *LiveGPT) connectedParticipants() []*GPTParticipant {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	participants := make([]*GPTParticipant, 0, len(s.participants))
+	for _, ap := range s.participants {
+		if ap.Participant != nil {
+			participants = append(participants, ap.Participant)
+		}
+	}
+	return participants
+}
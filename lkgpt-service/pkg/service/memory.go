@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/livekit/protocol/logger"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Long-term memory of a participant (e.g "Prefers metric units"), kept across meetings
+// Only participants who opted in (ParticipantMetadata.Memory) are remembered
+type MemoryStore interface {
+	Get(identity string) ([]string, error)
+	Set(identity string, facts []string) error
+	Erase(identity string) error
+}
+
+// One JSON file per identity
+type fileMemoryStore struct {
+	lock sync.Mutex
+	dir  string
+}
+
+func NewFileMemoryStore(dir string) (MemoryStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &fileMemoryStore{dir: dir}, nil
+}
+
+func (s *fileMemoryStore) path(identity string) string {
+	return filepath.Join(s.dir, sanitizeFilename(identity)+".json")
+}
+
+func (s *fileMemoryStore) Get(identity string) ([]string, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	data, err := os.ReadFile(s.path(identity))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var facts []string
+	if err := json.Unmarshal(data, &facts); err != nil {
+		return nil, err
+	}
+	return facts, nil
+}
+
+func (s *fileMemoryStore) Set(identity string, facts []string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	data, err := json.Marshal(facts)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path(identity), data, 0600)
+}
+
+func (s *fileMemoryStore) Erase(identity string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err := os.Remove(s.path(identity))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Update the memory of a participant with what has been learned during the meeting
+func (c *ChatCompletion) Memorize(ctx context.Context, events []*MeetingEvent, name string, facts []string, maxFacts int) ([]string, error) {
+	existing, err := json.Marshal(facts)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: c.taskModel(LLMTask_Summaries),
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role: openai.ChatMessageRoleSystem,
+				Content: fmt.Sprintf("You maintain the long-term memory of a voice assistant about %s. ", name) +
+					"From the meeting transcript, keep the facts that stay useful in future meetings " +
+					"(preferences, role, ongoing projects) and drop the ones that are outdated. " +
+					fmt.Sprintf("Answer with a JSON object containing \"facts\", an array of at most %d short sentences. ", maxFacts) +
+					fmt.Sprintf("Facts already known: %s", existing),
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: formatTranscript(events),
+			},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.countUsage(resp.Usage)
+
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("no memory returned")
+	}
+
+	res := struct {
+		Facts []string `json:"facts"`
+	}{}
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &res); err != nil {
+		return nil, fmt.Errorf("invalid memory: %w", err)
+	}
+
+	if len(res.Facts) > maxFacts {
+		res.Facts = res.Facts[:maxFacts]
+	}
+	return res.Facts, nil
+}
+
+// Retrieve the memory of a participant who opted in, so it can be used in the next answers
+func (p *GPTParticipant) loadMemory(identity string) {
+	if p.memory == nil {
+		return
+	}
+
+	facts, err := p.memory.Get(identity)
+	if err != nil {
+		logger.Errorw("failed to load the memory", err, "participant", identity)
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.memories[identity] = facts
+}
+
+func (p *GPTParticipant) forgetMemory(identity string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	delete(p.memories, identity)
+	if a, ok := p.attendees[identity]; ok {
+		a.Metadata.Memory = false // Don't remember this meeting either
+	}
+}
+
+// JobType_Memory: update the memory of the attendees who opted in with what has been learned during the meeting
+func (s *LiveGPT) memoryJob(ctx context.Context, job *Job) error {
+	if s.memory == nil {
+		return nil
+	}
+
+	record := &MeetingRecord{}
+	if err := json.Unmarshal(job.Payload, record); err != nil {
+		return err
+	}
+
+	completion := NewChatCompletion(s.llm, s.config.LLM)
+	completion.SetUsageMeter(s.usage)
+	var failed int
+	for _, a := range record.Attendees {
+		if !a.Metadata.Memory || !spokeDuringMeeting(record.Events, a.Name) {
+			continue
+		}
+
+		facts, err := completion.Memorize(ctx, record.Events, a.Name, record.Memories[a.Identity], s.config.Memory.MaxFacts)
+		if err != nil {
+			logger.Errorw("failed to update the memory", err, "participant", a.Identity)
+			failed++
+			continue
+		}
+
+		if err := s.memory.Set(a.Identity, facts); err != nil {
+			logger.Errorw("failed to save the memory", err, "participant", a.Identity)
+			failed++
+		}
+	}
+
+	// Retrying is safe, the memory is rebuilt from the same facts
+	if failed > 0 {
+		return fmt.Errorf("failed to update %d memories", failed)
+	}
+	return nil
+}
+
+func spokeDuringMeeting(events []*MeetingEvent, name string) bool {
+	for _, e := range events {
+		if e.Speech != nil && !e.Speech.IsBot && e.Speech.ParticipantName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// GET/DELETE /memory/{identity}
+// View or erase one's memory, requires a LiveKit access token issued for this identity
+func (s *LiveGPT) memoryHandler(w http.ResponseWriter, req *http.Request) {
+	identity := strings.Trim(strings.TrimPrefix(req.URL.Path, "/memory/"), "/")
+	if identity == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if s.memory == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("the memory is disabled"))
+		return
+	}
+
+	if err := s.authenticateIdentity(req, identity); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		facts, err := s.memory.Get(identity)
+		if err != nil {
+			logger.Errorw("failed to load the memory", err, "participant", identity)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		if facts == nil {
+			facts = []string{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(facts)
+	case http.MethodDelete:
+		if err := s.memory.Erase(identity); err != nil {
+			logger.Errorw("failed to erase the memory", err, "participant", identity)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		s.audit(req, "memory_erased", "", identity)
+
+		s.lock.Lock()
+		for _, ap := range s.participants {
+			if ap.Participant != nil {
+				ap.Participant.forgetMemory(identity)
+			}
+		}
+		s.lock.Unlock()
+
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,223 @@
+package service
+
+import (
+	"context"
+	"io"
+	"time"
+	"unicode/utf8"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/sashabaranov/go-openai"
+)
+
+var (
+	trackQueuedSecondsDesc = prometheus.NewDesc("kitt_track_queued_seconds",
+		"Duration of the audio waiting to be played by KITT", []string{"room"}, nil)
+	trackQueuedReadersDesc = prometheus.NewDesc("kitt_track_queued_readers",
+		"Number of synthesized sentences waiting to be played by KITT", []string{"room"}, nil)
+	trackPendingSeqsDesc = prometheus.NewDesc("kitt_track_pending_sentences",
+		"Number of sentences being synthesized", []string{"room"}, nil)
+
+	trackRefusedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kitt_track_refused_total",
+		Help: "Number of sentences refused because the backlog was full",
+	})
+
+	intentTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kitt_intents_total",
+		Help: "Number of spoken prompts per classified intent",
+	}, []string{"intent"})
+
+	roomsDesc = prometheus.NewDesc("kitt_rooms",
+		"Number of rooms KITT is connected to", nil, nil)
+	transcribersDesc = prometheus.NewDesc("kitt_transcribers",
+		"Number of transcribed tracks", nil, nil)
+
+	speechStreamsGauge = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kitt_stt_streams",
+		Help: "Number of open speech streams",
+	})
+
+	llmRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kitt_llm_requests_total",
+		Help: "Number of LLM requests per model and result (ok or error)",
+	}, []string{"model", "result"})
+	llmRequestSeconds = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kitt_llm_request_seconds",
+		Help:    "Latency of the LLM requests until the response, or the start of the stream",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 10),
+	}, []string{"model"})
+
+	ttsRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kitt_tts_requests_total",
+		Help: "Number of speech synthesis requests per result (ok or error)",
+	}, []string{"result"})
+	ttsCharactersTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "kitt_tts_characters_total",
+		Help: "Number of characters synthesized",
+	})
+
+	packetErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kitt_packet_errors_total",
+		Help: "Number of data packets that couldn't be sent, or received malformed",
+	}, []string{"direction"})
+)
+
+const (
+	metricResult_OK    = "ok"
+	metricResult_Error = "error"
+
+	packetDirection_Send    = "send"
+	packetDirection_Receive = "receive"
+)
+
+func metricResult(err error) string {
+	if err != nil {
+		return metricResult_Error
+	}
+	return metricResult_OK
+}
+
+// Reports the GPTTrack stats of every connected room when scraped
+type trackCollector struct {
+	s *LiveGPT
+}
+
+func (c *trackCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- trackQueuedSecondsDesc
+	ch <- trackQueuedReadersDesc
+	ch <- trackPendingSeqsDesc
+}
+
+func (c *trackCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, p := range c.s.connectedParticipants() {
+		stats := p.gptTrack.Stats()
+		room := p.room.Name()
+		ch <- prometheus.MustNewConstMetric(trackQueuedSecondsDesc, prometheus.GaugeValue, stats.QueuedDuration.Seconds(), room)
+		ch <- prometheus.MustNewConstMetric(trackQueuedReadersDesc, prometheus.GaugeValue, float64(stats.QueuedReaders), room)
+		ch <- prometheus.MustNewConstMetric(trackPendingSeqsDesc, prometheus.GaugeValue, float64(stats.PendingSeqs), room)
+	}
+}
+
+// Reports the rooms and the transcribers when scraped, also exported by the load monitor when enabled
+type roomsCollector struct {
+	s *LiveGPT
+}
+
+func (c *roomsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- roomsDesc
+	ch <- transcribersDesc
+}
+
+func (c *roomsCollector) Collect(ch chan<- prometheus.Metric) {
+	participants := c.s.connectedParticipants()
+	transcribers := 0
+	for _, p := range participants {
+		transcribers += p.transcriberCount()
+	}
+	ch <- prometheus.MustNewConstMetric(roomsDesc, prometheus.GaugeValue, float64(len(participants)))
+	ch <- prometheus.MustNewConstMetric(transcribersDesc, prometheus.GaugeValue, float64(transcribers))
+}
+
+func instrumentLLM(llm LLMClient) LLMClient {
+	return &instrumentedLLM{LLMClient: llm}
+}
+
+type instrumentedLLM struct {
+	LLMClient
+}
+
+func (l *instrumentedLLM) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	start := time.Now()
+	resp, err := l.LLMClient.CreateChatCompletion(ctx, req)
+	l.observe(req.Model, start, err)
+	return resp, err
+}
+
+func (l *instrumentedLLM) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (LLMStream, error) {
+	start := time.Now()
+	stream, err := l.LLMClient.CreateChatCompletionStream(ctx, req)
+	l.observe(req.Model, start, err)
+	return stream, err
+}
+
+func (l *instrumentedLLM) observe(model string, start time.Time, err error) {
+	llmRequestsTotal.WithLabelValues(model, metricResult(err)).Inc()
+	if err == nil {
+		llmRequestSeconds.WithLabelValues(model).Observe(time.Since(start).Seconds())
+	}
+}
+
+func instrumentSynthesizer(synthesizer SpeechSynthesizer) SpeechSynthesizer {
+	return &instrumentedSynthesizer{SpeechSynthesizer: synthesizer}
+}
+
+type instrumentedSynthesizer struct {
+	SpeechSynthesizer
+}
+
+func (s *instrumentedSynthesizer) Synthesize(ctx context.Context, text string, language *Language) ([]byte, error) {
+	audio, err := s.SpeechSynthesizer.Synthesize(ctx, text, language)
+	s.observe(text, err)
+	return audio, err
+}
+
+func (s *instrumentedSynthesizer) SynthesizeStream(ctx context.Context, text string, language *Language) (io.ReadCloser, error) {
+	stream, err := s.SpeechSynthesizer.SynthesizeStream(ctx, text, language)
+	s.observe(text, err)
+	return stream, err
+}
+
+func (s *instrumentedSynthesizer) observe(text string, err error) {
+	ttsRequestsTotal.WithLabelValues(metricResult(err)).Inc()
+	if err == nil {
+		ttsCharactersTotal.Add(float64(utf8.RuneCountInString(text)))
+	}
+}
+
+func (s *LiveGPT) registerMetrics() error {
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(&trackCollector{s: s}); err != nil {
+		return err
+	}
+	if err := registry.Register(&roomsCollector{s: s}); err != nil {
+		return err
+	}
+	for _, collector := range []prometheus.Collector{
+		collectors.NewGoCollector(), // Goroutines, memory and GC
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		speechStreamsGauge,
+		llmRequestsTotal,
+		llmRequestSeconds,
+		ttsRequestsTotal,
+		ttsCharactersTotal,
+		packetErrorsTotal,
+	} {
+		if err := registry.Register(collector); err != nil {
+			return err
+		}
+	}
+	if err := registry.Register(trackRefusedTotal); err != nil {
+		return err
+	}
+	if err := registry.Register(intentTotal); err != nil {
+		return err
+	}
+	if err := registry.Register(&joinQueueCollector{q: s.joins}); err != nil {
+		return err
+	}
+	if err := registry.Register(joinFailedTotal); err != nil {
+		return err
+	}
+	if err := registry.Register(&usageCollector{m: s.usage}); err != nil {
+		return err
+	}
+	if s.load != nil {
+		if err := registry.Register(&loadCollector{m: s.load}); err != nil {
+			return err
+		}
+	}
+	s.metrics = registry
+	return nil
+}
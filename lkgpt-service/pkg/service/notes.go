@@ -0,0 +1,241 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+const (
+	EmailProvider_SMTP     = "smtp"
+	EmailProvider_SendGrid = "sendgrid"
+)
+
+type EmailMessage struct {
+	From    string
+	To      []string
+	Subject string
+	Body    string // text/plain
+}
+
+type Mailer interface {
+	Send(ctx context.Context, msg *EmailMessage) error
+}
+
+func NewMailer(conf config.EmailConfig) (Mailer, error) {
+	switch conf.Provider {
+	case EmailProvider_SMTP:
+		return &smtpMailer{conf: conf.SMTP}, nil
+	case EmailProvider_SendGrid:
+		return &sendgridMailer{conf: conf.SendGrid}, nil
+	default:
+		return nil, fmt.Errorf("unknown email provider: %s", conf.Provider)
+	}
+}
+
+type smtpMailer struct {
+	conf config.SMTPConfig
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg *EmailMessage) error {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("From: %s\r\n", msg.From))
+	sb.WriteString(fmt.Sprintf("To: %s\r\n", strings.Join(msg.To, ", ")))
+	sb.WriteString(fmt.Sprintf("Subject: %s\r\n", msg.Subject))
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n\r\n")
+	sb.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if m.conf.Username != "" {
+		auth = smtp.PlainAuth("", m.conf.Username, m.conf.Password, m.conf.Host)
+	}
+
+	addr := fmt.Sprintf("%s:%d", m.conf.Host, m.conf.Port)
+	return smtp.SendMail(addr, auth, msg.From, msg.To, []byte(sb.String()))
+}
+
+type sendgridMailer struct {
+	conf config.SendGridConfig
+}
+
+func (m *sendgridMailer) Send(ctx context.Context, msg *EmailMessage) error {
+	to := make([]map[string]string, 0, len(msg.To))
+	for _, addr := range msg.To {
+		to = append(to, map[string]string{"email": addr})
+	}
+
+	body := map[string]interface{}{
+		"personalizations": []map[string]interface{}{
+			{"to": to},
+		},
+		"from":    map[string]string{"email": msg.From},
+		"subject": msg.Subject,
+		"content": []map[string]string{
+			{"type": "text/plain", "value": msg.Body},
+		},
+	}
+
+	return doJSONRequest(ctx, http.MethodPost, "https://api.sendgrid.com/v3/mail/send", body, nil, func(req *http.Request) {
+		req.Header.Set("Authorization", "Bearer "+m.conf.ApiKey)
+	})
+}
+
+// JobType_Summary: summarize the meeting, then store the summary, email it and call the meeting webhook
+func (s *LiveGPT) summaryJob(ctx context.Context, job *Job) error {
+	record := &MeetingRecord{}
+	if err := json.Unmarshal(job.Payload, record); err != nil {
+		return err
+	}
+
+	completion := NewChatCompletion(s.llm, s.config.LLM)
+	completion.SetUsageMeter(s.usage)
+	summary, err := completion.Summarize(ctx, record.Events, record.Scratchpad)
+	if err != nil {
+		return fmt.Errorf("failed to summarize the meeting: %w", err)
+	}
+
+	if s.store != nil && s.config.Storage.Summaries {
+		data, err := json.Marshal(summary)
+		if err != nil {
+			return err
+		}
+
+		key := fmt.Sprintf("summaries/%s_%s.json", sanitizeFilename(record.RoomName), record.RoomSid)
+		if err := s.store.Put(ctx, key, data, "application/json"); err != nil {
+			return fmt.Errorf("failed to store the summary: %w", err)
+		}
+	}
+
+	// Queued separately so they are retried independently
+	if recipients := s.notesRecipients(record); len(recipients) > 0 {
+		if _, err := s.jobs.Enqueue(JobType_Email, record.RoomName, s.meetingNotesEmail(record, summary, recipients)); err != nil {
+			return err
+		}
+	}
+
+	if s.config.MeetingWebhook.Url != "" {
+		payload := &MeetingWebhookPayload{
+			Room:       record.RoomName,
+			RoomSid:    record.RoomSid,
+			Summary:    summary,
+			Transcript: formatTranscript(record.Events),
+			Analytics:  record.Stats,
+		}
+		if _, err := s.jobs.Enqueue(JobType_Webhook, record.RoomName, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The attendees and the configured recipients, empty when the emails are disabled
+func (s *LiveGPT) notesRecipients(record *MeetingRecord) []string {
+	if s.config.Email.Provider == "" {
+		return nil
+	}
+
+	recipients := append([]string{}, s.config.Email.Recipients...)
+	for _, a := range record.Attendees {
+		recipients = append(recipients, a.Metadata.Email)
+	}
+	return dedupe(recipients)
+}
+
+// Notes of the meeting sent to the participants and the configured recipients
+func (s *LiveGPT) meetingNotesEmail(record *MeetingRecord, summary *MeetingSummary, recipients []string) *EmailMessage {
+	conf := s.config.Email
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Summary\n\n%s\n", summary.Summary))
+	if len(summary.ActionItems) > 0 {
+		sb.WriteString("\nAction items\n\n")
+		for _, item := range summary.ActionItems {
+			sb.WriteString(fmt.Sprintf("- %s\n", item))
+		}
+	}
+	if conf.TranscriptUrl != "" {
+		sb.WriteString(fmt.Sprintf("\nTranscript: %s\n", strings.ReplaceAll(conf.TranscriptUrl, "{room}", record.RoomName)))
+	}
+
+	return &EmailMessage{
+		From:    conf.From,
+		To:      recipients,
+		Subject: fmt.Sprintf("Meeting notes: %s", record.RoomName),
+		Body:    sb.String(),
+	}
+}
+
+// JobType_Email
+func (s *LiveGPT) emailJob(ctx context.Context, job *Job) error {
+	msg := &EmailMessage{}
+	if err := json.Unmarshal(job.Payload, msg); err != nil {
+		return err
+	}
+
+	mailer, err := NewMailer(s.config.Email)
+	if err != nil {
+		return err
+	}
+
+	if err := mailer.Send(ctx, msg); err != nil {
+		return err
+	}
+
+	logger.Infow("email sent", "room", job.Room, "subject", msg.Subject, "recipients", len(msg.To))
+	return nil
+}
+
+// Synthesized sentences, to debug the audio pipeline
+func (p *GPTParticipant) storeDebugAudio(seq uint64, audio []byte) {
+	if p.store == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	key := fmt.Sprintf("debug/%s_%s/%d-%d.ogg", sanitizeFilename(p.room.Name()), p.room.SID(), time.Now().UnixMilli(), seq)
+	if err := p.store.Put(ctx, key, audio, "audio/ogg"); err != nil {
+		logger.Errorw("failed to store the debug audio", err, "room", p.room.Name())
+	}
+}
+
+// Played sentences of an answer, each one is a complete ogg stream: the file is a chained ogg.
+// Returns the key right away, the upload runs in the background
+func (p *GPTParticipant) storeAnswerAudio(chunks [][]byte) string {
+	key := fmt.Sprintf("answers/%s_%s/%d.ogg", sanitizeFilename(p.room.Name()), p.room.SID(), time.Now().UnixMilli())
+	audio := bytes.Join(chunks, nil)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+		defer cancel()
+
+		if err := p.store.Put(ctx, key, audio, "audio/ogg"); err != nil {
+			logger.Errorw("failed to store the answer audio", err, "room", p.room.Name(), "key", key)
+		}
+	}()
+	return key
+}
+
+func dedupe(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	res := make([]string, 0, len(values))
+	for _, v := range values {
+		if _, ok := seen[v]; ok || v == "" {
+			continue
+		}
+		seen[v] = struct{}{}
+		res = append(res, v)
+	}
+	return res
+}
@@ -0,0 +1,433 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/utils"
+	lksdk "github.com/livekit/server-sdk-go"
+	docs "google.golang.org/api/docs/v1"
+	drive "google.golang.org/api/drive/v3"
+	"google.golang.org/api/option"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// In the notes mode, the running notes are also written to a shared document created when KITT joins,
+// its link is posted in the chat. KITT only rewrites its own section of the document: the participants
+// can write below it (Google Docs) or outside of it (Notion) during the meeting
+
+const (
+	NotesDocProvider_Notion     = "notion"
+	NotesDocProvider_GoogleDocs = "google_docs"
+
+	notesDocTimeout  = 15 * time.Second
+	notesDocMarker   = "End of KITT's notes, edit below this line"
+	notionApiUrl     = "https://api.notion.com/v1"
+	notionApiVersion = "2022-06-28"
+	notionMaxBlocks  = 100 // Blocks appended per request
+)
+
+type NotesDocument struct {
+	Id      string
+	Url     string
+	section string // Block containing the notes (Notion)
+}
+
+type NotesDocumentProvider interface {
+	Create(ctx context.Context, title string) (*NotesDocument, error)
+	Update(ctx context.Context, doc *NotesDocument, notes *MeetingNotes) error
+}
+
+func NewNotesDocumentProvider(ctx context.Context, conf config.NotesDocumentConfig, gcpCred option.ClientOption) (NotesDocumentProvider, error) {
+	switch conf.Provider {
+	case NotesDocProvider_Notion:
+		return &notionNotes{conf: conf.Notion}, nil
+	case NotesDocProvider_GoogleDocs:
+		scopes := option.WithScopes(drive.DriveFileScope, docs.DocumentsScope)
+		driveSvc, err := drive.NewService(ctx, gcpCred, scopes)
+		if err != nil {
+			return nil, err
+		}
+		docsSvc, err := docs.NewService(ctx, gcpCred, scopes)
+		if err != nil {
+			return nil, err
+		}
+		return &googleDocsNotes{conf: conf.GoogleDocs, drive: driveSvc, docs: docsSvc}, nil
+	default:
+		return nil, fmt.Errorf("unknown notes document provider: %s", conf.Provider)
+	}
+}
+
+// A line of the notes, the headings are styled by the providers
+type notesLine struct {
+	text    string
+	heading bool
+}
+
+func notesLines(notes *MeetingNotes) []notesLine {
+	var lines []notesLine
+	list := func(heading string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		lines = append(lines, notesLine{text: heading, heading: true})
+		for _, item := range items {
+			lines = append(lines, notesLine{text: item})
+		}
+	}
+
+	for _, topic := range notes.Topics {
+		list(topic.Title, topic.Points)
+	}
+	list("Decisions", notes.Decisions)
+	list("Action items", notes.ActionItems)
+	return lines
+}
+
+type googleDocsNotes struct {
+	conf  config.GoogleDocsConfig
+	drive *drive.Service
+	docs  *docs.Service
+}
+
+func (g *googleDocsNotes) Create(ctx context.Context, title string) (*NotesDocument, error) {
+	file := &drive.File{
+		Name:     title,
+		MimeType: "application/vnd.google-apps.document",
+	}
+	if g.conf.FolderId != "" {
+		file.Parents = []string{g.conf.FolderId}
+	}
+
+	file, err := g.drive.Files.Create(file).SupportsAllDrives(true).Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	permission := &drive.Permission{
+		Type: "anyone",
+		Role: g.conf.ShareRole,
+	}
+	if g.conf.ShareDomain != "" {
+		permission.Type = "domain"
+		permission.Domain = g.conf.ShareDomain
+	}
+	if _, err := g.drive.Permissions.Create(file.Id, permission).SupportsAllDrives(true).Context(ctx).Do(); err != nil {
+		return nil, fmt.Errorf("failed to share the document: %w", err)
+	}
+
+	return &NotesDocument{
+		Id:  file.Id,
+		Url: fmt.Sprintf("https://docs.google.com/document/d/%s/edit", file.Id),
+	}, nil
+}
+
+// Replace the text above the marker, the marker is written again when it was removed
+func (g *googleDocsNotes) Update(ctx context.Context, doc *NotesDocument, notes *MeetingNotes) error {
+	current, err := g.docs.Documents.Get(doc.Id).Context(ctx).Do()
+	if err != nil {
+		return err
+	}
+
+	var sectionEnd int64 // Start of the marker paragraph
+	for _, element := range current.Body.Content {
+		if element.Paragraph == nil {
+			continue
+		}
+		for _, e := range element.Paragraph.Elements {
+			if e.TextRun != nil && strings.Contains(e.TextRun.Content, notesDocMarker) {
+				sectionEnd = element.StartIndex
+				break
+			}
+		}
+		if sectionEnd > 0 {
+			break
+		}
+	}
+
+	var requests []*docs.Request
+	if sectionEnd > 1 {
+		requests = append(requests, &docs.Request{
+			DeleteContentRange: &docs.DeleteContentRangeRequest{
+				Range: &docs.Range{StartIndex: 1, EndIndex: sectionEnd},
+			},
+		})
+	}
+
+	// Indexes are in UTF-16 code units, from 1 (start of the body)
+	var sb strings.Builder
+	var styles []*docs.Request
+	index := int64(1)
+	write := func(text, style string) {
+		text += "\n"
+		length := int64(len(utf16.Encode([]rune(text))))
+		sb.WriteString(text)
+		styles = append(styles, &docs.Request{
+			UpdateParagraphStyle: &docs.UpdateParagraphStyleRequest{
+				Range:          &docs.Range{StartIndex: index, EndIndex: index + length},
+				ParagraphStyle: &docs.ParagraphStyle{NamedStyleType: style},
+				Fields:         "namedStyleType",
+			},
+		})
+		index += length
+	}
+	for _, line := range notesLines(notes) {
+		if line.heading {
+			write(line.text, "HEADING_2")
+		} else {
+			write("• "+line.text, "NORMAL_TEXT")
+		}
+	}
+	if sectionEnd == 0 {
+		write(notesDocMarker, "NORMAL_TEXT")
+	}
+	if sb.Len() > 0 {
+		requests = append(requests, &docs.Request{
+			InsertText: &docs.InsertTextRequest{
+				Location: &docs.Location{Index: 1},
+				Text:     sb.String(),
+			},
+		})
+		requests = append(requests, styles...)
+	}
+	if len(requests) == 0 {
+		return nil
+	}
+
+	_, err = g.docs.Documents.BatchUpdate(doc.Id, &docs.BatchUpdateDocumentRequest{Requests: requests}).Context(ctx).Do()
+	return err
+}
+
+type notionNotes struct {
+	conf config.NotionConfig
+}
+
+func (n *notionNotes) setAuth(req *http.Request) {
+	req.Header.Set("Authorization", "Bearer "+n.conf.Token)
+	req.Header.Set("Notion-Version", notionApiVersion)
+}
+
+func notionText(text string) []map[string]interface{} {
+	return []map[string]interface{}{
+		{"type": "text", "text": map[string]string{"content": text}},
+	}
+}
+
+// The notes are the children of a callout block, created with the page
+func (n *notionNotes) Create(ctx context.Context, title string) (*NotesDocument, error) {
+	body := map[string]interface{}{
+		"parent": map[string]string{"page_id": n.conf.ParentPageId},
+		"properties": map[string]interface{}{
+			"title": map[string]interface{}{"title": notionText(title)},
+		},
+		"children": []map[string]interface{}{
+			{
+				"object": "block",
+				"type":   "callout",
+				"callout": map[string]interface{}{
+					"rich_text": notionText(fmt.Sprintf("Notes taken by %s during the meeting", BotIdentity)),
+					"icon":      map[string]string{"emoji": "📝"},
+				},
+			},
+		},
+	}
+
+	page := struct {
+		Id  string `json:"id"`
+		Url string `json:"url"`
+	}{}
+	if err := doJSONRequest(ctx, http.MethodPost, notionApiUrl+"/pages", body, &page, n.setAuth); err != nil {
+		return nil, err
+	}
+
+	children, err := n.children(ctx, page.Id)
+	if err != nil {
+		return nil, err
+	}
+	if len(children) == 0 {
+		return nil, fmt.Errorf("notes block of page %s not found", page.Id)
+	}
+
+	return &NotesDocument{
+		Id:      page.Id,
+		Url:     page.Url,
+		section: children[0],
+	}, nil
+}
+
+func (n *notionNotes) Update(ctx context.Context, doc *NotesDocument, notes *MeetingNotes) error {
+	children, err := n.children(ctx, doc.section)
+	if err != nil {
+		return err
+	}
+	for _, id := range children {
+		if err := doJSONRequest(ctx, http.MethodDelete, notionApiUrl+"/blocks/"+id, nil, nil, n.setAuth); err != nil {
+			return err
+		}
+	}
+
+	var blocks []map[string]interface{}
+	for _, line := range notesLines(notes) {
+		blockType := "bulleted_list_item"
+		if line.heading {
+			blockType = "heading_3"
+		}
+		blocks = append(blocks, map[string]interface{}{
+			"object":  "block",
+			"type":    blockType,
+			blockType: map[string]interface{}{"rich_text": notionText(line.text)},
+		})
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+	if len(blocks) > notionMaxBlocks {
+		blocks = blocks[:notionMaxBlocks]
+	}
+
+	return doJSONRequest(ctx, http.MethodPatch, notionApiUrl+"/blocks/"+doc.section+"/children",
+		map[string]interface{}{"children": blocks}, nil, n.setAuth)
+}
+
+// Ids of the children of the block
+func (n *notionNotes) children(ctx context.Context, blockId string) ([]string, error) {
+	res := struct {
+		Results []struct {
+			Id string `json:"id"`
+		} `json:"results"`
+	}{}
+	u := fmt.Sprintf("%s/blocks/%s/children?page_size=%d", notionApiUrl, blockId, notionMaxBlocks)
+	if err := doJSONRequest(ctx, http.MethodGet, u, nil, &res, n.setAuth); err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(res.Results))
+	for _, r := range res.Results {
+		ids = append(ids, r.Id)
+	}
+	return ids, nil
+}
+
+// notesDocumentSink creates the document of a room and writes the last notes to it. The notes are
+// written by a single goroutine, only the last version is written when the updates pile up
+type notesDocumentSink struct {
+	provider    NotesDocumentProvider
+	conf        *config.Config
+	roomService *lksdk.RoomServiceClient
+	roomName    string
+
+	lock    sync.Mutex
+	notes   *MeetingNotes // Not written yet
+	closed  bool
+	updates chan struct{}
+	done    chan struct{}
+}
+
+func newNotesDocumentSink(provider NotesDocumentProvider, conf *config.Config, roomService *lksdk.RoomServiceClient, roomName string) *notesDocumentSink {
+	s := &notesDocumentSink{
+		provider:    provider,
+		conf:        conf,
+		roomService: roomService,
+		roomName:    roomName,
+		updates:     make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *notesDocumentSink) HandleEvent(event *RoomEvent) {
+	data, ok := event.Data.(*NotesEvent)
+	if !ok {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.closed {
+		return
+	}
+	s.notes = data.Notes
+	select {
+	case s.updates <- struct{}{}:
+	default: // Already pending
+	}
+}
+
+func (s *notesDocumentSink) run() {
+	defer close(s.done)
+
+	title := strings.NewReplacer("{room}", s.roomName, "{date}", time.Now().Format("2006-01-02")).Replace(s.conf.Notes.Document.Title)
+	ctx, cancel := context.WithTimeout(context.Background(), notesDocTimeout)
+	doc, err := s.provider.Create(ctx, title)
+	cancel()
+	if err != nil {
+		logger.Errorw("failed to create the notes document", err, "room", s.roomName)
+		for range s.updates {
+		}
+		return
+	}
+
+	logger.Infow("notes document created", "room", s.roomName, "url", doc.Url)
+	s.postLink(doc)
+
+	for range s.updates {
+		s.lock.Lock()
+		notes := s.notes
+		s.notes = nil
+		s.lock.Unlock()
+		if notes == nil {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), notesDocTimeout)
+		if err := s.provider.Update(ctx, doc, notes); err != nil {
+			logger.Errorw("failed to update the notes document", err, "room", s.roomName)
+		}
+		cancel()
+	}
+}
+
+// Sent in the LiveKit chat, like the messages of the chatSink
+func (s *notesDocumentSink) postLink(doc *NotesDocument) {
+	data, err := json.Marshal(&chatMessage{
+		ID:        utils.NewGuid("CM_"),
+		Timestamp: time.Now().UnixMilli(),
+		Message:   fmt.Sprintf("%s: I'm taking the notes of the meeting in %s", BotIdentity, doc.Url),
+	})
+	if err != nil {
+		return
+	}
+
+	topic := s.conf.Chat.Topic
+	ctx, cancel := context.WithTimeout(context.Background(), chatSendTimeout)
+	defer cancel()
+	if _, err := s.roomService.SendData(ctx, &livekit.SendDataRequest{
+		Room:  s.roomName,
+		Data:  data,
+		Kind:  livekit.DataPacket_RELIABLE,
+		Topic: &topic,
+	}); err != nil {
+		logger.Errorw("failed to post the notes document link", err, "room", s.roomName)
+	}
+}
+
+// Writes the last notes before returning
+func (s *notesDocumentSink) Close() {
+	s.lock.Lock()
+	s.closed = true
+	close(s.updates)
+	s.lock.Unlock()
+
+	<-s.done
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+const (
+	Mode_Assistant = "assistant" // Answer the participants
+	Mode_Notes     = "notes"     // Never speak, only take the notes of the meeting
+)
+
+type NotesTopic struct {
+	Title  string   `json:"title"`
+	Points []string `json:"points"`
+}
+
+// Structured notes, updated continuously in the notes mode
+type MeetingNotes struct {
+	Topics      []NotesTopic `json:"topics"`
+	Decisions   []string     `json:"decisions"`
+	ActionItems []string     `json:"actionItems"`
+}
+
+// Update the notes with the new events of the meeting
+func (c *ChatCompletion) TakeNotes(ctx context.Context, events []*MeetingEvent, notes *MeetingNotes) (*MeetingNotes, error) {
+	current, err := json.Marshal(notes)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: c.taskModel(LLMTask_Summaries),
+		Messages: []openai.ChatCompletionMessage{
+			{
+				Role: openai.ChatMessageRoleSystem,
+				Content: "You take the notes of an ongoing meeting. Update the current notes with the new part of the transcript. " +
+					"Answer with a JSON object containing \"topics\" (an array of objects with a \"title\" and \"points\", an array of strings), " +
+					"\"decisions\" and \"actionItems\" (arrays of strings). " +
+					fmt.Sprintf("Current notes: %s", current),
+			},
+			{
+				Role:    openai.ChatMessageRoleUser,
+				Content: formatTranscript(events),
+			},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	c.countUsage(resp.Usage)
+
+	if len(resp.Choices) == 0 {
+		return nil, errors.New("no notes returned")
+	}
+
+	updated := &MeetingNotes{}
+	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), updated); err != nil {
+		return nil, fmt.Errorf("invalid notes: %w", err)
+	}
+	return updated, nil
+}
+
+func (p *GPTParticipant) isNoteTaker() bool {
+	return p.conf.Mode == Mode_Notes
+}
+
+func (p *GPTParticipant) Notes() *MeetingNotes {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.notes
+}
+
+// Periodically update the notes with the transcripts received since the last update
+func (p *GPTParticipant) takeNotes() {
+	ticker := time.NewTicker(p.conf.Notes.UpdateInterval)
+	defer ticker.Stop()
+
+	notes := &MeetingNotes{}
+	processed := 0
+	for {
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if p.currentJoinState() != joinState_Listening {
+			continue
+		}
+
+		events, next := p.transcript.Since(processed)
+		if len(events) == 0 {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(p.ctx, p.conf.Notes.UpdateInterval)
+		updated, err := p.completion.TakeNotes(ctx, events, notes)
+		cancel()
+		if err != nil {
+			logger.Errorw("failed to update the notes", err, "room", p.room.Name())
+			continue
+		}
+
+		notes = updated
+		processed = next
+
+		p.lock.Lock()
+		p.notes = notes
+		p.lock.Unlock()
+
+		p.bus.Publish(&RoomEvent{
+			Type: RoomEvent_Notes,
+			Room: p.room.Name(),
+			Data: &NotesEvent{
+				Notes: notes,
+			},
+		})
+	}
+}
+
+// GET /rooms/{room}/notes
+func (s *LiveGPT) roomNotesHandler(w http.ResponseWriter, req *http.Request, p *GPTParticipant) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	notes := p.Notes()
+	if notes == nil {
+		notes = &MeetingNotes{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(notes)
+}
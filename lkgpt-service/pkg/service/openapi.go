@@ -0,0 +1,168 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/livekit-examples/livegpt/pkg/openapi"
+)
+
+//go:generate go run ../../cmd/apigen --spec ../../api/openapi.json --go ../client/api.gen.go --ts ../../../meet/lib/kitt-api.gen.ts
+
+// Every route of the HTTP API (except the LiveKit webhook), the OpenAPI spec and the clients are generated from it.
+// Keep it in sync with the handlers registered in Start
+var apiRoutes = []openapi.Route{
+	{
+		Method:   http.MethodPost,
+		Path:     "/join/{room}",
+		ID:       "joinRoom",
+		Summary:  "Make KITT join the room",
+		Security: []string{"signature"},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/rooms/{room}/events",
+		ID:       "streamRoomEvents",
+		Summary:  "Stream the events of the room (transcripts, answers, state, notes, ...)",
+		Response: &RoomEvent{},
+		Stream:   true,
+		Security: []string{"accessToken"},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/rooms/{room}/calendar",
+		ID:       "getRoomCalendar",
+		Summary:  "Get the calendar event linked to the room",
+		Response: &CalendarEvent{},
+		Security: []string{"accessToken"},
+	},
+	{
+		Method:   http.MethodPut,
+		Path:     "/rooms/{room}/calendar",
+		ID:       "setRoomCalendar",
+		Summary:  "Link the room to a calendar event",
+		Request:  &CalendarEvent{},
+		Security: []string{"accessToken"},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/rooms/{room}/notes",
+		ID:       "getRoomNotes",
+		Summary:  "Get the notes of the meeting (notes mode)",
+		Response: &MeetingNotes{},
+		Security: []string{"accessToken"},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/rooms/{room}/agenda",
+		ID:       "getRoomAgenda",
+		Summary:  "Get the agenda of the meeting (facilitator mode)",
+		Response: &Agenda{},
+		Security: []string{"accessToken"},
+	},
+	{
+		Method:   http.MethodPut,
+		Path:     "/rooms/{room}/agenda",
+		ID:       "setRoomAgenda",
+		Summary:  "Replace the agenda of the meeting (facilitator mode)",
+		Request:  &Agenda{},
+		Security: []string{"accessToken"},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/rooms/{room}/stats",
+		ID:       "getRoomStats",
+		Summary:  "Get the talk time, interruptions and sentiment of the participants (analytics)",
+		Response: &MeetingStats{},
+		Security: []string{"accessToken"},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/transcripts/{room}",
+		ID:      "listTranscripts",
+		Summary: "List the final transcripts and the answers of every session of the room (stored transcripts)",
+		Query: []openapi.Param{
+			{Name: "sid", Description: "Only return the session of this room sid"},
+		},
+		Response: []*TranscriptLine{},
+		Security: []string{"accessToken"},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/memory/{identity}",
+		ID:       "getMemory",
+		Summary:  "Get the facts KITT remembers about the participant",
+		Response: []string{},
+		Security: []string{"accessToken"},
+	},
+	{
+		Method:   http.MethodDelete,
+		Path:     "/memory/{identity}",
+		ID:       "eraseMemory",
+		Summary:  "Erase the memory of the participant",
+		Security: []string{"accessToken"},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/languages",
+		ID:       "listLanguages",
+		Summary:  "List the languages supported by KITT, the first one is the default language",
+		Response: []*Language{},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/jobs",
+		ID:      "listJobs",
+		Summary: "List the post-meeting jobs of the room",
+		Query: []openapi.Param{
+			{Name: "room", Description: "Name of the room", Required: true},
+		},
+		Response: []*Job{},
+		Security: []string{"accessToken"},
+	},
+	{
+		Method:   http.MethodGet,
+		Path:     "/jobs/{id}",
+		ID:       "getJob",
+		Summary:  "Get a post-meeting job",
+		Response: &Job{},
+		Security: []string{"accessToken"},
+	},
+}
+
+var apiSecuritySchemes = map[string]*openapi.SecurityScheme{
+	"accessToken": {
+		Type:         "http",
+		Scheme:       "bearer",
+		BearerFormat: "JWT",
+		Description: "LiveKit access token, also accepted in the access_token query param. " +
+			"The /rooms, /transcripts and /jobs routes require the roomAdmin grant for the room, /memory a token issued for the identity",
+	},
+	"signature": {
+		Type: "apiKey",
+		In:   "header",
+		Name: SignatureHeader_Signature,
+		Description: "HMAC-SHA256 signature with the LiveKit API secret, see admin_signature in config-sample.yaml. " +
+			"Required by /join, accepted by /rooms, /memory, /transcripts and /jobs in addition to their access token",
+	},
+}
+
+// OpenAPI specification of the HTTP API
+func OpenAPISpec() *openapi.Document {
+	return openapi.Build(openapi.Info{
+		Title:       "KITT",
+		Description: "HTTP API of lkgpt-service",
+		Version:     "1.0.0",
+	}, apiSecuritySchemes, apiRoutes)
+}
+
+// GET /openapi.json
+func (s *LiveGPT) openAPIHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(OpenAPISpec())
+}
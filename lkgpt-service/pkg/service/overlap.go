@@ -0,0 +1,166 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+	lksdk "github.com/livekit/server-sdk-go"
+	"golang.org/x/exp/slices"
+)
+
+// Overlapping speakers: a prompt received while KITT is answering another one (see ReplyConfig.Overlap)
+const (
+	OverlapPolicy_Drop        = "drop"        // Ignore the prompt
+	OverlapPolicy_Acknowledge = "acknowledge" // Answer the waiting prompts one by one once the answer ends, acknowledging the wait
+	OverlapPolicy_Combine     = "combine"     // Answer all the waiting prompts together once the answer ends
+)
+
+var (
+	OverlapMaxWaiting = 3                // Prompts waiting for the current answer, the next ones are dropped
+	OverlapMaxWait    = 30 * time.Second // Older prompts are dropped, the conversation moved on
+)
+
+type waitingPrompt struct {
+	rp         *lksdk.RemoteParticipant
+	prompt     *SpeechEvent
+	language   *Language
+	receivedAt time.Time
+}
+
+// Called when a prompt can't be answered because KITT is busy, the prompt is already in the history
+func (p *GPTParticipant) queuePrompt(rp *lksdk.RemoteParticipant, prompt *SpeechEvent, language *Language) {
+	policy := p.conf.Reply.Overlap
+	if policy == "" || policy == OverlapPolicy_Drop {
+		logger.Debugw("busy, dropping the prompt", "participant", rp.SID(), "text", prompt.Text)
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if len(p.waiting) >= OverlapMaxWaiting {
+		logger.Debugw("too many waiting prompts, dropping the prompt", "participant", rp.SID(), "text", prompt.Text)
+		return
+	}
+
+	logger.Debugw("busy, the prompt waits for the current answer", "participant", rp.SID(), "text", prompt.Text)
+	p.waiting = append(p.waiting, &waitingPrompt{
+		rp:         rp,
+		prompt:     prompt,
+		language:   language,
+		receivedAt: time.Now(),
+	})
+}
+
+// The next prompts to answer, all of them with OverlapPolicy_Combine. Also returns the history without
+// the waiting prompts: the ones answered are passed separately, the others are answered later
+func (p *GPTParticipant) takeWaiting() ([]*waitingPrompt, []*MeetingEvent) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	waiting := p.waiting[:0]
+	prompts := make([]*SpeechEvent, 0, len(p.waiting))
+	for _, w := range p.waiting {
+		if time.Since(w.receivedAt) > OverlapMaxWait || p.room.GetParticipant(w.rp.SID()) == nil {
+			continue
+		}
+		waiting = append(waiting, w)
+		prompts = append(prompts, w.prompt)
+	}
+
+	var batch []*waitingPrompt
+	if len(waiting) > 0 {
+		n := 1
+		if p.conf.Reply.Overlap == OverlapPolicy_Combine {
+			n = len(waiting)
+		}
+		batch = append(batch, waiting[:n]...)
+		waiting = waiting[n:]
+	}
+	p.waiting = append([]*waitingPrompt{}, waiting...)
+
+	history := p.history.Window(p.conf.Reply.HistoryTokens)
+	events := make([]*MeetingEvent, 0, len(history))
+	for _, e := range history {
+		if e.Speech == nil || !slices.Contains(prompts, e.Speech) {
+			events = append(events, e)
+		}
+	}
+	return batch, events
+}
+
+// Answer the prompts received during the previous answers, the caller must hold isBusy
+func (p *GPTParticipant) answerWaiting() {
+	for p.ctx.Err() == nil {
+		batch, events := p.takeWaiting()
+		if len(batch) == 0 {
+			return
+		}
+
+		// The last prompt is the one answered, the previous ones of a combined batch stay in the history
+		last := batch[len(batch)-1]
+		names := make([]string, 0, len(batch))
+		for _, w := range batch {
+			if !slices.Contains(names, w.rp.Identity()) {
+				names = append(names, w.rp.Identity())
+			}
+			if w != last {
+				events = append(events, &MeetingEvent{Speech: w.prompt})
+			}
+		}
+
+		p.lock.Lock()
+		p.waited = names
+		p.lock.Unlock()
+
+		logger.Debugw("answering the waiting prompts", "participants", names, "prompts", len(batch))
+		p.recordAnswer(last.rp)
+		p.setState(state_Loading)
+		answer, err := p.answer(nil, events, last.prompt, last.rp, last.language)
+		p.setState(state_Idle)
+		if err != nil {
+			if !errors.Is(err, errFloorTaken) {
+				logger.Errorw("failed to answer the waiting prompts", err, "participants", names)
+			}
+			continue
+		}
+
+		p.publishAnswer(last.rp, last.prompt, answer)
+		p.history.Append(&MeetingEvent{
+			Speech: answer,
+		})
+	}
+}
+
+// Returns the participants whose prompts waited, set by answerWaiting for the next answer
+func (p *GPTParticipant) takeWaited() []string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	waited := p.waited
+	p.waited = nil
+	return waited
+}
+
+func (m *MeetingContext) waited() []string {
+	if m == nil {
+		return nil
+	}
+	return m.Waited
+}
+
+// Instruction added to the completion of the prompts that waited for another answer
+func overlapPrompt(waited []string) string {
+	if len(waited) == 0 {
+		return ""
+	}
+	if len(waited) == 1 {
+		return fmt.Sprintf("%s spoke to you while you were answering someone else. "+
+			"Start with a very short acknowledgment of the wait (e.g \"Sorry for the wait, %s\") then answer them.", waited[0], waited[0])
+	}
+	return fmt.Sprintf("%s spoke to you while you were answering someone else. "+
+		"Answer all their requests above in a single answer, addressing each participant by name.", strings.Join(waited, ", "))
+}
@@ -0,0 +1,315 @@
+package service
+
+import (
+	"encoding/json"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+	lksdk "github.com/livekit/server-sdk-go"
+)
+
+// Packets sent over the datachannels
+type packetType int32
+
+const (
+	packet_Transcript   packetType = 0
+	packet_State        packetType = 1
+	packet_Error        packetType = 2  // Show an error message to the user screen
+	packet_Command      packetType = 3  // Sent by the clients to control KITT
+	packet_Notes        packetType = 4  // Notes of the meeting (notes mode)
+	packet_Speaking     packetType = 5  // Sentence being spoken by KITT (read-along captions)
+	packet_Signal       packetType = 6  // Sent by the clients when a participant is about to speak, see floor.go
+	packet_Capabilities packetType = 7  // Features enabled on the server, sent to the participants when they join
+	packet_Chunk        packetType = 8  // Part of a packet too large for a single message
+	packet_Snapshot     packetType = 9  // State of the room, sent to the participants joining mid-meeting
+	packet_Poll         packetType = 10 // Poll created by KITT, sent again on every vote and when it closes
+	packet_Vote         packetType = 11 // Sent by the clients to vote in a poll
+	packet_Citations    packetType = 12 // Sources of an answer, see citations.go
+	packet_Progress     packetType = 13 // Progress of a tool call taking a while, see progress.go
+	packet_Health       packetType = 14 // The assistant is limited or recovered, see health.go
+	packet_Chat         packetType = 15 // Message of KITT for the chat, see chatonly.go
+	packet_Farewell     packetType = 16 // KITT is leaving the room on its own, see farewell.go
+)
+
+const (
+	command_Start    = "start"    // See JoinBehavior_Command
+	command_Activate = "activate" // Answer the next sentence of the sender (e.g push-to-talk), see ReplyPolicy_Command
+	command_Stop     = "stop"     // Stop speaking, the rest of the answer is dropped
+
+	command_Repeat         = "repeat"          // Say the last answer again
+	command_ResetContext   = "reset_context"   // Forget the conversation, see resetContext
+	command_ChangeLanguage = "change_language" // Answer in the language of the command, or in the language of the speakers when empty
+)
+
+type gptState int32
+
+const (
+	state_Idle     gptState = 0
+	state_Loading  gptState = 1
+	state_Speaking gptState = 2
+	state_Active   gptState = 3
+)
+
+type packet struct {
+	Type packetType  `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// Packet received from the clients, Data is decoded depending on the Type
+type incomingPacket struct {
+	Type packetType      `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+type transcriptPacket struct {
+	Sid     string `json:"sid"`
+	Name    string `json:"name"`
+	Text    string `json:"text"`
+	IsFinal bool   `json:"isFinal"`
+}
+
+type statePacket struct {
+	State gptState `json:"state"`
+}
+
+type errorPacket struct {
+	Message string `json:"message"`
+}
+
+type notesPacket struct {
+	Notes *MeetingNotes `json:"notes"`
+}
+
+type speakingPacket struct {
+	Sid      string `json:"sid"`
+	Text     string `json:"text"`
+	Language string `json:"language"`
+	Index    int    `json:"index"`
+	Start    int64  `json:"start"`    // Unix time in milliseconds
+	Duration int64  `json:"duration"` // Milliseconds
+}
+
+type commandPacket struct {
+	Command  string `json:"command"`
+	Language string `json:"language,omitempty"` // change_language only
+}
+
+type capabilitiesPacket struct {
+	Mode      string   `json:"mode"`
+	Behavior  string   `json:"behavior"` // RoomBehavior_*, switched on the size of the room
+	Features  []string `json:"features"`
+	Commands  []string `json:"commands"` // Commands accepted in the command packets
+	Signals   []string `json:"signals"`  // Signals accepted in the signal packets
+	Languages []string `json:"languages"`
+}
+
+// See chunks.go
+type chunkPacket struct {
+	ID    string `json:"id"`
+	Index int    `json:"index"`
+	Count int    `json:"count"`
+	Size  int    `json:"size"` // Bytes of the whole packet
+	Data  []byte `json:"data"` // Part of the JSON of the packet, base64 encoded
+}
+
+// See polls.go
+type pollPacket struct {
+	ID       string   `json:"id"`
+	Question string   `json:"question"`
+	Options  []string `json:"options"`
+	Counts   []int    `json:"counts"`
+	Voters   int      `json:"voters"`
+	EndsAt   int64    `json:"endsAt"` // Unix time in milliseconds
+	Closed   bool     `json:"closed"`
+}
+
+type votePacket struct {
+	PollID string `json:"pollId"`
+	Option int    `json:"option"` // Index of the option
+}
+
+type citationsPacket struct {
+	Sid       string      `json:"sid"` // Participant who was answered
+	Citations []*Citation `json:"citations"`
+}
+
+type progressPacket struct {
+	Sid      string  `json:"sid"`
+	TaskId   string  `json:"taskId"`
+	Tool     string  `json:"tool"`
+	Message  string  `json:"message,omitempty"`
+	Progress float64 `json:"progress"`
+	Elapsed  int64   `json:"elapsed"` // Milliseconds
+	Done     bool    `json:"done"`
+}
+
+type healthPacket struct {
+	Degraded bool                 `json:"degraded"`
+	Issues   []*healthIssuePacket `json:"issues"`
+}
+
+type healthIssuePacket struct {
+	Provider string `json:"provider,omitempty"`
+	Reason   string `json:"reason"`
+	RetryAt  int64  `json:"retryAt,omitempty"` // Unix time in milliseconds
+	Message  string `json:"message"`
+}
+
+func newHealthPacket(event *HealthEvent) *healthPacket {
+	pkt := &healthPacket{
+		Degraded: event.Degraded,
+		Issues:   make([]*healthIssuePacket, 0, len(event.Issues)),
+	}
+	for _, issue := range event.Issues {
+		issuePkt := &healthIssuePacket{
+			Provider: issue.Provider,
+			Reason:   issue.Reason,
+			Message:  issue.Message,
+		}
+		if !issue.RetryAt.IsZero() {
+			issuePkt.RetryAt = issue.RetryAt.UnixMilli()
+		}
+		pkt.Issues = append(pkt.Issues, issuePkt)
+	}
+	return pkt
+}
+
+type chatPacket struct {
+	Sid     string `json:"sid,omitempty"` // Participant answered, empty for the announcements
+	Message string `json:"message"`
+}
+
+type farewellPacket struct {
+	Reason  string `json:"reason"`
+	Message string `json:"message,omitempty"`
+	Summary string `json:"summary,omitempty"`
+}
+
+type signalPacket struct {
+	Signal string `json:"signal"`
+	Active bool   `json:"active"` // False when released (push-to-talk released, hand lowered, message sent)
+}
+
+// packetSink forwards the room events to the participants using the datachannels
+type packetSink struct {
+	room *lksdk.Room
+}
+
+func (s *packetSink) HandleEvent(event *RoomEvent) {
+	var pkt *packet
+	switch data := event.Data.(type) {
+	case *TranscriptEvent:
+		pkt = &packet{
+			Type: packet_Transcript,
+			Data: &transcriptPacket{
+				Sid:     data.ParticipantSid,
+				Name:    data.ParticipantName,
+				Text:    data.Text,
+				IsFinal: data.IsFinal,
+			},
+		}
+	case *StateEvent:
+		pkt = &packet{
+			Type: packet_State,
+			Data: &statePacket{
+				State: data.State,
+			},
+		}
+	case *ErrorEvent:
+		pkt = &packet{
+			Type: packet_Error,
+			Data: &errorPacket{
+				Message: data.Message,
+			},
+		}
+	case *NotesEvent:
+		pkt = &packet{
+			Type: packet_Notes,
+			Data: &notesPacket{
+				Notes: data.Notes,
+			},
+		}
+	case *SpeakingEvent:
+		pkt = &packet{
+			Type: packet_Speaking,
+			Data: &speakingPacket{
+				Sid:      data.ParticipantSid,
+				Text:     data.Text,
+				Language: data.Language,
+				Index:    data.Index,
+				Start:    data.Start.UnixMilli(),
+				Duration: data.Duration.Milliseconds(),
+			},
+		}
+	case *PollEvent:
+		pkt = &packet{
+			Type: packet_Poll,
+			Data: newPollPacket(data),
+		}
+	case *AnswerEvent:
+		if len(data.Citations) == 0 {
+			return
+		}
+		pkt = &packet{
+			Type: packet_Citations,
+			Data: &citationsPacket{
+				Sid:       data.ParticipantSid,
+				Citations: data.Citations,
+			},
+		}
+	case *ProgressEvent:
+		pkt = &packet{
+			Type: packet_Progress,
+			Data: &progressPacket{
+				Sid:      data.ParticipantSid,
+				TaskId:   data.TaskId,
+				Tool:     data.Tool,
+				Message:  data.Message,
+				Progress: data.Progress,
+				Elapsed:  data.Elapsed.Milliseconds(),
+				Done:     data.Done,
+			},
+		}
+	case *HealthEvent:
+		pkt = &packet{
+			Type: packet_Health,
+			Data: newHealthPacket(data),
+		}
+	case *FarewellEvent:
+		pkt = &packet{
+			Type: packet_Farewell,
+			Data: &farewellPacket{
+				Reason:  data.Reason,
+				Message: data.Message,
+				Summary: data.Summary,
+			},
+		}
+	case *ChatEvent:
+		pkt = &packet{
+			Type: packet_Chat,
+			Data: &chatPacket{
+				Sid:     data.ParticipantSid,
+				Message: data.Message,
+			},
+		}
+	default:
+		return
+	}
+
+	if err := s.sendPacket(pkt); err != nil {
+		logger.Errorw("failed to send packet", err, "room", event.Room, "type", pkt.Type)
+	}
+}
+
+func (s *packetSink) sendPacket(packet *packet) error {
+	return publishPacket(s.room.LocalParticipant, packet, packetKind(packet), []string{})
+}
+
+// The interim transcripts are replaced by the next ones within a few hundred milliseconds, losing one is better
+// than delaying the next packets behind its retransmission. The other packets are reliable
+func packetKind(packet *packet) livekit.DataPacket_Kind {
+	if t, ok := packet.Data.(*transcriptPacket); ok && !t.IsFinal {
+		return livekit.DataPacket_LOSSY
+	}
+	return livekit.DataPacket_RELIABLE
+}
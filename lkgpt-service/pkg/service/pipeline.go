@@ -0,0 +1,143 @@
+package service
+
+// The audio of the participants goes through
+//
+//	STT -> [TranscriptStage] -> turn detection -> [TurnStage] -> [PromptStage] -> LLM -> [SentenceStage] -> TTS -> [AudioStage] -> GPTTrack
+//
+// A Stage implements one or several of the *Stage interfaces, the stages run in the order they were added (See LiveGPT.AddStage).
+// They are called synchronously from the goroutine of the room: a slow stage delays the captions or the answer
+
+type Stage interface {
+	Name() string
+}
+
+// Information about the room and the participant being processed
+type StageContext struct {
+	Room            string
+	ParticipantSid  string
+	ParticipantName string
+	Language        *Language
+}
+
+// Interim and final results of the speech recognition, returns false to drop the result (never published nor answered)
+type TranscriptStage interface {
+	Stage
+	ProcessTranscript(ctx *StageContext, result *RecognizeResult) bool
+}
+
+// Overrides the decision of the built-in turn detection (wake word, reply policy) for a final result
+type TurnStage interface {
+	Stage
+	DetectTurn(ctx *StageContext, result *RecognizeResult, answer bool) bool
+}
+
+// Question sent to the LLM (e.g domain rewriting), returns false to not answer it
+type PromptStage interface {
+	Stage
+	ProcessPrompt(ctx *StageContext, prompt *SpeechEvent) bool
+}
+
+// Sentence of the answer before it is synthesized, returns false to skip it
+type SentenceStage interface {
+	Stage
+	ProcessSentence(ctx *StageContext, sentence *Sentence) bool
+}
+
+// Synthesized audio (ogg/opus) of a sentence before it is played, returns the audio to play
+type AudioStage interface {
+	Stage
+	ProcessAudio(ctx *StageContext, sentence string, audio []byte) []byte
+}
+
+// Pipeline runs the stages of a room, the nil Pipeline has no stages
+type Pipeline struct {
+	stages []Stage
+}
+
+func NewPipeline(stages ...Stage) *Pipeline {
+	return &Pipeline{
+		stages: append([]Stage{}, stages...),
+	}
+}
+
+func (p *Pipeline) transcript(ctx *StageContext, result *RecognizeResult) bool {
+	if p == nil {
+		return true
+	}
+	for _, stage := range p.stages {
+		if s, ok := stage.(TranscriptStage); ok && !s.ProcessTranscript(ctx, result) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Pipeline) turn(ctx *StageContext, result *RecognizeResult, answer bool) bool {
+	if p == nil {
+		return answer
+	}
+	for _, stage := range p.stages {
+		if s, ok := stage.(TurnStage); ok {
+			answer = s.DetectTurn(ctx, result, answer)
+		}
+	}
+	return answer
+}
+
+func (p *Pipeline) prompt(ctx *StageContext, prompt *SpeechEvent) bool {
+	if p == nil {
+		return true
+	}
+	for _, stage := range p.stages {
+		if s, ok := stage.(PromptStage); ok && !s.ProcessPrompt(ctx, prompt) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Pipeline) sentence(ctx *StageContext, sentence *Sentence) bool {
+	if p == nil {
+		return true
+	}
+	for _, stage := range p.stages {
+		if s, ok := stage.(SentenceStage); ok && !s.ProcessSentence(ctx, sentence) {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *Pipeline) audio(ctx *StageContext, sentence string, audio []byte) []byte {
+	if p == nil {
+		return audio
+	}
+	for _, stage := range p.stages {
+		if s, ok := stage.(AudioStage); ok {
+			audio = s.ProcessAudio(ctx, sentence, audio)
+		}
+	}
+	return audio
+}
+
+// The audio stages need the whole audio of a sentence, it can't be streamed to the track
+func (p *Pipeline) hasAudioStages() bool {
+	if p == nil {
+		return false
+	}
+	for _, stage := range p.stages {
+		if _, ok := stage.(AudioStage); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *GPTParticipant) stageContext(sid, name string, language *Language) *StageContext {
+	return &StageContext{
+		Room:            p.room.Name(),
+		ParticipantSid:  sid,
+		ParticipantName: name,
+		Language:        language,
+	}
+}
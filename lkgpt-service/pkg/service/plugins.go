@@ -0,0 +1,81 @@
+package service
+
+import (
+	"fmt"
+	"path/filepath"
+	"plugin"
+	"strings"
+
+	"github.com/livekit/protocol/logger"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// Extensions are Go plugins (go build -buildmode=plugin) listed in the config and loaded at startup.
+// A plugin is a main package exporting
+//
+//	func Register(r *service.PluginRegistrar) error
+//
+// which adds its tools, stages and event sinks. It must be built with the same Go version and the same
+// versions of the packages shared with the service (go.mod), with cgo enabled, otherwise it can't be opened
+
+const pluginSymbol = "Register"
+
+type PluginRegistrar struct {
+	server *LiveGPT
+	conf   config.PluginConfig
+}
+
+func (r *PluginRegistrar) Name() string {
+	return r.conf.Name
+}
+
+// Decode the config section of the plugin into v, nothing to decode when it is empty
+func (r *PluginRegistrar) DecodeConfig(v interface{}) error {
+	if r.conf.Config.Kind == 0 {
+		return nil
+	}
+	return r.conf.Config.Decode(v)
+}
+
+// Tool available to the LLM in every room
+func (r *PluginRegistrar) AddTool(tool Tool) {
+	r.server.AddTool(tool)
+}
+
+func (r *PluginRegistrar) AddStage(stage Stage) {
+	r.server.AddStage(stage)
+}
+
+func (r *PluginRegistrar) AddEventSink(sink EventSink) {
+	r.server.AddEventSink(sink)
+}
+
+func (s *LiveGPT) loadPlugins() error {
+	for _, conf := range s.config.Plugins {
+		if conf.Name == "" {
+			conf.Name = strings.TrimSuffix(filepath.Base(conf.Path), filepath.Ext(conf.Path))
+		}
+
+		p, err := plugin.Open(conf.Path)
+		if err != nil {
+			return fmt.Errorf("failed to open the plugin %s: %w", conf.Name, err)
+		}
+
+		sym, err := p.Lookup(pluginSymbol)
+		if err != nil {
+			return fmt.Errorf("invalid plugin %s: %w", conf.Name, err)
+		}
+
+		register, ok := sym.(func(*PluginRegistrar) error)
+		if !ok {
+			return fmt.Errorf("invalid plugin %s: %s must be a func(*service.PluginRegistrar) error", conf.Name, pluginSymbol)
+		}
+
+		if err := register(&PluginRegistrar{server: s, conf: conf}); err != nil {
+			return fmt.Errorf("failed to register the plugin %s: %w", conf.Name, err)
+		}
+		logger.Infow("plugin loaded", "plugin", conf.Name, "path", conf.Path)
+	}
+	return nil
+}
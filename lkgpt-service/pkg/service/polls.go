@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+	"github.com/livekit/protocol/utils"
+	lksdk "github.com/livekit/server-sdk-go"
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// KITT creates the polls with the create_poll tool, they are sent to the participants in poll packets.
+// The participants vote with vote packets (one vote per identity, the last one counts) until the poll
+// expires, everyone voted or close_poll is called. The results are then announced
+
+const (
+	maxPollOptions   = 8
+	pollAnnounceWait = 30 * time.Second // Max wait for KITT to stop speaking before announcing the results
+	pollAnnounceTick = 500 * time.Millisecond
+)
+
+type poll struct {
+	id       string
+	question string
+	options  []string
+	votes    map[string]int // identity -> option
+	author   string
+	endsAt   time.Time
+	closed   bool
+	timer    *time.Timer
+}
+
+// Published on creation, on every vote and when the poll closes
+type PollEvent struct {
+	ID       string    `json:"id"`
+	Question string    `json:"question"`
+	Options  []string  `json:"options"`
+	Counts   []int     `json:"counts"` // Votes per option
+	Voters   int       `json:"voters"`
+	Author   string    `json:"author"` // Participant who asked for the poll
+	EndsAt   time.Time `json:"endsAt"`
+	Closed   bool      `json:"closed"`
+}
+
+func (pl *poll) event() *PollEvent {
+	counts := make([]int, len(pl.options))
+	for _, option := range pl.votes {
+		counts[option]++
+	}
+	return &PollEvent{
+		ID:       pl.id,
+		Question: pl.question,
+		Options:  pl.options,
+		Counts:   counts,
+		Voters:   len(pl.votes),
+		Author:   pl.author,
+		EndsAt:   pl.endsAt,
+		Closed:   pl.closed,
+	}
+}
+
+// Results spoken by KITT and returned to the LLM
+func (e *PollEvent) results() string {
+	if e.Voters == 0 {
+		return fmt.Sprintf("Nobody voted in the poll \"%s\".", e.Question)
+	}
+
+	parts := make([]string, 0, len(e.Options))
+	for i, option := range e.Options {
+		votes := "votes"
+		if e.Counts[i] == 1 {
+			votes = "vote"
+		}
+		parts = append(parts, fmt.Sprintf("%s: %d %s", option, e.Counts[i], votes))
+	}
+	return fmt.Sprintf("Results of the poll \"%s\": %s.", e.Question, strings.Join(parts, ", "))
+}
+
+func (p *GPTParticipant) createPoll(question string, options []string, duration time.Duration, author string) (*PollEvent, error) {
+	p.lock.Lock()
+	if p.poll != nil && !p.poll.closed {
+		p.lock.Unlock()
+		return nil, fmt.Errorf("the poll \"%s\" is still open, close it first", p.poll.question)
+	}
+
+	pl := &poll{
+		id:       utils.NewGuid("PL_"),
+		question: question,
+		options:  options,
+		votes:    make(map[string]int),
+		author:   author,
+		endsAt:   time.Now().Add(duration),
+	}
+	pl.timer = time.AfterFunc(duration, func() {
+		p.closePoll(pl.id, true)
+	})
+	p.poll = pl
+	event := pl.event()
+	p.lock.Unlock()
+
+	p.publishPoll(event)
+	return event, nil
+}
+
+// Close the poll if it is still open, returns nil otherwise
+func (p *GPTParticipant) closePoll(id string, announce bool) *PollEvent {
+	p.lock.Lock()
+	pl := p.poll
+	if pl == nil || pl.closed || (id != "" && pl.id != id) {
+		p.lock.Unlock()
+		return nil
+	}
+	pl.closed = true
+	pl.timer.Stop()
+	event := pl.event()
+	p.lock.Unlock()
+
+	p.history.Append(&MeetingEvent{
+		Speech: &SpeechEvent{
+			ParticipantName: BotIdentity,
+			IsBot:           true,
+			Text:            event.results(),
+			Time:            time.Now(),
+		},
+	})
+
+	if p.ctx.Err() != nil {
+		return nil
+	}
+
+	p.publishPoll(event)
+	if announce && p.conf.Polls.Announce {
+		go p.announcePoll(event)
+	}
+	return event
+}
+
+// Wait for KITT to be idle, the results are dropped when it is still busy after pollAnnounceWait
+func (p *GPTParticipant) announcePoll(event *PollEvent) {
+	ticker := time.NewTicker(pollAnnounceTick)
+	defer ticker.Stop()
+	deadline := time.Now().Add(pollAnnounceWait)
+
+	for !p.isBusy.CompareAndSwap(false, true) {
+		if time.Now().After(deadline) {
+			logger.Infow("KITT busy, poll results not announced", "room", p.room.Name(), "poll", event.ID)
+			return
+		}
+		select {
+		case <-p.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+	defer p.isBusy.Store(false)
+
+	if err := p.say(event.results(), p.replyLanguage(p.defaultLanguage())); err != nil {
+		logger.Errorw("failed to announce the poll results", err, "room", p.room.Name())
+	}
+}
+
+func (p *GPTParticipant) vote(rp *lksdk.RemoteParticipant, vote *votePacket) {
+	participants := len(p.room.GetParticipants())
+
+	p.lock.Lock()
+	pl := p.poll
+	if pl == nil || pl.closed || pl.id != vote.PollID || vote.Option < 0 || vote.Option >= len(pl.options) {
+		p.lock.Unlock()
+		return
+	}
+	pl.votes[rp.Identity()] = vote.Option
+	everyone := len(pl.votes) >= participants
+	event := pl.event()
+	p.lock.Unlock()
+
+	if everyone {
+		p.closePoll(pl.id, true)
+		return
+	}
+	p.publishPoll(event)
+}
+
+// Open poll, nil when there is none
+func (p *GPTParticipant) openPoll() *PollEvent {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.poll == nil || p.poll.closed {
+		return nil
+	}
+	return p.poll.event()
+}
+
+func (p *GPTParticipant) publishPoll(event *PollEvent) {
+	p.bus.Publish(&RoomEvent{
+		Type: RoomEvent_Poll,
+		Room: p.room.Name(),
+		Data: event,
+	})
+}
+
+func newPollPacket(event *PollEvent) *pollPacket {
+	return &pollPacket{
+		ID:       event.ID,
+		Question: event.Question,
+		Options:  event.Options,
+		Counts:   event.Counts,
+		Voters:   event.Voters,
+		EndsAt:   event.EndsAt.UnixMilli(),
+		Closed:   event.Closed,
+	}
+}
+
+type createPollTool struct {
+	conf config.PollsConfig
+}
+
+func (t *createPollTool) Definition() *openai.FunctionDefinition {
+	return &openai.FunctionDefinition{
+		Name: "create_poll",
+		Description: "Create a poll the participants vote on from their screen, when someone asks for a vote or a poll. " +
+			"The results are announced when everyone voted or when the poll expires.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"question": map[string]interface{}{
+					"type": "string",
+				},
+				"options": map[string]interface{}{
+					"type":        "array",
+					"items":       map[string]interface{}{"type": "string"},
+					"description": fmt.Sprintf("Between 2 and %d options", maxPollOptions),
+				},
+				"duration_seconds": map[string]interface{}{
+					"type":        "integer",
+					"description": fmt.Sprintf("How long the poll is open, %d by default", int(t.conf.DefaultDuration.Seconds())),
+				},
+			},
+			"required": []string{"question", "options"},
+		},
+	}
+}
+
+func (t *createPollTool) Call(ctx context.Context, tc *ToolContext, arguments string) (string, error) {
+	args := struct {
+		Question        string   `json:"question"`
+		Options         []string `json:"options"`
+		DurationSeconds int      `json:"duration_seconds"`
+	}{}
+	if err := parseToolArguments(arguments, &args); err != nil {
+		return "", err
+	}
+
+	question := strings.TrimSpace(args.Question)
+	if question == "" {
+		return "", fmt.Errorf("the question is required")
+	}
+	options := make([]string, 0, len(args.Options))
+	for _, option := range args.Options {
+		if option = strings.TrimSpace(option); option != "" {
+			options = append(options, option)
+		}
+	}
+	if len(options) < 2 || len(options) > maxPollOptions {
+		return "", fmt.Errorf("a poll needs between 2 and %d options", maxPollOptions)
+	}
+
+	duration := time.Duration(args.DurationSeconds) * time.Second
+	if duration <= 0 {
+		duration = t.conf.DefaultDuration
+	}
+	if t.conf.MaxDuration > 0 && duration > t.conf.MaxDuration {
+		duration = t.conf.MaxDuration
+	}
+
+	if _, err := tc.Participant.createPoll(question, options, duration, tc.Speaker.Name()); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("Poll created, the participants can vote on their screen for %d seconds. "+
+		"The results will be announced, don't announce them yourself.", int(duration.Seconds())), nil
+}
+
+type closePollTool struct{}
+
+func (t *closePollTool) Definition() *openai.FunctionDefinition {
+	return &openai.FunctionDefinition{
+		Name:        "close_poll",
+		Description: "Close the current poll before it expires and get its results, to tell them to the participants.",
+		Parameters: map[string]interface{}{
+			"type":       "object",
+			"properties": map[string]interface{}{},
+		},
+	}
+}
+
+func (t *closePollTool) Call(ctx context.Context, tc *ToolContext, arguments string) (string, error) {
+	event := tc.Participant.closePoll("", false)
+	if event == nil {
+		return "There is no open poll.", nil
+	}
+	return event.results(), nil
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/livekit/protocol/logger"
+)
+
+const (
+	JobType_Summary = "summary" // Summarize the meeting, queues the email and webhook jobs
+	JobType_Email   = "email"
+	JobType_Webhook = "webhook" // Meeting webhook
+	JobType_Memory  = "memory"
+)
+
+// Everything needed to process a meeting once KITT left the room
+type MeetingRecord struct {
+	RoomName  string              `json:"roomName"`
+	RoomSid   string              `json:"roomSid"`
+	Events    []*MeetingEvent     `json:"events"`
+	Attendees []*attendee         `json:"attendees"`
+	Memories  map[string][]string `json:"memories"` // identity -> facts remembered before the meeting
+	Stats     *MeetingStats       `json:"stats,omitempty"`
+
+	Scratchpad []*ScratchpadNote `json:"scratchpad,omitempty"`
+}
+
+// Body of the meeting webhook
+type MeetingWebhookPayload struct {
+	Room       string          `json:"room"`
+	RoomSid    string          `json:"roomSid"`
+	Summary    *MeetingSummary `json:"summary"`
+	Transcript string          `json:"transcript"`
+	Analytics  *MeetingStats   `json:"analytics,omitempty"`
+}
+
+func (p *GPTParticipant) meetingRecord() *MeetingRecord {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	record := &MeetingRecord{
+		RoomName: p.room.Name(),
+		RoomSid:  p.room.SID(),
+		Events:   p.transcript.Snapshot(),
+		Memories: make(map[string][]string, len(p.memories)),
+
+		Scratchpad: p.scratchpad.all(),
+	}
+	if p.analytics != nil {
+		record.Stats = p.analytics.Stats()
+	}
+	for _, a := range p.attendees {
+		attendee := *a
+		record.Attendees = append(record.Attendees, &attendee)
+	}
+	for identity, facts := range p.memories {
+		record.Memories[identity] = facts
+	}
+	return record
+}
+
+func (s *LiveGPT) registerJobHandlers() {
+	s.jobs.Handle(JobType_Summary, s.summaryJob)
+	s.jobs.Handle(JobType_Email, s.emailJob)
+	s.jobs.Handle(JobType_Webhook, s.webhookJob)
+	s.jobs.Handle(JobType_Memory, s.memoryJob)
+	s.jobs.Handle(JobType_QuotaAlert, s.quotaAlertJob)
+}
+
+// Queue the post-meeting processing
+func (s *LiveGPT) meetingFinished(record *MeetingRecord) {
+	if len(record.Events) == 0 {
+		return
+	}
+
+	summarize := len(s.notesRecipients(record)) > 0 ||
+		(s.store != nil && s.config.Storage.Summaries) ||
+		s.config.MeetingWebhook.Url != ""
+	if summarize {
+		if _, err := s.jobs.Enqueue(JobType_Summary, record.RoomName, record); err != nil {
+			logger.Errorw("failed to queue the summary", err, "room", record.RoomName)
+		}
+	}
+
+	if s.memory != nil {
+		if _, err := s.jobs.Enqueue(JobType_Memory, record.RoomName, record); err != nil {
+			logger.Errorw("failed to queue the memory update", err, "room", record.RoomName)
+		}
+	}
+}
+
+// JobType_Webhook
+func (s *LiveGPT) webhookJob(ctx context.Context, job *Job) error {
+	conf := s.config.MeetingWebhook
+	if conf.Url == "" {
+		return nil // Disabled since the job was queued
+	}
+
+	return doJSONRequest(ctx, http.MethodPost, conf.Url, json.RawMessage(job.Payload), nil, func(req *http.Request) {
+		for k, v := range conf.Headers {
+			req.Header.Set(k, v)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+	lksdk "github.com/livekit/server-sdk-go"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// Behavior switched on the size of the room (see RoomSizeConfig): answering anyone saying the activation words
+// doesn't scale to webinars, the large rooms only answer the activate command or are only captioned.
+// The frontends are told with the capabilities packet when the behavior changes
+
+const (
+	RoomBehavior_Assistant = "assistant" // The reply policies of the config
+	RoomBehavior_Command   = "command"   // Only answer after an activate command packet, the activation words are ignored
+	RoomBehavior_Captions  = "captions"  // Never answer, the transcripts are still published
+
+	RoomCount_All         = "all"
+	RoomCount_Microphones = "microphones" // Participants publishing a microphone, the audience of a webinar isn't counted
+)
+
+func validateRoomPresets(conf config.RoomSizeConfig) error {
+	if conf.Count != RoomCount_All && conf.Count != RoomCount_Microphones {
+		return fmt.Errorf("unknown count %q", conf.Count)
+	}
+	for _, preset := range conf.Presets {
+		switch preset.Behavior {
+		case RoomBehavior_Assistant, RoomBehavior_Command, RoomBehavior_Captions:
+		default:
+			return fmt.Errorf("unknown behavior %q", preset.Behavior)
+		}
+	}
+	return nil
+}
+
+// Behavior of the largest preset reached by the room, RoomBehavior_Assistant below every preset
+// unpublished is the SID of a track being unpublished, rp.Tracks() still returns it
+func (p *GPTParticipant) roomBehavior(unpublished string) string {
+	conf := p.conf.RoomSize
+	if len(conf.Presets) == 0 {
+		return RoomBehavior_Assistant
+	}
+
+	size := p.roomSize(conf.Count, unpublished)
+	behavior, min := RoomBehavior_Assistant, 0
+	for _, preset := range conf.Presets {
+		if size >= preset.MinParticipants && preset.MinParticipants >= min {
+			behavior, min = preset.Behavior, preset.MinParticipants
+		}
+	}
+	return behavior
+}
+
+func (p *GPTParticipant) roomSize(count, unpublished string) int {
+	participants := p.room.GetParticipants()
+	if count != RoomCount_Microphones {
+		return len(participants)
+	}
+
+	size := 0
+	for _, rp := range participants {
+		for _, publication := range rp.Tracks() {
+			if publication.Source() == livekit.TrackSource_MICROPHONE && publication.SID() != unpublished {
+				size++
+				break
+			}
+		}
+	}
+	return size
+}
+
+func (p *GPTParticipant) trackUnpublished(publication *lksdk.RemoteTrackPublication, rp *lksdk.RemoteParticipant) {
+	if publication.Source() == livekit.TrackSource_MICROPHONE {
+		p.updateRoomBehavior(publication.SID())
+	}
+}
+
+// Called when the participants or their microphones change
+func (p *GPTParticipant) checkRoomBehavior() {
+	p.updateRoomBehavior("")
+}
+
+func (p *GPTParticipant) updateRoomBehavior(unpublished string) {
+	if len(p.conf.RoomSize.Presets) == 0 {
+		return
+	}
+
+	behavior := p.roomBehavior(unpublished)
+	p.lock.Lock()
+	previous := p.behavior
+	p.behavior = behavior
+	p.lock.Unlock()
+	if behavior == previous {
+		return
+	}
+
+	logger.Infow("room behavior changed", "room", p.room.Name(), "behavior", behavior, "previous", previous)
+	p.sendCapabilities()
+}
+
+func (p *GPTParticipant) currentBehavior() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	return p.behavior
+}
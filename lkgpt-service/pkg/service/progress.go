@@ -0,0 +1,179 @@
+package service
+
+import (
+	"sync"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// The tool calls taking more than a few seconds (search, document processing) report their progress with
+// ToolContext.Progress. Once the delay elapsed, it is sent to the participants (progress packets) instead of
+// a silent Loading state, and KITT can say short verbal updates until the tool returns
+
+// Tool call being executed, the task id is the id of the tool call
+type toolTask struct {
+	tc      *ToolContext
+	id      string
+	tool    string
+	started time.Time
+
+	lock     sync.Mutex
+	message  string
+	progress float64 // 0.0 - 1.0, -1 when unknown
+	reported bool    // A progress event was published
+
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// Report the progress of the current tool call: a short message (e.g "Searching the documents")
+// and the completed fraction (0.0 - 1.0), or -1 when unknown
+func (tc *ToolContext) Progress(message string, progress float64) {
+	tc.lock.Lock()
+	task := tc.task
+	tc.lock.Unlock()
+	if task == nil {
+		return
+	}
+
+	task.lock.Lock()
+	task.message = message
+	task.progress = progress
+	task.lock.Unlock()
+
+	if conf := tc.progressConf(); conf != nil && time.Since(task.started) >= conf.Delay {
+		task.publish(false)
+	}
+}
+
+// Used by the answer to say the verbal updates, the chat answers don't have any
+func (tc *ToolContext) setProgressSpeech(f func(text string)) {
+	tc.lock.Lock()
+	defer tc.lock.Unlock()
+	tc.sayProgress = f
+}
+
+// nil when the progress isn't reported
+func (tc *ToolContext) progressConf() *config.ProgressConfig {
+	if tc.Participant == nil || !tc.Participant.conf.Progress.Enabled {
+		return nil
+	}
+	return &tc.Participant.conf.Progress
+}
+
+func (tc *ToolContext) startTask(id, tool string) *toolTask {
+	task := &toolTask{
+		tc:       tc,
+		id:       id,
+		tool:     tool,
+		started:  time.Now(),
+		progress: -1,
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+
+	tc.lock.Lock()
+	tc.task = task
+	tc.lock.Unlock()
+
+	if conf := tc.progressConf(); conf != nil {
+		go task.watch(conf)
+	} else {
+		close(task.stopped)
+	}
+	return task
+}
+
+// Wait for the verbal update being said, so the answer doesn't continue while it is queued
+func (t *toolTask) finish() {
+	close(t.done)
+	<-t.stopped
+
+	t.tc.lock.Lock()
+	if t.tc.task == t {
+		t.tc.task = nil
+	}
+	t.tc.lock.Unlock()
+
+	t.lock.Lock()
+	reported := t.reported
+	t.lock.Unlock()
+	if reported {
+		t.publish(true)
+	}
+}
+
+func (t *toolTask) watch(conf *config.ProgressConfig) {
+	defer close(t.stopped)
+
+	delay := time.NewTimer(conf.Delay)
+	defer delay.Stop()
+
+	var spoken <-chan time.Time
+	if conf.Spoken && conf.SpokenInterval > 0 {
+		ticker := time.NewTicker(conf.SpokenInterval)
+		defer ticker.Stop()
+		spoken = ticker.C
+	}
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-delay.C:
+			t.publish(false)
+		case <-spoken:
+			t.say(conf.Phrase)
+		}
+	}
+}
+
+func (t *toolTask) publish(done bool) {
+	p := t.tc.Participant
+
+	t.lock.Lock()
+	t.reported = true
+	event := &ProgressEvent{
+		TaskId:   t.id,
+		Tool:     t.tool,
+		Message:  t.message,
+		Progress: t.progress,
+		Elapsed:  time.Since(t.started),
+		Done:     done,
+	}
+	t.lock.Unlock()
+
+	if t.tc.Speaker != nil {
+		event.ParticipantSid = t.tc.Speaker.SID()
+	}
+	p.bus.Publish(&RoomEvent{
+		Type: RoomEvent_Progress,
+		Room: p.room.Name(),
+		Data: event,
+	})
+}
+
+// The last message reported by the tool is said, the phrase of the config otherwise
+func (t *toolTask) say(phrase string) {
+	t.tc.lock.Lock()
+	sayProgress := t.tc.sayProgress
+	t.tc.lock.Unlock()
+	if sayProgress == nil {
+		return
+	}
+
+	t.lock.Lock()
+	if t.message != "" {
+		phrase = t.message
+	}
+	t.lock.Unlock()
+
+	if phrase == "" {
+		return
+	}
+	logger.Debugw("saying progress update", "tool", t.tool, "text", phrase)
+	sayProgress(phrase)
+}
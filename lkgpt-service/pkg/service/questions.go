@@ -0,0 +1,60 @@
+package service
+
+import (
+	"strings"
+
+	"golang.org/x/exp/slices"
+)
+
+const (
+	QuestionsPolicy_Off  = "off"  // The questions are answered as a single prompt
+	QuestionsPolicy_List = "list" // Answer the questions in order
+	QuestionsPolicy_Ask  = "ask"  // Ask which question to answer first
+)
+
+var (
+	// Interrogative words starting a new question in the middle of an utterance
+	QuestionStartWords = []string{"what", "who", "why", "how", "when", "where", "which"}
+	// Words joining two questions without punctuation (e.g "what is X and how does Y work")
+	QuestionJoinWords = []string{"and", "also", "then", "plus", "or"}
+)
+
+// Number of distinct questions in an utterance. The transcripts are usually unpunctuated:
+// a new question starts after a question mark or with an interrogative word following a joining word
+func countQuestions(text string) int {
+	count := 0
+	for _, sentence := range strings.SplitAfter(text, "?") {
+		words := normalizeWords(sentence)
+		if len(words) == 0 {
+			continue
+		}
+
+		questions := 0
+		if strings.HasSuffix(strings.TrimSpace(sentence), "?") || looksLikeQuestion(sentence) {
+			questions = 1
+		}
+		for i := 1; i+2 < len(words); i++ { // The new question has at least two words
+			if slices.Contains(QuestionJoinWords, words[i]) && slices.Contains(QuestionStartWords, words[i+1]) {
+				questions++
+			}
+		}
+		count += questions
+	}
+	return count
+}
+
+// Instruction added to the completion when the prompt contains several questions
+func questionsPrompt(policy, text string) string {
+	if policy == "" || policy == QuestionsPolicy_Off || countQuestions(text) < 2 {
+		return ""
+	}
+
+	switch policy {
+	case QuestionsPolicy_Ask:
+		return "The participant asked several distinct questions. Don't answer them yet: " +
+			"briefly list them and ask which one they want you to answer first."
+	default:
+		return "The participant asked several distinct questions. Answer each of them in the order they were asked, " +
+			"starting each answer with a short reminder of its question (e.g \"First, about ...\")."
+	}
+}
@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+	"github.com/prometheus/client_golang/prometheus"
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+	"github.com/livekit-examples/livegpt/pkg/store"
+)
+
+// Usage of the paid providers, counted per UTC day against the configured quotas
+
+const (
+	usage_STTMinutes    = "stt_minutes"
+	usage_TTSCharacters = "tts_characters"
+	usage_OpenAITokens  = "openai_tokens"
+
+	JobType_QuotaAlert = "quota_alert"
+
+	usageFlushInterval = 30 * time.Second
+	charsPerToken      = 4 // The streamed completions don't report their usage, the tokens are estimated
+)
+
+var (
+	errQuotaExceeded = errors.New("provider quota exceeded")
+
+	usageKinds = []string{usage_STTMinutes, usage_TTSCharacters, usage_OpenAITokens}
+
+	usageDesc = prometheus.NewDesc("kitt_usage",
+		"Usage of the provider today (UTC)", []string{"kind"}, nil)
+	quotaDesc = prometheus.NewDesc("kitt_quota",
+		"Daily quota of the provider, 0 when unlimited", []string{"kind"}, nil)
+)
+
+// Payload of the alert webhook
+type QuotaAlert struct {
+	Kind     string  `json:"kind"`
+	Period   string  `json:"period"` // UTC day, e.g "2023-04-12"
+	Used     float64 `json:"used"`
+	Quota    float64 `json:"quota"`
+	Exceeded bool    `json:"exceeded"` // False when only the alert threshold is crossed
+}
+
+// usageMeter counts the usage of the providers. With the database, the usage is shared by the instances:
+// it is added to the budgets table periodically, the totals then include the other instances
+type usageMeter struct {
+	conf  config.QuotaConfig
+	db    store.Store // nil to only count the usage of this instance
+	alert func(alert *QuotaAlert)
+
+	lock    sync.Mutex
+	period  string
+	totals  map[string]float64
+	pending map[string]float64            // Not added to the database yet
+	stale   map[string]map[string]float64 // Pending usage of the past periods, by period
+	alerted map[string]int                // 1 when the threshold alert was sent, 2 when the exceeded one was
+}
+
+func newUsageMeter(conf config.QuotaConfig, db store.Store, alert func(alert *QuotaAlert)) *usageMeter {
+	return &usageMeter{
+		conf:    conf,
+		db:      db,
+		alert:   alert,
+		period:  usagePeriod(),
+		totals:  make(map[string]float64),
+		pending: make(map[string]float64),
+		stale:   make(map[string]map[string]float64),
+		alerted: make(map[string]int),
+	}
+}
+
+func usagePeriod() string {
+	return time.Now().UTC().Format("2006-01-02")
+}
+
+func (m *usageMeter) quota(kind string) float64 {
+	switch kind {
+	case usage_STTMinutes:
+		return m.conf.STTMinutes
+	case usage_TTSCharacters:
+		return m.conf.TTSCharacters
+	case usage_OpenAITokens:
+		return m.conf.OpenAITokens
+	default:
+		return 0
+	}
+}
+
+func (m *usageMeter) Add(kind string, amount float64) {
+	if m == nil || amount <= 0 {
+		return
+	}
+
+	m.lock.Lock()
+	m.rollPeriod()
+	m.totals[kind] += amount
+	if m.db != nil {
+		m.pending[kind] += amount
+	}
+	alert := m.check(kind)
+	m.lock.Unlock()
+
+	m.sendAlert(alert)
+}
+
+// True when a quota is exceeded, the new sessions are refused when QuotaConfig.RefuseSessions is set
+func (m *usageMeter) Exceeded() bool {
+	if m == nil {
+		return false
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.rollPeriod()
+	for _, kind := range usageKinds {
+		if quota := m.quota(kind); quota > 0 && m.totals[kind] >= quota {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *usageMeter) Run(done <-chan struct{}) {
+	if m.db == nil {
+		return
+	}
+
+	m.flush() // Loads the usage of the day
+	ticker := time.NewTicker(usageFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			m.flush()
+			return
+		case <-ticker.C:
+			m.flush()
+		}
+	}
+}
+
+// Add the pending usage to the database and read the totals of every instance
+func (m *usageMeter) flush() {
+	// The pending usage is added to the budget of the period it was used in, not to the current one
+	m.lock.Lock()
+	batches := m.stale
+	batches[m.period] = m.pending
+	m.stale = make(map[string]map[string]float64)
+	m.pending = make(map[string]float64)
+	m.rollPeriod()
+	current := m.period
+	m.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	for period, pending := range batches {
+		if period != current {
+			m.flushPeriod(ctx, period, pending)
+		}
+	}
+	m.flushPeriod(ctx, current, batches[current]) // Loads the totals of the day, even without usage
+}
+
+func (m *usageMeter) flushPeriod(ctx context.Context, period string, pending map[string]float64) {
+	for _, kind := range usageKinds {
+		total, err := m.db.AddBudgetUsage(ctx, "usage:"+kind, period, pending[kind])
+		if err != nil {
+			logger.Errorw("failed to store the usage", err, "kind", kind, "period", period)
+			m.lock.Lock()
+			m.addPending(period, kind, pending[kind]) // Retried on the next flush
+			m.lock.Unlock()
+			continue
+		}
+
+		m.lock.Lock()
+		var alert *QuotaAlert
+		if m.period == period {
+			m.totals[kind] = total + m.pending[kind]
+			alert = m.check(kind)
+		}
+		m.lock.Unlock()
+		m.sendAlert(alert)
+	}
+}
+
+// The caller must hold the lock
+func (m *usageMeter) addPending(period, kind string, amount float64) {
+	if amount == 0 {
+		return
+	}
+	if period == m.period {
+		m.pending[kind] += amount
+		return
+	}
+	if m.stale[period] == nil {
+		m.stale[period] = make(map[string]float64)
+	}
+	m.stale[period][kind] += amount
+}
+
+// The caller must hold the lock
+func (m *usageMeter) rollPeriod() {
+	if period := usagePeriod(); period != m.period {
+		previous, pending := m.period, m.pending
+		m.pending = make(map[string]float64)
+		m.period = period
+		for kind, amount := range pending {
+			m.addPending(previous, kind, amount) // Still flushed to the budget of the past period
+		}
+		m.totals = make(map[string]float64)
+		m.alerted = make(map[string]int)
+	}
+}
+
+// Returns the alert to send, if any. The caller must hold the lock
+func (m *usageMeter) check(kind string) *QuotaAlert {
+	quota := m.quota(kind)
+	if quota <= 0 {
+		return nil
+	}
+
+	used := m.totals[kind]
+	level := 0
+	if used >= quota {
+		level = 2
+	} else if m.conf.AlertThreshold > 0 && used >= quota*m.conf.AlertThreshold {
+		level = 1
+	}
+	if level <= m.alerted[kind] {
+		return nil
+	}
+
+	m.alerted[kind] = level
+	return &QuotaAlert{
+		Kind:     kind,
+		Period:   m.period,
+		Used:     used,
+		Quota:    quota,
+		Exceeded: level == 2,
+	}
+}
+
+func (m *usageMeter) sendAlert(alert *QuotaAlert) {
+	if alert == nil {
+		return
+	}
+
+	logger.Warnw("provider quota alert", nil, "kind", alert.Kind, "used", alert.Used, "quota", alert.Quota, "exceeded", alert.Exceeded)
+	if m.alert != nil {
+		m.alert(alert)
+	}
+}
+
+func estimateTokens(messages []openai.ChatCompletionMessage) float64 {
+	chars := 0
+	for _, message := range messages {
+		chars += len(message.Content)
+	}
+	return float64(chars) / charsPerToken
+}
+
+// JobType_QuotaAlert
+func (s *LiveGPT) quotaAlertJob(ctx context.Context, job *Job) error {
+	conf := s.config.Quota
+	if conf.AlertUrl == "" {
+		return nil
+	}
+
+	return doJSONRequest(ctx, http.MethodPost, conf.AlertUrl, json.RawMessage(job.Payload), nil, func(req *http.Request) {
+		for k, v := range conf.AlertHeaders {
+			req.Header.Set(k, v)
+		}
+	})
+}
+
+// Reports the usage of the day when scraped
+type usageCollector struct {
+	m *usageMeter
+}
+
+func (c *usageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- usageDesc
+	ch <- quotaDesc
+}
+
+func (c *usageCollector) Collect(ch chan<- prometheus.Metric) {
+	c.m.lock.Lock()
+	defer c.m.lock.Unlock()
+
+	c.m.rollPeriod()
+	for _, kind := range usageKinds {
+		ch <- prometheus.MustNewConstMetric(usageDesc, prometheus.GaugeValue, c.m.totals[kind], kind)
+		ch <- prometheus.MustNewConstMetric(quotaDesc, prometheus.GaugeValue, c.m.quota(kind), kind)
+	}
+}
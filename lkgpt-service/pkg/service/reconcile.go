@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"path"
+	"time"
+
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+)
+
+const reconcileTimeout = 30 * time.Second
+
+// Join the rooms that already have participants, KITT left them when the previous instance stopped.
+// With several instances, the room claims make sure only one of them joins each room
+func (s *LiveGPT) reconcileRooms() {
+	ctx, cancel := context.WithTimeout(context.Background(), reconcileTimeout)
+	defer cancel()
+
+	res, err := s.roomService.ListRooms(ctx, &livekit.ListRoomsRequest{})
+	if err != nil {
+		logger.Errorw("failed to list the rooms to join", err)
+		return
+	}
+
+	joined := 0
+	for _, room := range res.Rooms {
+		if !s.autoJoinAllowed(room.Name) {
+			continue
+		}
+
+		participants, err := s.roomService.ListParticipants(ctx, &livekit.ListParticipantsRequest{Room: room.Name})
+		if err != nil {
+			logger.Errorw("failed to list the participants", err, "room", room.Name)
+			continue
+		}
+
+		humans, bot := 0, false
+		for _, participant := range participants.Participants {
+			if participant.Identity == BotIdentity {
+				bot = true
+			} else {
+				humans++
+			}
+		}
+		if humans == 0 || bot {
+			continue // Joining with the same identity would kick the KITT already in the room
+		}
+
+		if err := s.joinRoom(room); err != nil {
+			logger.Errorw("failed to join the room", err, "room", room.Name)
+			continue
+		}
+		joined++
+	}
+	logger.Infow("reconciled the rooms", "rooms", len(res.Rooms), "joined", joined)
+}
+
+// Rooms KITT joins without an explicit /join call
+func (s *LiveGPT) autoJoinAllowed(roomName string) bool {
+	conf := s.config.AutoJoin
+	if len(conf.Allow) > 0 && !matchRoomName(conf.Allow, roomName) {
+		return false
+	}
+	return !matchRoomName(conf.Deny, roomName)
+}
+
+func matchRoomName(patterns []string, roomName string) bool {
+	for _, pattern := range patterns {
+		if ok, err := path.Match(pattern, roomName); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
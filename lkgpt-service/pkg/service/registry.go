@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/livekit/protocol/utils"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+const (
+	webhookEventTTL   = 10 * time.Minute // LiveKit retries the failed webhooks for a few minutes
+	roomClaimTTL      = 30 * time.Second
+	roomClaimInterval = 10 * time.Second // Refresh of the claims of the rooms KITT is in
+)
+
+// Coordinates the instances running behind the same webhook URL, so each webhook and each room is
+// handled by a single instance
+type RoomRegistry interface {
+	// Returns false when the webhook event has already been received (by this instance or another one)
+	ClaimEvent(ctx context.Context, eventId string) (bool, error)
+	// Returns false when the nonce of a signed request has already been used during ttl
+	ClaimNonce(ctx context.Context, nonce string, ttl time.Duration) (bool, error)
+	// Returns false when another instance is already in the room
+	ClaimRoom(ctx context.Context, roomSid string) (bool, error)
+	// Extend the claim, must be called before roomClaimTTL
+	RefreshRoom(ctx context.Context, roomSid string) error
+	ReleaseRoom(ctx context.Context, roomSid string) error
+}
+
+// Returns nil when conf.Address is empty
+func newRedisClient(conf config.RedisConfig) (redis.UniversalClient, error) {
+	if conf.Address == "" {
+		return nil, nil
+	}
+
+	rc := redis.NewClient(&redis.Options{
+		Addr:     conf.Address,
+		Username: conf.Username,
+		Password: conf.Password,
+		DB:       conf.DB,
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+	if err := rc.Ping(ctx).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to redis: %w", err)
+	}
+	return rc, nil
+}
+
+// A local registry is used when rc is nil (single instance)
+func NewRoomRegistry(rc redis.UniversalClient) RoomRegistry {
+	if rc == nil {
+		return &localRoomRegistry{
+			claims: make(map[string]time.Time),
+		}
+	}
+
+	hostname, _ := os.Hostname()
+	return &redisRoomRegistry{
+		rc:         rc,
+		instanceId: fmt.Sprintf("%s_%s", hostname, utils.NewGuid("")),
+	}
+}
+
+type localRoomRegistry struct {
+	lock   sync.Mutex
+	claims map[string]time.Time // key -> expiration
+}
+
+func (r *localRoomRegistry) ClaimEvent(ctx context.Context, eventId string) (bool, error) {
+	if eventId == "" {
+		return true, nil
+	}
+	return r.claim(redisEventKey(eventId), webhookEventTTL), nil
+}
+
+func (r *localRoomRegistry) ClaimNonce(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return r.claim(redisNonceKey(nonce), ttl), nil
+}
+
+func (r *localRoomRegistry) claim(key string, ttl time.Duration) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	now := time.Now()
+	for k, expiration := range r.claims {
+		if now.After(expiration) {
+			delete(r.claims, k)
+		}
+	}
+
+	if _, ok := r.claims[key]; ok {
+		return false
+	}
+	r.claims[key] = now.Add(ttl)
+	return true
+}
+
+// The rooms of this instance are already tracked by LiveGPT.participants
+func (r *localRoomRegistry) ClaimRoom(ctx context.Context, roomSid string) (bool, error) {
+	return true, nil
+}
+
+func (r *localRoomRegistry) RefreshRoom(ctx context.Context, roomSid string) error {
+	return nil
+}
+
+func (r *localRoomRegistry) ReleaseRoom(ctx context.Context, roomSid string) error {
+	return nil
+}
+
+type redisRoomRegistry struct {
+	rc         redis.UniversalClient
+	instanceId string
+}
+
+func redisEventKey(eventId string) string {
+	return "kitt:webhook:" + eventId
+}
+
+func redisNonceKey(nonce string) string {
+	return "kitt:nonce:" + nonce
+}
+
+func redisRoomKey(roomSid string) string {
+	return "kitt:room:" + roomSid
+}
+
+func (r *redisRoomRegistry) ClaimEvent(ctx context.Context, eventId string) (bool, error) {
+	if eventId == "" {
+		return true, nil
+	}
+	return r.rc.SetNX(ctx, redisEventKey(eventId), r.instanceId, webhookEventTTL).Result()
+}
+
+func (r *redisRoomRegistry) ClaimNonce(ctx context.Context, nonce string, ttl time.Duration) (bool, error) {
+	return r.rc.SetNX(ctx, redisNonceKey(nonce), r.instanceId, ttl).Result()
+}
+
+func (r *redisRoomRegistry) ClaimRoom(ctx context.Context, roomSid string) (bool, error) {
+	return r.rc.SetNX(ctx, redisRoomKey(roomSid), r.instanceId, roomClaimTTL).Result()
+}
+
+// Only the owner can refresh or release the claim
+var (
+	refreshRoomScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0`)
+
+	releaseRoomScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+)
+
+func (r *redisRoomRegistry) RefreshRoom(ctx context.Context, roomSid string) error {
+	return refreshRoomScript.Run(ctx, r.rc, []string{redisRoomKey(roomSid)}, r.instanceId, roomClaimTTL.Milliseconds()).Err()
+}
+
+func (r *redisRoomRegistry) ReleaseRoom(ctx context.Context, roomSid string) error {
+	return releaseRoomScript.Run(ctx, r.rc, []string{redisRoomKey(roomSid)}, r.instanceId).Err()
+}
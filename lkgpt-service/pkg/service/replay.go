@@ -0,0 +1,582 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+	lksdk "github.com/livekit/server-sdk-go"
+	"github.com/sashabaranov/go-openai"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// Recording and replay of the sessions, to reproduce the bug reports ("KITT behaved weirdly in this meeting").
+// The inputs that make a session nondeterministic, the transcripts and the LLM outputs, are recorded as JSON lines
+// (see ReplayConfig). A replay feeds the recorded transcripts to a room at their recorded times and the LLM answers
+// with the recorded outputs, the rest of the pipeline (turn taking, prompts, tools, synthesis) runs like the session
+
+const (
+	replayEntry_Session    = "session" // First line of a recording
+	replayEntry_Transcript = "transcript"
+	replayEntry_Completion = "completion"
+	replayEntry_Stream     = "stream"
+
+	replayLead    = time.Second      // Before the first transcript of a replay
+	replayGrace   = 10 * time.Second // After the last entry, before the LLM is live again
+	maxReplayBody = 32 << 20
+)
+
+var (
+	errReplayRunning   = errors.New("a replay is already running in this room")
+	errReplayExhausted = errors.New("no recorded completion left for this request")
+)
+
+type replayEntry struct {
+	Type   string        `json:"type"`
+	Offset time.Duration `json:"offset"` // Since the start of the recording
+
+	// replayEntry_Session
+	Room    string `json:"room,omitempty"`
+	RoomSid string `json:"roomSid,omitempty"`
+
+	// replayEntry_Transcript
+	Identity   string            `json:"identity,omitempty"`
+	Transcript *replayTranscript `json:"transcript,omitempty"`
+
+	// replayEntry_Completion and replayEntry_Stream, replayed in the order of the requests of each model
+	Seq         uint64                                `json:"seq,omitempty"`
+	Model       string                                `json:"model,omitempty"`
+	Completion  *openai.ChatCompletionResponse        `json:"completion,omitempty"`
+	Chunks      []openai.ChatCompletionStreamResponse `json:"chunks,omitempty"`
+	Error       string                                `json:"error,omitempty"`       // The request failed
+	StreamError string                                `json:"streamError,omitempty"` // The stream failed after the chunks
+}
+
+type replayTranscript struct {
+	Text       string       `json:"text"`
+	IsFinal    bool         `json:"isFinal,omitempty"`
+	Stability  float32      `json:"stability,omitempty"`
+	Confidence float32      `json:"confidence,omitempty"`
+	Words      []replayWord `json:"words,omitempty"`
+	Language   string       `json:"language,omitempty"`
+}
+
+type replayWord struct {
+	Word  string        `json:"word"`
+	Start time.Duration `json:"start"` // Since the start of the recording
+	End   time.Duration `json:"end"`
+}
+
+// The words are timed from start
+func (t *replayTranscript) result(start time.Time) RecognizeResult {
+	result := RecognizeResult{
+		Text:       t.Text,
+		IsFinal:    t.IsFinal,
+		Stability:  t.Stability,
+		Confidence: t.Confidence,
+	}
+	for _, w := range t.Words {
+		result.Words = append(result.Words, RecognizedWord{
+			Word:  w.Word,
+			Start: start.Add(w.Start),
+			End:   start.Add(w.End),
+		})
+	}
+	if t.Language != "" {
+		result.Language = findLanguage(t.Language)
+	}
+	return result
+}
+
+// nil when the sessions aren't recorded. Uploaded to the storage on Close
+type sessionRecorder struct {
+	store   BlobStore
+	key     string
+	started time.Time
+
+	lock   sync.Mutex
+	buf    bytes.Buffer
+	seq    uint64
+	closed bool
+}
+
+func newSessionRecorder(conf config.ReplayConfig, store BlobStore, roomName, roomSid string) *sessionRecorder {
+	r := &sessionRecorder{
+		store:   store,
+		key:     fmt.Sprintf("%s/%s_%s.jsonl", strings.Trim(conf.Dir, "/"), sanitizeFilename(roomName), roomSid),
+		started: time.Now(),
+	}
+	r.write(&replayEntry{
+		Type:    replayEntry_Session,
+		Room:    roomName,
+		RoomSid: roomSid,
+	})
+	return r
+}
+
+func (r *sessionRecorder) write(entry *replayEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		logger.Errorw("failed to marshal the replay entry", err, "type", entry.Type)
+		return
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return
+	}
+	r.buf.Write(data)
+	r.buf.WriteByte('\n')
+}
+
+func (r *sessionRecorder) recordTranscript(identity string, result RecognizeResult) {
+	if r == nil || result.Error != nil {
+		return
+	}
+
+	transcript := &replayTranscript{
+		Text:       result.Text,
+		IsFinal:    result.IsFinal,
+		Stability:  result.Stability,
+		Confidence: result.Confidence,
+	}
+	for _, w := range result.Words {
+		transcript.Words = append(transcript.Words, replayWord{
+			Word:  w.Word,
+			Start: w.Start.Sub(r.started),
+			End:   w.End.Sub(r.started),
+		})
+	}
+	if result.Language != nil {
+		transcript.Language = result.Language.Code
+	}
+
+	r.write(&replayEntry{
+		Type:       replayEntry_Transcript,
+		Offset:     time.Since(r.started),
+		Identity:   identity,
+		Transcript: transcript,
+	})
+}
+
+// The entry is written by finishCompletion, nil when the sessions aren't recorded
+func (r *sessionRecorder) startCompletion(kind, model string) *replayEntry {
+	if r == nil {
+		return nil
+	}
+
+	r.lock.Lock()
+	r.seq++
+	seq := r.seq
+	r.lock.Unlock()
+
+	return &replayEntry{
+		Type:   kind,
+		Offset: time.Since(r.started),
+		Seq:    seq,
+		Model:  model,
+	}
+}
+
+func (r *sessionRecorder) finishCompletion(entry *replayEntry, err error) {
+	if entry == nil {
+		return
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	r.write(entry)
+}
+
+func (r *sessionRecorder) Close() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return
+	}
+	r.closed = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+	if err := r.store.Put(ctx, r.key, r.buf.Bytes(), "application/jsonl"); err != nil {
+		logger.Errorw("failed to store the session recording", err, "key", r.key)
+	}
+	r.buf.Reset()
+}
+
+// Records the outputs of the LLM, or answers with the ones of a recording during a replay
+type sessionLLM struct {
+	LLMClient
+	seed     *int
+	recorder *sessionRecorder
+
+	replay atomic.Pointer[llmReplay] // nil when no replay is running
+}
+
+func newSessionLLM(llm LLMClient, conf config.ReplayConfig, recorder *sessionRecorder) *sessionLLM {
+	return &sessionLLM{
+		LLMClient: llm,
+		seed:      conf.Seed,
+		recorder:  recorder,
+	}
+}
+
+func (l *sessionLLM) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	if replay := l.replay.Load(); replay != nil {
+		return replay.completion(req.Model)
+	}
+
+	if req.Seed == nil {
+		req.Seed = l.seed
+	}
+	entry := l.recorder.startCompletion(replayEntry_Completion, req.Model)
+	resp, err := l.LLMClient.CreateChatCompletion(ctx, req)
+	if entry != nil && err == nil {
+		recorded := resp
+		entry.Completion = &recorded
+	}
+	l.recorder.finishCompletion(entry, err)
+	return resp, err
+}
+
+func (l *sessionLLM) CreateChatCompletionStream(ctx context.Context, req openai.ChatCompletionRequest) (LLMStream, error) {
+	if replay := l.replay.Load(); replay != nil {
+		return replay.stream(req.Model)
+	}
+
+	if req.Seed == nil {
+		req.Seed = l.seed
+	}
+	entry := l.recorder.startCompletion(replayEntry_Stream, req.Model)
+	stream, err := l.LLMClient.CreateChatCompletionStream(ctx, req)
+	if err != nil || entry == nil {
+		l.recorder.finishCompletion(entry, err)
+		return stream, err
+	}
+	return &recordingStream{LLMStream: stream, recorder: l.recorder, entry: entry}, nil
+}
+
+// The chunks received until the end of the stream or its closing are recorded
+type recordingStream struct {
+	LLMStream
+	recorder *sessionRecorder
+
+	lock     sync.Mutex
+	entry    *replayEntry
+	finished bool
+}
+
+func (s *recordingStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	resp, err := s.LLMStream.Recv()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err == nil {
+		if !s.finished {
+			s.entry.Chunks = append(s.entry.Chunks, resp)
+		}
+	} else {
+		if !errors.Is(err, io.EOF) {
+			s.entry.StreamError = err.Error()
+		}
+		s.finish()
+	}
+	return resp, err
+}
+
+func (s *recordingStream) Close() error {
+	s.lock.Lock()
+	s.finish()
+	s.lock.Unlock()
+	return s.LLMStream.Close()
+}
+
+func (s *recordingStream) finish() {
+	if !s.finished {
+		s.finished = true
+		s.recorder.finishCompletion(s.entry, nil)
+	}
+}
+
+// Recorded outputs of the LLM, served in the order of the requests of each model.
+// A request without a recorded output fails, the session diverged from the recording
+type llmReplay struct {
+	lock    sync.Mutex
+	entries map[string][]*replayEntry // type/model -> entries
+}
+
+func newLLMReplay(entries []*replayEntry) *llmReplay {
+	r := &llmReplay{entries: make(map[string][]*replayEntry)}
+	for _, entry := range entries {
+		if entry.Type == replayEntry_Completion || entry.Type == replayEntry_Stream {
+			key := entry.Type + "/" + entry.Model
+			r.entries[key] = append(r.entries[key], entry)
+		}
+	}
+	for _, queue := range r.entries {
+		sort.SliceStable(queue, func(i, j int) bool {
+			return queue[i].Seq < queue[j].Seq
+		})
+	}
+	return r
+}
+
+func (r *llmReplay) next(kind, model string) (*replayEntry, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	key := kind + "/" + model
+	queue := r.entries[key]
+	if len(queue) == 0 {
+		logger.Warnw("the replay diverged from the recording", errReplayExhausted, "type", kind, "model", model)
+		return nil, errReplayExhausted
+	}
+	r.entries[key] = queue[1:]
+
+	entry := queue[0]
+	if entry.Error != "" {
+		return nil, errors.New(entry.Error)
+	}
+	return entry, nil
+}
+
+func (r *llmReplay) completion(model string) (openai.ChatCompletionResponse, error) {
+	entry, err := r.next(replayEntry_Completion, model)
+	if err != nil {
+		return openai.ChatCompletionResponse{}, err
+	}
+	if entry.Completion == nil {
+		return openai.ChatCompletionResponse{}, nil
+	}
+	return *entry.Completion, nil
+}
+
+func (r *llmReplay) stream(model string) (LLMStream, error) {
+	entry, err := r.next(replayEntry_Stream, model)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := &replayStream{chunks: entry.Chunks, err: io.EOF}
+	if entry.StreamError != "" {
+		stream.err = errors.New(entry.StreamError)
+	}
+	return stream, nil
+}
+
+type replayStream struct {
+	chunks []openai.ChatCompletionStreamResponse
+	err    error // Once the chunks are received
+}
+
+func (s *replayStream) Recv() (openai.ChatCompletionStreamResponse, error) {
+	if len(s.chunks) == 0 {
+		return openai.ChatCompletionStreamResponse{}, s.err
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *replayStream) Close() error {
+	return nil
+}
+
+func parseRecording(reader io.Reader) ([]*replayEntry, error) {
+	var entries []*replayEntry
+	transcripts := 0
+	decoder := json.NewDecoder(reader)
+	for {
+		entry := &replayEntry{}
+		if err := decoder.Decode(entry); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("invalid recording: %w", err)
+		}
+
+		if entry.Type == replayEntry_Transcript {
+			if entry.Transcript == nil {
+				return nil, errors.New("invalid recording: transcript entry without a transcript")
+			}
+			transcripts++
+		}
+		entries = append(entries, entry)
+	}
+
+	if transcripts == 0 {
+		return nil, errors.New("the recording has no transcript")
+	}
+	return entries, nil
+}
+
+// The live transcripts are ignored and the LLM answers with the recorded outputs until the replay is over
+func (p *GPTParticipant) StartReplay(entries []*replayEntry) error {
+	p.lock.Lock()
+	if p.stopReplay != nil {
+		p.lock.Unlock()
+		return errReplayRunning
+	}
+	ctx, cancel := context.WithCancel(p.ctx)
+	p.stopReplay = cancel
+	p.lock.Unlock()
+
+	logger.Infow("replaying a session", "room", p.room.Name(), "entries", len(entries))
+	p.llm.replay.Store(newLLMReplay(entries))
+	p.replaying.Store(true)
+	go p.replay(ctx, entries)
+	return nil
+}
+
+// Returns false when no replay is running
+func (p *GPTParticipant) StopReplay() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if p.stopReplay == nil {
+		return false
+	}
+	p.stopReplay()
+	return true
+}
+
+func (p *GPTParticipant) replay(ctx context.Context, entries []*replayEntry) {
+	defer func() {
+		p.replaying.Store(false)
+		p.llm.replay.Store(nil)
+
+		p.lock.Lock()
+		p.stopReplay()
+		p.stopReplay = nil
+		p.lock.Unlock()
+		logger.Infow("replay finished", "room", p.room.Name())
+	}()
+
+	var transcripts []*replayEntry
+	var end time.Duration
+	for _, entry := range entries {
+		if entry.Offset > end {
+			end = entry.Offset
+		}
+		if entry.Type == replayEntry_Transcript {
+			transcripts = append(transcripts, entry)
+		}
+	}
+
+	// The replay starts shortly before the first transcript
+	skip := transcripts[0].Offset - replayLead
+	if skip < 0 {
+		skip = 0
+	}
+	start := time.Now().Add(-skip) // Start of the recording on the timeline of the replay
+
+	speakers := make(map[string]*lksdk.RemoteParticipant) // Recorded identity -> participant of the room
+	for _, entry := range transcripts {
+		select {
+		case <-time.After(time.Until(start.Add(entry.Offset))):
+		case <-ctx.Done():
+			return
+		}
+
+		rp, transcriber := p.replaySpeaker(entry.Identity, speakers)
+		if rp == nil {
+			logger.Warnw("no participant to replay the transcript", nil, "room", p.room.Name(), "identity", entry.Identity)
+			continue
+		}
+		p.onTranscriptionReceived(entry.Transcript.result(start), rp, transcriber)
+	}
+
+	select {
+	case <-time.After(time.Until(start.Add(end + replayGrace))):
+	case <-ctx.Done():
+	}
+}
+
+// The participant with the recorded identity, otherwise another one with a microphone: the speakers missing from the
+// room are mapped on the participants not mapped yet (in the order of their identities), then on the first one
+func (p *GPTParticipant) replaySpeaker(identity string, speakers map[string]*lksdk.RemoteParticipant) (*lksdk.RemoteParticipant, *Transcriber) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if rp, ok := speakers[identity]; ok {
+		return rp, p.transcribers[rp.SID()]
+	}
+
+	var candidates []*lksdk.RemoteParticipant
+	for _, rp := range p.room.GetParticipants() {
+		if p.transcribers[rp.SID()] == nil {
+			continue
+		}
+		if rp.Identity() == identity {
+			speakers[identity] = rp
+			return rp, p.transcribers[rp.SID()]
+		}
+		candidates = append(candidates, rp)
+	}
+	if len(candidates) == 0 {
+		return nil, nil
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Identity() < candidates[j].Identity()
+	})
+
+	rp := candidates[0]
+	for _, candidate := range candidates {
+		if !isReplaySpeaker(speakers, candidate) {
+			rp = candidate
+			break
+		}
+	}
+	speakers[identity] = rp
+	logger.Infow("replaying a speaker as another participant", "room", p.room.Name(), "identity", identity, "participant", rp.Identity())
+	return rp, p.transcribers[rp.SID()]
+}
+
+func isReplaySpeaker(speakers map[string]*lksdk.RemoteParticipant, rp *lksdk.RemoteParticipant) bool {
+	for _, speaker := range speakers {
+		if speaker == rp {
+			return true
+		}
+	}
+	return false
+}
+
+// POST /rooms/{room}/replay replays the recording in the body, DELETE stops the replay
+func (s *LiveGPT) roomReplayHandler(w http.ResponseWriter, req *http.Request, p *GPTParticipant) {
+	switch req.Method {
+	case http.MethodPost:
+		entries, err := parseRecording(io.LimitReader(req.Body, maxReplayBody))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		if err := p.StartReplay(entries); err != nil {
+			w.WriteHeader(http.StatusConflict)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+		s.audit(req, "replay_started", p.room.Name(), fmt.Sprintf("%d entries", len(entries)))
+		w.WriteHeader(http.StatusAccepted)
+	case http.MethodDelete:
+		if !p.StopReplay() {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.audit(req, "replay_stopped", p.room.Name(), "")
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
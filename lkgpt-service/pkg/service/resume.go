@@ -0,0 +1,151 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+	lksdk "github.com/livekit/server-sdk-go"
+	"golang.org/x/exp/slices"
+)
+
+const (
+	ResumePolicy_Off  = "off"  // Drop the rest of the answer
+	ResumePolicy_Ask  = "ask"  // Ask the participant if KITT should continue
+	ResumePolicy_Auto = "auto" // Continue once the failure is recovered
+
+	resumeDelay = 2 * time.Second
+)
+
+var (
+	AffirmativeWords = []string{"yes", "yeah", "yep", "sure", "continue", "go", "ok", "okay", "please",
+		"oui", "ja", "sí", "si"}
+
+	ResumeQuestion = "Sorry, I was cut off. Shall I continue?"
+	ContinuePrompt = "You were interrupted by a technical issue, continue your previous answer where you stopped without repeating it."
+
+	InterruptedAnswerPrompt = "Your previous answer was cut off, the participants only heard the part above."
+)
+
+// Answer that couldn't be played entirely (TTS failure, OpenAI connection lost, ...)
+type interruptedAnswer struct {
+	participantSid string
+	events         []*MeetingEvent
+	prompt         *SpeechEvent
+	language       *Language
+
+	spoken    []string
+	unspoken  []string // Synthesized/queued unsuccessfully, in order
+	truncated bool     // The completion stream failed, the end of the answer is missing
+}
+
+func (p *GPTParticipant) setInterruptedAnswer(interrupted *interruptedAnswer) {
+	if p.conf.Resume.Policy == ResumePolicy_Off {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.interrupted = interrupted
+}
+
+// Returns the interrupted answer of rp if any, it is removed either way
+func (p *GPTParticipant) takeInterruptedAnswer(rp *lksdk.RemoteParticipant) *interruptedAnswer {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	interrupted := p.interrupted
+	p.interrupted = nil
+	if interrupted == nil || interrupted.participantSid != rp.SID() {
+		return nil
+	}
+	return interrupted
+}
+
+// Called after an answer, the caller must hold isBusy
+func (p *GPTParticipant) handleInterruption(rp *lksdk.RemoteParticipant) {
+	p.lock.Lock()
+	interrupted := p.interrupted
+	p.lock.Unlock()
+	if interrupted == nil || interrupted.participantSid != rp.SID() {
+		return
+	}
+
+	switch p.conf.Resume.Policy {
+	case ResumePolicy_Auto:
+		select {
+		case <-time.After(resumeDelay):
+		case <-p.ctx.Done():
+			return
+		}
+
+		if interrupted = p.takeInterruptedAnswer(rp); interrupted != nil {
+			p.resume(interrupted, rp)
+		}
+	default:
+		if err := p.say(ResumeQuestion, interrupted.language); err != nil {
+			logger.Errorw("failed to ask to resume the answer", err, "participant", rp.SID())
+			return
+		}
+		p.activateParticipant(rp) // Answer directly to the next sentence
+	}
+}
+
+// Play the sentences that failed and request the end of the answer if it is missing
+// The caller must hold isBusy
+func (p *GPTParticipant) resume(interrupted *interruptedAnswer, rp *lksdk.RemoteParticipant) {
+	logger.Debugw("resuming the interrupted answer", "participant", rp.SID(), "unspoken", len(interrupted.unspoken), "truncated", interrupted.truncated)
+
+	spoken := interrupted.spoken
+	if len(interrupted.unspoken) > 0 {
+		text := strings.Join(interrupted.unspoken, " ")
+		if err := p.say(text, interrupted.language); err != nil {
+			logger.Errorw("failed to resume the answer", err, "participant", rp.SID())
+			p.publishError("Sorry, an error occured while synthesizing voice data", err)
+			return
+		}
+		spoken = append(spoken, interrupted.unspoken...)
+	}
+
+	answer := strings.Join(spoken, " ")
+	interruptedAgain := false
+	if interrupted.truncated {
+		events := append(interrupted.events,
+			&MeetingEvent{Speech: interrupted.prompt},
+			&MeetingEvent{Speech: botSpeech(answer, false)},
+		)
+		prompt := &SpeechEvent{
+			ParticipantName: rp.Identity(),
+			Text:            ContinuePrompt,
+		}
+
+		p.setState(state_Loading)
+		end, err := p.answer(nil, events, prompt, rp, interrupted.language)
+		if err != nil {
+			logger.Errorw("failed to resume the answer", err, "participant", rp.SID())
+			p.setState(state_Idle)
+			return
+		}
+		answer += " " + end.Text
+		interruptedAgain = end.Interrupted
+	}
+	p.setState(state_Idle)
+
+	p.history.Append(&MeetingEvent{
+		Speech: botSpeech(answer, interruptedAgain),
+	})
+}
+
+func isAffirmative(text string) bool {
+	words := normalizeWords(text)
+	if len(words) == 0 || len(words) > ActivationWordsLen+3 {
+		return false // Long sentences are new questions
+	}
+
+	for _, word := range words {
+		if slices.Contains(AffirmativeWords, word) {
+			return true
+		}
+	}
+	return false
+}
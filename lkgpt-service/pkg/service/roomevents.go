@@ -0,0 +1,126 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+)
+
+const (
+	sseBufferSize        = 64
+	sseKeepAliveInterval = 15 * time.Second
+)
+
+// sseSink buffers the events of a room for one Server-Sent Events consumer
+// Events are dropped when the consumer is too slow, the bus must never block
+type sseSink struct {
+	events chan *RoomEvent
+}
+
+func (s *sseSink) HandleEvent(event *RoomEvent) {
+	select {
+	case s.events <- event:
+	default:
+		logger.Warnw("dropping room event, the consumer is too slow", nil, "room", event.Room, "type", event.Type.String())
+	}
+}
+
+// /rooms/{room}/{resource}
+// Requires a LiveKit access token with the roomAdmin grant for this room (Authorization header or access_token query param)
+func (s *LiveGPT) roomsHandler(w http.ResponseWriter, req *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(req.URL.Path, "/rooms/"), "/"), "/")
+	if len(parts) != 2 || parts[0] == "" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	roomName := parts[0]
+	if err := s.authenticateRoomAdmin(req, roomName); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	p := s.participantByRoomName(roomName)
+	if p == nil {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte("the gpt participant isn't connected to this room"))
+		return
+	}
+
+	switch parts[1] {
+	case "events":
+		s.roomEventsHandler(w, req, p)
+	case "calendar":
+		s.roomCalendarHandler(w, req, p)
+	case "notes":
+		s.roomNotesHandler(w, req, p)
+	case "agenda":
+		s.roomAgendaHandler(w, req, p)
+	case "stats":
+		s.roomStatsHandler(w, req, p)
+	case "replay":
+		s.roomReplayHandler(w, req, p)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// GET /rooms/{room}/events
+// Streams the events of a room using Server-Sent Events.
+func (s *LiveGPT) roomEventsHandler(w http.ResponseWriter, req *http.Request, p *GPTParticipant) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sink := &sseSink{
+		events: make(chan *RoomEvent, sseBufferSize),
+	}
+	unsubscribe := p.Events().Subscribe(sink)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-p.ctx.Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case event := <-sink.events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				logger.Errorw("failed to marshal room event", err)
+				continue
+			}
+
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type.String(), data); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
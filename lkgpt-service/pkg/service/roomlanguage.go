@@ -0,0 +1,85 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+)
+
+// The first final transcripts of the room vote for its language, weighted by their number of words.
+// The majority replaces DefaultLanguage for the participants without a language and for the greeting
+
+// Language of the room, DefaultLanguage until it is detected
+func (p *GPTParticipant) defaultLanguage() *Language {
+	if language := p.roomLanguage.Load(); language != nil {
+		return language
+	}
+	return DefaultLanguage
+}
+
+func (p *GPTParticipant) voteLanguage(result RecognizeResult, transcriber *Transcriber) {
+	if !p.conf.Transcription.LanguageDetection.Enabled || p.roomLanguage.Load() != nil {
+		return
+	}
+
+	language := result.Language
+	if language == nil {
+		language = transcriber.Language()
+	}
+	words := len(strings.Fields(result.Text))
+	if words == 0 {
+		return
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.roomLanguage.Load() != nil {
+		return
+	}
+
+	p.langVotes[language.Code] += words
+	total := 0
+	var majority string
+	for code, votes := range p.langVotes {
+		total += votes
+		if majority == "" || votes > p.langVotes[majority] || (votes == p.langVotes[majority] && code < majority) {
+			majority = code
+		}
+	}
+	if total < p.conf.Transcription.LanguageDetection.MinWords {
+		return
+	}
+
+	logger.Infow("room language detected", "room", p.room.Name(), "language", majority, "votes", p.langVotes)
+	p.roomLanguage.Store(Languages[majority])
+	close(p.langDetected)
+}
+
+// Languages of LanguageDetectionConfig.Candidates, the unknown codes are ignored
+func (p *GPTParticipant) candidateLanguages() []*Language {
+	var candidates []*Language
+	for _, code := range p.conf.Transcription.LanguageDetection.Candidates {
+		language := findLanguage(code)
+		if language == nil {
+			logger.Warnw("unknown candidate language", nil, "language", code)
+			continue
+		}
+		candidates = append(candidates, language)
+	}
+	return candidates
+}
+
+// Wait until the language of the room is detected, at most timeout
+func (p *GPTParticipant) waitRoomLanguage(timeout time.Duration) {
+	if !p.conf.Transcription.LanguageDetection.Enabled {
+		return
+	}
+
+	select {
+	case <-p.langDetected:
+	case <-time.After(timeout):
+	case <-p.ctx.Done():
+	}
+}
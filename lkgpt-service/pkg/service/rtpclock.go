@@ -0,0 +1,71 @@
+package service
+
+import (
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	maxTimestampGap      = 2 * time.Second       // Longer gaps are discontinuities (mute/unmute, SSRC change, clock jump)
+	defaultFrameDuration = 20 * time.Millisecond // Opus frame duration used before any delta is known
+)
+
+// rtpClock rewrites the RTP timestamps of a track into a continuous timeline.
+// The oggwriter derives the granule positions from the timestamp deltas: a timestamp going backwards
+// wraps the uint32 delta into a huge granule, and a long gap leaves a hole in the ogg stream
+type rtpClock struct {
+	maxGap uint32
+
+	started   bool
+	ssrc      uint32
+	seq       uint16 // Last sequence number received
+	last      uint32 // Last timestamp received
+	out       uint32 // Last timestamp written
+	frameSize uint32 // Last delta between two consecutive packets, used to step over the discontinuities
+}
+
+func newRTPClock(clockRate uint32) *rtpClock {
+	return &rtpClock{
+		maxGap:    uint32(uint64(clockRate) * uint64(maxTimestampGap) / uint64(time.Second)),
+		frameSize: uint32(uint64(clockRate) * uint64(defaultFrameDuration) / uint64(time.Second)),
+	}
+}
+
+// Returns the timestamp to write, false when the packet must be dropped (duplicated or reordered)
+func (c *rtpClock) next(pkt *rtp.Packet) (uint32, bool) {
+	if !c.started {
+		c.started = true
+		c.ssrc = pkt.SSRC
+		c.seq = pkt.SequenceNumber
+		c.last = pkt.Timestamp
+		c.out = pkt.Timestamp
+		return c.out, true
+	}
+
+	if pkt.SSRC != c.ssrc {
+		// New source, its timestamps are unrelated to the previous ones
+		c.ssrc = pkt.SSRC
+		c.seq = pkt.SequenceNumber
+		c.last = pkt.Timestamp
+		c.out += c.frameSize
+		return c.out, true
+	}
+
+	delta := int32(pkt.Timestamp - c.last) // Handles the wraparound
+	switch {
+	case delta <= 0:
+		return 0, false
+	case uint32(delta) > c.maxGap:
+		// The audio of the gap was never sent, continue right after the previous packet
+		c.out += c.frameSize
+	default:
+		c.out += uint32(delta) // Short gaps (packet loss, DTX) keep their duration
+		if pkt.SequenceNumber == c.seq+1 {
+			c.frameSize = uint32(delta)
+		}
+	}
+	c.seq = pkt.SequenceNumber
+	c.last = pkt.Timestamp
+	return c.out, true
+}
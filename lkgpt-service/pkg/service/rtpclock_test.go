@@ -0,0 +1,218 @@
+package service
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+const testClockRate = 48000
+
+// Captures of pkg/utils/testdata, see gen.go
+func readRTPFixture(t *testing.T, name string) []*rtp.Packet {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("..", "utils", "testdata", name+".rtp"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var packets []*rtp.Packet
+	for len(data) >= 2 {
+		size := int(binary.BigEndian.Uint16(data))
+		pkt := &rtp.Packet{}
+		if err := pkt.Unmarshal(data[2 : 2+size]); err != nil {
+			t.Fatal(err)
+		}
+		packets = append(packets, pkt)
+		data = data[2+size:]
+	}
+	return packets
+}
+
+func fixtureGranule(t *testing.T, name string) uint64 {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join("..", "utils", "testdata", "fixtures.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var fixtures []struct {
+		Name    string `json:"name"`
+		Granule uint64 `json:"granule"`
+	}
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range fixtures {
+		if f.Name == name {
+			return f.Granule
+		}
+	}
+	t.Fatalf("unknown fixture %s", name)
+	return 0
+}
+
+func rtpPacket(ssrc uint32, seq uint16, timestamp uint32) *rtp.Packet {
+	return &rtp.Packet{Header: rtp.Header{SSRC: ssrc, SequenceNumber: seq, Timestamp: timestamp}}
+}
+
+// The packet loss and the DTX gaps are shorter than maxTimestampGap, they keep their duration
+func TestRTPClockFixtures(t *testing.T) {
+	for _, name := range []string{"mono_celt_20ms_loss", "mono_silk_dtx"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			packets := readRTPFixture(t, name)
+			clock := newRTPClock(testClockRate)
+
+			first := packets[0].Timestamp
+			var out uint32
+			for i, pkt := range packets {
+				ts, ok := clock.next(pkt)
+				if !ok {
+					t.Fatalf("packet %d dropped", i)
+				}
+				if want := pkt.Timestamp; ts != want {
+					t.Fatalf("packet %d: timestamp %d, want %d", i, ts, want)
+				}
+				out = ts
+			}
+
+			// The oggwriter starts the granule positions at 1
+			if granule := uint64(out-first) + 1; granule != fixtureGranule(t, name) {
+				t.Errorf("granule: got %d, want %d", granule, fixtureGranule(t, name))
+			}
+		})
+	}
+}
+
+func TestRTPClock(t *testing.T) {
+	const ssrc = 1
+	var start uint32 = math.MaxUint32 - 960*2 + 1 // Wraps after two packets
+
+	tests := []struct {
+		name    string
+		packets []*rtp.Packet
+		want    []int64 // Written timestamps relative to the first packet, -1 when dropped
+	}{
+		{
+			name: "wraparound",
+			packets: []*rtp.Packet{
+				rtpPacket(ssrc, 65534, start),
+				rtpPacket(ssrc, 65535, start+960),
+				rtpPacket(ssrc, 0, start+960*2),
+				rtpPacket(ssrc, 1, start+960*3),
+			},
+			want: []int64{0, 960, 960 * 2, 960 * 3},
+		},
+		{
+			name: "reordered and duplicated",
+			packets: []*rtp.Packet{
+				rtpPacket(ssrc, 1, 1000),
+				rtpPacket(ssrc, 3, 1000+960*2),
+				rtpPacket(ssrc, 2, 1000+960), // Late, the ogg stream can't go back
+				rtpPacket(ssrc, 3, 1000+960*2),
+				rtpPacket(ssrc, 4, 1000+960*3),
+			},
+			want: []int64{0, 960 * 2, -1, -1, 960 * 3},
+		},
+		{
+			name: "reordered across the wraparound",
+			packets: []*rtp.Packet{
+				rtpPacket(ssrc, 1, start),
+				rtpPacket(ssrc, 3, start+960*2),
+				rtpPacket(ssrc, 2, start+960),
+			},
+			want: []int64{0, 960 * 2, -1},
+		},
+		{
+			name: "ssrc change",
+			packets: []*rtp.Packet{
+				rtpPacket(ssrc, 1, 1000),
+				rtpPacket(ssrc, 2, 1000+480),
+				rtpPacket(2, 9000, 5), // Unrelated timestamps, continues one frame after
+				rtpPacket(2, 9001, 5+480),
+			},
+			want: []int64{0, 480, 480 * 2, 480 * 3},
+		},
+		{
+			name: "gap over 2s",
+			packets: []*rtp.Packet{
+				rtpPacket(ssrc, 1, 1000),
+				rtpPacket(ssrc, 2, 1000+960),
+				rtpPacket(ssrc, 3, 1000+960+testClockRate*3), // Unmuted after 3s, collapsed to one frame
+				rtpPacket(ssrc, 4, 1000+960*2+testClockRate*3),
+			},
+			want: []int64{0, 960, 960 * 2, 960 * 3},
+		},
+		{
+			name: "gap over 2s before any delta",
+			packets: []*rtp.Packet{
+				rtpPacket(ssrc, 1, 1000),
+				rtpPacket(ssrc, 2, 1000+testClockRate*5),
+			},
+			want: []int64{0, 960}, // defaultFrameDuration
+		},
+		{
+			name: "gap of 2s",
+			packets: []*rtp.Packet{
+				rtpPacket(ssrc, 1, 1000),
+				rtpPacket(ssrc, 2, 1000+testClockRate*2),
+			},
+			want: []int64{0, testClockRate * 2},
+		},
+		{
+			name: "dtx",
+			packets: []*rtp.Packet{
+				rtpPacket(ssrc, 1, 1000),
+				rtpPacket(ssrc, 2, 1000+960),
+				rtpPacket(ssrc, 3, 1000+960*21), // 400ms of silence not sent
+				rtpPacket(ssrc, 4, 1000+960*22),
+			},
+			want: []int64{0, 960, 960 * 21, 960 * 22},
+		},
+		{
+			name: "frame size learned from consecutive packets only",
+			packets: []*rtp.Packet{
+				rtpPacket(ssrc, 1, 1000),
+				rtpPacket(ssrc, 2, 1000+480),
+				rtpPacket(ssrc, 4, 1000+480*3),                  // Lost packet, not a frame size
+				rtpPacket(ssrc, 5, 1000+480*3+testClockRate*10), // Collapsed to the last frame size
+			},
+			want: []int64{0, 480, 480 * 3, 480 * 4},
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newRTPClock(testClockRate)
+			var first uint32
+			for i, pkt := range tt.packets {
+				ts, ok := clock.next(pkt)
+				if i == 0 {
+					first = ts
+				}
+
+				if tt.want[i] < 0 {
+					if ok {
+						t.Fatalf("packet %d: written at %d, want dropped", i, ts-first)
+					}
+					continue
+				}
+				if !ok {
+					t.Fatalf("packet %d dropped", i)
+				}
+				if got := int64(ts - first); got != tt.want[i] {
+					t.Fatalf("packet %d: written at %d, want %d", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// The scratchpad is the working memory of the LLM in a room (agenda progress, decisions, open questions...).
+// It is written with the store_note tool, added to the system prompt so it survives the truncation
+// of the history, and given to the summary at the end of the meeting
+
+type ScratchpadNote struct {
+	Key     string    `json:"key"`
+	Value   string    `json:"value"`
+	Author  string    `json:"author"` // Speaker of the question that led to the note
+	Updated time.Time `json:"updated"`
+}
+
+type scratchpad struct {
+	lock  sync.Mutex
+	notes []*ScratchpadNote // Oldest first
+}
+
+// Set the note, an empty value deletes it. Returns false when the scratchpad is full
+func (s *scratchpad) set(key, value, author string, maxNotes int) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, note := range s.notes {
+		if !strings.EqualFold(note.Key, key) {
+			continue
+		}
+		if value == "" {
+			s.notes = append(s.notes[:i], s.notes[i+1:]...)
+			return true
+		}
+		s.notes = append(append(s.notes[:i], s.notes[i+1:]...), &ScratchpadNote{
+			Key:     note.Key,
+			Value:   value,
+			Author:  author,
+			Updated: time.Now(),
+		})
+		return true
+	}
+
+	if value == "" {
+		return true
+	}
+	if maxNotes > 0 && len(s.notes) >= maxNotes {
+		return false
+	}
+	s.notes = append(s.notes, &ScratchpadNote{
+		Key:     key,
+		Value:   value,
+		Author:  author,
+		Updated: time.Now(),
+	})
+	return true
+}
+
+func (s *scratchpad) get(key string) *ScratchpadNote {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, note := range s.notes {
+		if strings.EqualFold(note.Key, key) {
+			n := *note
+			return &n
+		}
+	}
+	return nil
+}
+
+func (s *scratchpad) all() []*ScratchpadNote {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	notes := make([]*ScratchpadNote, 0, len(s.notes))
+	for _, note := range s.notes {
+		n := *note
+		notes = append(notes, &n)
+	}
+	return notes
+}
+
+func formatScratchpad(notes []*ScratchpadNote) string {
+	var sb strings.Builder
+	for _, note := range notes {
+		sb.WriteString(fmt.Sprintf("- %s: %s\n", note.Key, note.Value))
+	}
+	return sb.String()
+}
+
+type storeNoteTool struct {
+	conf config.ScratchpadConfig
+}
+
+func (t *storeNoteTool) Definition() *openai.FunctionDefinition {
+	return &openai.FunctionDefinition{
+		Name: "store_note",
+		Description: "Write a note in your scratchpad for this meeting, e.g the progress of the agenda, a decision or an open question. " +
+			"The notes are kept for the whole meeting and used for its summary. Storing an existing key replaces its value.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"key": map[string]interface{}{
+					"type":        "string",
+					"description": "Short name of the note, e.g \"decision_pricing\" or \"agenda_progress\"",
+				},
+				"value": map[string]interface{}{
+					"type":        "string",
+					"description": "Content of the note, an empty value deletes it",
+				},
+			},
+			"required": []string{"key", "value"},
+		},
+	}
+}
+
+func (t *storeNoteTool) Call(ctx context.Context, tc *ToolContext, arguments string) (string, error) {
+	args := struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	}{}
+	if err := parseToolArguments(arguments, &args); err != nil {
+		return "", err
+	}
+
+	key := strings.TrimSpace(args.Key)
+	if key == "" {
+		return "", fmt.Errorf("the key is required")
+	}
+	value := strings.TrimSpace(args.Value)
+	if t.conf.MaxValueLength > 0 && len(value) > t.conf.MaxValueLength {
+		return "", fmt.Errorf("the value is longer than %d characters, shorten it", t.conf.MaxValueLength)
+	}
+
+	if !tc.Participant.scratchpad.set(key, value, tc.Speaker.Name(), t.conf.MaxNotes) {
+		return fmt.Sprintf("The scratchpad is full (%d notes), replace or delete a note first.", t.conf.MaxNotes), nil
+	}
+	if value == "" {
+		return fmt.Sprintf("Note %s deleted.", key), nil
+	}
+	return fmt.Sprintf("Note %s stored.", key), nil
+}
+
+type getNotesTool struct{}
+
+func (t *getNotesTool) Definition() *openai.FunctionDefinition {
+	return &openai.FunctionDefinition{
+		Name:        "get_notes",
+		Description: "Read the notes of your scratchpad for this meeting, all of them when no key is given.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"key": map[string]interface{}{
+					"type":        "string",
+					"description": "Key of the note to read",
+				},
+			},
+		},
+	}
+}
+
+func (t *getNotesTool) Call(ctx context.Context, tc *ToolContext, arguments string) (string, error) {
+	args := struct {
+		Key string `json:"key"`
+	}{}
+	if err := parseToolArguments(arguments, &args); err != nil {
+		return "", err
+	}
+
+	if key := strings.TrimSpace(args.Key); key != "" {
+		note := tc.Participant.scratchpad.get(key)
+		if note == nil {
+			return fmt.Sprintf("No note %s.", key), nil
+		}
+		return note.Value, nil
+	}
+
+	notes := tc.Participant.scratchpad.all()
+	if len(notes) == 0 {
+		return "The scratchpad is empty.", nil
+	}
+	return formatScratchpad(notes), nil
+}
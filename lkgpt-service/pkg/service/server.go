@@ -11,9 +11,12 @@ import (
 	"sync"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/urfave/negroni"
 
 	"github.com/livekit-examples/livegpt/pkg/config"
+	"github.com/livekit-examples/livegpt/pkg/store"
 	"github.com/livekit/protocol/livekit"
 
 	"github.com/livekit/protocol/auth"
@@ -35,8 +38,10 @@ type ActiveParticipant struct {
 type LiveGPT struct {
 	config      *config.Config
 	roomService *lksdk.RoomServiceClient
+	egress      *lksdk.EgressClient
 	keyProvider *auth.SimpleKeyProvider
-	gptClient   *openai.Client
+	gptClient   *openai.Client // Whisper, nil without OpenAI API key
+	llm         LLMClient
 	sttClient   *stt.Client
 	ttsClient   *tts.Client
 
@@ -46,12 +51,61 @@ type LiveGPT struct {
 
 	lock         sync.Mutex
 	participants map[string]*ActiveParticipant
+	sinks        []EventSink
+	stages       []Stage
+	tools        []Tool
+	memory       MemoryStore
+	store        BlobStore   // nil when the storage couldn't be created
+	db           store.Store // nil when the database is disabled
+	jobs         *JobRunner
+	docs         NotesDocumentProvider // nil when the notes documents are disabled
+	registry     RoomRegistry
+	metrics      *prometheus.Registry
+	load         *loadMonitor // nil when the degradation is disabled
+	joins        *joinQueue
+	usage        *usageMeter
+	health       *providerHealth // nil when the health is disabled
+	transcripts  TranscriptStore // nil when the transcripts aren't stored
+	faults       *faultInjector  // nil unless testing, see faults.go
 }
 
-func NewLiveGPT(config *config.Config, sttClient *stt.Client, ttsClient *tts.Client) *LiveGPT {
-	return &LiveGPT{
+func NewLiveGPT(config *config.Config, sttClient *stt.Client, ttsClient *tts.Client, blobStore BlobStore, db store.Store, docs NotesDocumentProvider) *LiveGPT {
+	var memory MemoryStore
+	if config.Memory.Enabled {
+		var err error
+		memory, err = NewFileMemoryStore(config.Memory.Dir)
+		if err != nil {
+			logger.Errorw("failed to create the memory store", err)
+		}
+	}
+
+	transcripts, err := NewTranscriptStore(config.Transcripts, db, blobStore)
+	if err != nil {
+		logger.Errorw("failed to create the transcript store, the transcripts won't be stored", err)
+	}
+
+	rc, err := newRedisClient(config.Redis)
+	if err != nil {
+		logger.Errorw("failed to connect to redis, the instances won't be coordinated", err)
+	}
+
+	queue, err := NewJobQueue(config.Jobs, rc)
+	if err != nil {
+		logger.Errorw("failed to create the job queue, falling back to memory", err)
+		queue = newMemoryJobQueue(config.Jobs.Retention)
+	}
+
+	s := &LiveGPT{
 		config:       config,
+		memory:       memory,
+		store:        blobStore,
+		docs:         docs,
+		db:           db,
+		transcripts:  transcripts,
+		jobs:         NewJobRunner(config.Jobs, queue),
+		registry:     NewRoomRegistry(rc),
 		roomService:  lksdk.NewRoomServiceClient(config.LiveKit.Url, config.LiveKit.ApiKey, config.LiveKit.SecretKey),
+		egress:       lksdk.NewEgressClient(config.LiveKit.Url, config.LiveKit.ApiKey, config.LiveKit.SecretKey),
 		keyProvider:  auth.NewSimpleKeyProvider(config.LiveKit.ApiKey, config.LiveKit.SecretKey),
 		doneChan:     make(chan struct{}),
 		closedChan:   make(chan struct{}),
@@ -59,20 +113,77 @@ func NewLiveGPT(config *config.Config, sttClient *stt.Client, ttsClient *tts.Cli
 		sttClient:    sttClient,
 		ttsClient:    ttsClient,
 	}
+	s.joins = newJoinQueue(config.JoinQueue, s.doneChan, s.connectRoom)
+	s.usage = newUsageMeter(config.Quota, db, func(alert *QuotaAlert) {
+		if config.Quota.AlertUrl == "" {
+			return
+		}
+		if _, err := s.jobs.Enqueue(JobType_QuotaAlert, "", alert); err != nil {
+			logger.Errorw("failed to queue the quota alert", err, "kind", alert.Kind)
+		}
+	})
+	return s
+}
+
+// Subscribe a sink to the events of every room joined after this call
+func (s *LiveGPT) AddEventSink(sink EventSink) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.sinks = append(s.sinks, sink)
+}
+
+// Add a stage to the pipeline of every room joined after this call, see pipeline.go
+func (s *LiveGPT) AddStage(stage Stage) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.stages = append(s.stages, stage)
+}
+
+// Add a tool to the LLM of every room joined after this call
+func (s *LiveGPT) AddTool(tool Tool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.tools = append(s.tools, tool)
 }
 
 func (s *LiveGPT) Start() error {
-	mux := http.NewServeMux()
-	mux.HandleFunc("/webhook", s.webhookHandler)
-	mux.HandleFunc("/join/", s.joinHandler)
-	//mux.HandleFunc("/goroutines", func(writer http.ResponseWriter, request *http.Request) {
-	//	_ = pprof.Lookup("goroutine").WriteTo(writer, 2)
-	//})
-	mux.HandleFunc("/", s.healthCheckHandler)
+	if err := SetLanguages(s.config.Languages); err != nil {
+		return fmt.Errorf("invalid languages: %w", err)
+	}
+
+	if err := validateRoomPresets(s.config.RoomSize); err != nil {
+		return fmt.Errorf("invalid room presets: %w", err)
+	}
+
+	if err := s.loadPlugins(); err != nil {
+		return err
+	}
+
+	if s.config.Load.Enabled {
+		load, err := newLoadMonitor(s.config.Load, s)
+		if err != nil {
+			logger.Errorw("failed to monitor the load, the rooms won't be degraded", err)
+		} else {
+			s.load = load
+		}
+	}
+
+	if err := s.registerMetrics(); err != nil {
+		return err
+	}
+
+	faults, err := newFaultInjector(s.config.Faults, os.Getenv(faultsEnv))
+	if err != nil {
+		return fmt.Errorf("invalid faults: %w", err)
+	}
+	s.faults = faults
 
 	n := negroni.New()
 	n.Use(negroni.NewRecovery())
-	n.UseHandler(mux)
+	n.UseHandler(s.routes())
 
 	s.httpServer = &http.Server{
 		Addr:    fmt.Sprintf(":%d", s.config.Port),
@@ -82,11 +193,16 @@ func (s *LiveGPT) Start() error {
 	if s.config.OpenAIAPIKey == "" {
 		s.config.OpenAIAPIKey = os.Getenv("OPENAI_API_KEY")
 	}
-	if s.config.OpenAIAPIKey == "" {
-		return errors.New("OpenAI API key not found. Please set OPENAI_API_KEY environment variable or set it in config.yaml")
+	if s.config.OpenAIAPIKey != "" {
+		s.gptClient = openai.NewClientWithConfig(newOpenAIClientConfig(s.config.OpenAIAPIKey, s.config.OpenAI))
 	}
 
-	s.gptClient = openai.NewClient(s.config.OpenAIAPIKey)
+	llm, err := NewLLMClient(s.config.LLM, s.config.OpenAI, s.config.OpenAIAPIKey)
+	if err != nil {
+		return err
+	}
+	s.health = newProviderHealth(s.config.Health, s.updateHealth)
+	s.llm = instrumentLLM(s.health.wrapLLM(s.faults.wrapLLM(llm)))
 
 	httpListener, err := net.Listen("tcp", s.httpServer.Addr)
 	if err != nil {
@@ -101,15 +217,40 @@ func (s *LiveGPT) Start() error {
 		}
 	}()
 
+	if s.load != nil {
+		go s.load.Run(s.doneChan)
+	}
+	go s.joins.Run()
+	go s.usage.Run(s.doneChan)
+	if s.health != nil {
+		go s.watchHealth()
+	}
+	if s.config.Reconcile.Enabled {
+		go s.reconcileRooms()
+	}
+
+	jobsCtx, stopJobs := context.WithCancel(context.Background())
+	s.registerJobHandlers()
+	s.jobs.Start(jobsCtx)
+
 	<-s.doneChan
+	stopJobs()
+	s.drain()
 
 	// Shutdown the server
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
 	defer cancel()
 	_ = s.httpServer.Shutdown(ctx)
 
-	s.sttClient.Close()
-	s.ttsClient.Close()
+	if s.sttClient != nil {
+		s.sttClient.Close()
+	}
+	if s.ttsClient != nil {
+		s.ttsClient.Close()
+	}
+	if s.db != nil {
+		_ = s.db.Close()
+	}
 
 	close(s.closedChan)
 	return nil
@@ -120,7 +261,8 @@ func (s *LiveGPT) Stop() {
 	<-s.closedChan
 }
 
-func (s *LiveGPT) joinRoom(room *livekit.Room) {
+// Queue the connection of KITT to the room, the connection is paced by the join queue
+func (s *LiveGPT) joinRoom(room *livekit.Room) error {
 	// If the GPT participant is not connected, connect it
 	s.lock.Lock()
 	if _, ok := s.participants[room.Sid]; ok {
@@ -129,7 +271,7 @@ func (s *LiveGPT) joinRoom(room *livekit.Room) {
 			"room", room.Name,
 			"participantCount", room.NumParticipants,
 		)
-		return
+		return nil
 	}
 
 	s.participants[room.Sid] = &ActiveParticipant{
@@ -137,6 +279,51 @@ func (s *LiveGPT) joinRoom(room *livekit.Room) {
 	}
 	s.lock.Unlock()
 
+	if s.config.Quota.RefuseSessions && s.usage.Exceeded() {
+		logger.Warnw("provider quota exceeded, not joining the room", nil, "room", room.Name)
+		s.lock.Lock()
+		delete(s.participants, room.Sid)
+		s.lock.Unlock()
+		return errQuotaExceeded
+	}
+
+	if !s.joins.Enqueue(room) {
+		logger.Warnw("join queue full, not joining the room", nil, "room", room.Name)
+		s.lock.Lock()
+		delete(s.participants, room.Sid)
+		s.lock.Unlock()
+		return errJoinQueueFull
+	}
+	return nil
+}
+
+// Called by the join queue, the room is already reserved in s.participants
+func (s *LiveGPT) connectRoom(room *livekit.Room, attempt int) {
+	if attempt > 1 && !s.roomExists(room.Name) {
+		// Connecting would create the room again
+		logger.Infow("room closed before joining it", "room", room.Name)
+		s.lock.Lock()
+		delete(s.participants, room.Sid)
+		s.lock.Unlock()
+		return
+	}
+
+	// Another instance can be joining the room for the same participant_joined event
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	claimed, err := s.registry.ClaimRoom(ctx, room.Sid)
+	cancel()
+	if err != nil {
+		s.joinFailed(room, attempt, fmt.Errorf("failed to claim the room: %w", err))
+		return
+	}
+	if !claimed {
+		logger.Infow("gpt participant connected by another instance", "room", room.Name)
+		s.lock.Lock()
+		delete(s.participants, room.Sid)
+		s.lock.Unlock()
+		return
+	}
+
 	token := s.roomService.CreateToken().
 		SetIdentity(BotIdentity).
 		AddGrant(&auth.VideoGrant{
@@ -146,17 +333,96 @@ func (s *LiveGPT) joinRoom(room *livekit.Room) {
 
 	jwt, err := token.ToJWT()
 	if err != nil {
-		logger.Errorw("error creating jwt", err)
+		s.releaseRoom(room.Sid)
+		s.joinFailed(room, attempt, fmt.Errorf("error creating jwt: %w", err))
 		return
 	}
 
+	bus := NewEventBus()
+	tools := NewToolSetFromConfig(s.config)
+	s.lock.Lock()
+	for _, sink := range s.sinks {
+		bus.Subscribe(sink)
+	}
+	for _, tool := range s.tools {
+		tools.Add(tool)
+	}
+	pipeline := NewPipeline(s.stages...)
+	s.lock.Unlock()
+
+	var transcripts *transcriptStoreSink
+	if s.transcripts != nil {
+		transcripts = &transcriptStoreSink{transcripts: s.transcripts, roomName: room.Name, roomSid: room.Sid}
+		bus.Subscribe(transcripts)
+	}
+
+	roomStart := time.Unix(room.CreationTime, 0)
+	if room.CreationTime == 0 {
+		roomStart = time.Now()
+	}
+
+	var captions *captionsSink
+	if s.config.Captions.Enabled && s.store != nil {
+		captions, err = newCaptionsSink(s.config.Captions, s.store, room.Name, room.Sid, roomStart)
+		if err != nil {
+			logger.Errorw("failed to create the captions archive", err, "room", room.Name)
+		} else {
+			bus.Subscribe(captions)
+		}
+	}
+
+	var recorder *sessionRecorder
+	if s.config.Replay.Record && s.store != nil {
+		recorder = newSessionRecorder(s.config.Replay, s.store, room.Name, room.Sid)
+	}
+
+	var alignment *alignmentSink
+	if s.config.Alignment.Enabled && s.store != nil {
+		alignment = newAlignmentSink(s.config.Alignment, s.store, s.egress, room.Name, room.Sid, roomStart)
+		bus.Subscribe(alignment)
+	}
+
+	var chat *chatSink
+	if s.config.Chat.Enabled {
+		chat = newChatSink(s.config.Chat, s.roomService, room.Name)
+		bus.Subscribe(chat)
+	}
+
+	var notesDoc *notesDocumentSink
+	if s.docs != nil && s.config.Mode == Mode_Notes {
+		notesDoc = newNotesDocumentSink(s.docs, s.config, s.roomService, room.Name)
+		bus.Subscribe(notesDoc)
+	}
+
 	logger.Infow("connecting gpt participant", "room", room.Name)
-	p, err := ConnectGPTParticipant(s.config.LiveKit.Url, jwt, s.sttClient, s.ttsClient, s.gptClient)
+	p, err := ConnectGPTParticipant(s.config.LiveKit.Url, jwt, &participantDeps{
+		conf:      s.config,
+		memory:    s.memory,
+		store:     s.store,
+		usage:     s.usage,
+		sttClient: s.sttClient,
+		ttsClient: s.ttsClient,
+		llm:       s.llm,
+		gptClient: s.gptClient,
+		health:    s.health,
+		faults:    s.faults,
+		bus:       bus,
+		pipeline:  pipeline,
+		tools:     tools,
+		recorder:  recorder,
+	})
 	if err != nil {
-		logger.Errorw("error connecting gpt participant", err, "room", room.Name)
-		s.lock.Lock()
-		delete(s.participants, room.Sid)
-		s.lock.Unlock()
+		if captions != nil {
+			captions.Close()
+		}
+		if chat != nil {
+			chat.Close()
+		}
+		if notesDoc != nil {
+			notesDoc.Close()
+		}
+		s.releaseRoom(room.Sid)
+		s.joinFailed(room, attempt, fmt.Errorf("error connecting gpt participant: %w", err))
 		return
 	}
 
@@ -166,15 +432,210 @@ func (s *LiveGPT) joinRoom(room *livekit.Room) {
 		Participant: p,
 	}
 	s.lock.Unlock()
+	p.setLoadLevel(s.load.Level())
+	p.updateHealth(s.health.issues())
 
+	refreshCtx, stopRefresh := context.WithCancel(context.Background())
+	go s.refreshRoom(refreshCtx, room.Sid)
+
+	p.OnFinished(s.meetingFinished)
 	p.OnDisconnected(func() {
 		logger.Infow("gpt participant disconnected", "room", room.Name)
+		if transcripts != nil {
+			transcripts.Close()
+		}
+		if captions != nil {
+			captions.Close()
+		}
+		if alignment != nil {
+			alignment.Close()
+		}
+		if recorder != nil {
+			recorder.Close()
+		}
+		if chat != nil {
+			chat.Close()
+		}
+		if notesDoc != nil {
+			notesDoc.Close()
+		}
 		s.lock.Lock()
 		delete(s.participants, room.Sid)
 		s.lock.Unlock()
+
+		stopRefresh()
+		s.releaseRoom(room.Sid)
 	})
 }
 
+// Retry the join after a backoff, the room stays reserved meanwhile
+func (s *LiveGPT) joinFailed(room *livekit.Room, attempt int, err error) {
+	conf := s.config.JoinQueue
+	if attempt < conf.MaxAttempts {
+		delay := conf.RetryBackoff << (attempt - 1)
+		logger.Warnw("failed to join the room, retrying", err, "room", room.Name, "attempt", attempt, "delay", delay)
+		s.joins.Retry(room, attempt+1, delay)
+		return
+	}
+
+	logger.Errorw("failed to join the room, giving up", err, "room", room.Name, "attempts", attempt)
+	joinFailedTotal.Inc()
+	s.lock.Lock()
+	delete(s.participants, room.Sid)
+	s.lock.Unlock()
+}
+
+func (s *LiveGPT) roomExists(roomName string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	res, err := s.roomService.ListRooms(ctx, &livekit.ListRoomsRequest{Names: []string{roomName}})
+	if err != nil {
+		return true // Let the connection fail or succeed
+	}
+	return len(res.Rooms) > 0
+}
+
+// Keep the claim of the room while KITT is in it
+func (s *LiveGPT) refreshRoom(ctx context.Context, roomSid string) {
+	ticker := time.NewTicker(roomClaimInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		refreshCtx, cancel := context.WithTimeout(ctx, storageTimeout)
+		if err := s.registry.RefreshRoom(refreshCtx, roomSid); err != nil {
+			logger.Errorw("failed to refresh the room claim", err, "room", roomSid)
+		}
+		cancel()
+	}
+}
+
+func (s *LiveGPT) releaseRoom(roomSid string) {
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+
+	if err := s.registry.ReleaseRoom(ctx, roomSid); err != nil {
+		logger.Errorw("failed to release the room", err, "room", roomSid)
+	}
+}
+
+func (s *LiveGPT) participantByRoomName(roomName string) *GPTParticipant {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, ap := range s.participants {
+		if ap.Participant != nil && ap.Participant.room.Name() == roomName {
+			return ap.Participant
+		}
+	}
+	return nil
+}
+
+// Every route of the HTTP API, see apiRoutes
+func (s *LiveGPT) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/webhook", s.webhookHandler)
+	mux.HandleFunc("/join/", s.signedOnly(s.joinHandler))
+	mux.HandleFunc("/rooms/", s.signed(s.roomsHandler))
+	mux.HandleFunc("/memory/", s.signed(s.memoryHandler))
+	mux.HandleFunc("/jobs", s.signed(s.jobsHandler))
+	mux.HandleFunc("/jobs/", s.signed(s.jobsHandler))
+	mux.HandleFunc("/languages", s.languagesHandler)
+	mux.HandleFunc("/openapi.json", s.openAPIHandler)
+	mux.Handle("/metrics", promhttp.HandlerFor(s.metrics, promhttp.HandlerOpts{}))
+	if s.faults != nil {
+		mux.HandleFunc("/faults", s.signedOnly(s.faultsHandler)) // No other authentication
+	}
+	if s.transcripts != nil {
+		mux.HandleFunc("/transcripts/", s.signed(s.transcriptsHandler))
+	}
+	//mux.HandleFunc("/goroutines", func(writer http.ResponseWriter, request *http.Request) {
+	//	_ = pprof.Lookup("goroutine").WriteTo(writer, 2)
+	//})
+	mux.HandleFunc("/", s.healthCheckHandler)
+	return mux
+}
+
+// Verify that the request contains a LiveKit access token with the roomAdmin grant for roomName
+func (s *LiveGPT) authenticateRoomAdmin(req *http.Request, roomName string) error {
+	grants, err := s.verifyToken(req)
+	if err != nil {
+		return err
+	}
+
+	if grants.Video == nil || !grants.Video.RoomAdmin || grants.Video.Room != roomName {
+		return errors.New("the token doesn't have the roomAdmin grant for this room")
+	}
+
+	return nil
+}
+
+// Access token from the Authorization header or the access_token query param
+func (s *LiveGPT) verifyToken(req *http.Request) (*auth.ClaimGrants, error) {
+	token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if token == "" {
+		token = req.URL.Query().Get("access_token")
+	}
+	if token == "" {
+		return nil, errors.New("missing access token")
+	}
+
+	verifier, err := auth.ParseAPIToken(token)
+	if err != nil {
+		return nil, err
+	}
+
+	secret := s.keyProvider.GetSecret(verifier.APIKey())
+	if secret == "" {
+		return nil, errors.New("invalid api key")
+	}
+
+	return verifier.Verify(secret)
+}
+
+// Verify that the request contains a valid LiveKit access token issued for identity
+func (s *LiveGPT) authenticateIdentity(req *http.Request, identity string) error {
+	grants, err := s.verifyToken(req)
+	if err != nil {
+		return err
+	}
+
+	if grants.Identity != identity {
+		return errors.New("the token wasn't issued for this identity")
+	}
+
+	return nil
+}
+
+// Record an action done through the HTTP API, the actor is the identity of the token if any
+func (s *LiveGPT) audit(req *http.Request, action, room, details string) {
+	if s.db == nil {
+		return
+	}
+
+	log := &store.AuditLog{
+		Time:    time.Now(),
+		Action:  action,
+		Room:    room,
+		Details: details,
+	}
+	if grants, err := s.verifyToken(req); err == nil {
+		log.Actor = grants.Identity
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+	if err := s.db.AddAuditLog(ctx, log); err != nil {
+		logger.Errorw("failed to store the audit log", err, "action", action)
+	}
+}
+
 func (s *LiveGPT) joinHandler(w http.ResponseWriter, req *http.Request) {
 	if req.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -199,7 +660,12 @@ func (s *LiveGPT) joinHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	s.joinRoom(listRes.Rooms[0])
+	s.audit(req, "join", roomName, "")
+	if err := s.joinRoom(listRes.Rooms[0]); err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(err.Error()))
+		return
+	}
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Success"))
 }
@@ -215,7 +681,22 @@ func (s *LiveGPT) webhookHandler(w http.ResponseWriter, req *http.Request) {
 		if event.Participant.Identity == BotIdentity {
 			return
 		}
-		s.joinRoom(event.Room)
+
+		if !s.autoJoinAllowed(event.Room.Name) {
+			logger.Debugw("room not allowed to be joined automatically", "room", event.Room.Name)
+			return
+		}
+
+		// With several instances behind the webhook URL, only one of them processes each event
+		claimed, err := s.registry.ClaimEvent(req.Context(), event.Id)
+		if err != nil {
+			logger.Errorw("failed to claim the webhook event", err, "event", event.Id)
+		} else if !claimed {
+			logger.Debugw("webhook event already processed", "event", event.Id)
+			return
+		}
+
+		_ = s.joinRoom(event.Room)
 	}
 }
 
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+)
+
+// Signed admin requests, the secret is the one of the LiveKit API key (like the webhooks)
+const (
+	SignatureHeader_Key       = "X-Kitt-Key"
+	SignatureHeader_Timestamp = "X-Kitt-Timestamp" // Unix seconds
+	SignatureHeader_Nonce     = "X-Kitt-Nonce"
+	SignatureHeader_Signature = "X-Kitt-Signature"
+
+	maxSignedBodySize = 1 << 20
+	maxNonceLength    = 128
+)
+
+var errUnsigned = errors.New("missing request signature")
+
+// String signed by the client
+func signaturePayload(method, uri, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return strings.Join([]string{
+		method,
+		uri,
+		timestamp,
+		nonce,
+		base64.StdEncoding.EncodeToString(bodyHash[:]),
+	}, "\n")
+}
+
+func signRequest(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Reject the admin requests with an invalid (or missing when required) signature.
+// For the routes also authenticated by an access token, the signature is optional unless admin_signature.required is set
+func (s *LiveGPT) signed(handler http.HandlerFunc) http.HandlerFunc {
+	return s.checkSignature(handler, false)
+}
+
+// For the routes without any other authentication (e.g /join), the unsigned requests are always rejected
+func (s *LiveGPT) signedOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return s.checkSignature(handler, true)
+}
+
+func (s *LiveGPT) checkSignature(handler http.HandlerFunc, required bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if err := s.verifySignature(req); err != nil {
+			if errors.Is(err, errUnsigned) && !required && !s.config.AdminSignature.Required {
+				handler(w, req)
+				return
+			}
+
+			logger.Infow("rejected admin request", "path", req.URL.Path, "reason", err.Error())
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(err.Error()))
+			return
+		}
+
+		handler(w, req)
+	}
+}
+
+// The body is read to compute its hash, then restored for the handler
+func (s *LiveGPT) verifySignature(req *http.Request) error {
+	apiKey := req.Header.Get(SignatureHeader_Key)
+	signature := req.Header.Get(SignatureHeader_Signature)
+	if apiKey == "" && signature == "" {
+		return errUnsigned
+	}
+
+	timestamp := req.Header.Get(SignatureHeader_Timestamp)
+	nonce := req.Header.Get(SignatureHeader_Nonce)
+	if apiKey == "" || signature == "" || timestamp == "" || nonce == "" {
+		return errors.New("incomplete request signature")
+	}
+	if len(nonce) > maxNonceLength {
+		return errors.New("nonce too long")
+	}
+
+	secret := s.keyProvider.GetSecret(apiKey)
+	if secret == "" {
+		return errors.New("invalid api key")
+	}
+
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp: %w", err)
+	}
+	maxSkew := s.config.AdminSignature.MaxSkew
+	if skew := time.Since(time.Unix(ts, 0)); skew > maxSkew || skew < -maxSkew {
+		return errors.New("request timestamp outside of the allowed window")
+	}
+
+	var body []byte
+	if req.Body != nil {
+		body, err = io.ReadAll(io.LimitReader(req.Body, maxSignedBodySize+1))
+		_ = req.Body.Close()
+		if err != nil {
+			return err
+		}
+		if len(body) > maxSignedBodySize {
+			return errors.New("request body too large")
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	expected := signRequest(secret, signaturePayload(req.Method, req.URL.RequestURI(), timestamp, nonce, body))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return errors.New("invalid request signature")
+	}
+
+	// The timestamp check rejects the requests older than maxSkew, the nonces only need to be kept for twice as long
+	claimed, err := s.registry.ClaimNonce(req.Context(), apiKey+":"+nonce, 2*maxSkew)
+	if err != nil {
+		return fmt.Errorf("failed to check the nonce: %w", err)
+	}
+	if !claimed {
+		return errors.New("request replayed")
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+	"github.com/livekit/protocol/auth"
+)
+
+const (
+	testApiKey    = "APIkey"
+	testApiSecret = "secret"
+)
+
+func newSignatureTestServer(required bool) *LiveGPT {
+	return &LiveGPT{
+		config: &config.Config{
+			AdminSignature: config.SignatureConfig{Required: required, MaxSkew: 5 * time.Minute},
+		},
+		keyProvider: auth.NewSimpleKeyProvider(testApiKey, testApiSecret),
+		registry:    NewRoomRegistry(nil),
+	}
+}
+
+func signedTestRequest(method, uri, nonce string, body []byte) *http.Request {
+	req := httptest.NewRequest(method, uri, bytes.NewReader(body))
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(SignatureHeader_Key, testApiKey)
+	req.Header.Set(SignatureHeader_Timestamp, timestamp)
+	req.Header.Set(SignatureHeader_Nonce, nonce)
+	req.Header.Set(SignatureHeader_Signature, signRequest(testApiSecret, signaturePayload(method, uri, timestamp, nonce, body)))
+	return req
+}
+
+func TestSignature(t *testing.T) {
+	badSignature := func() *http.Request {
+		req := signedTestRequest(http.MethodPost, "/join/daily", "bad", nil)
+		req.Header.Set(SignatureHeader_Signature, signRequest("other", "payload"))
+		return req
+	}
+	stale := func() *http.Request {
+		req := signedTestRequest(http.MethodPost, "/join/daily", "stale", nil)
+		req.Header.Set(SignatureHeader_Timestamp, strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10))
+		return req
+	}
+
+	tests := []struct {
+		name       string
+		signedOnly bool
+		required   bool
+		req        func() *http.Request
+		status     int
+	}{
+		{name: "unsigned", req: unsignedJoin, status: http.StatusOK},
+		{name: "unsigned when required", required: true, req: unsignedJoin, status: http.StatusUnauthorized},
+		{name: "unsigned on a signed only route", signedOnly: true, req: unsignedJoin, status: http.StatusUnauthorized},
+		{name: "signed on a signed only route", signedOnly: true, req: func() *http.Request {
+			return signedTestRequest(http.MethodPost, "/join/daily", "valid", nil)
+		}, status: http.StatusOK},
+		{name: "bad signature", req: badSignature, status: http.StatusUnauthorized},
+		{name: "stale timestamp", req: stale, status: http.StatusUnauthorized},
+		{name: "body changed", req: func() *http.Request {
+			req := signedTestRequest(http.MethodPut, "/faults", "body", []byte("tts:error"))
+			req.Body = http.NoBody
+			return req
+		}, status: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := newSignatureTestServer(tt.required)
+			handler := func(w http.ResponseWriter, req *http.Request) {}
+			wrapped := s.signed(handler)
+			if tt.signedOnly {
+				wrapped = s.signedOnly(handler)
+			}
+
+			w := httptest.NewRecorder()
+			wrapped(w, tt.req())
+			if w.Code != tt.status {
+				t.Fatalf("got %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func unsignedJoin() *http.Request {
+	return httptest.NewRequest(http.MethodPost, "/join/daily", nil)
+}
+
+func TestSignatureReplay(t *testing.T) {
+	s := newSignatureTestServer(true)
+	var body []byte
+	handler := s.signedOnly(func(w http.ResponseWriter, req *http.Request) {
+		body, _ = io.ReadAll(req.Body)
+	})
+
+	w := httptest.NewRecorder()
+	handler(w, signedTestRequest(http.MethodPut, "/faults", "once", []byte("tts:error")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d, want %d", w.Code, http.StatusOK)
+	}
+	if string(body) != "tts:error" {
+		t.Errorf("the body isn't restored for the handler: got %q", body)
+	}
+
+	w = httptest.NewRecorder()
+	handler(w, signedTestRequest(http.MethodPut, "/faults", "once", []byte("tts:error")))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("replayed: got %d, want %d", w.Code, http.StatusUnauthorized)
+	}
+}
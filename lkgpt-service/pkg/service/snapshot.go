@@ -0,0 +1,84 @@
+package service
+
+import (
+	"github.com/livekit/protocol/livekit"
+	"github.com/livekit/protocol/logger"
+)
+
+const snapshotLines = 20 // Lines of the transcript sent in the snapshots
+
+// State of the room sent to a participant joining mid-meeting, so their UI doesn't start blank
+type snapshotPacket struct {
+	State        gptState            `json:"state"`
+	ActiveSid    string              `json:"activeSid,omitempty"` // Participant KITT is listening or answering to
+	Speakers     []string            `json:"speakers"`            // Sids of the participants speaking
+	Transcript   []snapshotLine      `json:"transcript"`          // Last final transcripts and answers, oldest first
+	Notes        *MeetingNotes       `json:"notes,omitempty"`     // Notes mode only
+	Poll         *pollPacket         `json:"poll,omitempty"`      // Open poll
+	Health       *healthPacket       `json:"health,omitempty"`    // Only when degraded
+	Capabilities *capabilitiesPacket `json:"capabilities"`
+}
+
+type snapshotLine struct {
+	Name  string `json:"name"`
+	Text  string `json:"text"`
+	IsBot bool   `json:"isBot"`
+	Time  int64  `json:"time"` // Unix time in milliseconds
+}
+
+func (p *GPTParticipant) snapshot() *snapshotPacket {
+	snapshot := &snapshotPacket{
+		State:        gptState(p.state.Load()),
+		Speakers:     []string{},
+		Transcript:   []snapshotLine{},
+		Capabilities: p.capabilities(),
+		Health:       p.healthPacket(),
+	}
+
+	for _, speaker := range p.room.ActiveSpeakers() {
+		snapshot.Speakers = append(snapshot.Speakers, speaker.SID())
+	}
+
+	events := p.transcript.Snapshot()
+	for i := len(events) - 1; i >= 0 && len(snapshot.Transcript) < snapshotLines; i-- {
+		if speech := events[i].Speech; speech != nil {
+			snapshot.Transcript = append(snapshot.Transcript, snapshotLine{
+				Name:  speech.ParticipantName,
+				Text:  speech.Text,
+				IsBot: speech.IsBot,
+				Time:  speech.Time.UnixMilli(),
+			})
+		}
+	}
+	for i, j := 0, len(snapshot.Transcript)-1; i < j; i, j = i+1, j-1 {
+		snapshot.Transcript[i], snapshot.Transcript[j] = snapshot.Transcript[j], snapshot.Transcript[i]
+	}
+
+	if poll := p.openPoll(); poll != nil {
+		snapshot.Poll = newPollPacket(poll)
+	}
+
+	p.lock.Lock()
+	if p.activeParticipant != nil {
+		snapshot.ActiveSid = p.activeParticipant.SID()
+	}
+	snapshot.Notes = p.notes
+	p.lock.Unlock()
+
+	return snapshot
+}
+
+// Sent to the participants joining once KITT is in the room, the transcript may be large (See chunks.go)
+func (p *GPTParticipant) sendSnapshot(sid string) {
+	if p.room == nil {
+		return
+	}
+
+	pkt := &packet{
+		Type: packet_Snapshot,
+		Data: p.snapshot(),
+	}
+	if err := publishPacket(p.room.LocalParticipant, pkt, livekit.DataPacket_RELIABLE, []string{sid}); err != nil {
+		logger.Errorw("failed to send the snapshot", err, "room", p.room.Name(), "participant", sid)
+	}
+}
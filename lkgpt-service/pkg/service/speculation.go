@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"unicode"
+
+	"github.com/livekit/protocol/logger"
+	lksdk "github.com/livekit/server-sdk-go"
+	"golang.org/x/exp/slices"
+)
+
+var (
+	// Naive question detection, used to decide if an interim result is worth a speculative completion
+	QuestionWords = []string{"what", "who", "why", "how", "when", "where", "which", "can", "could",
+		"is", "are", "do", "does", "did", "will", "would", "should", "tell", "explain"}
+	QuestionMinWords = 3
+)
+
+// A ChatCompletion started on a stable interim result.
+// It is used for the answer if the final transcript doesn't differ materially, otherwise it is discarded.
+type speculation struct {
+	sid     string
+	text    string
+	nEvents int // Length of the history when the request was started
+
+	cancel context.CancelFunc
+	done   chan struct{}
+	stream *ChatStream
+	err    error
+}
+
+func newSpeculation(ctx context.Context, completion *ChatCompletion, events []*MeetingEvent, nEvents int, prompt *SpeechEvent,
+	rp *lksdk.RemoteParticipant, room *lksdk.Room, language *Language, meeting *MeetingContext, tools *ToolSet, toolCtx *ToolContext) *speculation {
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &speculation{
+		sid:     rp.SID(),
+		text:    prompt.Text,
+		nEvents: nEvents,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+
+	go func() {
+		defer close(s.done)
+		// The tools are only called when the stream is read (after take)
+		s.stream, s.err = completion.Complete(ctx, events, prompt, rp, room, language, meeting, tools, toolCtx)
+	}()
+
+	return s
+}
+
+// Returns the speculative stream if it can be used to answer the final transcript.
+// The speculation is discarded otherwise.
+func (s *speculation) take(sid, text string, nEvents int, maxDistance int) *ChatStream {
+	if s.sid != sid || s.nEvents != nEvents || wordDistance(s.text, text) > maxDistance {
+		logger.Debugw("discarding speculative completion", "speculated", s.text, "final", text)
+		s.discard()
+		return nil
+	}
+
+	<-s.done
+	if s.err != nil {
+		s.cancel()
+		return nil
+	}
+
+	logger.Debugw("using speculative completion", "text", text)
+	return s.stream
+}
+
+func (s *speculation) discard() {
+	s.cancel()
+	go func() {
+		<-s.done
+		if s.stream != nil {
+			s.stream.Close()
+		}
+	}()
+}
+
+func looksLikeQuestion(text string) bool {
+	words := normalizeWords(text)
+	if len(words) < QuestionMinWords {
+		return false
+	}
+
+	if strings.HasSuffix(strings.TrimSpace(text), "?") {
+		return true
+	}
+
+	// The question word can be preceded by the activation words (e.g "Hey Kitt, what is ...")
+	limit := len(words)
+	if limit > ActivationWordsLen+1 {
+		limit = ActivationWordsLen + 1
+	}
+
+	for _, word := range words[:limit] {
+		if slices.Contains(QuestionWords, word) {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '\''
+	})
+}
+
+// Levenshtein distance between the normalized words of a and b
+func wordDistance(a, b string) int {
+	wa, wb := normalizeWords(a), normalizeWords(b)
+
+	prev := make([]int, len(wb)+1)
+	curr := make([]int, len(wb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(wa); i++ {
+		curr[0] = i
+		for j := 1; j <= len(wb); j++ {
+			cost := 1
+			if wa[i-1] == wb[j-1] {
+				cost = 0
+			}
+
+			curr[j] = prev[j-1] + cost
+			if prev[j]+1 < curr[j] {
+				curr[j] = prev[j] + 1
+			}
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(wb)]
+}
@@ -1,33 +1,126 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode/utf8"
 
 	tts "cloud.google.com/go/texttospeech/apiv1"
 	ttspb "cloud.google.com/go/texttospeech/apiv1/texttospeechpb"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+const (
+	SynthesisProvider_Google     = "google"
+	SynthesisProvider_ElevenLabs = "elevenlabs"
+	SynthesisProvider_Azure      = "azure"
 )
 
-type Synthesizer struct {
+// Text to speech provider, the audio is returned as ogg/opus
+type SpeechSynthesizer interface {
+	Synthesize(ctx context.Context, text string, language *Language) ([]byte, error)
+	// The audio is returned while it is synthesized when the provider supports it, the reader must be closed
+	SynthesizeStream(ctx context.Context, text string, language *Language) (io.ReadCloser, error)
+	// Override the voices used for some languages (e.g per room), the other languages are kept
+	SetVoices(voices map[string]config.VoiceConfig)
+	SetUsageMeter(usage *usageMeter)
+}
+
+// ttsClient is nil when Google isn't the synthesis provider
+func NewSpeechSynthesizer(conf config.SynthesisConfig, azure config.AzureConfig, ttsClient *tts.Client) (SpeechSynthesizer, error) {
+	switch conf.Provider {
+	case SynthesisProvider_Google:
+		return NewGoogleSynthesizer(ttsClient, conf.Voices), nil
+	case SynthesisProvider_ElevenLabs:
+		return NewElevenLabsSynthesizer(conf.ElevenLabs, conf.Voices), nil
+	case SynthesisProvider_Azure:
+		return NewAzureSynthesizer(azure, conf.Voices), nil
+	default:
+		return nil, fmt.Errorf("unknown synthesis provider: %s", conf.Provider)
+	}
+}
+
+type GoogleSynthesizer struct {
 	client *tts.Client
+	usage  *usageMeter
+
+	lock   sync.Mutex
+	voices map[string]config.VoiceConfig // language code -> voice, overrides Language.SynthesizerModel
 }
 
-func NewSynthesizer(client *tts.Client) *Synthesizer {
-	return &Synthesizer{
+func NewGoogleSynthesizer(client *tts.Client, voices map[string]config.VoiceConfig) *GoogleSynthesizer {
+	s := &GoogleSynthesizer{
 		client: client,
+		voices: make(map[string]config.VoiceConfig),
+	}
+	s.SetVoices(voices)
+	return s
+}
+
+func (s *GoogleSynthesizer) SetVoices(voices map[string]config.VoiceConfig) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for code, voice := range voices {
+		s.voices[code] = voice
 	}
 }
 
-func (s *Synthesizer) Synthesize(ctx context.Context, text string, language *Language) (*ttspb.SynthesizeSpeechResponse, error) {
+func (s *GoogleSynthesizer) SetUsageMeter(usage *usageMeter) {
+	s.usage = usage
+}
+
+func (s *GoogleSynthesizer) voice(language *Language) *ttspb.VoiceSelectionParams {
+	s.lock.Lock()
+	voice, ok := s.voices[language.Code]
+	s.lock.Unlock()
+
+	params := &ttspb.VoiceSelectionParams{
+		LanguageCode: language.SynthesizerCode,
+		Name:         language.SynthesizerModel,
+	}
+	if !ok {
+		return params
+	}
+
+	if voice.Gender != "" {
+		params.SsmlGender = ssmlGender(voice.Gender)
+		if voice.Name == "" {
+			params.Name = "" // Let Google TTS pick a voice of this gender
+		}
+	}
+	if voice.Name != "" {
+		params.Name = voice.Name
+	}
+	return params
+}
+
+func ssmlGender(gender string) ttspb.SsmlVoiceGender {
+	switch strings.ToLower(gender) {
+	case "male":
+		return ttspb.SsmlVoiceGender_MALE
+	case "female":
+		return ttspb.SsmlVoiceGender_FEMALE
+	case "neutral":
+		return ttspb.SsmlVoiceGender_NEUTRAL
+	default:
+		return ttspb.SsmlVoiceGender_SSML_VOICE_GENDER_UNSPECIFIED
+	}
+}
+
+func (s *GoogleSynthesizer) Synthesize(ctx context.Context, text string, language *Language) ([]byte, error) {
 	req := &ttspb.SynthesizeSpeechRequest{
 		Input: &ttspb.SynthesisInput{
 			InputSource: &ttspb.SynthesisInput_Text{
 				Text: text,
 			},
 		},
-		Voice: &ttspb.VoiceSelectionParams{
-			LanguageCode: language.Code,
-			Name:         language.SynthesizerModel,
-		},
+		Voice: s.voice(language),
 		AudioConfig: &ttspb.AudioConfig{
 			AudioEncoding:   ttspb.AudioEncoding_OGG_OPUS,
 			SampleRateHertz: 48000,
@@ -35,5 +128,18 @@ func (s *Synthesizer) Synthesize(ctx context.Context, text string, language *Lan
 	}
 
 	resp, err := s.client.SynthesizeSpeech(ctx, req)
-	return resp, err
+	if err != nil {
+		return nil, err
+	}
+	s.usage.Add(usage_TTSCharacters, float64(utf8.RuneCountInString(text)))
+	return resp.AudioContent, nil
+}
+
+// The client version has no streaming synthesis (and Google only streams PCM), the sentence is returned at once
+func (s *GoogleSynthesizer) SynthesizeStream(ctx context.Context, text string, language *Language) (io.ReadCloser, error) {
+	audio, err := s.Synthesize(ctx, text, language)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(audio)), nil
 }
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+const (
+	TicketingProvider_Zendesk = "zendesk"
+	TicketingProvider_Jira    = "jira"
+)
+
+type Ticket struct {
+	Subject     string
+	Description string
+	Priority    string // low, normal, high, urgent
+	Requester   string // Identity of the participant
+}
+
+type TicketRef struct {
+	Id  string
+	Url string
+}
+
+type CustomerRecord struct {
+	Id    string `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email,omitempty"`
+	Phone string `json:"phone,omitempty"`
+	Notes string `json:"notes,omitempty"`
+}
+
+// Connector to a CRM/ticketing system
+type TicketingConnector interface {
+	CreateTicket(ctx context.Context, ticket *Ticket) (*TicketRef, error)
+	LookupCustomers(ctx context.Context, query string) ([]*CustomerRecord, error)
+}
+
+func NewTicketingConnector(conf config.TicketingConfig) (TicketingConnector, error) {
+	switch conf.Provider {
+	case TicketingProvider_Zendesk:
+		return &zendeskConnector{conf: conf.Zendesk}, nil
+	case TicketingProvider_Jira:
+		return &jiraConnector{conf: conf.Jira}, nil
+	default:
+		return nil, fmt.Errorf("unknown ticketing provider: %s", conf.Provider)
+	}
+}
+
+type zendeskConnector struct {
+	conf config.ZendeskConfig
+}
+
+func (z *zendeskConnector) baseUrl() string {
+	return fmt.Sprintf("https://%s.zendesk.com/api/v2", z.conf.Subdomain)
+}
+
+func (z *zendeskConnector) setAuth(req *http.Request) {
+	req.SetBasicAuth(z.conf.Email+"/token", z.conf.ApiToken)
+}
+
+func (z *zendeskConnector) CreateTicket(ctx context.Context, ticket *Ticket) (*TicketRef, error) {
+	priority := ticket.Priority
+	if priority == "" {
+		priority = "normal"
+	}
+
+	body := map[string]interface{}{
+		"ticket": map[string]interface{}{
+			"subject":  ticket.Subject,
+			"priority": priority,
+			"comment": map[string]interface{}{
+				"body": fmt.Sprintf("%s\n\nRequested by %s (created by %s)", ticket.Description, ticket.Requester, BotIdentity),
+			},
+		},
+	}
+
+	res := struct {
+		Ticket struct {
+			Id int64 `json:"id"`
+		} `json:"ticket"`
+	}{}
+	if err := doJSONRequest(ctx, http.MethodPost, z.baseUrl()+"/tickets.json", body, &res, z.setAuth); err != nil {
+		return nil, err
+	}
+
+	id := fmt.Sprintf("%d", res.Ticket.Id)
+	return &TicketRef{
+		Id:  id,
+		Url: fmt.Sprintf("https://%s.zendesk.com/agent/tickets/%s", z.conf.Subdomain, id),
+	}, nil
+}
+
+func (z *zendeskConnector) LookupCustomers(ctx context.Context, query string) ([]*CustomerRecord, error) {
+	res := struct {
+		Users []struct {
+			Id    int64  `json:"id"`
+			Name  string `json:"name"`
+			Email string `json:"email"`
+			Phone string `json:"phone"`
+			Notes string `json:"notes"`
+		} `json:"users"`
+	}{}
+
+	u := z.baseUrl() + "/users/search.json?query=" + url.QueryEscape(query)
+	if err := doJSONRequest(ctx, http.MethodGet, u, nil, &res, z.setAuth); err != nil {
+		return nil, err
+	}
+
+	records := make([]*CustomerRecord, 0, len(res.Users))
+	for _, u := range res.Users {
+		records = append(records, &CustomerRecord{
+			Id:    fmt.Sprintf("%d", u.Id),
+			Name:  u.Name,
+			Email: u.Email,
+			Phone: u.Phone,
+			Notes: u.Notes,
+		})
+	}
+	return records, nil
+}
+
+type jiraConnector struct {
+	conf config.JiraConfig
+}
+
+func (j *jiraConnector) setAuth(req *http.Request) {
+	req.SetBasicAuth(j.conf.Email, j.conf.ApiToken)
+}
+
+func (j *jiraConnector) CreateTicket(ctx context.Context, ticket *Ticket) (*TicketRef, error) {
+	fields := map[string]interface{}{
+		"project":     map[string]string{"key": j.conf.ProjectKey},
+		"issuetype":   map[string]string{"name": j.conf.IssueType},
+		"summary":     ticket.Subject,
+		"description": fmt.Sprintf("%s\n\nRequested by %s (created by %s)", ticket.Description, ticket.Requester, BotIdentity),
+	}
+	if priority := jiraPriority(ticket.Priority); priority != "" {
+		fields["priority"] = map[string]string{"name": priority}
+	}
+
+	res := struct {
+		Key string `json:"key"`
+	}{}
+	if err := doJSONRequest(ctx, http.MethodPost, strings.TrimSuffix(j.conf.Url, "/")+"/rest/api/2/issue",
+		map[string]interface{}{"fields": fields}, &res, j.setAuth); err != nil {
+		return nil, err
+	}
+
+	return &TicketRef{
+		Id:  res.Key,
+		Url: fmt.Sprintf("%s/browse/%s", strings.TrimSuffix(j.conf.Url, "/"), res.Key),
+	}, nil
+}
+
+func (j *jiraConnector) LookupCustomers(ctx context.Context, query string) ([]*CustomerRecord, error) {
+	var users []struct {
+		AccountId    string `json:"accountId"`
+		DisplayName  string `json:"displayName"`
+		EmailAddress string `json:"emailAddress"`
+	}
+
+	u := strings.TrimSuffix(j.conf.Url, "/") + "/rest/api/2/user/search?query=" + url.QueryEscape(query)
+	if err := doJSONRequest(ctx, http.MethodGet, u, nil, &users, j.setAuth); err != nil {
+		return nil, err
+	}
+
+	records := make([]*CustomerRecord, 0, len(users))
+	for _, u := range users {
+		records = append(records, &CustomerRecord{
+			Id:    u.AccountId,
+			Name:  u.DisplayName,
+			Email: u.EmailAddress,
+		})
+	}
+	return records, nil
+}
+
+func jiraPriority(priority string) string {
+	switch priority {
+	case "low":
+		return "Low"
+	case "high":
+		return "High"
+	case "urgent":
+		return "Highest"
+	case "normal":
+		return "Medium"
+	default:
+		return ""
+	}
+}
+
+type createTicketTool struct {
+	connector TicketingConnector
+}
+
+func (t *createTicketTool) Definition() *openai.FunctionDefinition {
+	return &openai.FunctionDefinition{
+		Name:        "create_ticket",
+		Description: "File a support ticket on behalf of the participant you are talking to. Tell them the ticket id once created.",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"subject": map[string]interface{}{
+					"type":        "string",
+					"description": "Short summary of the issue",
+				},
+				"description": map[string]interface{}{
+					"type":        "string",
+					"description": "Detailed description of the issue, including what the participant already tried",
+				},
+				"priority": map[string]interface{}{
+					"type": "string",
+					"enum": []string{"low", "normal", "high", "urgent"},
+				},
+			},
+			"required": []string{"subject", "description"},
+		},
+	}
+}
+
+func (t *createTicketTool) Call(ctx context.Context, tc *ToolContext, arguments string) (string, error) {
+	args := struct {
+		Subject     string `json:"subject"`
+		Description string `json:"description"`
+		Priority    string `json:"priority"`
+	}{}
+	if err := parseToolArguments(arguments, &args); err != nil {
+		return "", err
+	}
+
+	if args.Subject == "" {
+		return "", errors.New("subject is required")
+	}
+
+	ref, err := t.connector.CreateTicket(ctx, &Ticket{
+		Subject:     args.Subject,
+		Description: args.Description,
+		Priority:    args.Priority,
+		Requester:   tc.Speaker.Identity(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("Ticket %s created (%s)", ref.Id, ref.Url), nil
+}
+
+type lookupCustomerTool struct {
+	connector TicketingConnector
+}
+
+func (t *lookupCustomerTool) Definition() *openai.FunctionDefinition {
+	return &openai.FunctionDefinition{
+		Name:        "lookup_customer",
+		Description: "Search the customer records by name, email or phone number",
+		Parameters: map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"query": map[string]interface{}{
+					"type":        "string",
+					"description": "Name, email or phone number of the customer",
+				},
+			},
+			"required": []string{"query"},
+		},
+	}
+}
+
+func (t *lookupCustomerTool) Call(ctx context.Context, tc *ToolContext, arguments string) (string, error) {
+	args := struct {
+		Query string `json:"query"`
+	}{}
+	if err := parseToolArguments(arguments, &args); err != nil {
+		return "", err
+	}
+
+	records, err := t.connector.LookupCustomers(ctx, args.Query)
+	if err != nil {
+		return "", err
+	}
+
+	if len(records) == 0 {
+		return "No customer found", nil
+	}
+
+	const maxRecords = 5
+	if len(records) > maxRecords {
+		records = records[:maxRecords]
+	}
+
+	data, err := json.Marshal(records)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
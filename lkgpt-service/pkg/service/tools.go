@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/livekit/protocol/logger"
+	lksdk "github.com/livekit/server-sdk-go"
+	openai "github.com/sashabaranov/go-openai"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+const maxToolRounds = 4 // Max number of consecutive tool calls inside one answer
+
+// A function the LLM can call while answering
+type Tool interface {
+	Definition() *openai.FunctionDefinition
+	Call(ctx context.Context, tc *ToolContext, arguments string) (string, error)
+}
+
+// Context of the answer that triggered the tool call
+type ToolContext struct {
+	Participant *GPTParticipant
+	Speaker     *lksdk.RemoteParticipant
+
+	lock        sync.Mutex
+	citations   []*Citation // See citations.go
+	task        *toolTask   // Tool call being executed, see progress.go
+	sayProgress func(text string)
+
+	clarification *clarification // Clarifying question the participant answered, see clarification.go
+}
+
+type ToolSet struct {
+	tools map[string]Tool
+	order []string
+}
+
+func NewToolSet() *ToolSet {
+	return &ToolSet{
+		tools: make(map[string]Tool),
+	}
+}
+
+// Tools enabled in the config
+func NewToolSetFromConfig(conf *config.Config) *ToolSet {
+	ts := NewToolSet()
+	if conf.Escalation.Enabled {
+		ts.Add(&escalationTool{conf: conf.Escalation, livekit: conf.LiveKit})
+	}
+	if conf.Scratchpad.Enabled {
+		ts.Add(&storeNoteTool{conf: conf.Scratchpad})
+		ts.Add(&getNotesTool{})
+	}
+	if conf.Polls.Enabled {
+		ts.Add(&createPollTool{conf: conf.Polls})
+		ts.Add(&closePollTool{})
+	}
+	if conf.Ticketing.Provider != "" {
+		connector, err := NewTicketingConnector(conf.Ticketing)
+		if err != nil {
+			logger.Errorw("failed to create the ticketing connector", err)
+		} else {
+			ts.Add(&createTicketTool{connector: connector})
+			ts.Add(&lookupCustomerTool{connector: connector})
+		}
+	}
+	if conf.Clarification.Enabled {
+		ts.Add(&askClarificationTool{conf: conf.Clarification})
+	}
+	if conf.Issues.Provider != "" {
+		tracker, err := NewIssueTracker(conf.Issues)
+		if err != nil {
+			logger.Errorw("failed to create the issue tracker", err)
+		} else {
+			ts.Add(&proposeIssueTool{conf: conf.Issues})
+			ts.Add(&confirmIssueTool{tracker: tracker})
+		}
+	}
+	return ts
+}
+
+func (ts *ToolSet) Add(tool Tool) {
+	name := tool.Definition().Name
+	if _, ok := ts.tools[name]; !ok {
+		ts.order = append(ts.order, name)
+	}
+	ts.tools[name] = tool
+}
+
+func (ts *ToolSet) Empty() bool {
+	return ts == nil || len(ts.order) == 0
+}
+
+func (ts *ToolSet) Definitions() []openai.Tool {
+	if ts.Empty() {
+		return nil
+	}
+
+	defs := make([]openai.Tool, 0, len(ts.order))
+	for _, name := range ts.order {
+		defs = append(defs, openai.Tool{
+			Type:     openai.ToolTypeFunction,
+			Function: ts.tools[name].Definition(),
+		})
+	}
+	return defs
+}
+
+// Call the requested tool, errors are returned to the LLM as the tool result
+func (ts *ToolSet) Call(ctx context.Context, tc *ToolContext, call openai.ToolCall) string {
+	tool, ok := ts.tools[call.Function.Name]
+	if !ok {
+		return fmt.Sprintf("error: unknown tool %s", call.Function.Name)
+	}
+
+	logger.Debugw("calling tool", "tool", call.Function.Name, "arguments", call.Function.Arguments)
+	cited := tc.citationCount()
+	task := tc.startTask(call.ID, call.Function.Name)
+	result, err := tool.Call(ctx, tc, call.Function.Arguments)
+	task.finish()
+	if err != nil {
+		logger.Errorw("tool call failed", err, "tool", call.Function.Name)
+		return fmt.Sprintf("error: %s", err.Error())
+	}
+	return tc.appendSources(result, cited)
+}
+
+// Helper used by the tools to decode their arguments
+func parseToolArguments(arguments string, v interface{}) error {
+	if arguments == "" {
+		arguments = "{}"
+	}
+	if err := json.Unmarshal([]byte(arguments), v); err != nil {
+		return fmt.Errorf("invalid arguments: %w", err)
+	}
+	return nil
+}
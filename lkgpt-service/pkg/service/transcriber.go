@@ -6,6 +6,7 @@ import (
 	"io"
 	"strings"
 	"sync"
+	"time"
 
 	stt "cloud.google.com/go/speech/apiv1"
 	sttpb "cloud.google.com/go/speech/apiv1/speechpb"
@@ -15,14 +16,23 @@ import (
 	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+	"github.com/livekit-examples/livegpt/pkg/utils"
+)
+
+const (
+	TranscriptionProvider_Google = "google"
+	TranscriptionProvider_Azure  = "azure"
 )
 
 type Transcriber struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	speechClient *stt.Client
+	speechClient *stt.Client // nil when Google isn't the transcription provider
 	language     *Language
+	fallback     *SpeechFallback // nil when disabled
 
 	rtpCodec webrtc.RTPCodecParameters
 	//sb       *samplebuilder.SampleBuilder
@@ -31,18 +41,56 @@ type Transcriber struct {
 	oggWriter     *io.PipeWriter
 	oggReader     *io.PipeReader
 	oggSerializer *oggwriter.OggWriter
+	rtpClock      *rtpClock // Timeline of the current ogg stream
+	streamStart   time.Time // Time when the first audio data was sent to the current speech stream (word offsets are relative to it)
+
+	// While the track is muted, the speech stream is closed instead of waiting for Google to time it out
+	muted   bool
+	paused  bool          // The speech stream was closed because of the mute, reopened once unmuted
+	unmuted chan struct{} // Closed by Resume
+
+	gate      *voiceGate // nil when the audio is always streamed, see vad.go
+	reconnect config.StreamReconnectConfig
+
+	degraded bool // The instance is overloaded: no interim results and the standard model, from the next speech stream
+
+	// The language of the participant is unknown: the other languages are recognized too, from the next speech stream
+	detect     bool
+	detected   *Language   // Language of the last final result
+	candidates []*Language // Recognized besides language when detect is set, the other Languages when empty
+
+	usage    *usageMeter
+	unbilled time.Duration // Audio sent since the last usage report
+
+	fallbackBuf *fallbackBuffer // Set while the fallback is used instead of the speech stream, see fallback.go
+
+	replacement *Transcriber // Continues the transcription of the track once closed
+
+	wakeWord *wakeWordDetector // nil when the activation words are matched in the transcripts
+
+	faults *faultInjector // nil unless testing
 
 	results chan RecognizeResult
 	closeCh chan struct{}
 }
 
 type RecognizeResult struct {
-	Error   error
-	Text    string
-	IsFinal bool
+	Error      error
+	Text       string
+	IsFinal    bool
+	Stability  float32          // Estimate of the likelihood that an interim result will not change (0.0 - 1.0)
+	Confidence float32          // Only set on final results (0.0 - 1.0), 0 when unknown
+	Words      []RecognizedWord // Only set on final results
+	Language   *Language        // Recognized language of the final results, nil when unknown
 }
 
-func NewTranscriber(rtpCodec webrtc.RTPCodecParameters, speechClient *stt.Client, language *Language) (*Transcriber, error) {
+type RecognizedWord struct {
+	Word  string    `json:"word"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+func NewTranscriber(rtpCodec webrtc.RTPCodecParameters, speechClient *stt.Client, language *Language, fallback *SpeechFallback, conf config.TranscriptionConfig) (*Transcriber, error) {
 	if !strings.EqualFold(rtpCodec.MimeType, "audio/opus") {
 		return nil, errors.New("only opus is supported")
 	}
@@ -58,52 +106,304 @@ func NewTranscriber(rtpCodec webrtc.RTPCodecParameters, speechClient *stt.Client
 		oggWriter:    oggWriter,
 		language:     language,
 		speechClient: speechClient,
+		fallback:     fallback,
+		reconnect:    conf.Reconnect,
 		results:      make(chan RecognizeResult),
 		closeCh:      make(chan struct{}),
 	}
+	if speechClient != nil && language.TranscriberCode != "" {
+		t.gate = newVoiceGate(conf.VAD) // The fallback detects the utterances itself
+	}
 	go t.start()
 	return t, nil
 }
 
+// The recognized language when it is detected, the one the transcriber was created with otherwise
 func (t *Transcriber) Language() *Language {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.detected != nil {
+		return t.detected
+	}
 	return t.language
 }
 
+// Returns io.EOF once the transcriber is closed
 func (t *Transcriber) WriteRTP(pkt *rtp.Packet) error {
 	t.lock.Lock()
 	defer t.lock.Unlock()
 
+	if t.ctx.Err() != nil {
+		return io.EOF
+	}
+
+	if !t.muted {
+		t.wakeWord.WriteRTP(pkt)
+	}
+
+	if t.fallbackBuf != nil && !t.muted {
+		t.fallbackBuf.write(pkt)
+		t.countAudio(pkt.Payload)
+		return nil
+	}
+
+	if t.muted {
+		return nil
+	}
+
+	packets := []*rtp.Packet{pkt}
+	if t.gate != nil {
+		write, closing := t.gate.push(pkt, !t.paused)
+		if closing {
+			t.closeStream() // The silence isn't streamed
+		}
+		if !write {
+			return nil
+		}
+		packets = append(t.gate.take(), pkt)
+	}
+
+	if t.paused {
+		return nil // Nobody reads the pipe until the next speech stream
+	}
+
+	for _, pkt := range packets {
+		if err := t.writeOgg(pkt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The caller must hold the lock
+func (t *Transcriber) writeOgg(pkt *rtp.Packet) error {
 	if t.oggSerializer == nil {
 		oggSerializer, err := oggwriter.NewWith(t.oggWriter, t.rtpCodec.ClockRate, t.rtpCodec.Channels)
+		if err == io.ErrClosedPipe && t.ctx.Err() == nil {
+			return nil // The speech stream failed, see dropStream
+		}
 		if err != nil {
 			logger.Errorw("failed to create ogg serializer", err)
 			return err
 		}
 		t.oggSerializer = oggSerializer
+		t.rtpClock = newRTPClock(t.rtpCodec.ClockRate)
 	}
 
+	timestamp, ok := t.rtpClock.next(pkt)
+	if !ok {
+		return nil // Duplicated or reordered, the ogg stream can't go back in time
+	}
+
+	// The granule positions are computed from the timestamps
+	rewritten := *pkt
+	rewritten.Timestamp = timestamp
+
 	//t.sb.Push(pkt)
 	//for _, p := range t.sb.PopPackets() {
-	if err := t.oggSerializer.WriteRTP(pkt); err != nil {
+	if err := t.oggSerializer.WriteRTP(&rewritten); err != nil {
+		if err == io.ErrClosedPipe && t.ctx.Err() == nil {
+			return nil // The speech stream failed, see dropStream
+		}
 		return err
 	}
+
+	t.countAudio(pkt.Payload)
 	//}
 
 	return nil
 }
 
+// Google bills the audio sent, by increments of 15 seconds. The caller must hold the lock
+func (t *Transcriber) countAudio(payload []byte) {
+	if duration, err := utils.ParsePacketDuration(payload); err == nil {
+		t.unbilled += duration
+		if t.unbilled >= 15*time.Second {
+			t.reportUsage()
+		}
+	}
+}
+
+// Close the speech stream while the track is muted, the audio already sent is still transcribed
+func (t *Transcriber) Pause() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.muted {
+		return
+	}
+	t.muted = true
+	t.unmuted = make(chan struct{})
+	if t.gate != nil {
+		t.gate.close() // The next stream waits for the speech once unmuted
+	}
+	t.closeStream()
+}
+
+// The forwarder reads EOF and half-closes the speech stream, Google then sends the last final results.
+// The caller must hold the lock
+func (t *Transcriber) closeStream() {
+	if t.paused {
+		return
+	}
+	t.paused = true
+	t.oggWriter.Close()
+	t.oggReader, t.oggWriter = io.Pipe()
+	t.oggSerializer = nil
+	t.rtpClock = nil
+}
+
+func (t *Transcriber) IsMuted() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.muted
+}
+
+func (t *Transcriber) Resume() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if !t.muted {
+		return
+	}
+	t.muted = false
+	close(t.unmuted)
+	t.unmuted = nil
+}
+
+func (t *Transcriber) SetUsageMeter(usage *usageMeter) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.usage = usage
+}
+
+// The caller must hold the lock
+func (t *Transcriber) reportUsage() {
+	t.usage.Add(usage_STTMinutes, t.unbilled.Minutes())
+	t.unbilled = 0
+}
+
+func (t *Transcriber) SetDegraded(degraded bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.degraded = degraded
+}
+
+// The ogg stream of the transcriber can continue with the packets of a track of this codec
+func (t *Transcriber) SameCodec(codec webrtc.RTPCodecParameters) bool {
+	return strings.EqualFold(codec.MimeType, t.rtpCodec.MimeType) &&
+		codec.ClockRate == t.rtpCodec.ClockRate && codec.Channels == t.rtpCodec.Channels
+}
+
+// Set before closing the transcriber, the packets of the track are then written to next
+func (t *Transcriber) ReplaceWith(next *Transcriber) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.replacement = next
+}
+
+func (t *Transcriber) Replacement() *Transcriber {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.replacement
+}
+
+// Closed with the transcriber
+func (t *Transcriber) SetWakeWord(detector *wakeWordDetector) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.wakeWord = detector
+}
+
+// False when the activation words must be matched in the transcripts
+func (t *Transcriber) DetectsWakeWord() bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.wakeWord.Running()
+}
+
+func (t *Transcriber) SetFaults(faults *faultInjector) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.faults = faults
+}
+
+func (t *Transcriber) SetDetectLanguage(detect bool, candidates []*Language) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.detect = detect
+	t.candidates = candidates
+}
+
 func (t *Transcriber) start() error {
+	streaming := false // The speech stream is counted by speechStreamsGauge
 	defer func() {
+		if streaming {
+			speechStreamsGauge.Dec()
+		}
 		close(t.closeCh)
 	}()
 
+	attempts := 0 // Consecutive speech streams failed with a transient error
 	for {
-		stream, err := t.newStream()
+		t.lock.Lock()
+		unmuted := t.unmuted
+		pipe := t.oggReader
+		t.lock.Unlock()
+		if unmuted != nil {
+			select {
+			case <-unmuted:
+			case <-t.ctx.Done():
+				return nil
+			}
+		}
+
+		// Don't open the speech stream before the participant speaks
+		t.lock.Lock()
+		var voiced chan struct{}
+		if t.gate != nil {
+			voiced = t.gate.voiced
+		}
+		t.lock.Unlock()
+		if voiced != nil {
+			select {
+			case <-voiced:
+			case <-t.ctx.Done():
+				return nil
+			}
+		}
+
+		var stream sttpb.Speech_StreamingRecognizeClient
+		var err error
+		if t.speechClient == nil {
+			err = errNoSpeechStream
+		} else if t.language.TranscriberCode == "" {
+			err = errUnsupportedLanguage
+		} else {
+			stream, err = t.newStream()
+		}
 		if err != nil {
 			if status, ok := status.FromError(err); ok && status.Code() == codes.Canceled {
 				return nil
 			}
 
+			if t.canReconnect(attempts, err) {
+				t.dropStream(pipe)
+				attempts++
+				if !t.backoff(attempts, err) {
+					return nil
+				}
+				continue
+			}
+
+			if t.fallback != nil {
+				logger.Warnw("speech stream unavailable, using the transcription fallback", err, "language", t.language.Code)
+				t.useFallback()
+				t.runFallback(err == errUnsupportedLanguage || err == errNoSpeechStream)
+				continue
+			}
+
 			logger.Errorw("failed to create a new speech stream", err)
 			t.results <- RecognizeResult{
 				Error: err,
@@ -111,6 +411,19 @@ func (t *Transcriber) start() error {
 			return err
 		}
 
+		streaming = true
+		speechStreamsGauge.Inc()
+
+		t.lock.Lock()
+		t.paused = false
+		oggReader := t.oggReader
+		if t.muted {
+			t.closeStream() // Paused while the stream was created, nothing would be written to it
+		} else if t.gate != nil && !t.gate.open {
+			t.closeStream() // The speech ended while the stream was created
+		}
+		t.lock.Unlock()
+
 		endStreamCh := make(chan struct{})
 		nextCh := make(chan struct{})
 
@@ -123,9 +436,11 @@ func (t *Transcriber) start() error {
 				case <-endStreamCh:
 					return
 				default:
-					n, err := t.oggReader.Read(buf)
+					n, err := oggReader.Read(buf)
 					if err != nil {
-						if err != io.EOF {
+						if err == io.EOF {
+							_ = stream.CloseSend() // Paused
+						} else if err != io.ErrClosedPipe { // Dropped, see dropStream
 							logger.Errorw("failed to read from ogg reader", err)
 						}
 						return
@@ -135,12 +450,18 @@ func (t *Transcriber) start() error {
 						continue // No data
 					}
 
+					t.lock.Lock()
+					if t.streamStart.IsZero() {
+						t.streamStart = time.Now()
+					}
+					t.lock.Unlock()
+
 					if err := stream.Send(&sttpb.StreamingRecognizeRequest{
 						StreamingRequest: &sttpb.StreamingRecognizeRequest_AudioContent{
 							AudioContent: buf[:n],
 						},
 					}); err != nil {
-						if err != io.EOF {
+						if err != io.EOF && t.fallback == nil {
 							logger.Errorw("failed to forward audio data to speech stream", err)
 							t.results <- RecognizeResult{
 								Error: err,
@@ -154,9 +475,14 @@ func (t *Transcriber) start() error {
 		}()
 
 		// Read transcription results
+		var streamErr error // The fallback is used when set
+		var reconnectErr error
 		for {
 			resp, err := stream.Recv()
 			if err != nil {
+				if err == io.EOF {
+					break // Half-closed by Pause, every result was received
+				}
 				if status, ok := status.FromError(err); ok {
 					if status.Code() == codes.OutOfRange {
 						break // Create a new speech stream (maximum speech length exceeded)
@@ -165,6 +491,16 @@ func (t *Transcriber) start() error {
 					}
 				}
 
+				if t.canReconnect(attempts, err) {
+					reconnectErr = err
+					break
+				}
+
+				if t.fallback != nil {
+					streamErr = err
+					break
+				}
+
 				logger.Errorw("failed to receive response from speech stream", err)
 				t.results <- RecognizeResult{
 					Error: err,
@@ -176,11 +512,16 @@ func (t *Transcriber) start() error {
 			if resp.Error != nil {
 				break
 			}
+			attempts = 0
 
 			// Read the whole transcription and put inside one string
 			// We don't need to process each part individually (atm?)
 			var sb strings.Builder
+			var words []RecognizedWord
 			final := false
+			stability := float32(1)
+			var confidence float32
+			var language *Language
 			for _, result := range resp.Results {
 				alt := result.Alternatives[0]
 				text := alt.Transcript
@@ -190,35 +531,202 @@ func (t *Transcriber) start() error {
 					sb.Reset()
 					sb.WriteString(text)
 					final = true
+					confidence = alt.Confidence
+					words = t.recognizedWords(alt.Words)
+					language = t.recognizedLanguage(result.LanguageCode)
 					break
 				}
+
+				// Keep the least stable part of the interim transcript
+				if result.Stability < stability {
+					stability = result.Stability
+				}
 			}
 
 			t.results <- RecognizeResult{
-				Text:    sb.String(),
-				IsFinal: final,
+				Text:       sb.String(),
+				IsFinal:    final,
+				Stability:  stability,
+				Confidence: confidence,
+				Words:      words,
+				Language:   language,
 			}
 		}
 
+		streaming = false
+		speechStreamsGauge.Dec()
+
 		close(endStreamCh)
+		if reconnectErr != nil {
+			t.dropStream(oggReader) // The forwarder returns on the closed pipe
+		}
+		if streamErr != nil {
+			logger.Warnw("speech stream dropped, using the transcription fallback", streamErr, "language", t.language.Code)
+			t.useFallback() // Closes the pipe, the forwarder doesn't wait for the next data
+		}
 
-		// When nothing is written on the transcriber (The track is muted), this will block because the oggReader
-		// is waiting for data. It avoids to create useless speech streams. (Also we end up here because Google automatically close the
-		// previous stream when there's no "activity")
-		//
-		// Otherwise (When we have data) it is used to wait for the end of the current stream,
-		// so we can create the next one and reset the oggSerializer
+		// Wait for the end of the current stream, so we can create the next one and reset the oggSerializer.
+		// The pipe is closed by Pause (the track is muted) and by the voice gate, the forwarder doesn't block
+		// on an idle speech stream (Google also closes the streams without "activity")
 		<-nextCh
 
 		// Create a new oggSerializer each time we open a new SpeechStream
 		// This is required because the stream requires ogg headers to be sent again
 		t.lock.Lock()
+		if !t.paused {
+			t.oggSerializer = nil // Already reset with the pipe by Pause
+			t.rtpClock = nil
+		}
+		t.streamStart = time.Time{}
+		t.lock.Unlock()
+
+		if streamErr != nil {
+			t.runFallback(false)
+		}
+		if reconnectErr != nil {
+			attempts++
+			if !t.backoff(attempts, reconnectErr) {
+				return nil
+			}
+		}
+	}
+}
+
+// Unavailable, ResourceExhausted and DeadlineExceeded are transient, while attempts remain
+func (t *Transcriber) canReconnect(attempts int, err error) bool {
+	if attempts >= t.reconnect.MaxAttempts {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+// Wait before reopening the speech stream, false when the transcriber was closed meanwhile
+func (t *Transcriber) backoff(attempt int, err error) bool {
+	delay := t.reconnect.Backoff << (attempt - 1)
+	if max := t.reconnect.MaxBackoff; max > 0 && (delay <= 0 || delay > max) {
+		delay = max // delay overflows after many attempts
+	}
+	logger.Warnw("speech stream failed, reconnecting", err, "language", t.language.Code, "attempt", attempt, "delay", delay)
+
+	select {
+	case <-time.After(delay):
+		return true
+	case <-t.ctx.Done():
+		return false
+	}
+}
+
+// Discard the pipe of the failed speech stream. Closing its reader first releases a WriteRTP blocked on it (no stream
+// reads the pipe), the audio is then held by the voice gate or dropped until the next stream
+func (t *Transcriber) dropStream(oggReader *io.PipeReader) {
+	oggReader.Close()
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.oggReader == oggReader {
+		t.closeStream()
+	}
+}
+
+// Buffer the audio for the fallback instead of writing it to the speech stream
+func (t *Transcriber) useFallback() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.fallbackBuf = &fallbackBuffer{}
+	if !t.paused {
+		t.oggWriter.Close()
+		t.oggReader, t.oggWriter = io.Pipe()
 		t.oggSerializer = nil
+		t.rtpClock = nil
+	}
+}
+
+// Transcribe the utterances with the fallback until the retry interval elapsed,
+// forever when there is no speech stream for the language
+func (t *Transcriber) runFallback(unsupported bool) {
+	defer func() {
+		t.lock.Lock()
+		t.fallbackBuf = nil
 		t.lock.Unlock()
+	}()
+
+	var retry <-chan time.Time
+	if !unsupported && t.fallback.conf.RetryInterval > 0 {
+		timer := time.NewTimer(t.fallback.conf.RetryInterval)
+		defer timer.Stop()
+		retry = timer.C
+	}
+
+	ticker := time.NewTicker(fallbackTick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.ctx.Done():
+			return
+		case <-retry:
+			t.flushFallback(true)
+			return
+		case <-ticker.C:
+			t.flushFallback(false)
+		}
+	}
+}
+
+// Transcribe the buffered utterance once it is complete, or right away when forced
+func (t *Transcriber) flushFallback(force bool) {
+	conf := t.fallback.conf
+
+	t.lock.Lock()
+	buf := t.fallbackBuf
+	if buf.lastVoice.IsZero() {
+		if buf.duration >= conf.Pause {
+			buf.reset() // Only silence
+		}
+		t.lock.Unlock()
+		return
+	}
+	if !force && !buf.complete(time.Now(), conf) {
+		t.lock.Unlock()
+		return
+	}
+
+	audio, err := buf.ogg(t.rtpCodec)
+	start := buf.start
+	buf.reset()
+	language := t.language
+	if t.detected != nil {
+		language = t.detected
+	}
+	t.lock.Unlock()
+
+	if err != nil {
+		logger.Errorw("failed to encode the utterance", err)
+		return
+	}
+
+	result, err := t.fallback.Transcribe(t.ctx, audio, language, start)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			logger.Errorw("failed to transcribe the utterance with the fallback", err)
+		}
+		return
+	}
+	if result.Text != "" {
+		t.results <- *result
 	}
 }
 
 func (t *Transcriber) Close() {
+	t.lock.Lock()
+	t.reportUsage()
+	t.wakeWord.Close()
+	t.lock.Unlock()
+
 	t.cancel()
 	t.oggReader.Close()
 	t.oggWriter.Close()
@@ -230,11 +738,60 @@ func (t *Transcriber) Results() <-chan RecognizeResult {
 	return t.results
 }
 
+// Convert the word offsets of the current stream to absolute times
+func (t *Transcriber) recognizedWords(words []*sttpb.WordInfo) []RecognizedWord {
+	t.lock.Lock()
+	streamStart := t.streamStart
+	t.lock.Unlock()
+
+	recognized := make([]RecognizedWord, 0, len(words))
+	for _, w := range words {
+		recognized = append(recognized, RecognizedWord{
+			Word:  w.Word,
+			Start: streamStart.Add(w.StartTime.AsDuration()),
+			End:   streamStart.Add(w.EndTime.AsDuration()),
+		})
+	}
+	return recognized
+}
+
+// Google returns the code in lowercase (e.g "fr-fr")
+func (t *Transcriber) recognizedLanguage(code string) *Language {
+	language := findLanguage(code)
+	if language == nil {
+		return nil
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.detect {
+		if t.detected != nil && t.detected != language {
+			logger.Debugw("spoken language changed", "from", t.detected.Code, "to", language.Code)
+		}
+		t.detected = language
+	}
+	return language
+}
+
 func (t *Transcriber) newStream() (sttpb.Speech_StreamingRecognizeClient, error) {
+	t.lock.Lock()
+	faults := t.faults
+	t.lock.Unlock()
+	if err := faults.inject(t.ctx, faultProvider_STT); err != nil {
+		return nil, err
+	}
+
 	stream, err := t.speechClient.StreamingRecognize(t.ctx)
 	if err != nil {
 		return nil, err
 	}
+	stream = faults.wrapSpeechStream(t.ctx, stream)
+
+	t.lock.Lock()
+	degraded := t.degraded
+	detect := t.detect
+	candidates := t.candidates
+	t.lock.Unlock()
 
 	config := &sttpb.RecognitionConfig{
 		Model: "command_and_search",
@@ -278,17 +835,35 @@ func (t *Transcriber) newStream() (sttpb.Speech_StreamingRecognizeClient, error)
 				},
 			},
 		},
-		UseEnhanced:       true,
-		Encoding:          sttpb.RecognitionConfig_OGG_OPUS,
-		SampleRateHertz:   int32(t.rtpCodec.ClockRate),
-		AudioChannelCount: int32(t.rtpCodec.Channels),
-		LanguageCode:      t.language.TranscriberCode,
+		UseEnhanced:           !degraded,
+		EnableWordTimeOffsets: true,
+		Encoding:              sttpb.RecognitionConfig_OGG_OPUS,
+		SampleRateHertz:       int32(t.rtpCodec.ClockRate),
+		AudioChannelCount:     int32(t.rtpCodec.Channels),
+		LanguageCode:          t.language.TranscriberCode,
+	}
+
+	if detect {
+		if len(candidates) == 0 {
+			candidates = languageList
+		}
+
+		var codes []string
+		for _, language := range candidates {
+			if language != t.language && language.TranscriberCode != "" {
+				codes = append(codes, language.TranscriberCode)
+			}
+		}
+		if len(codes) > 3 {
+			codes = codes[:3] // Google accepts at most 3 alternative languages
+		}
+		config.AlternativeLanguageCodes = codes
 	}
 
 	if err := stream.Send(&sttpb.StreamingRecognizeRequest{
 		StreamingRequest: &sttpb.StreamingRecognizeRequest_StreamingConfig{
 			StreamingConfig: &sttpb.StreamingRecognitionConfig{
-				InterimResults: true,
+				InterimResults: !degraded,
 				Config:         config,
 			},
 		},
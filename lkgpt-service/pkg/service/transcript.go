@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/livekit/protocol/logger"
+
+	"github.com/livekit-examples/livegpt/pkg/store"
+)
+
+// transcriptRecorder keeps every final transcript and answer of the room (not only the ones addressed to KITT)
+type transcriptRecorder struct {
+	History
+}
+
+func (r *transcriptRecorder) HandleEvent(event *RoomEvent) {
+	e := &MeetingEvent{}
+	switch data := event.Data.(type) {
+	case *TranscriptEvent:
+		if !data.IsFinal || strings.TrimSpace(data.Text) == "" {
+			return // Interim or ignored (low confidence)
+		}
+		e.Speech = &SpeechEvent{
+			ParticipantName: data.ParticipantName,
+			Text:            data.Text,
+			Time:            event.Time,
+		}
+	case *AnswerEvent:
+		e.Speech = &SpeechEvent{
+			ParticipantName: BotIdentity,
+			IsBot:           true,
+			Text:            data.Answer,
+			Time:            event.Time,
+			AudioKey:        data.AudioKey,
+		}
+	case *MuteEvent:
+		e.Microphone = &MicrophoneEvent{
+			Muted:           data.Muted,
+			ParticipantName: data.ParticipantName,
+			Time:            event.Time,
+		}
+	default:
+		return
+	}
+
+	r.Append(e)
+}
+
+// transcriptStoreSink persists the final transcripts and the answers of a room, see transcriptstore.go
+type transcriptStoreSink struct {
+	transcripts TranscriptStore
+	roomName    string
+	roomSid     string
+	pending     sync.WaitGroup
+}
+
+func (s *transcriptStoreSink) HandleEvent(event *RoomEvent) {
+	entry := &store.TranscriptEntry{
+		RoomName: s.roomName,
+		RoomSid:  s.roomSid,
+		Time:     event.Time,
+	}
+
+	switch data := event.Data.(type) {
+	case *TranscriptEvent:
+		if !data.IsFinal || strings.TrimSpace(data.Text) == "" {
+			return // Interim or ignored (low confidence)
+		}
+		entry.ParticipantName = data.ParticipantName
+		entry.Text = data.Text
+	case *AnswerEvent:
+		entry.ParticipantName = BotIdentity
+		entry.IsBot = true
+		entry.Text = data.Answer
+		entry.AudioKey = data.AudioKey
+	default:
+		return
+	}
+
+	// The sinks are called synchronously, don't block the event bus on the database
+	s.pending.Add(1)
+	go func() {
+		defer s.pending.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+		defer cancel()
+
+		if err := s.transcripts.Append(ctx, entry); err != nil {
+			logger.Errorw("failed to store the transcript", err, "room", s.roomName)
+		}
+	}()
+}
+
+// Called when KITT leaves the room
+func (s *transcriptStoreSink) Close() {
+	s.pending.Wait()
+
+	ctx, cancel := context.WithTimeout(context.Background(), storageTimeout)
+	defer cancel()
+	if err := s.transcripts.Flush(ctx, s.roomName, s.roomSid); err != nil {
+		logger.Errorw("failed to flush the transcripts", err, "room", s.roomName)
+	}
+}
@@ -0,0 +1,224 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/livekit/protocol/logger"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+	"github.com/livekit-examples/livegpt/pkg/store"
+)
+
+// Meeting records kept for compliance (see TranscriptsConfig): every final transcript and answer of the rooms
+// with its time, appended by transcriptStoreSink and served by GET /transcripts/{room}
+
+const (
+	TranscriptStore_Database = "database" // Rows of the transcripts table, written right away
+	TranscriptStore_Storage  = "storage"  // One JSON lines file per room, written when KITT leaves the room
+	TranscriptStore_None     = "none"
+)
+
+type TranscriptStore interface {
+	Append(ctx context.Context, entry *store.TranscriptEntry) error
+	// Called when KITT leaves the room, the entries of the session must be persisted when it returns
+	Flush(ctx context.Context, roomName, roomSid string) error
+	// Every session of the room, ordered by time
+	List(ctx context.Context, roomName string) ([]*store.TranscriptEntry, error)
+}
+
+// Returns nil when the transcripts are disabled or the backend of the store isn't configured
+func NewTranscriptStore(conf config.TranscriptsConfig, db store.Store, blobs BlobStore) (TranscriptStore, error) {
+	switch conf.Store {
+	case "", TranscriptStore_None:
+		return nil, nil
+	case TranscriptStore_Database:
+		if db == nil {
+			return nil, nil // The database is optional, keep running without the records
+		}
+		return &databaseTranscriptStore{db: db}, nil
+	case TranscriptStore_Storage:
+		if blobs == nil {
+			return nil, errors.New("the storage isn't configured")
+		}
+		return &blobTranscriptStore{
+			blobs:    blobs,
+			dir:      conf.Dir,
+			sessions: make(map[string][]*store.TranscriptEntry),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown transcript store: %s", conf.Store)
+	}
+}
+
+type databaseTranscriptStore struct {
+	db store.Store
+}
+
+func (s *databaseTranscriptStore) Append(ctx context.Context, entry *store.TranscriptEntry) error {
+	return s.db.AppendTranscript(ctx, entry)
+}
+
+func (s *databaseTranscriptStore) Flush(ctx context.Context, roomName, roomSid string) error {
+	return nil // Every entry is already inserted
+}
+
+func (s *databaseTranscriptStore) List(ctx context.Context, roomName string) ([]*store.TranscriptEntry, error) {
+	return s.db.ListRoomTranscripts(ctx, roomName)
+}
+
+// The sessions are kept in memory until KITT leaves the room, then appended to <dir>/<room>.jsonl.
+// A room is only handled by one instance at a time (see RoomRegistry), the file isn't written concurrently
+type blobTranscriptStore struct {
+	blobs BlobStore
+	dir   string
+
+	lock     sync.Mutex
+	sessions map[string][]*store.TranscriptEntry // By room sid
+}
+
+func (s *blobTranscriptStore) key(roomName string) string {
+	return s.dir + "/" + roomName + ".jsonl"
+}
+
+func (s *blobTranscriptStore) Append(ctx context.Context, entry *store.TranscriptEntry) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.sessions[entry.RoomSid] = append(s.sessions[entry.RoomSid], entry)
+	return nil
+}
+
+func (s *blobTranscriptStore) Flush(ctx context.Context, roomName, roomSid string) error {
+	s.lock.Lock()
+	entries := s.sessions[roomSid]
+	delete(s.sessions, roomSid)
+	s.lock.Unlock()
+	if len(entries) == 0 {
+		return nil
+	}
+
+	data, err := s.blobs.Get(ctx, s.key(roomName))
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
+	// The entries are appended from several goroutines
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Time.Before(entries[j].Time)
+	})
+
+	buf := bytes.NewBuffer(data)
+	enc := json.NewEncoder(buf)
+	for _, entry := range entries {
+		if err := enc.Encode(newTranscriptLine(entry)); err != nil {
+			return err
+		}
+	}
+	return s.blobs.Put(ctx, s.key(roomName), buf.Bytes(), "application/jsonl")
+}
+
+func (s *blobTranscriptStore) List(ctx context.Context, roomName string) ([]*store.TranscriptEntry, error) {
+	data, err := s.blobs.Get(ctx, s.key(roomName))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*store.TranscriptEntry
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for dec.More() {
+		line := &TranscriptLine{}
+		if err := dec.Decode(line); err != nil {
+			return nil, err
+		}
+		res = append(res, line.entry(roomName))
+	}
+	return res, nil
+}
+
+// A final transcript or an answer of KITT, returned by GET /transcripts/{room}
+type TranscriptLine struct {
+	RoomSid         string    `json:"roomSid"`
+	ParticipantName string    `json:"participantName"`
+	IsBot           bool      `json:"isBot"`
+	Text            string    `json:"text"`
+	Time            time.Time `json:"time"`
+	AudioKey        string    `json:"audioKey,omitempty"` // Blob of the audio of the answer, when stored
+}
+
+func newTranscriptLine(entry *store.TranscriptEntry) *TranscriptLine {
+	return &TranscriptLine{
+		RoomSid:         entry.RoomSid,
+		ParticipantName: entry.ParticipantName,
+		IsBot:           entry.IsBot,
+		Text:            entry.Text,
+		Time:            entry.Time,
+		AudioKey:        entry.AudioKey,
+	}
+}
+
+func (l *TranscriptLine) entry(roomName string) *store.TranscriptEntry {
+	return &store.TranscriptEntry{
+		RoomName:        roomName,
+		RoomSid:         l.RoomSid,
+		ParticipantName: l.ParticipantName,
+		IsBot:           l.IsBot,
+		Text:            l.Text,
+		Time:            l.Time,
+		AudioKey:        l.AudioKey,
+	}
+}
+
+// GET /transcripts/{room}
+// The transcripts of every session of the room, or of one session with ?sid=RM_xxx.
+// Unlike /rooms, KITT doesn't need to be in the room. Only registered when the transcripts are stored
+func (s *LiveGPT) transcriptsHandler(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	roomName := strings.Trim(strings.TrimPrefix(req.URL.Path, "/transcripts/"), "/")
+	if roomName == "" || strings.Contains(roomName, "/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if err := s.authenticateRoomAdmin(req, roomName); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), storageTimeout)
+	defer cancel()
+
+	entries, err := s.transcripts.List(ctx, roomName)
+	if err != nil {
+		logger.Errorw("failed to list the transcripts", err, "room", roomName)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sid := req.URL.Query().Get("sid")
+	lines := make([]*TranscriptLine, 0, len(entries))
+	for _, entry := range entries {
+		if sid == "" || entry.RoomSid == sid {
+			lines = append(lines, newTranscriptLine(entry))
+		}
+	}
+
+	s.audit(req, "transcripts", roomName, sid)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(lines)
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"time"
+
+	"github.com/pion/rtp"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+	"github.com/livekit-examples/livegpt/pkg/utils"
+)
+
+// Voice activity gate of the Transcriber (see VADConfig): the audio is only streamed to Google STT while the
+// participant speaks, the speech stream is half-closed after Hangover of silence and reopened on the next speech.
+// Disabled, the gate still suspends the speech stream after IdleTimeout of silence (long quiet meetings).
+// The opus encoders of the clients already run a voice activity detector: with DTX (default of livekit-client),
+// the silence is sent as packets of a few bytes, so the audio doesn't need to be decoded
+
+const vadMaxPending = 2 * time.Second // Speech buffered while the next speech stream is created
+
+type voiceGate struct {
+	conf config.VADConfig
+
+	open      bool            // The audio is written to the speech stream
+	lastVoice time.Time       // Last packet with speech
+	voiced    chan struct{}   // Closed when the speech starts, nil while open
+	pending   []*rtp.Packet   // Pre-roll while closed, then the speech waiting for the speech stream
+	duration  time.Duration   // Of the pending packets
+	durations []time.Duration // Of each pending packet
+}
+
+// nil when the audio is always streamed
+func newVoiceGate(conf config.VADConfig) *voiceGate {
+	if !conf.Enabled && conf.IdleTimeout <= 0 {
+		return nil
+	}
+	return &voiceGate{
+		conf:   conf,
+		voiced: make(chan struct{}),
+	}
+}
+
+// Returns true when pkt must be written to the speech stream, false when it is silent or kept pending.
+// Returns closing when the silence lasted the idle period: the speech stream must be half-closed
+func (g *voiceGate) push(pkt *rtp.Packet, streaming bool) (write bool, closing bool) {
+	now := time.Now()
+	voice := !utils.IsSilentPacket(pkt.Payload, g.conf.SilenceThreshold)
+	if voice {
+		g.lastVoice = now
+	}
+
+	if !g.open {
+		if !voice {
+			g.hold(pkt, g.conf.PreRoll)
+			return false, false
+		}
+		g.open = true
+		close(g.voiced)
+		g.voiced = nil
+	} else if now.Sub(g.lastVoice) >= g.idle() {
+		g.close()
+		g.hold(pkt, g.conf.PreRoll)
+		return false, true
+	}
+
+	if !streaming {
+		g.hold(pkt, vadMaxPending) // The speech stream is being created
+		return false, false
+	}
+	return true, false
+}
+
+// Silence closing the speech stream
+func (g *voiceGate) idle() time.Duration {
+	if g.conf.Enabled {
+		return g.conf.Hangover
+	}
+	return g.conf.IdleTimeout
+}
+
+// Wait for the next speech before opening a speech stream (e.g the track is muted)
+func (g *voiceGate) close() {
+	if !g.open {
+		return
+	}
+	g.open = false
+	g.voiced = make(chan struct{})
+}
+
+// Keep pkt pending, the oldest packets are dropped beyond max
+func (g *voiceGate) hold(pkt *rtp.Packet, max time.Duration) {
+	d, err := utils.ParsePacketDuration(pkt.Payload)
+	if err != nil {
+		d = defaultFrameDuration
+	}
+
+	p := *pkt
+	p.Payload = append([]byte{}, pkt.Payload...)
+	g.pending = append(g.pending, &p)
+	g.durations = append(g.durations, d)
+	g.duration += d
+
+	for len(g.pending) > 1 && g.duration > max {
+		g.duration -= g.durations[0]
+		g.pending = g.pending[1:]
+		g.durations = g.durations[1:]
+	}
+}
+
+// The pending packets, to write before the next one
+func (g *voiceGate) take() []*rtp.Packet {
+	pending := g.pending
+	g.pending = nil
+	g.durations = nil
+	g.duration = 0
+	return pending
+}
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"sync/atomic"
+
+	"github.com/livekit/protocol/logger"
+	lksdk "github.com/livekit/server-sdk-go"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+
+	"github.com/livekit-examples/livegpt/pkg/config"
+)
+
+// Wake word detection on the audio of the microphones (see WakeWordConfig), so KITT is activated even when the
+// speech-to-text mis-transcribes its name. The opus packets are decoded to PCM by an external command (ffmpeg)
+// and streamed to a Wyoming server running the engine (wyoming-openwakeword, wyoming-porcupine1).
+// The activation words are matched in the transcripts of the tracks without a running detector
+
+const (
+	WakeWordEngine_String       = "string"       // Match GreetingWords and NameWords in the transcripts
+	WakeWordEngine_OpenWakeWord = "openwakeword" // openWakeWord served by wyoming-openwakeword
+	WakeWordEngine_Porcupine    = "porcupine"    // Porcupine served by wyoming-porcupine1
+)
+
+const (
+	wakeWordSampleRate = 16000 // PCM expected by the engines, 16-bit mono
+	wakeWordChunkSize  = 2048  // Bytes of PCM per audio chunk (64ms)
+	wakeWordQueueSize  = 50    // RTP packets waiting for the decoder (1s), the next ones are dropped
+)
+
+type wakeWordDetector struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	conf       config.WakeWordConfig
+	codec      webrtc.RTPCodecParameters
+	packets    chan *rtp.Packet
+	onDetected func(name string)
+	running    atomic.Bool // False once the detector failed, the transcripts are matched instead
+}
+
+// nil with WakeWordEngine_String
+func newWakeWordDetector(conf config.WakeWordConfig, codec webrtc.RTPCodecParameters, onDetected func(name string)) *wakeWordDetector {
+	if conf.Engine == "" || conf.Engine == WakeWordEngine_String {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &wakeWordDetector{
+		ctx:        ctx,
+		cancel:     cancel,
+		conf:       conf,
+		codec:      codec,
+		packets:    make(chan *rtp.Packet, wakeWordQueueSize),
+		onDetected: onDetected,
+	}
+	d.running.Store(true)
+	go func() {
+		err := d.run()
+		d.running.Store(false)
+		if err != nil && ctx.Err() == nil {
+			logger.Warnw("wake word detection stopped, matching the transcripts instead", err, "engine", conf.Engine)
+		}
+	}()
+	return d
+}
+
+// False when the activation words must be matched in the transcripts
+func (d *wakeWordDetector) Running() bool {
+	return d != nil && d.running.Load()
+}
+
+// Never blocks, the packets are dropped when the decoder is late
+func (d *wakeWordDetector) WriteRTP(pkt *rtp.Packet) {
+	if !d.Running() {
+		return
+	}
+
+	select {
+	case d.packets <- pkt:
+	default:
+	}
+}
+
+func (d *wakeWordDetector) Close() {
+	if d != nil {
+		d.cancel()
+	}
+}
+
+func (d *wakeWordDetector) run() error {
+	if len(d.conf.Decoder) == 0 {
+		return errors.New("no decoder command")
+	}
+
+	dialer := net.Dialer{Timeout: d.conf.ConnectTimeout}
+	conn, err := dialer.DialContext(d.ctx, "tcp", d.conf.Address)
+	if err != nil {
+		return fmt.Errorf("failed to connect to the wake word server: %w", err)
+	}
+	defer conn.Close()
+
+	cmd := exec.CommandContext(d.ctx, d.conf.Decoder[0], d.conf.Decoder[1:]...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start the decoder: %w", err)
+	}
+	defer func() {
+		d.cancel()
+		_ = cmd.Wait()
+	}()
+
+	go d.writeOgg(stdin)
+	go d.readDetections(conn)
+
+	w := &wyomingWriter{w: conn}
+	audioFormat := map[string]interface{}{"rate": wakeWordSampleRate, "width": 2, "channels": 1}
+	if err := w.write("detect", map[string]interface{}{"names": d.conf.Names}, nil); err != nil {
+		return err
+	}
+	if err := w.write("audio-start", audioFormat, nil); err != nil {
+		return err
+	}
+
+	buf := make([]byte, wakeWordChunkSize)
+	for {
+		n, err := io.ReadFull(stdout, buf)
+		if err != nil {
+			if d.ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("decoder stopped: %w", err)
+		}
+		if err := w.write("audio-chunk", audioFormat, buf[:n]); err != nil {
+			return err
+		}
+	}
+}
+
+// Serialize the packets to the stdin of the decoder, see Transcriber.WriteRTP
+func (d *wakeWordDetector) writeOgg(stdin io.WriteCloser) {
+	defer stdin.Close()
+
+	ogg, err := oggwriter.NewWith(stdin, d.codec.ClockRate, d.codec.Channels)
+	if err != nil {
+		logger.Errorw("failed to create the ogg serializer of the wake word", err)
+		d.cancel()
+		return
+	}
+	clock := newRTPClock(d.codec.ClockRate)
+
+	for {
+		select {
+		case <-d.ctx.Done():
+			return
+		case pkt := <-d.packets:
+			timestamp, ok := clock.next(pkt)
+			if !ok {
+				continue
+			}
+			rewritten := *pkt
+			rewritten.Timestamp = timestamp
+			if err := ogg.WriteRTP(&rewritten); err != nil {
+				d.cancel() // The decoder exited, run returns its error
+				return
+			}
+		}
+	}
+}
+
+func (d *wakeWordDetector) readDetections(conn net.Conn) {
+	defer d.cancel()
+
+	r := bufio.NewReader(conn)
+	for {
+		event, err := readWyomingEvent(r)
+		if err != nil {
+			if d.ctx.Err() == nil {
+				logger.Warnw("wake word server disconnected", err)
+			}
+			return
+		}
+
+		if event.Type == "detection" {
+			detection := struct {
+				Name string `json:"name"`
+			}{}
+			_ = json.Unmarshal(event.Data, &detection)
+			d.onDetected(detection.Name)
+		}
+	}
+}
+
+// Events of the Wyoming protocol: a JSON header line, followed by the data (when data_length is set) and the payload
+type wyomingEvent struct {
+	Type          string          `json:"type"`
+	Data          json.RawMessage `json:"data,omitempty"`
+	DataLength    int             `json:"data_length,omitempty"`
+	PayloadLength int             `json:"payload_length,omitempty"`
+	Payload       []byte          `json:"-"`
+}
+
+type wyomingWriter struct {
+	w io.Writer
+}
+
+func (w *wyomingWriter) write(eventType string, data interface{}, payload []byte) error {
+	rawData, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	header, err := json.Marshal(&wyomingEvent{
+		Type:          eventType,
+		Data:          rawData,
+		PayloadLength: len(payload),
+	})
+	if err != nil {
+		return err
+	}
+
+	msg := make([]byte, 0, len(header)+1+len(payload))
+	msg = append(msg, header...)
+	msg = append(msg, '\n')
+	msg = append(msg, payload...)
+	_, err = w.w.Write(msg)
+	return err
+}
+
+func readWyomingEvent(r *bufio.Reader) (*wyomingEvent, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	event := &wyomingEvent{}
+	if err := json.Unmarshal(line, event); err != nil {
+		return nil, fmt.Errorf("invalid wyoming event: %w", err)
+	}
+	if event.DataLength > 0 {
+		data := make([]byte, event.DataLength)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		event.Data = data
+	}
+	if event.PayloadLength > 0 {
+		event.Payload = make([]byte, event.PayloadLength)
+		if _, err := io.ReadFull(r, event.Payload); err != nil {
+			return nil, err
+		}
+	}
+	return event, nil
+}
+
+// The wake word was heard in the microphone of rp, KITT answers their next sentence like with "Hey Kitt"
+func (p *GPTParticipant) wakeWordDetected(rp *lksdk.RemoteParticipant, name string) {
+	if p.currentJoinState() != joinState_Listening || p.isNoteTaker() || p.isEscalated() || p.currentBehavior() != RoomBehavior_Assistant {
+		return
+	}
+
+	policy := p.conf.Reply.OneOnOne
+	if len(p.room.GetParticipants()) == 1 && (policy == ReplyPolicy_Always || policy == ReplyPolicy_Command) {
+		return // Always answered, or only after the activate command
+	}
+
+	logger.Debugw("activating KITT for participant", "wakeWord", name, "participant", rp.Identity())
+	p.activeInterim.Store(true) // The final transcript of the wake word alone isn't answered
+	p.activateParticipant(rp)
+}
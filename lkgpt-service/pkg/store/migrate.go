@@ -0,0 +1,119 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/livekit/protocol/logger"
+)
+
+//go:embed migrations/*.sql
+var migrations embed.FS
+
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// migrations/NNNN_name.sql of fsys (the embedded migrations outside of the tests), sorted by version
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	var res []migration
+	for _, entry := range entries {
+		name := entry.Name()
+		prefix, _, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration name: %s", name)
+		}
+
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration name: %s", name)
+		}
+
+		content, err := fs.ReadFile(fsys, "migrations/"+name)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, migration{version: version, name: name, sql: string(content)})
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].version < res[j].version
+	})
+	for i := 1; i < len(res); i++ {
+		if res[i].version == res[i-1].version {
+			return nil, fmt.Errorf("duplicated migration version: %s and %s", res[i-1].name, res[i].name)
+		}
+	}
+	return res, nil
+}
+
+// Apply the migrations not applied yet, each one in its own transaction
+func migrate(ctx context.Context, db *sql.DB, fsys fs.FS) error {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`)
+	if err != nil {
+		return err
+	}
+
+	all, err := loadMigrations(fsys)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range all {
+		if err := applyMigration(ctx, db, m); err != nil {
+			return fmt.Errorf("migration %s failed: %w", m.name, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback() // No-op once committed
+	}()
+
+	// Serialize the instances migrating concurrently
+	if _, err := tx.ExecContext(ctx, "LOCK TABLE schema_migrations IN EXCLUSIVE MODE"); err != nil {
+		return err
+	}
+
+	var applied bool
+	err = tx.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)", m.version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", m.version); err != nil {
+		return err
+	}
+
+	logger.Infow("database migration applied", "migration", m.name)
+	return tx.Commit()
+}
@@ -0,0 +1,162 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	all, err := loadMigrations(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) == 0 {
+		t.Fatal("no migration")
+	}
+	for i, m := range all {
+		if m.version != i+1 {
+			t.Errorf("%s: version %d, want %d (the versions must follow each other)", m.name, m.version, i+1)
+		}
+		if m.sql == "" {
+			t.Errorf("%s: empty", m.name)
+		}
+	}
+}
+
+func TestLoadMigrationsOrdering(t *testing.T) {
+	fsys := fstest.MapFS{
+		"migrations/10_c.sql":   {Data: []byte("SELECT 10")},
+		"migrations/2_b.sql":    {Data: []byte("SELECT 2")},
+		"migrations/0001_a.sql": {Data: []byte("SELECT 1")},
+	}
+
+	all, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		version int
+		name    string
+		sql     string
+	}{
+		{1, "0001_a.sql", "SELECT 1"},
+		{2, "2_b.sql", "SELECT 2"},
+		{10, "10_c.sql", "SELECT 10"}, // Sorted by version, not by name
+	}
+	if len(all) != len(want) {
+		t.Fatalf("got %d migrations, want %d", len(all), len(want))
+	}
+	for i, m := range all {
+		if m.version != want[i].version || m.name != want[i].name || m.sql != want[i].sql {
+			t.Errorf("migration %d: got %d %s %q, want %d %s %q", i, m.version, m.name, m.sql, want[i].version, want[i].name, want[i].sql)
+		}
+	}
+}
+
+func TestLoadMigrationsInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+	}{
+		{name: "no prefix", files: []string{"init.sql"}},
+		{name: "not a number", files: []string{"abc_init.sql"}},
+		{name: "zero", files: []string{"0000_init.sql"}},
+		{name: "negative", files: []string{"-1_init.sql"}},
+		{name: "duplicated version", files: []string{"0001_init.sql", "1_other.sql"}},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for _, file := range tt.files {
+				fsys["migrations/"+file] = &fstest.MapFile{Data: []byte("SELECT 1")}
+			}
+			if _, err := loadMigrations(fsys); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
+
+// Each migration is applied once: applying them again would fail (the tables already exist)
+func TestMigrateAppliedOnce(t *testing.T) {
+	_, db := testDatabase(t)
+	ctx := context.Background()
+
+	fsys := fstest.MapFS{
+		"migrations/0001_first.sql": {Data: []byte("CREATE TABLE first (id INTEGER)")},
+	}
+	for i := 0; i < 2; i++ {
+		if err := migrate(ctx, db, fsys); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+	if n := countRows(t, db, "schema_migrations"); n != 1 {
+		t.Fatalf("applied migrations: got %d, want 1", n)
+	}
+
+	fsys["migrations/0002_second.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE second (id INTEGER)")}
+	if err := migrate(ctx, db, fsys); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, db, "schema_migrations"); n != 2 {
+		t.Fatalf("applied migrations: got %d, want 2", n)
+	}
+
+	all, err := loadMigrations(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := applyMigration(ctx, db, all[0]); err != nil {
+		t.Fatalf("an applied migration must be skipped: %v", err)
+	}
+}
+
+// A failed migration is rolled back and not recorded, the next ones aren't applied
+func TestMigrateFailure(t *testing.T) {
+	_, db := testDatabase(t)
+	ctx := context.Background()
+
+	fsys := fstest.MapFS{
+		"migrations/0001_first.sql":  {Data: []byte("CREATE TABLE first (id INTEGER)")},
+		"migrations/0002_broken.sql": {Data: []byte("CREATE TABLE broken (id INTEGER); SELECT * FROM missing")},
+		"migrations/0003_third.sql":  {Data: []byte("CREATE TABLE third (id INTEGER)")},
+	}
+	if err := migrate(ctx, db, fsys); err == nil {
+		t.Fatal("expected an error")
+	}
+	if n := countRows(t, db, "schema_migrations"); n != 1 {
+		t.Fatalf("applied migrations: got %d, want 1", n)
+	}
+
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT to_regclass('broken') IS NOT NULL").Scan(&exists); err != nil {
+		t.Fatal(err)
+	}
+	if exists {
+		t.Error("the failed migration wasn't rolled back")
+	}
+}
+
+// The embedded migrations can be applied on an up-to-date database
+func TestMigrateEmbedded(t *testing.T) {
+	_, db := testDatabase(t)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := migrate(ctx, db, migrations); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+
+	all, err := loadMigrations(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, db, "schema_migrations"); n != len(all) {
+		t.Fatalf("applied migrations: got %d, want %d", n, len(all))
+	}
+}
@@ -0,0 +1,47 @@
+CREATE TABLE transcripts (
+    id               BIGSERIAL PRIMARY KEY,
+    room_name        TEXT        NOT NULL,
+    room_sid         TEXT        NOT NULL,
+    participant_name TEXT        NOT NULL,
+    is_bot           BOOLEAN     NOT NULL DEFAULT FALSE,
+    text             TEXT        NOT NULL,
+    time             TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX transcripts_room_sid_idx ON transcripts (room_sid, time);
+
+CREATE TABLE audit_logs (
+    id      BIGSERIAL PRIMARY KEY,
+    time    TIMESTAMPTZ NOT NULL,
+    actor   TEXT        NOT NULL,
+    action  TEXT        NOT NULL,
+    room    TEXT        NOT NULL,
+    details TEXT        NOT NULL
+);
+CREATE INDEX audit_logs_room_idx ON audit_logs (room, time);
+
+CREATE TABLE feedback (
+    id        BIGSERIAL PRIMARY KEY,
+    time      TIMESTAMPTZ NOT NULL,
+    room_name TEXT        NOT NULL,
+    room_sid  TEXT        NOT NULL,
+    identity  TEXT        NOT NULL,
+    rating    INTEGER     NOT NULL,
+    comment   TEXT        NOT NULL
+);
+CREATE INDEX feedback_room_name_idx ON feedback (room_name, time);
+
+CREATE TABLE schedules (
+    id        BIGSERIAL PRIMARY KEY,
+    room_name TEXT        NOT NULL,
+    start_at  TIMESTAMPTZ NOT NULL,
+    end_at    TIMESTAMPTZ NOT NULL,
+    metadata  TEXT        NOT NULL
+);
+CREATE INDEX schedules_start_at_idx ON schedules (start_at);
+
+CREATE TABLE budgets (
+    key    TEXT             NOT NULL,
+    period TEXT             NOT NULL,
+    used   DOUBLE PRECISION NOT NULL,
+    PRIMARY KEY (key, period)
+);
@@ -0,0 +1 @@
+ALTER TABLE transcripts ADD COLUMN audio_key TEXT NOT NULL DEFAULT '';
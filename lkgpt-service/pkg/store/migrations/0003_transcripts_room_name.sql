@@ -0,0 +1 @@
+CREATE INDEX transcripts_room_name_idx ON transcripts (room_name, time);
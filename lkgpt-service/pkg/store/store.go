@@ -0,0 +1,72 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// A final transcript or an answer of KITT
+type TranscriptEntry struct {
+	RoomName        string
+	RoomSid         string
+	ParticipantName string
+	IsBot           bool
+	Text            string
+	Time            time.Time
+	AudioKey        string // Blob of the audio of the answer, empty when not stored
+}
+
+// Action done through the HTTP API (join, memory erased, agenda updated, ...)
+type AuditLog struct {
+	Time    time.Time
+	Actor   string // Identity of the token used, empty when not authenticated
+	Action  string
+	Room    string
+	Details string
+}
+
+// Rating of an answer or of a whole meeting given by a participant
+type Feedback struct {
+	Time     time.Time
+	RoomName string
+	RoomSid  string
+	Identity string
+	Rating   int
+	Comment  string
+}
+
+// A room KITT must join at a given time
+type Schedule struct {
+	ID       int64 // Assigned by SaveSchedule
+	RoomName string
+	Start    time.Time
+	End      time.Time
+	Metadata string
+}
+
+// Persistence shared by the features outliving a room
+type Store interface {
+	AppendTranscript(ctx context.Context, entry *TranscriptEntry) error
+	ListTranscript(ctx context.Context, roomSid string) ([]*TranscriptEntry, error)
+	ListRoomTranscripts(ctx context.Context, roomName string) ([]*TranscriptEntry, error) // Every session of the room
+
+	AddAuditLog(ctx context.Context, log *AuditLog) error
+	ListAuditLogs(ctx context.Context, room string, limit int) ([]*AuditLog, error)
+
+	AddFeedback(ctx context.Context, feedback *Feedback) error
+	ListFeedback(ctx context.Context, roomName string) ([]*Feedback, error)
+
+	// Create the schedule when ID is 0, update it otherwise
+	SaveSchedule(ctx context.Context, schedule *Schedule) error
+	ListSchedules(ctx context.Context, from, to time.Time) ([]*Schedule, error)
+	DeleteSchedule(ctx context.Context, id int64) error
+
+	// Usage of a budget (e.g OpenAI tokens of a room) over a period (e.g "2023-04-12"), returns the new total
+	AddBudgetUsage(ctx context.Context, key, period string, amount float64) (float64, error)
+	BudgetUsage(ctx context.Context, key, period string) (float64, error)
+
+	Close() error
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+// Expected values of the fixtures of testdata, see testdata/gen.go
+type fixture struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Channels    uint8  `json:"channels"`
+	Packets     int    `json:"packets"`
+	Samples     int    `json:"samples"`
+	Granule     uint64 `json:"granule"`
+	SilentCount int    `json:"silentCount"`
+}
+
+// Packets of at most this size are silent in the fixtures
+const fixtureSilenceThreshold = 3
+
+func loadFixtures(tb testing.TB) []*fixture {
+	tb.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", "fixtures.json"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	var fixtures []*fixture
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		tb.Fatal(err)
+	}
+	if len(fixtures) == 0 {
+		tb.Fatal("no fixture")
+	}
+	return fixtures
+}
+
+func readFixture(tb testing.TB, name string) []byte {
+	tb.Helper()
+
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+// The .rtp files are the packets received from LiveKit, each prefixed by its length on 2 bytes (big endian)
+func readRTPFixture(tb testing.TB, name string) []*rtp.Packet {
+	tb.Helper()
+
+	data := readFixture(tb, name+".rtp")
+	var packets []*rtp.Packet
+	for len(data) > 0 {
+		if len(data) < 2 {
+			tb.Fatalf("%s: truncated length", name)
+		}
+		size := int(binary.BigEndian.Uint16(data))
+		data = data[2:]
+		if len(data) < size {
+			tb.Fatalf("%s: truncated packet", name)
+		}
+
+		pkt := &rtp.Packet{}
+		if err := pkt.Unmarshal(data[:size]); err != nil {
+			tb.Fatalf("%s: %v", name, err)
+		}
+		packets = append(packets, pkt)
+		data = data[size:]
+	}
+	return packets
+}
+
+type oggPacket struct {
+	payload   []byte
+	granule   uint64
+	endOfPage bool
+}
+
+// Every packet of the stream, until io.EOF
+func readOggPackets(reader *OggReader) ([]*oggPacket, error) {
+	var packets []*oggPacket
+	for {
+		payload, err := reader.ReadPacket()
+		if errors.Is(err, io.EOF) {
+			return packets, nil
+		}
+		if err != nil {
+			return packets, err
+		}
+
+		granule, endOfPage := reader.Granule()
+		packets = append(packets, &oggPacket{payload: payload, granule: granule, endOfPage: endOfPage})
+	}
+}
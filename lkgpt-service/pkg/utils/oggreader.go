@@ -7,7 +7,7 @@ package utils
 // RTP Packet can contains only one Opus Packet.
 // https://www.rfc-editor.org/rfc/rfc7587#section-4.2
 //
-// TODO(theomonnom): This currently doesn't support continued pages.
+// The packets continued on the next pages are joined, up to maxPacketSize.
 
 import (
 	"encoding/binary"
@@ -16,6 +16,7 @@ import (
 )
 
 const (
+	pageHeaderTypeContinuation      = 0x01
 	pageHeaderTypeBeginningOfStream = 0x02
 	pageHeaderSignature             = "OggS"
 
@@ -23,16 +24,22 @@ const (
 
 	pageHeaderLen       = 27
 	idPagePayloadLength = 19
+
+	maxPacketSize = 1 << 16 // Far above the largest Opus packet (120ms at 510kbps)
 )
 
 var (
 	errNilStream                 = errors.New("stream is nil")
 	errBadIDPageSignature        = errors.New("bad header signature")
+	errBadPageSignature          = errors.New("bad page signature")
 	errBadIDPageType             = errors.New("wrong header, expected beginning of stream")
 	errBadIDPageLength           = errors.New("payload for id page must be 19 bytes")
 	errBadIDPagePayloadSignature = errors.New("bad payload signature")
 	errShortPageHeader           = errors.New("not enough data for payload header")
 	errChecksumMismatch          = errors.New("expected and actual checksum do not match")
+	errMissingContinuation       = errors.New("continued packet not followed by a continuation page")
+	errUnexpectedContinuation    = errors.New("continuation page without a continued packet")
+	errPacketTooLarge            = errors.New("packet too large")
 )
 
 // OggReader is used to read Ogg files and return page payloads
@@ -44,6 +51,9 @@ type OggReader struct {
 	segment uint8
 	offset  int
 
+	granule   uint64 // Granule position of the page of the last packet read
+	endOfPage bool   // True if the last packet read is the last one of its page
+
 	checksumTable *[256]uint32
 	doChecksum    bool
 }
@@ -99,22 +109,29 @@ func newWith(in io.Reader, doChecksum bool) (*OggReader, *OggHeader, error) {
 		return nil, nil, err
 	}
 
-	// ignore
-	_, _ = reader.readPage()
+	// Ignore the comment header, it can be continued on several pages
+	for {
+		page, err := reader.readPage()
+		if err != nil {
+			break
+		}
+		if n := len(page.segmentsTable); n == 0 || page.segmentsTable[n-1] != 255 {
+			break
+		}
+	}
 
 	return reader, header, nil
 }
 
 func (o *OggReader) readHeaders() (*OggHeader, error) {
 	page, err := o.readPage()
-	if err != nil {
+	if errors.Is(err, errBadPageSignature) {
+		return nil, errBadIDPageSignature
+	} else if err != nil {
 		return nil, err
 	}
 
 	header := &OggHeader{}
-	if string(page.sig[:]) != pageHeaderSignature {
-		return nil, errBadIDPageSignature
-	}
 
 	if page.headerType != pageHeaderTypeBeginningOfStream {
 		return nil, errBadIDPageType
@@ -151,6 +168,9 @@ func (o *OggReader) readPage() (*OggPage, error) {
 	page := &OggPage{
 		sig: [4]byte{h[0], h[1], h[2], h[3]},
 	}
+	if string(page.sig[:]) != pageHeaderSignature {
+		return nil, errBadPageSignature
+	}
 
 	page.version = h[4]
 	page.headerType = h[5]
@@ -208,42 +228,81 @@ func (o *OggReader) readPage() (*OggPage, error) {
 }
 
 func (o *OggReader) ReadPacket() ([]byte, error) {
-	page := o.page
-	if page == nil {
-		nPage, err := o.readPage()
-		if err != nil {
-			return nil, err
+	var packet []byte
+	continued := false // The packet ends on a next page
+	for {
+		page := o.page
+		for page == nil {
+			nPage, err := o.readPage()
+			if err != nil {
+				if continued && errors.Is(err, io.EOF) {
+					return nil, io.ErrUnexpectedEOF
+				}
+				return nil, err
+			}
+			if isContinuation := nPage.headerType&pageHeaderTypeContinuation != 0; isContinuation != continued {
+				if continued {
+					return nil, errMissingContinuation
+				}
+				return nil, errUnexpectedContinuation
+			}
+			if len(nPage.segmentsTable) == 0 {
+				continue // Valid but contains no packet
+			}
+			page = nPage
+
+			o.page = page
+			o.offset = 0
+			o.segment = 0
 		}
-		page = nPage
 
-		o.page = page
-		o.offset = 0
-		o.segment = 0
-	}
+		// The granule position of a continued packet is the one of the page where it ends
+		o.granule = page.GranulePosition
+		o.endOfPage = false
+
+		// Calculate the size of the packet
+		packetSize := 0
+		complete := false
+		for {
+			segmentSize := page.segmentsTable[o.segment]
+			packetSize += int(segmentSize)
+			complete = segmentSize != 255
+
+			o.segment++
+			if o.segment == uint8(len(page.segmentsTable)) {
+				o.page = nil
+				o.endOfPage = true
+				break
+			}
 
-	// Calculate the size of the packet
-	packetSize := 0
-	for {
-		segmentSize := page.segmentsTable[o.segment]
-		packetSize += int(segmentSize)
+			if complete {
+				break
+			}
+		}
 
-		o.segment++
-		if o.segment == uint8(len(page.segmentsTable)) {
-			o.page = nil
-			break
+		if len(packet)+packetSize > maxPacketSize {
+			return nil, errPacketTooLarge
 		}
 
-		if segmentSize != 255 {
-			break
+		// Read the packet
+		packet = append(packet, page.payload[o.offset:o.offset+packetSize]...)
+		o.offset += packetSize
+
+		if complete {
+			if packet == nil {
+				packet = []byte{} // Zero-length packet
+			}
+			return packet, nil
 		}
+		continued = true
 	}
+}
 
-	// Read the packet
-	packet := make([]byte, packetSize)
-	copy(packet, page.payload[o.offset:o.offset+packetSize])
-	o.offset += packetSize
-
-	return packet, nil
+// Granule position of the page containing the last packet returned by ReadPacket,
+// and whether this packet is the last one of the page.
+// For Opus, the granule position is the number of 48kHz samples at the end of the page (including the pre-skip)
+func (o *OggReader) Granule() (uint64, bool) {
+	return o.granule, o.endOfPage
 }
 
 func generateChecksumTable() *[256]uint32 {
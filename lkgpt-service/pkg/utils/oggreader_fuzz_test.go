@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+// Seeds: the Ogg files of testdata, go test -fuzz=FuzzReadPacket ./pkg/utils to explore more inputs
+func addOggSeeds(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.ogg"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		f.Add(readFixture(f, filepath.Base(file)))
+	}
+	f.Add(oggHeaders())
+}
+
+func FuzzReadPage(f *testing.F) {
+	addOggSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// Without the checksum, so the mutated pages are parsed further
+		reader := &OggReader{
+			stream:        bytes.NewReader(data),
+			checksumTable: generateChecksumTable(),
+		}
+		for {
+			page, err := reader.readPage()
+			if err != nil {
+				return
+			}
+
+			size := 0
+			for _, s := range page.segmentsTable {
+				size += int(s)
+			}
+			if size != len(page.payload) {
+				t.Fatalf("the payload has %d bytes, the segments table %d", len(page.payload), size)
+			}
+		}
+	})
+}
+
+func FuzzReadPacket(f *testing.F) {
+	addOggSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		reader, _, err := newWith(bytes.NewReader(data), false)
+		if err != nil {
+			return
+		}
+		for {
+			packet, err := reader.ReadPacket()
+			if err != nil {
+				return
+			}
+			if len(packet) > maxPacketSize {
+				t.Fatalf("packet of %d bytes", len(packet))
+			}
+		}
+	})
+}
@@ -0,0 +1,303 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+)
+
+func TestOggReaderFixtures(t *testing.T) {
+	for _, f := range loadFixtures(t) {
+		f := f
+		t.Run(f.Name, func(t *testing.T) {
+			reader, header, err := NewOggReader(bytes.NewReader(readFixture(t, f.Name+".ogg")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header.Channels != f.Channels {
+				t.Errorf("channels: got %d, want %d", header.Channels, f.Channels)
+			}
+			if header.SampleRate != OpusSampleRate {
+				t.Errorf("sample rate: got %d, want %d", header.SampleRate, OpusSampleRate)
+			}
+
+			packets, err := readOggPackets(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(packets) != f.Packets {
+				t.Fatalf("packets: got %d, want %d", len(packets), f.Packets)
+			}
+
+			samples := 0
+			var granule uint64
+			for i, pkt := range packets {
+				n, err := ParsePacketSamples(pkt.payload)
+				if err != nil {
+					t.Fatalf("packet %d: %v", i, err)
+				}
+				samples += n
+
+				if !pkt.endOfPage {
+					t.Errorf("packet %d: the oggwriter writes one packet per page", i)
+				}
+				if pkt.granule < granule {
+					t.Errorf("packet %d: granule went back from %d to %d", i, granule, pkt.granule)
+				}
+				granule = pkt.granule
+			}
+			if samples != f.Samples {
+				t.Errorf("samples: got %d, want %d", samples, f.Samples)
+			}
+			if granule != f.Granule {
+				t.Errorf("granule: got %d, want %d", granule, f.Granule)
+			}
+		})
+	}
+}
+
+// The framing of the transcriber: the RTP packets are written with the oggwriter and read back by the OggReader
+func TestOggFraming(t *testing.T) {
+	for _, f := range loadFixtures(t) {
+		f := f
+		t.Run(f.Name, func(t *testing.T) {
+			rtpPackets := readRTPFixture(t, f.Name)
+			if len(rtpPackets) != f.Packets {
+				t.Fatalf("rtp packets: got %d, want %d", len(rtpPackets), f.Packets)
+			}
+
+			buf := &bytes.Buffer{}
+			writer, err := oggwriter.NewWith(buf, OpusSampleRate, uint16(f.Channels))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, pkt := range rtpPackets {
+				if err := writer.WriteRTP(pkt); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			reader, _, err := NewOggReader(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			packets, err := readOggPackets(reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(packets) != len(rtpPackets) {
+				t.Fatalf("packets: got %d, want %d", len(packets), len(rtpPackets))
+			}
+
+			first := rtpPackets[0].Timestamp
+			for i, pkt := range packets {
+				if !bytes.Equal(pkt.payload, rtpPackets[i].Payload) {
+					t.Fatalf("packet %d: payload differs", i)
+				}
+				// The oggwriter starts at 1 and adds the timestamp deltas
+				if want := uint64(rtpPackets[i].Timestamp-first) + 1; pkt.granule != want {
+					t.Fatalf("packet %d: granule %d, want %d", i, pkt.granule, want)
+				}
+			}
+			if last := packets[len(packets)-1].granule; last != f.Granule {
+				t.Errorf("granule: got %d, want %d", last, f.Granule)
+			}
+		})
+	}
+}
+
+func TestOggReaderErrors(t *testing.T) {
+	valid := readFixture(t, "mono_celt_20ms_32k.ogg")
+
+	corrupt := func(offset int) []byte {
+		data := append([]byte{}, valid...)
+		data[offset] ^= 0xff
+		return data
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{name: "empty", data: nil, err: io.EOF},
+		{name: "short header", data: valid[:10], err: io.ErrUnexpectedEOF},
+		{name: "bad signature", data: corrupt(0), err: errBadIDPageSignature},
+		{name: "bad checksum", data: corrupt(pageHeaderLen + 2), err: errChecksumMismatch},
+		{name: "truncated id page", data: valid[:pageHeaderLen+5], err: io.ErrUnexpectedEOF},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := NewOggReader(bytes.NewReader(tt.data))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestOggReaderTruncatedPage(t *testing.T) {
+	valid := readFixture(t, "mono_celt_20ms_32k.ogg")
+	reader, _, err := NewOggReader(bytes.NewReader(valid[:len(valid)-10]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packets, err := readOggPackets(reader)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("got %v, want %v", err, io.ErrUnexpectedEOF)
+	}
+	if len(packets) != 99 {
+		t.Errorf("packets before the truncated page: got %d, want 99", len(packets))
+	}
+}
+
+// Ogg page with a valid checksum, the segments table is built from the packets sizes.
+// The last packet is continued on the next page when continued is set
+func oggPage(headerType uint8, granule uint64, index uint32, continued bool, packets ...[]byte) []byte {
+	var segments, payload []byte
+	for i, packet := range packets {
+		size := len(packet)
+		for size >= 255 {
+			segments = append(segments, 255)
+			size -= 255
+		}
+		if !continued || i < len(packets)-1 {
+			segments = append(segments, byte(size))
+		} else if size > 0 {
+			panic("a continued packet must end on a 255 segment")
+		}
+		payload = append(payload, packet...)
+	}
+
+	page := make([]byte, pageHeaderLen, pageHeaderLen+len(segments)+len(payload))
+	copy(page, pageHeaderSignature)
+	page[5] = headerType
+	binary.LittleEndian.PutUint64(page[6:], granule)
+	binary.LittleEndian.PutUint32(page[14:], 0x4b495454)
+	binary.LittleEndian.PutUint32(page[18:], index)
+	page[26] = byte(len(segments))
+	page = append(page, segments...)
+	page = append(page, payload...)
+
+	table := generateChecksumTable()
+	var checksum uint32
+	for _, v := range page {
+		checksum = (checksum << 8) ^ table[byte(checksum>>24)^v]
+	}
+	binary.LittleEndian.PutUint32(page[22:], checksum)
+	return page
+}
+
+// ID and comment headers
+func oggHeaders() []byte {
+	id := make([]byte, idPagePayloadLength)
+	copy(id, idPageSignature)
+	id[8] = 1
+	id[9] = 1
+	binary.LittleEndian.PutUint32(id[12:], OpusSampleRate)
+
+	comment := append([]byte("OpusTags"), make([]byte, 8)...)
+	return append(oggPage(pageHeaderTypeBeginningOfStream, 0, 0, false, id), oggPage(0, 0, 1, false, comment)...)
+}
+
+func filled(size int, v byte) []byte {
+	return bytes.Repeat([]byte{v}, size)
+}
+
+func TestOggReaderContinuedPackets(t *testing.T) {
+	first := filled(300, 1)
+	second := filled(510+100, 2) // 255*2 on the first page, 100 on the continuation page
+	third := filled(20, 3)
+
+	stream := oggHeaders()
+	stream = append(stream, oggPage(0, 960, 2, true, first, second[:510])...)
+	stream = append(stream, oggPage(pageHeaderTypeContinuation, 1920, 3, false, second[510:], third)...)
+
+	reader, _, err := NewOggReader(bytes.NewReader(stream))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packets, err := readOggPackets(reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*oggPacket{
+		{payload: first, granule: 960, endOfPage: false},
+		{payload: second, granule: 1920, endOfPage: false}, // Ends on the continuation page
+		{payload: third, granule: 1920, endOfPage: true},
+	}
+	if len(packets) != len(want) {
+		t.Fatalf("packets: got %d, want %d", len(packets), len(want))
+	}
+	for i, pkt := range packets {
+		if !bytes.Equal(pkt.payload, want[i].payload) {
+			t.Errorf("packet %d: got %d bytes, want %d", i, len(pkt.payload), len(want[i].payload))
+		}
+		if pkt.granule != want[i].granule || pkt.endOfPage != want[i].endOfPage {
+			t.Errorf("packet %d: got granule %d/%v, want %d/%v", i, pkt.granule, pkt.endOfPage, want[i].granule, want[i].endOfPage)
+		}
+	}
+}
+
+func TestOggReaderContinuationErrors(t *testing.T) {
+	continued := oggPage(0, 960, 2, true, filled(255, 1))
+
+	tests := []struct {
+		name  string
+		pages [][]byte
+		err   error
+	}{
+		{
+			name:  "missing continuation",
+			pages: [][]byte{continued, oggPage(0, 1920, 3, false, filled(10, 2))},
+			err:   errMissingContinuation,
+		},
+		{
+			name:  "unexpected continuation",
+			pages: [][]byte{oggPage(pageHeaderTypeContinuation, 960, 2, false, filled(10, 2))},
+			err:   errUnexpectedContinuation,
+		},
+		{
+			name:  "end of stream",
+			pages: [][]byte{continued},
+			err:   io.ErrUnexpectedEOF,
+		},
+		{
+			name: "too large",
+			pages: func() [][]byte {
+				pages := [][]byte{oggPage(0, 0, 2, true, filled(255*255, 1))}
+				for i := 0; i < maxPacketSize/(255*255)+1; i++ {
+					pages = append(pages, oggPage(pageHeaderTypeContinuation, 0, uint32(3+i), true, filled(255*255, 1)))
+				}
+				return pages
+			}(),
+			err: errPacketTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			stream := oggHeaders()
+			for _, page := range tt.pages {
+				stream = append(stream, page...)
+			}
+
+			reader, _, err := NewOggReader(bytes.NewReader(stream))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := readOggPackets(reader); !errors.Is(err, tt.err) {
+				t.Fatalf("got %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
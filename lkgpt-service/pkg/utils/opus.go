@@ -9,9 +9,31 @@ var (
 	ErrInvalidPacket = errors.New("invalid opus packet")
 )
 
+// Cheap silence detection without decoding, based on the size of the packet.
+// The encoder spends almost no bits on silence (DTX or very low energy frames), so these packets
+// are only a TOC byte and a few bytes.
+func IsSilentPacket(data []byte, maxSize int) bool {
+	return len(data) <= maxSize
+}
+
+const OpusSampleRate = 48000
+
 // Parse the duration of a an OpusPacket
-// https://www.rfc-editor.org/rfc/rfc6716#section-3.1
 func ParsePacketDuration(data []byte) (time.Duration, error) {
+	samples, err := ParsePacketSamples(data)
+	if err != nil {
+		return 0, err
+	}
+	return SamplesDuration(int64(samples)), nil
+}
+
+func SamplesDuration(samples int64) time.Duration {
+	return time.Duration(samples) * time.Second / OpusSampleRate
+}
+
+// Parse the number of 48kHz samples of an OpusPacket
+// https://www.rfc-editor.org/rfc/rfc6716#section-3.1
+func ParsePacketSamples(data []byte) (int, error) {
 	durations := [32]uint64{
 		480, 960, 1920, 2880, // Silk-Only
 		480, 960, 1920, 2880, // Silk-Only
@@ -28,28 +50,37 @@ func ParsePacketDuration(data []byte) (time.Duration, error) {
 		return 0, ErrInvalidPacket
 	}
 
+	// The packets come from the participants, reject the ones breaking the RFC rules instead of trusting them
 	toc := data[0]
 	var nframes int
 	switch toc & 3 {
 	case 0:
 		nframes = 1
 	case 1:
+		if (len(data)-1)%2 != 0 { // Two frames of the same size
+			return 0, ErrInvalidPacket
+		}
 		nframes = 2
 	case 2:
+		if len(data) < 2 { // Missing the size of the first frame
+			return 0, ErrInvalidPacket
+		}
 		nframes = 2
 	case 3:
 		if len(data) < 2 {
 			return 0, ErrInvalidPacket
 		}
 		nframes = int(data[1] & 63)
+		if nframes == 0 {
+			return 0, ErrInvalidPacket
+		}
 	}
 
-	frameDuration := int64(durations[toc>>3])
-	duration := int64(nframes * int(frameDuration))
-	if duration > 5760 { // 120ms
+	frameSamples := int(durations[toc>>3])
+	samples := nframes * frameSamples
+	if samples > 5760 { // 120ms
 		return 0, ErrInvalidPacket
 	}
 
-	ms := duration * 1000 / 48000
-	return time.Duration(ms) * time.Millisecond, nil
+	return samples, nil
 }
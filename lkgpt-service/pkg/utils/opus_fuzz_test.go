@@ -0,0 +1,32 @@
+package utils
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Seeds: the Opus packets of testdata, go test -fuzz=FuzzParsePacketDuration ./pkg/utils to explore more inputs
+func FuzzParsePacketDuration(f *testing.F) {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.rtp"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, file := range files {
+		for _, pkt := range readRTPFixture(f, strings.TrimSuffix(filepath.Base(file), ".rtp")) {
+			f.Add(pkt.Payload)
+		}
+	}
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		d, err := ParsePacketDuration(data)
+		if err != nil {
+			return
+		}
+		if d <= 0 || d > 120*time.Millisecond {
+			t.Fatalf("invalid duration %v", d)
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParsePacketSamples(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		samples int
+		err     error
+	}{
+		{name: "empty", data: nil, err: ErrInvalidPacket},
+		{name: "silk nb 10ms", data: []byte{0 << 3}, samples: 480},
+		{name: "silk nb 60ms", data: []byte{3 << 3}, samples: 2880},
+		{name: "hybrid fb 20ms", data: []byte{15 << 3}, samples: 960},
+		{name: "celt fb 2.5ms", data: []byte{28 << 3}, samples: 120},
+		{name: "celt fb 20ms", data: []byte{31 << 3}, samples: 960},
+		{name: "code 1", data: []byte{31<<3 | 1, 0xaa, 0xbb}, samples: 1920},
+		{name: "code 1 odd size", data: []byte{31<<3 | 1, 0xaa}, err: ErrInvalidPacket},
+		{name: "code 2", data: []byte{31<<3 | 2, 1, 0xaa, 0xbb}, samples: 1920},
+		{name: "code 2 missing size", data: []byte{31<<3 | 2}, err: ErrInvalidPacket},
+		{name: "code 3", data: []byte{31<<3 | 3, 3}, samples: 2880},
+		{name: "code 3 missing count", data: []byte{31<<3 | 3}, err: ErrInvalidPacket},
+		{name: "code 3 no frame", data: []byte{31<<3 | 3, 0}, err: ErrInvalidPacket},
+		{name: "code 3 120ms", data: []byte{31<<3 | 3, 6}, samples: 5760},
+		{name: "code 3 over 120ms", data: []byte{31<<3 | 3, 7}, err: ErrInvalidPacket},
+		{name: "code 3 silk over 120ms", data: []byte{3<<3 | 3, 3}, err: ErrInvalidPacket},
+	}
+
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			samples, err := ParsePacketSamples(tt.data)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if samples != tt.samples {
+				t.Fatalf("got %d samples, want %d", samples, tt.samples)
+			}
+		})
+	}
+}
+
+func TestParsePacketDurationFixtures(t *testing.T) {
+	for _, f := range loadFixtures(t) {
+		f := f
+		t.Run(f.Name, func(t *testing.T) {
+			var duration time.Duration
+			silent := 0
+			for i, pkt := range readRTPFixture(t, f.Name) {
+				d, err := ParsePacketDuration(pkt.Payload)
+				if err != nil {
+					t.Fatalf("packet %d: %v", i, err)
+				}
+				duration += d
+				if IsSilentPacket(pkt.Payload, fixtureSilenceThreshold) {
+					silent++
+				}
+			}
+
+			if want := SamplesDuration(int64(f.Samples)); duration != want {
+				t.Errorf("duration: got %v, want %v", duration, want)
+			}
+			if silent != f.SilentCount {
+				t.Errorf("silent packets: got %d, want %d", silent, f.SilentCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,226 @@
+//go:build ignore
+
+// Generates the Ogg/Opus fixtures of this directory: go run gen.go
+//
+// The Opus payloads are synthetic (valid TOC bytes, deterministic filler), the parsers never decode them.
+// Each fixture is written twice: as the RTP packets received from LiveKit (.rtp, each packet prefixed
+// by its length on 2 bytes, big endian) and as the Ogg file written by the transcriber (.ogg).
+// fixtures.json holds the expected values of each fixture, checked by the tests of pkg/utils and pkg/service.
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"math/rand"
+	"os"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+)
+
+const clockRate = 48000
+
+// TOC configurations, https://www.rfc-editor.org/rfc/rfc6716#section-3.1
+const (
+	silkNB60ms  = 3
+	silkWB20ms  = 9
+	hybridFB20  = 15
+	celtFB10ms  = 30
+	celtFB20ms  = 31
+	tocStereo   = 0x04
+	frameCount3 = 3 // Code 3: arbitrary number of frames, the count is in the second byte
+)
+
+type packet struct {
+	payload []byte
+	samples int  // 48kHz samples of the packet
+	lost    bool // Never received: the sequence number and the timestamp are skipped
+	gap     int  // Samples not sent before this packet (DTX)
+}
+
+type fixture struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Channels    uint8  `json:"channels"`
+	Packets     int    `json:"packets"`     // Received packets
+	Samples     int    `json:"samples"`     // Sum of the samples of the received packets
+	Granule     uint64 `json:"granule"`     // Granule position of the last page
+	SilentCount int    `json:"silentCount"` // Packets of at most 3 bytes (see utils.IsSilentPacket)
+
+	packets []packet
+}
+
+func frame(rnd *rand.Rand, config byte, stereo bool, size int) []byte {
+	toc := config << 3
+	if stereo {
+		toc |= tocStereo
+	}
+	payload := make([]byte, size)
+	payload[0] = toc
+	rnd.Read(payload[1:])
+	return payload
+}
+
+// Code 3 packet of n frames, CBR
+func multiframe(rnd *rand.Rand, config byte, n int, size int) []byte {
+	payload := make([]byte, size)
+	payload[0] = config<<3 | frameCount3
+	payload[1] = byte(n)
+	rnd.Read(payload[2:])
+	return payload
+}
+
+func fixtures(rnd *rand.Rand) []*fixture {
+	var list []*fixture
+
+	// 32kbps, 20ms frames
+	f := &fixture{Name: "mono_celt_20ms_32k", Description: "CELT fullband, 20ms frames, 32kbps", Channels: 1}
+	for i := 0; i < 100; i++ {
+		f.packets = append(f.packets, packet{payload: frame(rnd, celtFB20ms, false, 80), samples: 960})
+	}
+	list = append(list, f)
+
+	// 64kbps, 10ms frames
+	f = &fixture{Name: "mono_celt_10ms_64k", Description: "CELT fullband, 10ms frames, 64kbps", Channels: 1}
+	for i := 0; i < 200; i++ {
+		f.packets = append(f.packets, packet{payload: frame(rnd, celtFB10ms, false, 80), samples: 480})
+	}
+	list = append(list, f)
+
+	// 12kbps, 60ms frames
+	f = &fixture{Name: "mono_silk_60ms_12k", Description: "SILK narrowband, 60ms frames, 12kbps", Channels: 1}
+	for i := 0; i < 34; i++ {
+		f.packets = append(f.packets, packet{payload: frame(rnd, silkNB60ms, false, 90), samples: 2880})
+	}
+	list = append(list, f)
+
+	// Stereo, 20ms frames
+	f = &fixture{Name: "stereo_hybrid_20ms_64k", Description: "Hybrid fullband stereo, 20ms frames, 64kbps", Channels: 2}
+	for i := 0; i < 100; i++ {
+		f.packets = append(f.packets, packet{payload: frame(rnd, hybridFB20, true, 160), samples: 960})
+	}
+	list = append(list, f)
+
+	// DTX: speech, then silence only sent every 400ms (1 byte packets), then speech again
+	f = &fixture{Name: "mono_silk_dtx", Description: "SILK wideband with DTX, silent packets every 400ms", Channels: 1}
+	for i := 0; i < 50; i++ {
+		f.packets = append(f.packets, packet{payload: frame(rnd, silkWB20ms, false, 60), samples: 960})
+	}
+	for i := 0; i < 10; i++ {
+		p := packet{payload: frame(rnd, silkWB20ms, false, 1), samples: 960}
+		if i > 0 {
+			p.gap = 19 * 960
+		}
+		f.packets = append(f.packets, p)
+	}
+	for i := 0; i < 50; i++ {
+		p := packet{payload: frame(rnd, silkWB20ms, false, 60), samples: 960}
+		if i == 0 {
+			p.gap = 19 * 960
+		}
+		f.packets = append(f.packets, p)
+	}
+	list = append(list, f)
+
+	// Packet loss: 1 packet out of 7, then a burst of 5 packets
+	f = &fixture{Name: "mono_celt_20ms_loss", Description: "CELT fullband 20ms frames, 1/7 packets lost and a burst of 5", Channels: 1}
+	for i := 0; i < 150; i++ {
+		lost := i%7 == 3 || (i >= 100 && i < 105)
+		f.packets = append(f.packets, packet{payload: frame(rnd, celtFB20ms, false, 80), samples: 960, lost: lost})
+	}
+	list = append(list, f)
+
+	// Several frames per packet (code 3), 3x20ms
+	f = &fixture{Name: "mono_celt_multiframe", Description: "CELT fullband, 3 frames of 20ms per packet (code 3)", Channels: 1}
+	for i := 0; i < 34; i++ {
+		f.packets = append(f.packets, packet{payload: multiframe(rnd, celtFB20ms, 3, 240), samples: 2880})
+	}
+	list = append(list, f)
+
+	return list
+}
+
+func write(f *fixture) error {
+	rtpFile, err := os.Create(f.Name + ".rtp")
+	if err != nil {
+		return err
+	}
+	defer rtpFile.Close()
+
+	ogg, err := oggwriter.New(f.Name+".ogg", clockRate, uint16(f.Channels))
+	if err != nil {
+		return err
+	}
+	defer ogg.Close()
+
+	var seq uint16 = 1000
+	var ts uint32 = 160000
+	first := true
+	var firstTs uint32
+	for _, p := range f.packets {
+		ts += uint32(p.gap)
+		if p.lost {
+			seq++
+			ts += uint32(p.samples)
+			continue
+		}
+
+		pkt := &rtp.Packet{
+			Header: rtp.Header{
+				Version:        2,
+				PayloadType:    111,
+				SequenceNumber: seq,
+				Timestamp:      ts,
+				SSRC:           0x4b495454,
+			},
+			Payload: p.payload,
+		}
+		data, err := pkt.Marshal()
+		if err != nil {
+			return err
+		}
+		if err := binary.Write(rtpFile, binary.BigEndian, uint16(len(data))); err != nil {
+			return err
+		}
+		if _, err := rtpFile.Write(data); err != nil {
+			return err
+		}
+		if err := ogg.WriteRTP(pkt); err != nil {
+			return err
+		}
+
+		if first {
+			firstTs = ts
+			first = false
+		}
+		f.Packets++
+		f.Samples += p.samples
+		f.Granule = uint64(ts-firstTs) + 1 // The oggwriter starts at 1, then adds the timestamp deltas
+		if len(p.payload) <= 3 {
+			f.SilentCount++
+		}
+
+		seq++
+		ts += uint32(p.samples)
+	}
+	return nil
+}
+
+func main() {
+	rnd := rand.New(rand.NewSource(1731))
+
+	list := fixtures(rnd)
+	for _, f := range list {
+		if err := write(f); err != nil {
+			panic(err)
+		}
+	}
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	if err := os.WriteFile("fixtures.json", append(data, '\n'), 0644); err != nil {
+		panic(err)
+	}
+}
@@ -1,19 +1,25 @@
 import { Box } from '@chakra-ui/react';
 import { useDataChannel } from '@livekit/components-react';
 import { useCallback, useEffect, useState } from 'react';
-import { ErrorPacket, Packet, PacketType } from '../lib/packet';
+import { ErrorPacket, FarewellPacket, Packet, PacketType } from '../lib/packet';
 import type { ReceivedDataMessage } from '@livekit/components-core';
 
 export const ErrorMessage = () => {
   const [visible, setVisible] = useState<boolean>(false);
   const [error, setError] = useState<string>('');
+  const [farewell, setFarewell] = useState<boolean>(false); // Not an error, KITT is leaving
 
   const onData = useCallback((message: ReceivedDataMessage) => {
     const decoder = new TextDecoder();
     const packet = JSON.parse(decoder.decode(message.payload)) as Packet;
     if (packet.type == PacketType.Error) {
       const errorPacket = packet.data as ErrorPacket;
+      setFarewell(false);
       setError(errorPacket.message);
+    } else if (packet.type == PacketType.Farewell) {
+      const farewellPacket = packet.data as FarewellPacket;
+      setFarewell(true);
+      setError(farewellPacket.message || 'KITT left the room');
     }
   }, []);
 
@@ -40,7 +46,7 @@ export const ErrorMessage = () => {
       paddingX="4px"
       top="4rem"
       borderRadius="4px"
-      bgColor="#A52A2A"
+      bgColor={farewell ? 'rgba(255, 255, 255, 0.12)' : '#A52A2A'}
     >
       {error}
     </Box>
@@ -9,11 +9,19 @@ import {
   useParticipants,
   useParticipantTile,
 } from '@livekit/components-react';
-import { Participant, Track } from 'livekit-client';
+import { DataPacket_Kind, Participant, Track } from 'livekit-client';
 import React, { useCallback } from 'react';
 import { useEffect } from 'react';
-import { Box } from '@chakra-ui/react';
-import { GPTState, Packet, PacketType, StatePacket } from '../lib/packet';
+import { Box, Button } from '@chakra-ui/react';
+import {
+  CommandPacket,
+  GPTState,
+  HealthPacket,
+  Packet,
+  PacketType,
+  SnapshotPacket,
+  StatePacket,
+} from '../lib/packet';
 import { AIVisualizer } from './AIVisualizer';
 import type { ReceivedDataMessage } from '@livekit/components-core';
 
@@ -22,11 +30,13 @@ export type GPTTileProps = React.HTMLAttributes<HTMLDivElement> & {
 };
 
 const decoder = new TextDecoder();
+const encoder = new TextEncoder();
 
 export const GPTTile = ({ participant, ...htmlProps }: GPTTileProps) => {
   const participants = useParticipants();
   const [volume, setVolume] = React.useState(0);
   const [state, setState] = React.useState<GPTState>(GPTState.Idle);
+  const [health, setHealth] = React.useState<HealthPacket | undefined>(); // set while the assistant is limited
   const activateSoundRef = React.useRef<HTMLAudioElement>(null);
   const p = useEnsureParticipant(participant);
 
@@ -39,10 +49,24 @@ export const GPTTile = ({ participant, ...htmlProps }: GPTTileProps) => {
 
       if (statePacket.state == GPTState.Active && participants.length > 2)
         activateSoundRef.current?.play();
+    } else if (packet.type == PacketType.Health) {
+      const healthPacket = packet.data as HealthPacket;
+      setHealth(healthPacket.degraded ? healthPacket : undefined);
+    } else if (packet.type == PacketType.Snapshot) {
+      const snapshot = packet.data as SnapshotPacket;
+      setState(snapshot.state);
+      setHealth(snapshot.health);
     }
   }, []);
 
-  useDataChannel(undefined, onData);
+  const { send } = useDataChannel(undefined, onData);
+
+  // Stop KITT speaking, the rest of the answer is dropped
+  const onStop = () => {
+    const commandPacket: CommandPacket = { command: 'stop' };
+    const packet: Packet = { type: PacketType.Command, data: commandPacket };
+    send(encoder.encode(JSON.stringify(packet)), { kind: DataPacket_Kind.RELIABLE });
+  };
 
   const tile = useParticipantTile({
     participant: p,
@@ -113,6 +137,25 @@ export const GPTTile = ({ participant, ...htmlProps }: GPTTileProps) => {
               thinkingSpeed: 0.015,
             }}
           />
+          {health && (
+            <Box
+              position="absolute"
+              top="0.5rem"
+              paddingX="8px"
+              borderRadius="4px"
+              fontSize="sm"
+              bgColor="rgba(255, 99, 82, 0.24)"
+              title={health.issues.map((issue) => issue.message).join('\n')}
+              role="status"
+            >
+              AI assistant temporarily limited
+            </Box>
+          )}
+          {state == GPTState.Speaking && (
+            <Button position="absolute" bottom="2.5rem" size="sm" onClick={onStop}>
+              Stop
+            </Button>
+          )}
         </Box>
         <div className="lk-participant-metadata">
           <div className="lk-participant-metadata-item">
@@ -0,0 +1,83 @@
+import { Box, Button, Text } from '@chakra-ui/react';
+import { useDataChannel } from '@livekit/components-react';
+import { DataPacket_Kind } from 'livekit-client';
+import { useCallback, useEffect, useState } from 'react';
+import { Packet, PacketType, PollPacket, SnapshotPacket, VotePacket } from '../lib/packet';
+import type { ReceivedDataMessage } from '@livekit/components-core';
+
+const encoder = new TextEncoder();
+
+export const Poll = () => {
+  const [poll, setPoll] = useState<PollPacket>();
+  const [vote, setVote] = useState<number>();
+
+  const onData = useCallback((message: ReceivedDataMessage) => {
+    const decoder = new TextDecoder();
+    const packet = JSON.parse(decoder.decode(message.payload)) as Packet;
+    if (packet.type == PacketType.Poll) {
+      const pollPacket = packet.data as PollPacket;
+      setPoll((current) => {
+        if (current?.id != pollPacket.id) setVote(undefined);
+        return pollPacket;
+      });
+    } else if (packet.type == PacketType.Snapshot) {
+      const snapshot = packet.data as SnapshotPacket;
+      if (snapshot.poll) setPoll(snapshot.poll);
+    }
+  }, []);
+
+  const { send } = useDataChannel(undefined, onData);
+
+  // Hide the results a few seconds after the poll closed
+  useEffect(() => {
+    if (!poll?.closed) return;
+
+    const timeout = setTimeout(() => setPoll(undefined), 15000);
+    return () => clearTimeout(timeout);
+  }, [poll]);
+
+  const onVote = (option: number) => {
+    if (!poll || poll.closed) return;
+
+    const votePacket: VotePacket = { pollId: poll.id, option };
+    const packet: Packet = { type: PacketType.Vote, data: votePacket };
+    send(encoder.encode(JSON.stringify(packet)), { kind: DataPacket_Kind.RELIABLE });
+    setVote(option);
+  };
+
+  return poll ? (
+    <Box
+      position="fixed"
+      right="1rem"
+      top="4rem"
+      width="18rem"
+      padding="12px"
+      borderRadius="4px"
+      bgColor="rgba(0, 0, 0, 0.8)"
+      aria-live="polite"
+    >
+      <Text margin={0} fontWeight="bold">
+        {poll.question}
+      </Text>
+      {poll.options.map((option, i) => (
+        <Button
+          key={i}
+          width="100%"
+          marginTop="8px"
+          justifyContent="space-between"
+          isDisabled={poll.closed}
+          variant={vote == i ? 'solid' : 'outline'}
+          onClick={() => onVote(i)}
+        >
+          <span>{option}</span>
+          <span>{poll.counts[i]}</span>
+        </Button>
+      ))}
+      <Text margin={0} marginTop="8px" fontSize="sm">
+        {poll.closed ? 'Poll closed' : `${poll.voters} vote${poll.voters == 1 ? '' : 's'}`}
+      </Text>
+    </Box>
+  ) : (
+    <> </>
+  );
+};
@@ -10,6 +10,7 @@ import {
 } from 'livekit-client';
 import * as React from 'react';
 
+import { KittApi, Language } from '../lib/kitt-api.gen';
 import styles from '../styles/Home.module.css';
 
 export type LocalUserChoices = {
@@ -30,6 +31,41 @@ const DEFAULT_USER_CHOICES = {
   language: 'en-US',
 };
 
+// Used when NEXT_PUBLIC_KITT_URL isn't set or KITT can't be reached
+const DEFAULT_LANGUAGES: Language[] = [
+  { code: 'en-US', label: 'English (United States)' },
+  { code: 'fr-FR', label: 'French (France)' },
+  { code: 'de-DE', label: 'German (Germany)' },
+  { code: 'es-ES', label: 'Spanish' },
+];
+
+// Languages supported by KITT (GET /languages), the first one is its default language
+function useLanguages(): Language[] {
+  const [languages, setLanguages] = React.useState<Language[]>(DEFAULT_LANGUAGES);
+
+  React.useEffect(() => {
+    const url = process.env.NEXT_PUBLIC_KITT_URL;
+    if (!url) {
+      return;
+    }
+
+    let canceled = false;
+    new KittApi(url)
+      .listLanguages()
+      .then((languages) => {
+        if (!canceled && languages.length > 0) {
+          setLanguages(languages);
+        }
+      })
+      .catch((e) => log.warn('failed to fetch the languages of KITT', e));
+    return () => {
+      canceled = true;
+    };
+  }, []);
+
+  return languages;
+}
+
 const ParticipantPlaceholder = (props: React.SVGProps<SVGSVGElement>) => (
   <svg
     width={320}
@@ -224,6 +260,13 @@ export const PreJoin = ({
     defaults.audioDeviceId ?? DEFAULT_USER_CHOICES.audioDeviceId,
   );
   const [lang, setLang] = React.useState<string>(DEFAULT_USER_CHOICES.language);
+  const languages = useLanguages();
+
+  React.useEffect(() => {
+    if (!languages.some((l) => l.code === lang)) {
+      setLang(languages[0].code);
+    }
+  }, [languages, lang]);
 
   const video = usePreviewDevice(videoEnabled, videoDeviceId, 'videoinput');
   const videoEl = React.useRef(null);
@@ -350,14 +393,16 @@ export const PreJoin = ({
       <form className="lk-username-container">
         <select
           className={styles.startSelect}
+          value={lang}
           onChange={(e) => {
             setLang(e.target.value);
           }}
         >
-          <option value="en-US">English (United States)</option>
-          <option value="fr-FR">French (France)</option>
-          <option value="de-DE">German (Germany)</option>
-          <option value="es-ES">Spanish</option>
+          {languages.map((l) => (
+            <option key={l.code} value={l.code}>
+              {l.label}
+            </option>
+          ))}
         </select>
         <input
           className="lk-form-control"
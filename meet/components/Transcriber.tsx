@@ -1,7 +1,18 @@
-import { Box, Text } from '@chakra-ui/react';
+import { Box, Link, Text } from '@chakra-ui/react';
 import { useDataChannel } from '@livekit/components-react';
 import { useCallback, useEffect, useState } from 'react';
-import { GPTState, Packet, PacketType, StatePacket, TranscriptPacket } from '../lib/packet';
+import {
+  ChatPacket,
+  CitationsPacket,
+  GPTState,
+  Packet,
+  PacketType,
+  ProgressPacket,
+  SnapshotPacket,
+  SpeakingPacket,
+  StatePacket,
+  TranscriptPacket,
+} from '../lib/packet';
 import type { ReceivedDataMessage } from '@livekit/components-core';
 
 export const Transcriber = () => {
@@ -9,6 +20,7 @@ export const Transcriber = () => {
   const [activity, setActivity] = useState<number>(Date.now());
   const [state, setState] = useState<GPTState>(GPTState.Idle);
   const [transcripts, setTranscripts] = useState<Map<string, string>>(new Map()); // transcription of every participant
+  const [citations, setCitations] = useState<CitationsPacket['citations']>([]); // sources of the last answer
 
   const onData = useCallback((message: ReceivedDataMessage) => {
     const decoder = new TextDecoder();
@@ -16,16 +28,54 @@ export const Transcriber = () => {
     if (packet.type == PacketType.Transcript) {
       const transcript = packet.data as TranscriptPacket;
       const sid = transcript.sid;
-      const text = transcript.name + ': ' + transcript.text;
-      setTranscripts(new Map(transcripts.set(sid, text)));
+      if (transcript.isFinal && !transcript.text) {
+        // Ignored by KITT (low confidence), clear the interim transcript
+        transcripts.delete(sid);
+        setTranscripts(new Map(transcripts));
+      } else {
+        const text = transcript.name + ': ' + transcript.text;
+        setTranscripts(new Map(transcripts.set(sid, text)));
+      }
       setActivity(Date.now());
 
       if (state == GPTState.Active) {
         setVisible(true);
       }
+    } else if (packet.type == PacketType.Speaking) {
+      // Read along while KITT is speaking
+      const speaking = packet.data as SpeakingPacket;
+      setTranscripts(new Map(transcripts.set('KITT', 'KITT: ' + speaking.text)));
+      setActivity(Date.now() + speaking.duration);
+      setVisible(true);
+      if (speaking.index == 0) setCitations([]);
+    } else if (packet.type == PacketType.Citations) {
+      setCitations((packet.data as CitationsPacket).citations);
+      setActivity(Date.now() + 10000); // Leave the time to open them
+      setVisible(true);
+    } else if (packet.type == PacketType.Progress) {
+      // Tool call taking a while, replaced by the answer once it is spoken
+      const progress = packet.data as ProgressPacket;
+      if (progress.done) {
+        transcripts.delete('KITT');
+        setTranscripts(new Map(transcripts));
+      } else {
+        let text = 'KITT: ' + (progress.message || 'Working on it') + '…';
+        if (progress.progress >= 0) text += ` ${Math.round(progress.progress * 100)}%`;
+        setTranscripts(new Map(transcripts.set('KITT', text)));
+        setActivity(Date.now());
+        setVisible(true);
+      }
+    } else if (packet.type == PacketType.Chat) {
+      // Nobody has a microphone, KITT reads the chat
+      const chat = packet.data as ChatPacket;
+      setTranscripts(new Map(transcripts.set('KITT', 'KITT: ' + chat.message)));
+      setActivity(Date.now() + 10000); // Leave the time to read it
+      setVisible(true);
     } else if (packet.type == PacketType.State) {
       const statePacket = packet.data as StatePacket;
       setState(statePacket.state);
+    } else if (packet.type == PacketType.Snapshot) {
+      setState((packet.data as SnapshotPacket).state);
     }
   }, [state]);
 
@@ -37,8 +87,9 @@ export const Transcriber = () => {
       if (currentActivity == activity) {
         setVisible(false);
         setTranscripts(new Map());
+        setCitations([]);
       }
-    }, 3000);
+    }, Math.max(activity - Date.now(), 0) + 3000);
 
     return () => clearTimeout(timeout);
   }, [activity]);
@@ -51,6 +102,7 @@ export const Transcriber = () => {
       paddingX="4px"
       bottom="8rem"
       bgColor="rgba(255, 255, 255, 0.12)"
+      aria-live="polite"
     >
       {Array.from(transcripts.entries()).map((entry) => {
         const [key, value] = entry;
@@ -60,6 +112,23 @@ export const Transcriber = () => {
           </Text>
         );
       })}
+      {citations.length > 0 && (
+        <Text margin={0} fontSize="sm">
+          Sources:{' '}
+          {citations.map((citation, i) => (
+            <span key={i}>
+              {i > 0 && ', '}
+              {citation.url ? (
+                <Link href={citation.url} isExternal title={citation.snippet}>
+                  {citation.title || citation.url}
+                </Link>
+              ) : (
+                <span title={citation.snippet}>{citation.title}</span>
+              )}
+            </span>
+          ))}
+        </Text>
+      )}
     </Box>
   ) : (
     <> </>
@@ -14,6 +14,8 @@ import {
   MessageFormatter,
   useTracks,
   ParticipantTile,
+  Chat,
+  WidgetState,
 } from '@livekit/components-react';
 
 import { isEqualTrackRef, isTrackReference } from '@livekit/components-core';
@@ -22,6 +24,7 @@ import { useMediaQuery } from '../hooks/useMediaQuery';
 import { usePinnedTracks } from '../hooks/usePinnedTracks';
 import { GPTTile } from './GPTTile';
 import { Transcriber } from './Transcriber';
+import { Poll } from './Poll';
 import { ErrorMessage } from './ErrorMessage';
 
 const BotIdentity = 'KITT';
@@ -42,6 +45,7 @@ export function VideoConference({ chatMessageFormatter, ...props }: VideoConfere
   );
 
   const layoutContext = useCreateLayoutContext();
+  const [widgetState, setWidgetState] = React.useState<WidgetState>({ showChat: false }); // KITT answers the @KITT messages
 
   const screenShareTracks = tracks
     .filter(isTrackReference)
@@ -66,7 +70,7 @@ export function VideoConference({ chatMessageFormatter, ...props }: VideoConfere
 
   return (
     <div className="lk-video-conference" {...props}>
-      <LayoutContextProvider value={layoutContext}>
+      <LayoutContextProvider value={layoutContext} onWidgetChange={setWidgetState}>
         <div className="lk-video-conference-inner">
           {!focusTrack ? (
             <div className="lk-grid-layout-wrapper">
@@ -92,9 +96,14 @@ export function VideoConference({ chatMessageFormatter, ...props }: VideoConfere
           )}
           <ControlBar variation={isMobile ? 'minimal' : 'verbose'} />
         </div>
+        <Chat
+          style={{ display: widgetState.showChat ? 'flex' : 'none' }}
+          messageFormatter={chatMessageFormatter}
+        />
       </LayoutContextProvider>
       <ErrorMessage />
       <Transcriber />
+      <Poll />
       <RoomAudioRenderer />
       <ConnectionStateToast />
     </div>
@@ -0,0 +1,161 @@
+// Code generated by cmd/apigen. DO NOT EDIT.
+
+import { KittClient } from './kitt-client';
+
+export interface Agenda {
+  start: string;
+  items: AgendaItem[];
+}
+
+export interface AgendaItem {
+  topic: string;
+  minutes: number;
+}
+
+export interface CalendarEvent {
+  title: string;
+  agenda?: string;
+  start: string;
+  end: string;
+  invitees?: CalendarInvitee[];
+}
+
+export interface CalendarInvitee {
+  name: string;
+  email?: string;
+}
+
+export interface Job {
+  id: string;
+  type: string;
+  room: string;
+  payload: unknown;
+  status: string;
+  attempts: number;
+  error?: string;
+  runAt: string;
+  createdAt: string;
+  updatedAt: string;
+}
+
+export interface Language {
+  code: string;
+  label: string;
+}
+
+export interface MeetingNotes {
+  topics: NotesTopic[];
+  decisions: string[];
+  actionItems: string[];
+}
+
+export interface MeetingStats {
+  start: string;
+  duration: number;
+  sentiment: number;
+  participants: ParticipantStats[];
+}
+
+export interface NotesTopic {
+  title: string;
+  points: string[];
+}
+
+export interface ParticipantStats {
+  sid: string;
+  name: string;
+  talkTime: number;
+  words: number;
+  turns: number;
+  interruptions: number;
+  interrupted: number;
+  sentiment: number;
+}
+
+export interface RoomEvent {
+  type: number;
+  room: string;
+  time: string;
+  data: unknown;
+}
+
+export interface TranscriptLine {
+  roomSid: string;
+  participantName: string;
+  isBot: boolean;
+  text: string;
+  time: string;
+  audioKey?: string;
+}
+
+export class KittApi extends KittClient {
+  /** Make KITT join the room */
+  joinRoom(room: string): Promise<void> {
+    return this.request<void>('POST', `/join/${encodeURIComponent(room)}`);
+  }
+
+  /** Stream the events of the room (transcripts, answers, state, notes, ...) */
+  streamRoomEvents(room: string, onEvent: (event: RoomEvent) => void): AbortController {
+    return this.stream<RoomEvent>(`/rooms/${encodeURIComponent(room)}/events`, undefined, onEvent);
+  }
+
+  /** Get the calendar event linked to the room */
+  getRoomCalendar(room: string): Promise<CalendarEvent> {
+    return this.request<CalendarEvent>('GET', `/rooms/${encodeURIComponent(room)}/calendar`);
+  }
+
+  /** Link the room to a calendar event */
+  setRoomCalendar(room: string, body: CalendarEvent): Promise<void> {
+    return this.request<void>('PUT', `/rooms/${encodeURIComponent(room)}/calendar`, { body });
+  }
+
+  /** Get the notes of the meeting (notes mode) */
+  getRoomNotes(room: string): Promise<MeetingNotes> {
+    return this.request<MeetingNotes>('GET', `/rooms/${encodeURIComponent(room)}/notes`);
+  }
+
+  /** Get the agenda of the meeting (facilitator mode) */
+  getRoomAgenda(room: string): Promise<Agenda> {
+    return this.request<Agenda>('GET', `/rooms/${encodeURIComponent(room)}/agenda`);
+  }
+
+  /** Replace the agenda of the meeting (facilitator mode) */
+  setRoomAgenda(room: string, body: Agenda): Promise<void> {
+    return this.request<void>('PUT', `/rooms/${encodeURIComponent(room)}/agenda`, { body });
+  }
+
+  /** Get the talk time, interruptions and sentiment of the participants (analytics) */
+  getRoomStats(room: string): Promise<MeetingStats> {
+    return this.request<MeetingStats>('GET', `/rooms/${encodeURIComponent(room)}/stats`);
+  }
+
+  /** List the final transcripts and the answers of every session of the room (stored transcripts) */
+  listTranscripts(room: string, sid?: string): Promise<TranscriptLine[]> {
+    return this.request<TranscriptLine[]>('GET', `/transcripts/${encodeURIComponent(room)}`, { query: { sid } });
+  }
+
+  /** Get the facts KITT remembers about the participant */
+  getMemory(identity: string): Promise<string[]> {
+    return this.request<string[]>('GET', `/memory/${encodeURIComponent(identity)}`);
+  }
+
+  /** Erase the memory of the participant */
+  eraseMemory(identity: string): Promise<void> {
+    return this.request<void>('DELETE', `/memory/${encodeURIComponent(identity)}`);
+  }
+
+  /** List the languages supported by KITT, the first one is the default language */
+  listLanguages(): Promise<Language[]> {
+    return this.request<Language[]>('GET', '/languages');
+  }
+
+  /** List the post-meeting jobs of the room */
+  listJobs(room: string): Promise<Job[]> {
+    return this.request<Job[]>('GET', '/jobs', { query: { room } });
+  }
+
+  /** Get a post-meeting job */
+  getJob(id: string): Promise<Job> {
+    return this.request<Job>('GET', `/jobs/${encodeURIComponent(id)}`);
+  }
+}
@@ -0,0 +1,118 @@
+// Base of the generated KittApi (kitt-api.gen.ts), the client of the HTTP API of lkgpt-service
+
+export interface KittClientOptions {
+  // LiveKit access token, sent in the Authorization header
+  accessToken?: string;
+}
+
+export class KittError extends Error {
+  constructor(public status: number, message: string) {
+    super(`kitt: status ${status}: ${message}`);
+  }
+}
+
+interface RequestOptions {
+  query?: Record<string, string | undefined>;
+  body?: unknown;
+}
+
+export class KittClient {
+  private baseUrl: string;
+
+  constructor(baseUrl: string, private options: KittClientOptions = {}) {
+    this.baseUrl = baseUrl.replace(/\/$/, '');
+  }
+
+  setAccessToken(accessToken: string) {
+    this.options.accessToken = accessToken;
+  }
+
+  private url(path: string, query?: Record<string, string | undefined>): string {
+    const params = new URLSearchParams();
+    for (const [key, value] of Object.entries(query ?? {})) {
+      if (value !== undefined && value !== '') {
+        params.set(key, value);
+      }
+    }
+    const search = params.toString();
+    return this.baseUrl + path + (search ? `?${search}` : '');
+  }
+
+  private headers(): Record<string, string> {
+    const headers: Record<string, string> = {};
+    if (this.options.accessToken) {
+      headers['Authorization'] = `Bearer ${this.options.accessToken}`;
+    }
+    return headers;
+  }
+
+  protected async request<T>(method: string, path: string, options: RequestOptions = {}): Promise<T> {
+    const headers = this.headers();
+    if (options.body !== undefined) {
+      headers['Content-Type'] = 'application/json';
+    }
+
+    const res = await fetch(this.url(path, options.query), {
+      method,
+      headers,
+      body: options.body !== undefined ? JSON.stringify(options.body) : undefined,
+    });
+    if (!res.ok) {
+      throw new KittError(res.status, (await res.text()).trim());
+    }
+
+    const text = await res.text();
+    return (text ? JSON.parse(text) : undefined) as T;
+  }
+
+  // Server-Sent Events, abort the returned controller to close the stream
+  protected stream<T>(
+    path: string,
+    query: Record<string, string | undefined> | undefined,
+    onEvent: (event: T) => void,
+  ): AbortController {
+    const controller = new AbortController();
+
+    const read = async () => {
+      const res = await fetch(this.url(path, query), {
+        headers: { ...this.headers(), Accept: 'text/event-stream' },
+        signal: controller.signal,
+      });
+      if (!res.ok || !res.body) {
+        throw new KittError(res.status, (await res.text()).trim());
+      }
+
+      const reader = res.body.getReader();
+      const decoder = new TextDecoder();
+      let buffer = '';
+      for (;;) {
+        const { done, value } = await reader.read();
+        if (done) {
+          return;
+        }
+
+        buffer += decoder.decode(value, { stream: true });
+        let end: number;
+        while ((end = buffer.indexOf('\n\n')) >= 0) {
+          const data = buffer
+            .slice(0, end)
+            .split('\n')
+            .filter((line) => line.startsWith('data:'))
+            .map((line) => line.slice(5).trimStart())
+            .join('\n');
+          buffer = buffer.slice(end + 2);
+          if (data) {
+            onEvent(JSON.parse(data) as T);
+          }
+        }
+      }
+    };
+
+    read().catch((e) => {
+      if (!controller.signal.aborted) {
+        console.error('kitt event stream closed', e);
+      }
+    });
+    return controller;
+  }
+}
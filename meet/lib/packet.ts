@@ -2,6 +2,20 @@ export enum PacketType {
   Transcript = 0,
   State,
   Error,
+  Command,
+  Notes,
+  Speaking,
+  Signal,
+  Capabilities,
+  Chunk,
+  Snapshot,
+  Poll,
+  Vote,
+  Citations,
+  Progress,
+  Health,
+  Chat,
+  Farewell,
 }
 
 export enum GPTState {
@@ -13,7 +27,24 @@ export enum GPTState {
 
 export interface Packet {
   type: PacketType;
-  data: TranscriptPacket | StatePacket | ErrorPacket;
+  data:
+    | TranscriptPacket
+    | StatePacket
+    | ErrorPacket
+    | CommandPacket
+    | NotesPacket
+    | SpeakingPacket
+    | SignalPacket
+    | CapabilitiesPacket
+    | ChunkPacket
+    | SnapshotPacket
+    | PollPacket
+    | VotePacket
+    | CitationsPacket
+    | ProgressPacket
+    | HealthPacket
+    | ChatPacket
+    | FarewellPacket;
 }
 
 export interface TranscriptPacket {
@@ -30,3 +61,162 @@ export interface StatePacket {
 export interface ErrorPacket {
   message: string;
 }
+
+export interface SpeakingPacket {
+  sid: string;
+  text: string;
+  language: string;
+  index: number;
+  start: number; // unix time in ms
+  duration: number; // ms
+}
+
+export interface CommandPacket {
+  command: 'start' | 'activate' | 'stop' | 'repeat' | 'reset_context' | 'change_language';
+  language?: string; // change_language only, empty to answer in the language of the speakers
+}
+
+// Sent when the local participant is about to speak, KITT delays its answers meanwhile
+export interface SignalPacket {
+  signal: 'typing' | 'push_to_talk' | 'hand_raised';
+  active: boolean;
+}
+
+// Features enabled on the server, received when joining
+export interface CapabilitiesPacket {
+  mode: 'assistant' | 'notes' | 'facilitator';
+  behavior: 'assistant' | 'command' | 'captions'; // Switched on the size of the room
+  features: string[]; // captions, read_along, caption_files, alignment, notes, agenda, chat, chat_prompts, memory, escalation, turn_taking, polls, citations, progress
+  commands: CommandPacket['command'][];
+  signals: SignalPacket['signal'][];
+  languages: string[];
+}
+
+export interface NotesPacket {
+  notes: {
+    topics: { title: string; points: string[] }[];
+    decisions: string[];
+    actionItems: string[];
+  };
+}
+
+// State of the room, received when joining mid-meeting
+export interface SnapshotPacket {
+  state: GPTState;
+  activeSid?: string; // participant KITT is listening or answering to
+  speakers: string[];
+  transcript: { name: string; text: string; isBot: boolean; time: number }[]; // last lines, oldest first
+  notes?: NotesPacket['notes'];
+  poll?: PollPacket; // open poll
+  health?: HealthPacket; // only when degraded
+  capabilities: CapabilitiesPacket;
+}
+
+// Poll created by KITT, received again on every vote and when it closes
+export interface PollPacket {
+  id: string;
+  question: string;
+  options: string[];
+  counts: number[];
+  voters: number;
+  endsAt: number; // unix time in ms
+  closed: boolean;
+}
+
+// Sent to vote in the open poll, the last vote of a participant counts
+export interface VotePacket {
+  pollId: string;
+  option: number; // index of the option
+}
+
+// Sources of an answer of KITT, received once it finished answering
+export interface CitationsPacket {
+  sid: string; // participant who was answered
+  citations: { title: string; url?: string; snippet?: string }[];
+}
+
+// Progress of a tool call taking a while (search, document processing), received until it is done
+export interface ProgressPacket {
+  sid: string; // participant being answered
+  taskId: string;
+  tool: string;
+  message?: string;
+  progress: number; // 0.0 - 1.0, -1 when unknown
+  elapsed: number; // ms
+  done: boolean;
+}
+
+// The assistant is limited (provider failing or rate-limited, quota exceeded, overload), received again once recovered
+export interface HealthPacket {
+  degraded: boolean;
+  issues: {
+    provider?: 'llm' | 'tts'; // missing for the issues of the server
+    reason: 'circuit_open' | 'rate_limited' | 'quota_exceeded' | 'overloaded';
+    retryAt?: number; // unix time in ms
+    message: string;
+  }[];
+}
+
+// Message of KITT, e.g how to talk to it when nobody has a microphone, then its answers to the @KITT chat messages
+export interface ChatPacket {
+  sid?: string; // participant answered, missing for the announcements
+  message: string;
+}
+
+// KITT is leaving the room on its own (server restarting, idle room)
+export interface FarewellPacket {
+  reason: 'shutdown' | 'idle' | 'max_duration';
+  message?: string;
+  summary?: string; // Of the meeting, max_duration only
+}
+
+// Part of a packet too large for a single message, the chunks are received in order
+export interface ChunkPacket {
+  id: string;
+  index: number;
+  count: number;
+  size: number; // bytes of the whole packet
+  data: string; // base64 encoded part of the JSON of the packet
+}
+
+// Split a packet too large for a single message, the chunks must be sent reliably and in order
+export function encodePacket(packet: Packet, maxSize = 15 * 1024, chunkSize = 10 * 1024): Uint8Array[] {
+  const data = new TextEncoder().encode(JSON.stringify(packet));
+  if (data.length <= maxSize) {
+    return [data];
+  }
+
+  const id = `PC_${Math.random().toString(36).slice(2)}`;
+  const count = Math.ceil(data.length / chunkSize);
+  const chunks: Uint8Array[] = [];
+  for (let i = 0; i < count; i++) {
+    const part = data.subarray(i * chunkSize, (i + 1) * chunkSize);
+    const chunk: ChunkPacket = {
+      id,
+      index: i,
+      count,
+      size: data.length,
+      data: btoa(String.fromCharCode(...part)),
+    };
+    chunks.push(new TextEncoder().encode(JSON.stringify({ type: PacketType.Chunk, data: chunk })));
+  }
+  return chunks;
+}
+
+// Returns the packet once all its chunks were received
+export class ChunkAssembler {
+  private parts = new Map<string, string[]>();
+
+  push(chunk: ChunkPacket): Packet | undefined {
+    const parts = this.parts.get(chunk.id) ?? [];
+    parts[chunk.index] = atob(chunk.data);
+    this.parts.set(chunk.id, parts);
+    if (parts.filter((p) => p !== undefined).length < chunk.count) {
+      return undefined;
+    }
+
+    this.parts.delete(chunk.id);
+    const bytes = Uint8Array.from(parts.join(''), (c) => c.charCodeAt(0));
+    return JSON.parse(new TextDecoder().decode(bytes)) as Packet;
+  }
+}